@@ -21,8 +21,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -68,6 +70,10 @@ type BookReconciler struct {
 	Log    *log.Logger
 	Scheme *runtime.Scheme
 	SVC    string
+
+	// TokenFile holds the service token writes to the bookstore API are
+	// authorized with.
+	TokenFile string
 }
 
 // BooksFinalizerLabel defines the finalizer.
@@ -254,6 +260,17 @@ func (r *BookReconciler) getBook(book *booksv1.Book) (*booksv1.BookStatus, error
 	}, nil
 }
 
+// authorize adds the service token to a request for the bookstore API.
+func (r *BookReconciler) authorize(req *http.Request) error {
+	token, err := ioutil.ReadFile(r.TokenFile)
+	if err != nil {
+		return fmt.Errorf("reading service token: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	return nil
+}
+
 func (r *BookReconciler) deleteBook(bookID string) error {
 	getURL := fmt.Sprintf("%s/%s/%s", r.SVC, "books", bookID)
 	req, err := http.NewRequest(http.MethodDelete, getURL, nil)
@@ -261,6 +278,9 @@ func (r *BookReconciler) deleteBook(bookID string) error {
 		log.Printf("get delete request %v failed: %v", getURL, err)
 		return err
 	}
+	if err := r.authorize(req); err != nil {
+		return err
+	}
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -275,6 +295,13 @@ func (r *BookReconciler) deleteBook(bookID string) error {
 	return nil
 }
 
+// idempotencyKey names the creation of the book for a Book, so that retrying
+// it after an error gets the book created by the first attempt. The key
+// changes with the spec and when the book is recreated after it went missing.
+func idempotencyKey(book *booksv1.Book) string {
+	return fmt.Sprintf("%s/%d/%s", book.UID, book.Generation, book.Status.ID)
+}
+
 func (r *BookReconciler) createBook(book *booksv1.Book) (*booksv1.BookStatus, error) {
 	getURL := fmt.Sprintf("%s/%s", r.SVC, "books")
 
@@ -291,7 +318,14 @@ func (r *BookReconciler) createBook(book *booksv1.Book) (*booksv1.BookStatus, er
 		return nil, err
 	}
 	req, err := http.NewRequest("POST", getURL, bytes.NewBuffer(newProdBytes))
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", idempotencyKey(book))
+	if err := r.authorize(req); err != nil {
+		return nil, err
+	}
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -343,6 +377,9 @@ func (r *BookReconciler) updateBook(book *booksv1.Book) (*booksv1.BookStatus, er
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if err := r.authorize(req); err != nil {
+		return nil, err
+	}
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -49,10 +49,14 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var tokenFile string
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&tokenFile, "bookstore-token-file", "/var/run/secrets/bookstore/token",
+		"The file holding the service token the bookstore API is called with. "+
+			"It is read on every call, so a rotated token mounted from a Secret is picked up.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
@@ -95,9 +99,10 @@ func main() {
 	if err = (&controllers.BookReconciler{
 		Client: mgr.GetClient(),
 		//Log:    ctrl.Log.WithName("controllers").WithName("Book"),
-		Log:    log.New(os.Stdout, "Bookstore : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile),
-		Scheme: mgr.GetScheme(),
-		SVC:    bookstoreService,
+		Log:       log.New(os.Stdout, "Bookstore : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile),
+		Scheme:    mgr.GetScheme(),
+		SVC:       bookstoreService,
+		TokenFile: tokenFile,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Book")
 		os.Exit(1)
@@ -0,0 +1,243 @@
+package author
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// Author is a person books are written by. Books reference it by ID and carry
+// a copy of its Name for display.
+type Author struct {
+	ID          string    `db:"author_id" json:"id"`
+	Name        string    `db:"name" json:"name"`
+	DateCreated time.Time `db:"datecreated" json:"date_created"`
+	DateUpdated time.Time `db:"dateupdated" json:"date_updated"`
+}
+
+// NewAuthor is what we require from clients when adding an Author.
+type NewAuthor struct {
+	Name string `json:"name" validate:"required"`
+}
+
+// UpdateAuthor defines what information may be provided to modify an existing
+// Author.
+type UpdateAuthor struct {
+	Name *string `json:"name" validate:"omitempty,min=1"`
+}
+
+// Predefined errors identify expected failure conditions.
+var (
+	// ErrNotFound is used when a specific Author is requested but does not
+	// exist.
+	ErrNotFound = errors.New("author not found")
+
+	// ErrInvalidID is used when an invalid UUID is provided.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrInvalidName is used when a name has no letters or digits to tell
+	// the Author apart from others.
+	ErrInvalidName = errors.New("author name must contain letters or digits")
+
+	// ErrDuplicate is used when an Author is given a name that is already
+	// taken by another Author, however it is spelled.
+	ErrDuplicate = errors.New("an author with this name already exists")
+
+	// ErrHasBooks is used when an Author that books still reference is
+	// deleted.
+	ErrHasBooks = errors.New("author still has books")
+)
+
+// Key returns the form of an author name used to tell whether two names are
+// the same Author. "Last, First" is turned around, case is folded and
+// punctuation and spacing are dropped, so "J.R.R. Tolkien" and
+// "Tolkien, J. R. R." have the same key. A name without letters or digits has
+// an empty key.
+func Key(name string) string {
+	if parts := strings.Split(name, ","); len(parts) == 2 {
+		name = parts[1] + " " + parts[0]
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	return strings.Join(words, " ")
+}
+
+// List gets the Authors in name order. When q has a Limit and more Authors
+// are available, the returned cursor can be set on the next query to continue
+// after the last returned Author. It is empty on the last page.
+func List(ctx context.Context, db Store, q Query) ([]Author, string, error) {
+	if err := q.prepare(); err != nil {
+		return nil, "", err
+	}
+
+	// Ask for one extra Author to learn whether there is a next page.
+	limit := q.Limit
+	if limit > 0 {
+		q.Limit = limit + 1
+	}
+
+	authors, err := db.List(ctx, q)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if limit > 0 && len(authors) > limit {
+		authors = authors[:limit]
+		next = cursorAfter(authors[limit-1])
+	}
+
+	return authors, next, nil
+}
+
+// Retrieve gets a single Author from the database.
+func Retrieve(ctx context.Context, db Store, id string) (*Author, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	return db.Retrieve(ctx, id)
+}
+
+// Create adds an Author to the database. It fails with ErrDuplicate when the
+// name is another spelling of an existing Author.
+func Create(ctx context.Context, db Store, na NewAuthor, now time.Time) (*Author, error) {
+	name := strings.TrimSpace(na.Name)
+	if Key(name) == "" {
+		return nil, ErrInvalidName
+	}
+
+	a := Author{
+		ID:          uuid.New().String(),
+		Name:        name,
+		DateCreated: now.UTC(),
+		DateUpdated: now.UTC(),
+	}
+
+	if err := db.Insert(ctx, a); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// Resolve returns the Author a name refers to, creating it when no existing
+// Author has the same key.
+func Resolve(ctx context.Context, db Store, name string, now time.Time) (*Author, error) {
+	key := Key(name)
+	if key == "" {
+		return nil, ErrInvalidName
+	}
+
+	a, err := db.RetrieveByKey(ctx, key)
+	if err != ErrNotFound {
+		return a, err
+	}
+
+	a, err = Create(ctx, db, NewAuthor{Name: name}, now)
+	if err == ErrDuplicate {
+
+		// Another request created the Author since it was looked up.
+		return db.RetrieveByKey(ctx, key)
+	}
+	return a, err
+}
+
+// Update renames an Author and the books referencing it. Books are renamed
+// one at a time after the Author, each gets a new revision. Books in the
+// trash keep the old name until they are restored.
+func Update(ctx context.Context, db Store, books product.Store, id string, ua UpdateAuthor, now time.Time) (*Author, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	if ua.Name == nil {
+		return db.Retrieve(ctx, id)
+	}
+
+	name := strings.TrimSpace(*ua.Name)
+	if Key(name) == "" {
+		return nil, ErrInvalidName
+	}
+
+	a, err := db.Update(ctx, id, name, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rename(ctx, books, a.ID, a.Name, now); err != nil {
+		return nil, errors.Wrapf(err, "renaming books of author %q", id)
+	}
+
+	return a, nil
+}
+
+// Delete removes an Author that no live book references anymore. Books in the
+// trash keep their reference.
+func Delete(ctx context.Context, db Store, books product.Store, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidID
+	}
+
+	ps, _, err := product.List(ctx, books, product.Query{AuthorID: id, Limit: 1})
+	if err != nil {
+		return errors.Wrap(err, "looking for books")
+	}
+	if len(ps) > 0 {
+		return ErrHasBooks
+	}
+
+	return db.Delete(ctx, id)
+}
+
+// rename sets the author name of every live book referencing the Author with
+// the given ID. A book changed concurrently is read again, and left alone if
+// it no longer references the Author.
+func rename(ctx context.Context, books product.Store, id, name string, now time.Time) error {
+	var ps []product.Product
+	err := product.Walk(ctx, books, product.Query{AuthorID: id}, func(p product.Product) error {
+		if p.Author != name {
+			ps = append(ps, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	update := product.UpdateProduct{Author: &name}
+	for _, p := range ps {
+		for {
+			_, err := product.Update(ctx, books, p.ID, p.Revision, update, now)
+			if err != product.ErrRevisionMismatch {
+				if err != nil && err != product.ErrNotFound {
+					return err
+				}
+				break
+			}
+
+			cur, err := product.Retrieve(ctx, books, p.ID)
+			if err == product.ErrNotFound {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if cur.AuthorID != id {
+				break
+			}
+			p = *cur
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package author_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/author"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/tests"
+)
+
+// TestAuthors tests author CRUD APIs against mongodb.
+func TestAuthors(t *testing.T) {
+	client, teardown := tests.NewUnit(t)
+	defer teardown()
+
+	db := author.NewMongoStore(client, "test", "authors")
+	if err := db.EnsureIndexes(context.Background()); err != nil {
+		t.Fatalf("creating indexes: %s", err)
+	}
+	testAuthors(t, db, product.NewMongoStore(client, "test", "books"))
+}
+
+// TestAuthorsMemory tests author CRUD APIs against the in-memory stores.
+func TestAuthorsMemory(t *testing.T) {
+	testAuthors(t, author.NewMemoryStore(), product.NewMemoryStore())
+}
+
+func testAuthors(t *testing.T, db author.Store, books product.Store) {
+	t.Helper()
+
+	ctx := context.Background()
+	now := time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC)
+
+	a0, err := author.Create(ctx, db, author.NewAuthor{Name: " J.R.R. Tolkien "}, now)
+	if err != nil {
+		t.Fatalf("creating author: %s", err)
+	}
+	if exp, got := "J.R.R. Tolkien", a0.Name; exp != got {
+		t.Fatalf("expected name %q, got %q", exp, got)
+	}
+
+	a1, err := author.Retrieve(ctx, db, a0.ID)
+	if err != nil {
+		t.Fatalf("getting author: %s", err)
+	}
+	if diff := cmp.Diff(a0, a1); diff != "" {
+		t.Fatalf("fetched != created:\n%s", diff)
+	}
+
+	// Another spelling of the same name is the same Author.
+	if _, err := author.Create(ctx, db, author.NewAuthor{Name: "Tolkien, J. R. R."}, now); err != author.ErrDuplicate {
+		t.Fatalf("creating another spelling: expected %v, got %v", author.ErrDuplicate, err)
+	}
+	a2, err := author.Resolve(ctx, db, "Tolkien, J. R. R.", now)
+	if err != nil {
+		t.Fatalf("resolving author: %s", err)
+	}
+	if a2.ID != a0.ID {
+		t.Fatalf("expected another spelling to resolve to %s, got %s", a0.ID, a2.ID)
+	}
+
+	a3, err := author.Resolve(ctx, db, "Ursula K. Le Guin", now)
+	if err != nil {
+		t.Fatalf("resolving new author: %s", err)
+	}
+
+	list, next, err := author.List(ctx, db, author.Query{Limit: 1})
+	if err != nil {
+		t.Fatalf("listing authors: %s", err)
+	}
+	if len(list) != 1 || list[0].ID != a0.ID || next == "" {
+		t.Fatalf("expected first page with %s and a cursor, got %v %q", a0.ID, list, next)
+	}
+	list, next, err = author.List(ctx, db, author.Query{Limit: 1, Cursor: next})
+	if err != nil {
+		t.Fatalf("listing authors: %s", err)
+	}
+	if len(list) != 1 || list[0].ID != a3.ID || next != "" {
+		t.Fatalf("expected last page with %s, got %v %q", a3.ID, list, next)
+	}
+
+	// Renaming an Author renames its books.
+	p, err := product.Create(ctx, books, product.NewProduct{Name: "The Hobbit", Author: a0.Name, AuthorID: a0.ID}, now)
+	if err != nil {
+		t.Fatalf("creating book: %s", err)
+	}
+
+	name := "John Ronald Reuel Tolkien"
+	if _, err := author.Update(ctx, db, books, a0.ID, author.UpdateAuthor{Name: &name}, now); err != nil {
+		t.Fatalf("renaming author: %s", err)
+	}
+	p, err = product.Retrieve(ctx, books, p.ID)
+	if err != nil {
+		t.Fatalf("getting book: %s", err)
+	}
+	if p.Author != name || p.Revision != 2 {
+		t.Fatalf("expected book renamed to %q at revision 2, got %q at %d", name, p.Author, p.Revision)
+	}
+
+	taken := "Le Guin, Ursula K."
+	if _, err := author.Update(ctx, db, books, a0.ID, author.UpdateAuthor{Name: &taken}, now); err != author.ErrDuplicate {
+		t.Fatalf("renaming to a taken name: expected %v, got %v", author.ErrDuplicate, err)
+	}
+
+	// An Author with books cannot be deleted.
+	if err := author.Delete(ctx, db, books, a0.ID); err != author.ErrHasBooks {
+		t.Fatalf("deleting author with books: expected %v, got %v", author.ErrHasBooks, err)
+	}
+	if err := author.Delete(ctx, db, books, a3.ID); err != nil {
+		t.Fatalf("deleting author: %s", err)
+	}
+	if _, err := author.Retrieve(ctx, db, a3.ID); err != author.ErrNotFound {
+		t.Fatalf("getting deleted author: expected %v, got %v", author.ErrNotFound, err)
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name, key string
+	}{
+		{"J.R.R. Tolkien", "j r r tolkien"},
+		{"Tolkien, J. R. R.", "j r r tolkien"},
+		{"  jrr   TOLKIEN ", "jrr tolkien"},
+		{"Gabriel García Márquez", "gabriel garcía márquez"},
+		{"...", ""},
+	}
+
+	for _, tt := range tests {
+		if got := author.Key(tt.name); got != tt.key {
+			t.Errorf("Key(%q) = %q, want %q", tt.name, got, tt.key)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC)
+
+	db := author.NewMemoryStore()
+	books := product.NewMemoryStore()
+
+	existing, err := author.Create(ctx, db, author.NewAuthor{Name: "Le Guin, Ursula K."}, now)
+	if err != nil {
+		t.Fatalf("creating author: %s", err)
+	}
+
+	spellings := []string{"J.R.R. Tolkien", "Tolkien, J. R. R.", "J.R.R. Tolkien", "Ursula K. Le Guin", ""}
+	ids := make([]string, len(spellings))
+	for i, s := range spellings {
+		p, err := product.Create(ctx, books, product.NewProduct{Name: "Book", Author: s}, now)
+		if err != nil {
+			t.Fatalf("creating book: %s", err)
+		}
+		ids[i] = p.ID
+	}
+
+	report, err := author.Migrate(ctx, db, books, now)
+	if err != nil {
+		t.Fatalf("migrating: %s", err)
+	}
+	if diff := cmp.Diff(&author.MigrationReport{Authors: 1, Linked: 4}, report); diff != "" {
+		t.Fatalf("unexpected report:\n%s", diff)
+	}
+
+	tolkien, err := db.RetrieveByKey(ctx, author.Key("J.R.R. Tolkien"))
+	if err != nil {
+		t.Fatalf("getting migrated author: %s", err)
+	}
+	if exp, got := "J.R.R. Tolkien", tolkien.Name; exp != got {
+		t.Fatalf("expected the commonest spelling %q, got %q", exp, got)
+	}
+
+	exp := []struct{ id, name string }{
+		{tolkien.ID, tolkien.Name},
+		{tolkien.ID, tolkien.Name},
+		{tolkien.ID, tolkien.Name},
+		{existing.ID, existing.Name},
+		{"", ""},
+	}
+	for i, id := range ids {
+		p, err := product.Retrieve(ctx, books, id)
+		if err != nil {
+			t.Fatalf("getting book: %s", err)
+		}
+		if p.AuthorID != exp[i].id || p.Author != exp[i].name {
+			t.Errorf("book %d: expected author %q (%s), got %q (%s)", i, exp[i].name, exp[i].id, p.Author, p.AuthorID)
+		}
+	}
+
+	// Running it again changes nothing.
+	report, err = author.Migrate(ctx, db, books, now)
+	if err != nil {
+		t.Fatalf("migrating again: %s", err)
+	}
+	if diff := cmp.Diff(&author.MigrationReport{}, report); diff != "" {
+		t.Fatalf("unexpected report of second run:\n%s", diff)
+	}
+}
@@ -0,0 +1,79 @@
+package author
+
+import (
+	"context"
+	"time"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// Linker points books at their Author records. Authors it looked up are
+// remembered, so that a bulk import resolves each name once.
+type Linker struct {
+	db    Store
+	cache map[string]*Author
+}
+
+// NewLinker returns a Linker resolving authors in db.
+func NewLinker(db Store) *Linker {
+	return &Linker{db: db, cache: make(map[string]*Author)}
+}
+
+// Link returns the author ID and name a book should be stored with. An ID
+// must name an existing Author, whose name replaces the given one, or else
+// ErrNotFound is returned. A name alone is resolved to the Author with the
+// same key, which is created when there is none. A name without letters or
+// digits is kept unlinked.
+func (l *Linker) Link(ctx context.Context, id, name string, now time.Time) (string, string, error) {
+	var a *Author
+	var err error
+
+	switch {
+	case id != "":
+		if a = l.cache["id:"+id]; a == nil {
+			a, err = Retrieve(ctx, l.db, id)
+		}
+	case Key(name) != "":
+		if a = l.cache["key:"+Key(name)]; a == nil {
+			a, err = Resolve(ctx, l.db, name, now)
+		}
+	default:
+		return "", name, nil
+	}
+
+	if err != nil {
+		return "", "", err
+	}
+
+	l.cache["id:"+a.ID] = a
+	l.cache["key:"+Key(a.Name)] = a
+	return a.ID, a.Name, nil
+}
+
+// LinkUpdate links the author of a book update. An empty author ID unlinks
+// the book and keeps its name unless one is given.
+func (l *Linker) LinkUpdate(ctx context.Context, update *product.UpdateProduct, now time.Time) error {
+	if update.AuthorID == nil && update.Author == nil {
+		return nil
+	}
+	if update.AuthorID != nil && *update.AuthorID == "" {
+		return nil
+	}
+
+	var id, name string
+	if update.AuthorID != nil {
+		id = *update.AuthorID
+	}
+	if update.Author != nil {
+		name = *update.Author
+	}
+
+	id, name, err := l.Link(ctx, id, name, now)
+	if err != nil {
+		return err
+	}
+
+	update.AuthorID = &id
+	update.Author = &name
+	return nil
+}
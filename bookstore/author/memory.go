@@ -0,0 +1,131 @@
+package author
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps authors in process memory. It is safe for
+// concurrent use and is intended for tests and for running the service
+// without a database.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	authors map[string]Author
+	keys    map[string]string
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		authors: make(map[string]Author),
+		keys:    make(map[string]string),
+	}
+}
+
+// List gets a page of Authors in name order.
+func (s *MemoryStore) List(ctx context.Context, q Query) ([]Author, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	authors := make([]Author, 0, len(s.authors))
+	for _, a := range s.authors {
+		if q.after == nil || q.after.after(a) {
+			authors = append(authors, a)
+		}
+	}
+
+	sort.Slice(authors, func(i, j int) bool {
+		return less(authors[i], authors[j])
+	})
+
+	if q.Limit > 0 && len(authors) > q.Limit {
+		authors = authors[:q.Limit]
+	}
+
+	return authors, nil
+}
+
+// Retrieve gets a single Author.
+func (s *MemoryStore) Retrieve(ctx context.Context, id string) (*Author, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.authors[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &a, nil
+}
+
+// RetrieveByKey gets the Author whose name has the given key.
+func (s *MemoryStore) RetrieveByKey(ctx context.Context, key string) (*Author, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.keys[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	a := s.authors[id]
+	return &a, nil
+}
+
+// Insert adds an Author.
+func (s *MemoryStore) Insert(ctx context.Context, a Author) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := Key(a.Name)
+	if _, ok := s.keys[key]; ok {
+		return ErrDuplicate
+	}
+
+	s.authors[a.ID] = a
+	s.keys[key] = a.ID
+
+	return nil
+}
+
+// Update renames an Author.
+func (s *MemoryStore) Update(ctx context.Context, id string, name string, now time.Time) (*Author, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.authors[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	key := Key(name)
+	if other, ok := s.keys[key]; ok && other != id {
+		return nil, ErrDuplicate
+	}
+
+	delete(s.keys, Key(a.Name))
+	a.Name = name
+	a.DateUpdated = now
+	s.authors[id] = a
+	s.keys[key] = id
+
+	return &a, nil
+}
+
+// Delete removes an Author.
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.authors[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	delete(s.keys, Key(a.Name))
+	delete(s.authors, id)
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package author
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// MigrationReport summarizes a Migrate run.
+type MigrationReport struct {
+
+	// Authors is the number of Authors created.
+	Authors int `json:"authors"`
+
+	// Linked is the number of books that now reference an Author.
+	Linked int `json:"linked"`
+
+	// Skipped is the number of books changed or deleted while the
+	// migration ran. Running it again picks them up.
+	Skipped int `json:"skipped"`
+}
+
+// Migrate turns the free text author names of live books into Author
+// records. Names with the same Key become one Author, named after its most
+// common spelling, or the existing Author with that key. Each book is then
+// linked to its Author and renamed to the Author's name. Books that already
+// reference an Author or have no author name are left alone, so Migrate can
+// be run again.
+func Migrate(ctx context.Context, db Store, books product.Store, now time.Time) (*MigrationReport, error) {
+	type book struct {
+		id  string
+		rev int
+	}
+
+	// The books and spellings of each key.
+	groups := make(map[string][]book)
+	spellings := make(map[string]map[string]int)
+
+	err := product.Walk(ctx, books, product.Query{}, func(p product.Product) error {
+		key := Key(p.Author)
+		if p.AuthorID != "" || key == "" {
+			return nil
+		}
+
+		groups[key] = append(groups[key], book{p.ID, p.Revision})
+		if spellings[key] == nil {
+			spellings[key] = make(map[string]int)
+		}
+		spellings[key][p.Author]++
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "reading books")
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var report MigrationReport
+	for _, key := range keys {
+		a, err := db.RetrieveByKey(ctx, key)
+		if err == ErrNotFound {
+			a, err = Create(ctx, db, NewAuthor{Name: commonest(spellings[key])}, now)
+			if err == nil {
+				report.Authors++
+			}
+		}
+		if err != nil {
+			return &report, errors.Wrapf(err, "creating author %q", key)
+		}
+
+		update := product.UpdateProduct{AuthorID: &a.ID, Author: &a.Name}
+		for _, b := range groups[key] {
+			_, err := product.Update(ctx, books, b.id, b.rev, update, now)
+			switch err {
+			case nil:
+				report.Linked++
+			case product.ErrRevisionMismatch, product.ErrNotFound:
+				report.Skipped++
+			default:
+				return &report, errors.Wrapf(err, "linking book %q", b.id)
+			}
+		}
+	}
+
+	return &report, nil
+}
+
+// commonest returns the spelling used most often, the first in alphabetical
+// order on a tie.
+func commonest(spellings map[string]int) string {
+	var best string
+	for s, n := range spellings {
+		if best == "" || n > spellings[best] || (n == spellings[best] && s < best) {
+			best = s
+		}
+	}
+	return best
+}
@@ -0,0 +1,156 @@
+package author
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/database"
+)
+
+// MongoStore is a Store backed by a MongoDB collection.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+// document is how an Author is stored. The author ID doubles as the Mongo _id
+// and the Key of the name is stored next to it for the unique index.
+type document struct {
+	MongoID string `bson:"_id"`
+	Key     string `bson:"key"`
+	Author  `bson:",inline"`
+}
+
+// NewMongoStore returns a Store that keeps authors in the named database and
+// collection of the provided client.
+func NewMongoStore(client *mongo.Client, database, collection string) *MongoStore {
+	return &MongoStore{
+		collection: client.Database(database).Collection(collection),
+	}
+}
+
+// EnsureIndexes creates the unique index on the name keys and the index List
+// sorts with. Creating an index that already exists is a no-op.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	models := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "name", Value: 1}, {Key: "id", Value: 1}},
+		},
+	}
+
+	if _, err := s.collection.Indexes().CreateMany(ctx, models); err != nil {
+		return errors.Wrap(err, "creating indexes")
+	}
+
+	return nil
+}
+
+// List gets a page of Authors in name order.
+func (s *MongoStore) List(ctx context.Context, q Query) ([]Author, error) {
+	authors := []Author{}
+
+	filter := bson.M{}
+	if q.after != nil {
+		filter["$or"] = bson.A{
+			bson.M{"name": bson.M{"$gt": q.after.Name}},
+			bson.M{"name": q.after.Name, "id": bson.M{"$gt": q.after.ID}},
+		}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "id", Value: 1}})
+	if q.Limit > 0 {
+		opts.SetLimit(int64(q.Limit))
+	}
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting authors")
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &authors); err != nil {
+		return nil, errors.Wrap(err, "decoding authors")
+	}
+
+	return authors, nil
+}
+
+// Retrieve gets a single Author from the collection.
+func (s *MongoStore) Retrieve(ctx context.Context, id string) (*Author, error) {
+	return s.findOne(ctx, bson.M{"_id": id})
+}
+
+// RetrieveByKey gets the Author whose name has the given key.
+func (s *MongoStore) RetrieveByKey(ctx context.Context, key string) (*Author, error) {
+	return s.findOne(ctx, bson.M{"key": key})
+}
+
+func (s *MongoStore) findOne(ctx context.Context, filter bson.M) (*Author, error) {
+	var a Author
+
+	if err := s.collection.FindOne(ctx, filter).Decode(&a); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrap(err, "get author")
+	}
+
+	return &a, nil
+}
+
+// Insert adds an Author to the collection.
+func (s *MongoStore) Insert(ctx context.Context, a Author) error {
+	if _, err := s.collection.InsertOne(ctx, document{a.ID, Key(a.Name), a}); err != nil {
+		if database.IsDuplicateKey(err) {
+			return ErrDuplicate
+		}
+		return errors.Wrap(err, "inserting author")
+	}
+
+	return nil
+}
+
+// Update renames an Author. The unique index rejects a name taken by another
+// Author.
+func (s *MongoStore) Update(ctx context.Context, id string, name string, now time.Time) (*Author, error) {
+	change := bson.M{
+		"$set": bson.M{"name": name, "key": Key(name), "dateupdated": now},
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var a Author
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, change, opts).Decode(&a)
+	if err != nil {
+		switch {
+		case err == mongo.ErrNoDocuments:
+			return nil, ErrNotFound
+		case database.IsDuplicateKey(err):
+			return nil, ErrDuplicate
+		}
+		return nil, errors.Wrap(err, "updating author")
+	}
+
+	return &a, nil
+}
+
+// Delete removes an Author from the collection.
+func (s *MongoStore) Delete(ctx context.Context, id string) error {
+	res, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return errors.Wrap(err, "delete author")
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
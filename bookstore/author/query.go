@@ -0,0 +1,72 @@
+package author
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidCursor is used when a List cursor cannot be decoded.
+var ErrInvalidCursor = errors.New("cursor is not valid for this query")
+
+// Query describes which page of Authors List returns. Authors are ordered by
+// name and then by ID.
+type Query struct {
+
+	// Limit caps the number of Authors returned, zero means no limit.
+	Limit int
+
+	// Cursor is the opaque value returned by a previous List call. When set
+	// only Authors after that position are returned.
+	Cursor string
+
+	// after is the decoded Cursor, populated by prepare.
+	after *cursor
+}
+
+// cursor is the position of the last Author of a page.
+type cursor struct {
+	Name string `json:"n"`
+	ID   string `json:"id"`
+}
+
+// prepare decodes the cursor of the query.
+func (q *Query) prepare() error {
+	q.after = nil
+	if q.Cursor == "" {
+		return nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return ErrInvalidCursor
+	}
+
+	q.after = &c
+	return nil
+}
+
+// cursorAfter returns the cursor pointing just past a.
+func cursorAfter(a Author) string {
+	b, _ := json.Marshal(cursor{Name: a.Name, ID: a.ID})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// less reports whether a sorts before b.
+func less(a, b Author) bool {
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	return a.ID < b.ID
+}
+
+// after reports whether a sorts after the cursor position c.
+func (c *cursor) after(a Author) bool {
+	return less(Author{Name: c.Name, ID: c.ID}, a)
+}
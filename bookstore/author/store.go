@@ -0,0 +1,34 @@
+package author
+
+import (
+	"context"
+	"time"
+)
+
+// Store is the persistence layer behind the author functions. The package
+// level functions own the business rules and use a Store only to read and
+// write documents. A Store keeps the Key of every Author name unique.
+type Store interface {
+
+	// List returns the Authors of the page q asks for, in name order. The
+	// query has already been validated and its cursor decoded.
+	List(ctx context.Context, q Query) ([]Author, error)
+
+	// Retrieve returns the Author with the given ID or ErrNotFound.
+	Retrieve(ctx context.Context, id string) (*Author, error)
+
+	// RetrieveByKey returns the Author whose name has the given Key or
+	// ErrNotFound.
+	RetrieveByKey(ctx context.Context, key string) (*Author, error)
+
+	// Insert stores a new Author. It returns ErrDuplicate when the Key of
+	// its name is taken.
+	Insert(ctx context.Context, a Author) error
+
+	// Update renames the Author with the given ID. It returns the renamed
+	// Author, ErrNotFound or ErrDuplicate.
+	Update(ctx context.Context, id string, name string, now time.Time) (*Author, error)
+
+	// Delete removes the Author with the given ID or returns ErrNotFound.
+	Delete(ctx context.Context, id string) error
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/author"
+)
+
+// GetAuthor returns the Author with the given ID.
+func (c *Client) GetAuthor(ctx context.Context, id string) (*author.Author, error) {
+	var a author.Author
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/authors/" + url.PathEscape(id)}, &a); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// CreateAuthor adds an Author. A ConflictError is returned when the name is
+// another spelling of an existing Author.
+func (c *Client) CreateAuthor(ctx context.Context, na author.NewAuthor) (*author.Author, error) {
+	var a author.Author
+	if _, err := c.do(ctx, request{method: http.MethodPost, path: "/authors", body: na}, &a); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// UpdateAuthor renames the Author with the given ID, and its books with it.
+func (c *Client) UpdateAuthor(ctx context.Context, id string, ua author.UpdateAuthor) (*author.Author, error) {
+	var a author.Author
+	if _, err := c.do(ctx, request{method: http.MethodPut, path: "/authors/" + url.PathEscape(id), body: ua}, &a); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// DeleteAuthor removes the Author with the given ID. A ConflictError is
+// returned while books still reference it.
+func (c *Client) DeleteAuthor(ctx context.Context, id string) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: "/authors/" + url.PathEscape(id)}, nil)
+	return err
+}
+
+// AuthorIterator iterates over Authors in name order, fetching a page at a
+// time. It is used like a BookIterator.
+type AuthorIterator struct {
+	pager
+	page []author.Author
+	cur  author.Author
+}
+
+// Authors returns an iterator over the Authors. q.Limit sets the page size
+// and q.Cursor the position to start after.
+func (c *Client) Authors(q author.Query) *AuthorIterator {
+	params := url.Values{}
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Cursor != "" {
+		params.Set("cursor", q.Cursor)
+	}
+
+	return &AuthorIterator{pager: pager{c: c, path: "/authors", query: params}}
+}
+
+// Next advances to the next Author, fetching the next page when needed. It
+// returns false when there are no more Authors or a call failed, see Err.
+func (it *AuthorIterator) Next(ctx context.Context) bool {
+	for len(it.page) == 0 {
+		if !it.fetch(ctx, &it.page) {
+			return false
+		}
+	}
+
+	it.cur, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Author returns the Author Next advanced to.
+func (it *AuthorIterator) Author() author.Author {
+	return it.cur
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *AuthorIterator) Err() error {
+	return it.err
+}
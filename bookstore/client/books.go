@@ -0,0 +1,142 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// GetBook returns the book with the given ID.
+func (c *Client) GetBook(ctx context.Context, id string) (*product.Product, error) {
+	var p product.Product
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/books/" + url.PathEscape(id)}, &p); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// CreateBook adds a book and returns it with its generated fields.
+func (c *Client) CreateBook(ctx context.Context, np product.NewProduct) (*product.Product, error) {
+	var p product.Product
+	if _, err := c.do(ctx, request{method: http.MethodPost, path: "/books", body: np}, &p); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// UpdateBook applies update to the book with the given ID. Unless rev is
+// product.AnyRevision the update only happens while the book is at that
+// revision, otherwise a ConflictError is returned.
+func (c *Client) UpdateBook(ctx context.Context, id string, rev int, update product.UpdateProduct) error {
+	req := request{
+		method: http.MethodPut,
+		path:   "/books/" + url.PathEscape(id),
+		header: ifMatch(rev),
+		body:   update,
+	}
+
+	_, err := c.do(ctx, req, nil)
+	return err
+}
+
+// DeleteBook moves the book with the given ID to the trash. rev makes the
+// delete conditional like for UpdateBook.
+func (c *Client) DeleteBook(ctx context.Context, id string, rev int) error {
+	req := request{
+		method: http.MethodDelete,
+		path:   "/books/" + url.PathEscape(id),
+		header: ifMatch(rev),
+	}
+
+	_, err := c.do(ctx, req, nil)
+	return err
+}
+
+// ifMatch returns the If-Match header of a call made at revision rev.
+func ifMatch(rev int) http.Header {
+	if rev == product.AnyRevision {
+		return nil
+	}
+
+	return http.Header{"If-Match": {strconv.Quote(strconv.Itoa(rev))}}
+}
+
+// BookIterator iterates over the books matching a query, fetching a page at
+// a time.
+//
+//	it := c.Books(product.Query{Genre: "Fantasy"})
+//	for it.Next(ctx) {
+//		p := it.Product()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type BookIterator struct {
+	pager
+	page []product.Product
+	cur  product.Product
+}
+
+// Books returns an iterator over the books matching q. Limit sets the page
+// size and Cursor the position to start after. Deleted iterates over the
+// trash.
+func (c *Client) Books(q product.Query) *BookIterator {
+	params := url.Values{}
+	for name, value := range map[string]string{
+		"author":    q.Author,
+		"author_id": q.AuthorID,
+		"genre":     q.Genre,
+		"isbn":      q.ISBN,
+		"cursor":    q.Cursor,
+	} {
+		if value != "" {
+			params.Set(name, value)
+		}
+	}
+	if q.Sort != "" {
+		sort := q.Sort
+		if q.Desc {
+			sort = "-" + sort
+		}
+		params.Set("sort", sort)
+	}
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	path := "/books"
+	if q.Deleted {
+		path = "/books/trash"
+	}
+
+	return &BookIterator{pager: pager{c: c, path: path, query: params}}
+}
+
+// Next advances to the next book, fetching the next page when needed. It
+// returns false when there are no more books or a call failed, see Err.
+func (it *BookIterator) Next(ctx context.Context) bool {
+	for len(it.page) == 0 {
+		if !it.fetch(ctx, &it.page) {
+			return false
+		}
+	}
+
+	it.cur, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Product returns the book Next advanced to.
+func (it *BookIterator) Product() product.Product {
+	return it.cur
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *BookIterator) Err() error {
+	return it.err
+}
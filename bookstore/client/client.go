@@ -0,0 +1,280 @@
+// Package client is a Go client of the bookstore REST API. It sends and
+// receives the types of the service itself and turns error responses into
+// typed errors.
+//
+// Every call takes a context. Calls failing with a network error or a 429,
+// 502, 503 or 504 response are retried with exponential backoff. Retrying a
+// POST or a PATCH is safe as each call carries an Idempotency-Key, which
+// callers may choose with WithIdempotencyKey.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultTimeout bounds each attempt of a call made with the default
+	// http.Client.
+	defaultTimeout = 10 * time.Second
+
+	// maxErrorBody caps how much of an error response is read.
+	maxErrorBody = 1 << 20
+)
+
+// DefaultRetry is the Retry of a Client made by New.
+var DefaultRetry = Retry{
+	Retries:    3,
+	MinBackoff: 100 * time.Millisecond,
+	MaxBackoff: 2 * time.Second,
+}
+
+// Retry configures how failed calls are retried. The wait before the nth
+// retry is picked at random between half and all of MinBackoff doubled n-1
+// times, up to MaxBackoff. A Retry-After header of the response is honored
+// up to MaxBackoff.
+type Retry struct {
+	Retries    int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// backoff returns the wait before the given retry, counted from 1.
+func (r Retry) backoff(retry int) time.Duration {
+	d := r.MinBackoff
+	for i := 1; i < retry && d < r.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.MaxBackoff {
+		d = r.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// TokenSource returns the bearer token of a call. It is called for every
+// call, so that it can pick up a rotated token.
+type TokenSource func(ctx context.Context) (string, error)
+
+// StaticToken returns a TokenSource of a fixed token.
+func StaticToken(token string) TokenSource {
+	return func(ctx context.Context) (string, error) {
+		return token, nil
+	}
+}
+
+// TokenFile returns a TokenSource reading the token from a file, such as a
+// mounted Kubernetes secret.
+func TokenFile(path string) TokenSource {
+	return func(ctx context.Context) (string, error) {
+		token, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", errors.Wrap(err, "reading token")
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+}
+
+// Client calls the bookstore REST API at BaseURL. Its fields may be changed
+// before it is first used.
+type Client struct {
+	BaseURL    *url.URL
+	HTTPClient *http.Client
+	Retry      Retry
+
+	// Token authorizes calls when set. Reads work without one.
+	Token TokenSource
+
+	// Tenant names the catalog calls work on when the service serves one per
+	// tenant. It defaults to the tenant of the token.
+	Tenant string
+}
+
+// New returns a Client of the API served at baseURL, such as
+// http://bookstore:8888, with a default http.Client and DefaultRetry.
+func New(baseURL string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing base URL")
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, errors.Errorf("base URL %q must be absolute", baseURL)
+	}
+
+	c := Client{
+		BaseURL:    u,
+		HTTPClient: &http.Client{Timeout: defaultTimeout},
+		Retry:      DefaultRetry,
+	}
+
+	return &c, nil
+}
+
+// ctxKey is the type of the context keys of the package.
+type ctxKey int
+
+// idempotencyKey is the context key of the Idempotency-Key of a call.
+const idempotencyKey ctxKey = 1
+
+// WithIdempotencyKey returns a context making the POST or PATCH call it is
+// given to with key. Without one a call gets a random key, which makes its
+// own retries safe but not a repeated call.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey, key)
+}
+
+// request is a call to the API.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   interface{}
+}
+
+// do makes a call, retrying it as configured, and decodes its JSON response
+// into out unless out is nil. It returns the response, whose body is closed.
+func (c *Client) do(ctx context.Context, req request, out interface{}) (*http.Response, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, errors.Wrap(err, "encoding request")
+		}
+	}
+
+	u := *c.BaseURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + req.path
+	u.RawQuery = req.query.Encode()
+
+	header := make(http.Header)
+	for name, values := range req.header {
+		header[name] = values
+	}
+	header.Set("Accept", "application/json")
+	if body != nil {
+		header.Set("Content-Type", "application/json")
+	}
+	if c.Tenant != "" {
+		header.Set("X-Tenant-ID", c.Tenant)
+	}
+	if c.Token != nil {
+		token, err := c.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		header.Set("Authorization", "Bearer "+token)
+	}
+	if req.method == http.MethodPost || req.method == http.MethodPatch {
+		key, _ := ctx.Value(idempotencyKey).(string)
+		if key == "" {
+			key = uuid.New().String()
+		}
+		header.Set("Idempotency-Key", key)
+	}
+
+	for retry := 0; ; retry++ {
+		resp, err := c.attempt(ctx, req.method, u.String(), header, body, out)
+		if err == nil || !retryable(ctx, resp) || retry >= c.Retry.Retries {
+			if err != nil && resp == nil {
+				err = errors.Wrapf(err, "%s %s", req.method, req.path)
+			}
+			return resp, err
+		}
+
+		wait := c.Retry.backoff(retry + 1)
+		if after := retryAfter(resp); after > wait {
+			wait = after
+			if wait > c.Retry.MaxBackoff {
+				wait = c.Retry.MaxBackoff
+			}
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return resp, errors.Wrapf(err, "%s %s", req.method, req.path)
+		case <-t.C:
+		}
+	}
+}
+
+// attempt makes one attempt of a call. It returns a nil response when the
+// call failed before a response came.
+func (c *Client) attempt(ctx context.Context, method, url string, header http.Header, body []byte, out interface{}) (*http.Response, error) {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, method, url, rd)
+	if err != nil {
+		return nil, err
+	}
+	r.Header = header.Clone()
+
+	resp, err := c.HTTPClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, decodeError(resp)
+	}
+
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, errors.Wrap(err, "decoding response")
+		}
+	}
+
+	return resp, nil
+}
+
+// retryable reports whether a failed attempt, which got resp, is worth
+// retrying. Attempts that got no response failed on the network.
+func retryable(ctx context.Context, resp *http.Response) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if resp == nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryAfter returns the wait asked for by the Retry-After header of resp.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
@@ -0,0 +1,236 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/author"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/cover"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/handlers"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/idempotency"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/tests"
+)
+
+// newTestServer serves the API over in-memory stores and returns a token
+// with every role for it. wrap, when set, wraps the API handler.
+func newTestServer(t *testing.T, wrap func(http.Handler) http.Handler) (*httptest.Server, string) {
+	t.Helper()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := auth.Keys{"test": privateKey}
+	a, err := auth.New("RS256", keys.Lookup, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := product.NewBroadcaster(8, 8)
+	db := product.WithEvents(product.NewMemoryStore(), events)
+	tk := handlers.Tokens{Auth: a, KID: "test", Users: auth.Users{}}
+	logger := log.New(ioutil.Discard, "", 0)
+	idem := handlers.Idempotency{Store: idempotency.NewMemoryStore(), Window: time.Hour, Log: logger}
+
+	var h http.Handler = handlers.API(db, author.NewMemoryStore(), events, cover.NewMemoryStore(), &tk, &idem, nil, tests.LoanPolicy(), 0, logger)
+	if wrap != nil {
+		h = wrap(h)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	claims := auth.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   "alice",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		Roles: []string{auth.RoleUser, auth.RoleAdmin},
+	}
+	token, err := a.GenerateToken("test", claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return srv, token
+}
+
+// newTestClient returns a Client of srv authorized with token that retries
+// without waiting long.
+func newTestClient(t *testing.T, srv *httptest.Server, token string) *Client {
+	t.Helper()
+
+	c, err := New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Token = StaticToken(token)
+	c.Retry = Retry{Retries: 2, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+	return c
+}
+
+func TestBooks(t *testing.T) {
+	srv, token := newTestServer(t, nil)
+	c := newTestClient(t, srv, token)
+	ctx := context.Background()
+
+	created, err := c.CreateBook(ctx, product.NewProduct{Name: "Dune", Author: "Frank Herbert", Genre: "SF", ISBN: "0-441-17271-7"})
+	if err != nil {
+		t.Fatalf("creating: %s", err)
+	}
+	if created.ID == "" || created.AuthorID == "" {
+		t.Errorf("expected generated IDs, got %+v", created)
+	}
+
+	_, err = c.CreateBook(ctx, product.NewProduct{Name: "Dune", ISBN: "9780441172719"})
+	if ce, ok := err.(*ConflictError); !ok || ce.ID != created.ID {
+		t.Errorf("creating a duplicate ISBN: expected a ConflictError naming %s, got %v", created.ID, err)
+	}
+
+	got, err := c.GetBook(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("getting: %s", err)
+	}
+	if got.Name != "Dune" {
+		t.Errorf("expected Dune, got %+v", got)
+	}
+
+	name := "Dune Messiah"
+	if err := c.UpdateBook(ctx, created.ID, got.Revision, product.UpdateProduct{Name: &name}); err != nil {
+		t.Fatalf("updating: %s", err)
+	}
+	if err := c.UpdateBook(ctx, created.ID, got.Revision, product.UpdateProduct{Name: &name}); !IsConflict(err) {
+		t.Errorf("updating a stale revision: expected a ConflictError, got %v", err)
+	}
+
+	a, err := c.GetAuthor(ctx, created.AuthorID)
+	if err != nil || a.Name != "Frank Herbert" {
+		t.Errorf("getting author: got %+v, %v", a, err)
+	}
+	if _, err := c.CreateAuthor(ctx, author.NewAuthor{Name: "Herbert, Frank"}); !IsConflict(err) {
+		t.Errorf("creating a duplicate author: expected a ConflictError, got %v", err)
+	}
+
+	if err := c.DeleteBook(ctx, created.ID, product.AnyRevision); err != nil {
+		t.Fatalf("deleting: %s", err)
+	}
+	if _, err := c.GetBook(ctx, created.ID); !IsNotFound(err) {
+		t.Errorf("getting a deleted book: expected a NotFoundError, got %v", err)
+	}
+
+	_, err = c.CreateBook(ctx, product.NewProduct{Genre: "SF"})
+	ve, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("creating without a name: expected a ValidationError, got %v", err)
+	}
+	if len(ve.Fields) != 1 || ve.Fields[0].Field != "name" {
+		t.Errorf("expected a name field error, got %+v", ve.Fields)
+	}
+
+	c.Token = nil
+	if _, err := c.CreateBook(ctx, product.NewProduct{Name: "Emma"}); err == nil {
+		t.Error("creating without a token: expected an error")
+	} else if e, ok := err.(*Error); !ok || e.Status != http.StatusUnauthorized {
+		t.Errorf("creating without a token: expected a 401 Error, got %v", err)
+	}
+}
+
+func TestIterators(t *testing.T) {
+	srv, token := newTestServer(t, nil)
+	c := newTestClient(t, srv, token)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		np := product.NewProduct{Name: fmt.Sprintf("Book %d", i), Author: fmt.Sprintf("Author %d", i)}
+		if _, err := c.CreateBook(ctx, np); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var names []string
+	it := c.Books(product.Query{Sort: "name", Desc: true, Limit: 2})
+	for it.Next(ctx) {
+		names = append(names, it.Product().Name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("iterating books: %s", err)
+	}
+	if len(names) != 5 || names[0] != "Book 4" || names[4] != "Book 0" {
+		t.Errorf("expected the 5 books in descending name order, got %v", names)
+	}
+
+	authors := 0
+	ait := c.Authors(author.Query{Limit: 2})
+	for ait.Next(ctx) {
+		authors++
+	}
+	if err := ait.Err(); err != nil || authors != 5 {
+		t.Errorf("expected 5 authors, got %d, %v", authors, err)
+	}
+
+	it = c.Books(product.Query{Sort: "pages"})
+	if it.Next(ctx) || !IsValidation(it.Err()) {
+		t.Errorf("iterating with an unknown sort: expected a ValidationError, got %v", it.Err())
+	}
+}
+
+// TestRetry fails the first attempts of every call and checks that retried
+// POSTs keep their Idempotency-Key.
+func TestRetry(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		keys     = map[string]bool{}
+	)
+	flaky := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			attempts++
+			fail := attempts%3 != 0
+			if r.Method == http.MethodPost {
+				keys[r.Header.Get("Idempotency-Key")] = true
+			}
+			mu.Unlock()
+
+			if fail {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	srv, token := newTestServer(t, flaky)
+	c := newTestClient(t, srv, token)
+	ctx := context.Background()
+
+	if _, err := c.CreateBook(ctx, product.NewProduct{Name: "Dune"}); err != nil {
+		t.Fatalf("creating: %s", err)
+	}
+	if attempts != 3 || len(keys) != 1 {
+		t.Errorf("expected 3 attempts with one Idempotency-Key, got %d with %d", attempts, len(keys))
+	}
+
+	c.Retry.Retries = 1
+	_, err := c.CreateBook(ctx, product.NewProduct{Name: "Emma"})
+	if e, ok := err.(*Error); !ok || e.Status != http.StatusServiceUnavailable {
+		t.Errorf("running out of retries: expected a 503 Error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := c.GetBook(ctx, "0b0e4f5a-6b5e-4e57-9b5c-2c7b0ec1e0a1"); err == nil {
+		t.Error("expected an error with a canceled context")
+	}
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// FieldError names a request field that failed validation and why.
+type FieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// errorResponse is the body of the error responses of the service.
+type errorResponse struct {
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields"`
+	ID     string       `json:"id"`
+}
+
+// NotFoundError is returned for 404 Not Found responses.
+type NotFoundError struct {
+	Message string
+}
+
+// Error implements the error interface.
+func (err *NotFoundError) Error() string {
+	return "not found: " + err.Message
+}
+
+// ValidationError is returned for 400 Bad Request responses. Fields lists the
+// request fields that failed validation, when the service named them.
+type ValidationError struct {
+	Message string
+	Fields  []FieldError
+}
+
+// Error implements the error interface.
+func (err *ValidationError) Error() string {
+	msg := "invalid request: " + err.Message
+	for _, f := range err.Fields {
+		msg += fmt.Sprintf("; %s: %s", f.Field, f.Error)
+	}
+	return msg
+}
+
+// ConflictError is returned for 409 Conflict and 412 Precondition Failed
+// responses, such as when an update names a revision that is no longer the
+// current one. ID names the existing resource the call conflicts with, such
+// as the book that has the ISBN given to another.
+type ConflictError struct {
+	Status  int
+	Message string
+	ID      string
+}
+
+// Error implements the error interface.
+func (err *ConflictError) Error() string {
+	return "conflict: " + err.Message
+}
+
+// Error is returned for the other error responses.
+type Error struct {
+	Status  int
+	Message string
+	Fields  []FieldError
+}
+
+// Error implements the error interface.
+func (err *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", err.Status, http.StatusText(err.Status), err.Message)
+}
+
+// IsNotFound reports whether err is or wraps a NotFoundError.
+func IsNotFound(err error) bool {
+	var nf *NotFoundError
+	return errors.As(err, &nf)
+}
+
+// IsValidation reports whether err is or wraps a ValidationError.
+func IsValidation(err error) bool {
+	var ve *ValidationError
+	return errors.As(err, &ve)
+}
+
+// IsConflict reports whether err is or wraps a ConflictError.
+func IsConflict(err error) bool {
+	var ce *ConflictError
+	return errors.As(err, &ce)
+}
+
+// decodeError turns an error response into one of the error types of the
+// package. Responses that are not an error response of the service, such as
+// those of a proxy, get the status text as message.
+func decodeError(resp *http.Response) error {
+	var er errorResponse
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if err := json.Unmarshal(body, &er); err != nil || er.Error == "" {
+		er = errorResponse{Error: http.StatusText(resp.StatusCode)}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return &NotFoundError{Message: er.Error}
+	case http.StatusBadRequest:
+		return &ValidationError{Message: er.Error, Fields: er.Fields}
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return &ConflictError{Status: resp.StatusCode, Message: er.Error, ID: er.ID}
+	default:
+		return &Error{Status: resp.StatusCode, Message: er.Error, Fields: er.Fields}
+	}
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// pager fetches the pages of a list one after the other, following the
+// cursor of the Link header with rel="next" of each page.
+type pager struct {
+	c     *Client
+	path  string
+	query url.Values
+	done  bool
+	err   error
+}
+
+// fetch decodes the next page into out. It returns false once the last page
+// was fetched or a call failed.
+func (p *pager) fetch(ctx context.Context, out interface{}) bool {
+	if p.done || p.err != nil {
+		return false
+	}
+
+	resp, err := p.c.do(ctx, request{method: http.MethodGet, path: p.path, query: p.query}, out)
+	if err != nil {
+		p.err = err
+		return false
+	}
+
+	cursor := nextCursor(resp.Header.Get("Link"))
+	if cursor == "" {
+		p.done = true
+	} else {
+		p.query.Set("cursor", cursor)
+	}
+
+	return true
+}
+
+// nextCursor returns the cursor parameter of the rel="next" link of a Link
+// header, or "" when there is none.
+func nextCursor(link string) string {
+	for _, l := range strings.Split(link, ",") {
+		l = strings.TrimSpace(l)
+		end := strings.Index(l, ">")
+		if !strings.HasPrefix(l, "<") || end < 0 || !strings.Contains(l[end:], `rel="next"`) {
+			continue
+		}
+
+		u, err := url.Parse(l[1:end])
+		if err != nil {
+			return ""
+		}
+		return u.Query().Get("cursor")
+	}
+
+	return ""
+}
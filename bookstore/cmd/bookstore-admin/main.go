@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/author"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/conf"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatalf("run failed %v", err)
+	}
+}
+
+func run() error {
+
+	// =========================================================================
+	// Configuration
+
+	// The mongo and auth settings are the ones of the bookstore service, so the
+	// same BOOKSTORE_* environment applies to both.
+	var cfg struct {
+		Auth struct {
+			KeysFolder string        `conf:"default:/etc/bookstore/keys"`
+			ActiveKID  string        `conf:""`
+			Algorithm  string        `conf:"default:RS256"`
+			TokenTTL   time.Duration `conf:"default:8760h,help:lifetime of the tokens made by tokengen"`
+			Tenant     string        `conf:"help:tenant the tokens made by tokengen are scoped to"`
+		}
+		Mongo struct {
+			URI         string        `conf:"default:mongodb://localhost:27017,noprint"`
+			Database    string        `conf:"default:test"`
+			Collection  string        `conf:"default:books"`
+			Authors     string        `conf:"default:authors"`
+			DialTimeout time.Duration `conf:"default:10s"`
+		}
+		Args conf.Args
+	}
+
+	if err := conf.Parse(os.Args[1:], "BOOKSTORE", &cfg); err != nil {
+		if err == conf.ErrHelpWanted {
+			usage, err := conf.Usage("BOOKSTORE", &cfg)
+			if err != nil {
+				return errors.Wrap(err, "generating usage")
+			}
+			fmt.Println(usage)
+			return nil
+		}
+		return errors.Wrap(err, "error: parsing config")
+	}
+
+	var err error
+	switch cfg.Args.Num(0) {
+	case "migrate-authors":
+		err = migrateAuthors(cfg.Mongo.URI, cfg.Mongo.Database, cfg.Mongo.Collection, cfg.Mongo.Authors, cfg.Mongo.DialTimeout)
+	case "keygen":
+		err = keygen(cfg.Auth.KeysFolder)
+	case "tokengen":
+		var roles []string
+		if len(cfg.Args) > 2 {
+			roles = cfg.Args[2:]
+		}
+		err = tokengen(cfg.Auth.KeysFolder, cfg.Auth.ActiveKID, cfg.Auth.Algorithm, cfg.Auth.TokenTTL, cfg.Auth.Tenant, cfg.Args.Num(1), roles)
+	case "hashpw":
+		err = hashpw(cfg.Args.Num(1))
+	default:
+		err = errors.New("Must specify a command: migrate-authors, keygen, tokengen or hashpw")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// migrateAuthors links the books to author records, creating one record for
+// every author name however it is spelled.
+func migrateAuthors(uri, database, books, authors string, dialTimeout time.Duration) error {
+	client, err := mongo.NewClient(options.Client().ApplyURI(uri))
+	if err != nil {
+		return errors.Wrap(err, "creating mongo client")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+
+	if err := client.Connect(ctx); err != nil {
+		return errors.Wrap(err, "connecting to mongo")
+	}
+	defer client.Disconnect(context.Background())
+
+	as := author.NewMongoStore(client, database, authors)
+	if err := as.EnsureIndexes(ctx); err != nil {
+		return errors.Wrap(err, "creating author indexes")
+	}
+
+	// Migrating authors does not change ISBNs, it runs whether or not they
+	// are unique yet.
+	ps := product.NewMongoStore(client, database, books)
+	if err := ps.EnsureIndexes(ctx); err != nil && err != product.ErrDuplicateISBNs {
+		return errors.Wrap(err, "creating book indexes")
+	}
+
+	report, err := author.Migrate(context.Background(), as, ps, time.Now())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created %d authors, linked %d books", report.Authors, report.Linked)
+	if report.Skipped > 0 {
+		fmt.Printf(", skipped %d books changed during the migration, run it again to link them", report.Skipped)
+	}
+	fmt.Println()
+	return nil
+}
+
+// keygen adds a new RSA private key to the key set in the keys folder. The
+// key is named after a new key id.
+func keygen(folder string) error {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return errors.Wrap(err, "generating key")
+	}
+
+	kid := uuid.New().String()
+	path := filepath.Join(folder, kid+".pem")
+
+	privateFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.Wrap(err, "creating key file")
+	}
+	defer privateFile.Close()
+
+	privateBlock := pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	}
+	if err := pem.Encode(privateFile, &privateBlock); err != nil {
+		return errors.Wrap(err, "encoding key")
+	}
+
+	fmt.Printf("Created key %s in %s\n", kid, path)
+	return nil
+}
+
+// tokengen prints a token for the subject with the given roles, signed with
+// the active key and scoped to tenant when it is set. It makes the service
+// tokens of other programs, such as the bookstore-operator.
+func tokengen(folder, activeKID, algorithm string, ttl time.Duration, tenant, subject string, roles []string) error {
+	if subject == "" || len(roles) == 0 {
+		return errors.New("tokengen requires a subject and at least one role")
+	}
+
+	keys, err := auth.ReadKeys(folder)
+	if err != nil {
+		return err
+	}
+
+	kid, err := keys.Active(activeKID)
+	if err != nil {
+		return err
+	}
+
+	a, err := auth.New(algorithm, keys.Lookup, keys)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	claims := auth.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    "bookstore",
+			Subject:   subject,
+			ExpiresAt: now.Add(ttl).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		Roles:  roles,
+		Tenant: tenant,
+	}
+
+	token, err := a.GenerateToken(kid, claims)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(token)
+	return nil
+}
+
+// hashpw prints the bcrypt hash of a password for the users file of the
+// token endpoint.
+func hashpw(password string) error {
+	if password == "" {
+		return errors.New("hashpw requires a password")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.Wrap(err, "hashing password")
+	}
+
+	fmt.Println(string(hash))
+	return nil
+}
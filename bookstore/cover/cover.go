@@ -0,0 +1,221 @@
+// Package cover keeps the cover images of books, with thumbnails of them at
+// fixed sizes, in a blob store.
+package cover
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	_ "image/gif" // Register the GIF decoder.
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxSize caps the size in bytes of an uploaded image.
+	MaxSize = 5 << 20
+
+	// maxPixels caps the number of pixels of an uploaded image, so that a
+	// small file cannot take a lot of memory to decode.
+	maxPixels = 40 << 20
+
+	// Original names the uploaded image among the sizes of a cover.
+	Original = "original"
+)
+
+// Sizes are the thumbnails made of every cover, by name, as the length in
+// pixels of their longest side. Images that are smaller already are kept at
+// their size.
+var Sizes = map[string]int{
+	"small":  96,
+	"medium": 240,
+	"large":  480,
+}
+
+// types lists the image types a cover may have.
+var types = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// Predefined errors identify expected failure conditions.
+var (
+	// ErrNotFound is used when a book has no cover.
+	ErrNotFound = errors.New("cover not found")
+
+	// ErrTooLarge is used when an image is over MaxSize bytes or has too
+	// many pixels.
+	ErrTooLarge = errors.New("cover image is too large")
+
+	// ErrUnsupportedType is used when an image is not a JPEG, PNG or GIF.
+	ErrUnsupportedType = errors.New("cover must be a JPEG, PNG or GIF image")
+
+	// ErrInvalidImage is used when an image cannot be decoded.
+	ErrInvalidImage = errors.New("cover image cannot be decoded")
+
+	// ErrInvalidSize is used when a size is neither Original nor one of
+	// Sizes.
+	ErrInvalidSize = errors.New("cover size is unknown")
+)
+
+// Blob is one stored image of a cover, keyed by the ID of its book and its
+// size.
+type Blob struct {
+	Key          string
+	ContentType  string
+	Data         []byte
+	DateModified time.Time
+}
+
+// ETag returns the entity tag of the content of the Blob.
+func (b *Blob) ETag() string {
+	sum := sha256.Sum256(b.Data)
+	return strconv.Quote(hex.EncodeToString(sum[:16]))
+}
+
+// Cover describes the cover of a book as it was uploaded.
+type Cover struct {
+	ContentType  string    `json:"content_type"`
+	Size         int       `json:"size"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	Sizes        []string  `json:"sizes"`
+	DateUploaded time.Time `json:"date_uploaded"`
+}
+
+// Key returns the key of the image of the given size of the cover of a book.
+func Key(productID, size string) string {
+	return productID + "/" + size
+}
+
+// Upload stores data as the cover of the book with the given ID, replacing
+// the cover it had, and makes its thumbnails. The image must be a JPEG, PNG
+// or GIF, which is told from its content.
+func Upload(ctx context.Context, s Store, productID string, data []byte, now time.Time) (*Cover, error) {
+	if len(data) > MaxSize {
+		return nil, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	if !types[contentType] {
+		return nil, ErrUnsupportedType
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	now = now.UTC()
+	c := Cover{
+		ContentType:  contentType,
+		Size:         len(data),
+		Width:        cfg.Width,
+		Height:       cfg.Height,
+		DateUploaded: now,
+	}
+
+	// Thumbnails are made from the next larger one, which is much faster
+	// than making each from the original. The original is stored last so
+	// that a cover is only served once all of it is stored.
+	names := make([]string, 0, len(Sizes))
+	for name := range Sizes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return Sizes[names[i]] > Sizes[names[j]] })
+
+	thumb := img
+	for _, name := range names {
+		thumb = thumbnail(thumb, Sizes[name])
+
+		b, err := encode(thumb, contentType)
+		if err != nil {
+			return nil, errors.Wrapf(err, "encoding %s thumbnail", name)
+		}
+		b.Key = Key(productID, name)
+		b.DateModified = now
+
+		if err := s.Put(ctx, *b); err != nil {
+			return nil, errors.Wrapf(err, "storing %s thumbnail", name)
+		}
+		c.Sizes = append(c.Sizes, name)
+	}
+
+	original := Blob{
+		Key:          Key(productID, Original),
+		ContentType:  contentType,
+		Data:         data,
+		DateModified: now,
+	}
+	if err := s.Put(ctx, original); err != nil {
+		return nil, errors.Wrap(err, "storing cover")
+	}
+
+	sort.Strings(c.Sizes)
+	return &c, nil
+}
+
+// Open returns the image of the given size of the cover of the book with
+// the given ID. An empty size is the Original.
+func Open(ctx context.Context, s Store, productID, size string) (*Blob, error) {
+	if size == "" {
+		size = Original
+	}
+	if _, ok := Sizes[size]; !ok && size != Original {
+		return nil, ErrInvalidSize
+	}
+
+	return s.Get(ctx, Key(productID, size))
+}
+
+// Remove deletes the cover of the book with the given ID with all its
+// thumbnails. Removing a missing cover is not an error.
+func Remove(ctx context.Context, s Store, productID string) error {
+	if err := s.Delete(ctx, Key(productID, Original)); err != nil {
+		return errors.Wrap(err, "deleting cover")
+	}
+
+	for name := range Sizes {
+		if err := s.Delete(ctx, Key(productID, name)); err != nil {
+			return errors.Wrapf(err, "deleting %s thumbnail", name)
+		}
+	}
+
+	return nil
+}
+
+// encode encodes a thumbnail as a JPEG for JPEG covers and as a PNG for the
+// others, which may be transparent.
+func encode(img image.Image, contentType string) (*Blob, error) {
+	var buf bytes.Buffer
+
+	if contentType == "image/jpeg" {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, err
+		}
+		return &Blob{ContentType: contentType, Data: buf.Bytes()}, nil
+	}
+
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return &Blob{ContentType: "image/png", Data: buf.Bytes()}, nil
+}
@@ -0,0 +1,147 @@
+package cover
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+)
+
+// testPNG returns a PNG image of the given size.
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUpload(t *testing.T) {
+	stores := map[string]Store{
+		"memory": NewMemoryStore(),
+		"file":   NewFileStore(t.TempDir()),
+	}
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			testUpload(t, s)
+		})
+	}
+}
+
+func testUpload(t *testing.T, s Store) {
+	ctx := context.Background()
+	id := "0b0e4f5a-6b5e-4e57-9b5c-2c7b0ec1e0a1"
+	now := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+	data := testPNG(t, 600, 300)
+
+	c, err := Upload(ctx, s, id, data, now)
+	if err != nil {
+		t.Fatalf("uploading: %s", err)
+	}
+	if c.ContentType != "image/png" || c.Width != 600 || c.Height != 300 || c.Size != len(data) {
+		t.Errorf("unexpected cover %+v", c)
+	}
+
+	original, err := Open(ctx, s, id, "")
+	if err != nil {
+		t.Fatalf("opening original: %s", err)
+	}
+	if !bytes.Equal(original.Data, data) {
+		t.Error("expected the original to be the uploaded image")
+	}
+	if !original.DateModified.Equal(now) {
+		t.Errorf("expected original modified at %v, got %v", now, original.DateModified)
+	}
+
+	// Thumbnails keep the aspect ratio and are never larger than the image.
+	for size, w := range map[string]int{"small": 96, "medium": 240, "large": 480} {
+		b, err := Open(ctx, s, id, size)
+		if err != nil {
+			t.Fatalf("opening %s: %s", size, err)
+		}
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(b.Data))
+		if err != nil {
+			t.Fatalf("decoding %s: %s", size, err)
+		}
+		if cfg.Width != w || cfg.Height != w/2 {
+			t.Errorf("%s: expected %dx%d, got %dx%d", size, w, w/2, cfg.Width, cfg.Height)
+		}
+		if b.ETag() == original.ETag() {
+			t.Errorf("%s: expected an ETag of its own", size)
+		}
+	}
+
+	if _, err := Open(ctx, s, id, "huge"); err != ErrInvalidSize {
+		t.Errorf("expected %v opening an unknown size, got %v", ErrInvalidSize, err)
+	}
+
+	small := testPNG(t, 50, 80)
+	if _, err := Upload(ctx, s, id, small, now.Add(time.Hour)); err != nil {
+		t.Fatalf("replacing: %s", err)
+	}
+	b, err := Open(ctx, s, id, "large")
+	if err != nil {
+		t.Fatalf("opening replaced thumbnail: %s", err)
+	}
+	if cfg, _, _ := image.DecodeConfig(bytes.NewReader(b.Data)); cfg.Width != 50 || cfg.Height != 80 {
+		t.Errorf("expected an image smaller than a thumbnail to keep its size, got %dx%d", cfg.Width, cfg.Height)
+	}
+
+	if err := Remove(ctx, s, id); err != nil {
+		t.Fatalf("removing: %s", err)
+	}
+	for _, size := range []string{Original, "small", "medium", "large"} {
+		if _, err := Open(ctx, s, id, size); err != ErrNotFound {
+			t.Errorf("expected %v opening removed %s, got %v", ErrNotFound, size, err)
+		}
+	}
+	if err := Remove(ctx, s, id); err != nil {
+		t.Errorf("removing again: %s", err)
+	}
+}
+
+func TestUploadRejects(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"text", []byte("not an image at all"), ErrUnsupportedType},
+		{"truncated", testPNG(t, 20, 20)[:40], ErrInvalidImage},
+		{"too large", append(testPNG(t, 20, 20), make([]byte, MaxSize)...), ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		if _, err := Upload(ctx, s, "book", tt.data, now); err != tt.err {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestFileStoreKeys(t *testing.T) {
+	s := NewFileStore(t.TempDir())
+	ctx := context.Background()
+
+	for _, key := range []string{"../x", "a/../../x", "a/.tmp-1", "a", "a/b/c", `a\b/c`} {
+		if err := s.Put(ctx, Blob{Key: key, Data: []byte("x")}); err == nil {
+			t.Errorf("expected key %q to be rejected", key)
+		}
+	}
+}
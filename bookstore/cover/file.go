@@ -0,0 +1,133 @@
+package cover
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FileStore is a Store that keeps blobs as files in a folder of the local
+// filesystem, with a folder per book. The content type of a Blob is told
+// from its content and its DateModified is the modification time of its file.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a FileStore keeping blobs in dir, which is created on
+// first use.
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+// Put writes a Blob to a temporary file that then replaces the file of its
+// key, so that readers never see a partly written Blob.
+func (s *FileStore) Put(ctx context.Context, b Blob) error {
+	path, err := s.path(b.Key)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.Wrap(err, "creating blob folder")
+	}
+
+	f, err := ioutil.TempFile(dir, ".tmp-")
+	if err != nil {
+		return errors.Wrap(err, "creating blob file")
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b.Data); err != nil {
+		f.Close()
+		return errors.Wrap(err, "writing blob file")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "writing blob file")
+	}
+
+	if err := os.Chtimes(f.Name(), b.DateModified, b.DateModified); err != nil {
+		return errors.Wrap(err, "dating blob file")
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return errors.Wrap(err, "replacing blob file")
+	}
+
+	return nil
+}
+
+// Get reads the file of the Blob with the given key.
+func (s *FileStore) Get(ctx context.Context, key string) (*Blob, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrapf(err, "opening blob %q", key)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading blob %q", key)
+	}
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading blob %q", key)
+	}
+
+	b := Blob{
+		Key:          key,
+		ContentType:  http.DetectContentType(data),
+		Data:         data,
+		DateModified: info.ModTime().UTC(),
+	}
+
+	return &b, nil
+}
+
+// Delete removes the file of the Blob with the given key, and the folder of
+// its book once it is empty.
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "deleting blob %q", key)
+	}
+
+	// Removing a folder that still has files fails, which is fine.
+	os.Remove(filepath.Dir(path))
+
+	return nil
+}
+
+// path returns the path of the file of a key. Keys are made of a folder and
+// a file name that stay inside the folder of the store and cannot be taken
+// for the temporary files of Put.
+func (s *FileStore) path(key string) (string, error) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 2 {
+		return "", errors.Errorf("invalid blob key %q", key)
+	}
+	for _, p := range parts {
+		if p == "" || strings.HasPrefix(p, ".") || strings.Contains(p, `\`) {
+			return "", errors.Errorf("invalid blob key %q", key)
+		}
+	}
+
+	return filepath.Join(s.dir, parts[0], parts[1]), nil
+}
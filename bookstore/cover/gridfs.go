@@ -0,0 +1,136 @@
+package cover
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GridFSStore is a Store backed by a MongoDB GridFS bucket. The key of a Blob
+// doubles as the _id and the name of its file, and its DateModified is the
+// upload date of the file.
+type GridFSStore struct {
+	database *mongo.Database
+	bucket   string
+}
+
+// file is the part of a GridFS file document a Blob is read from.
+type file struct {
+	UploadDate time.Time `bson:"uploadDate"`
+	Metadata   struct {
+		ContentType string `bson:"contenttype"`
+	} `bson:"metadata"`
+}
+
+// NewGridFSStore returns a Store that keeps blobs in the named database and
+// GridFS bucket of the provided client.
+func NewGridFSStore(client *mongo.Client, database, bucket string) *GridFSStore {
+	return &GridFSStore{
+		database: client.Database(database),
+		bucket:   bucket,
+	}
+}
+
+// Put uploads a Blob after deleting the file with its key. GridFS files
+// cannot be replaced in place.
+func (s *GridFSStore) Put(ctx context.Context, b Blob) error {
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := bucket.Delete(b.Key); err != nil && err != gridfs.ErrFileNotFound {
+		return errors.Wrapf(err, "replacing blob %q", b.Key)
+	}
+
+	opts := options.GridFSUpload().SetMetadata(bson.M{"contenttype": b.ContentType})
+	if err := bucket.UploadFromStreamWithID(b.Key, b.Key, bytes.NewReader(b.Data), opts); err != nil {
+		return errors.Wrapf(err, "uploading blob %q", b.Key)
+	}
+
+	return nil
+}
+
+// Get downloads the Blob with the given key.
+func (s *GridFSStore) Get(ctx context.Context, key string) (*Blob, error) {
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := bucket.Find(bson.M{"_id": key})
+	if err != nil {
+		return nil, errors.Wrapf(err, "finding blob %q", key)
+	}
+	defer cursor.Close(ctx)
+
+	if !cursor.Next(ctx) {
+		if err := cursor.Err(); err != nil {
+			return nil, errors.Wrapf(err, "finding blob %q", key)
+		}
+		return nil, ErrNotFound
+	}
+
+	var f file
+	if err := cursor.Decode(&f); err != nil {
+		return nil, errors.Wrapf(err, "decoding blob %q", key)
+	}
+
+	var buf bytes.Buffer
+	if _, err := bucket.DownloadToStream(key, &buf); err != nil {
+		if err == gridfs.ErrFileNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrapf(err, "downloading blob %q", key)
+	}
+
+	b := Blob{
+		Key:          key,
+		ContentType:  f.Metadata.ContentType,
+		Data:         buf.Bytes(),
+		DateModified: f.UploadDate.UTC(),
+	}
+
+	return &b, nil
+}
+
+// Delete removes the file of the Blob with the given key.
+func (s *GridFSStore) Delete(ctx context.Context, key string) error {
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := bucket.Delete(key); err != nil && err != gridfs.ErrFileNotFound {
+		return errors.Wrapf(err, "deleting blob %q", key)
+	}
+
+	return nil
+}
+
+// open returns a Bucket for one operation, as a Bucket is not safe for
+// concurrent use. GridFS takes deadlines instead of contexts, so the
+// deadline of ctx is applied to it.
+func (s *GridFSStore) open(ctx context.Context) (*gridfs.Bucket, error) {
+	bucket, err := gridfs.NewBucket(s.database, options.GridFSBucket().SetName(s.bucket))
+	if err != nil {
+		return nil, errors.Wrap(err, "opening gridfs bucket")
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := bucket.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+		if err := bucket.SetWriteDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	return bucket, nil
+}
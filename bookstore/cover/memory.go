@@ -0,0 +1,56 @@
+package cover
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore is a Store that keeps blobs in process memory. It is safe for
+// concurrent use and is intended for tests and for running the service
+// without a database.
+type MemoryStore struct {
+	mu    sync.Mutex
+	blobs map[string]Blob
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		blobs: make(map[string]Blob),
+	}
+}
+
+// Put adds a Blob or replaces the Blob with its key.
+func (s *MemoryStore) Put(ctx context.Context, b Blob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b.Data = append([]byte(nil), b.Data...)
+	s.blobs[b.Key] = b
+
+	return nil
+}
+
+// Get returns a copy of the Blob with the given key.
+func (s *MemoryStore) Get(ctx context.Context, key string) (*Blob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.blobs[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	b.Data = append([]byte(nil), b.Data...)
+
+	return &b, nil
+}
+
+// Delete removes the Blob with the given key.
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.blobs, key)
+
+	return nil
+}
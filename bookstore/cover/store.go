@@ -0,0 +1,20 @@
+package cover
+
+import "context"
+
+// Store is the blob store behind the cover functions. Keys are made by Key
+// and contain a single slash. Covers follow the trash retention of their
+// books: they are kept while a book is in the trash and removed with Remove
+// once it is purged.
+type Store interface {
+
+	// Put stores a Blob, replacing the Blob with its key.
+	Put(ctx context.Context, b Blob) error
+
+	// Get returns the Blob with the given key or ErrNotFound.
+	Get(ctx context.Context, key string) (*Blob, error)
+
+	// Delete removes the Blob with the given key. Removing a missing Blob
+	// is not an error.
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,62 @@
+package cover
+
+import (
+	"image"
+	"image/color"
+)
+
+// thumbnail scales img down to fit in a square of side px, keeping its
+// aspect ratio. Each pixel of the thumbnail is the average of the pixels of
+// img it covers. Images that fit already are returned as they are.
+func thumbnail(img image.Image, px int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= px && h <= px {
+		return img
+	}
+
+	tw, th := px, px
+	if w > h {
+		th = h * px / w
+	} else {
+		tw = w * px / h
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+
+			// RGBA returns alpha-premultiplied values, which average
+			// correctly across transparent pixels.
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r += uint64(pr)
+					g += uint64(pg)
+					bl += uint64(pb)
+					a += uint64(pa)
+					n++
+				}
+			}
+
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
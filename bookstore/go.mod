@@ -3,9 +3,12 @@ module www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/books
 go 1.15
 
 require (
+	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	github.com/evanphx/json-patch v4.9.0+incompatible
 	github.com/go-chi/chi v1.5.1
 	github.com/go-playground/locales v0.13.0
 	github.com/go-playground/universal-translator v0.17.0
+	github.com/golang/protobuf v1.4.3
 	github.com/google/go-cmp v0.5.4
 	github.com/google/uuid v1.1.2
 	github.com/leodido/go-urn v1.2.1 // indirect
@@ -13,6 +16,9 @@ require (
 	github.com/prometheus/client_golang v1.9.0
 	github.com/struCoder/pidusage v0.1.3
 	go.mongodb.org/mongo-driver v1.4.4
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	google.golang.org/grpc v1.35.0
+	google.golang.org/protobuf v1.25.0
 	gopkg.in/go-playground/assert.v1 v1.2.1 // indirect
 	gopkg.in/go-playground/validator.v9 v9.31.0
 )
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// Authenticate validates a JWT from the `Authorization` header.
+func Authenticate(a *auth.Auth) product.Middleware {
+
+	// This is the actual middleware function to be executed.
+	f := func(before product.Handler) product.Handler {
+
+		// Wrap this handler around the next one provided.
+		h := func(w http.ResponseWriter, r *http.Request) error {
+
+			// Expecting: bearer <token>
+			parts := strings.Split(r.Header.Get("Authorization"), " ")
+			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+				err := errors.New("expected authorization header format: bearer <token>")
+				return NewRequestError(err, http.StatusUnauthorized)
+			}
+
+			// Validate the token is signed by us.
+			claims, err := a.ValidateToken(parts[1])
+			if err != nil {
+				return NewRequestError(err, http.StatusUnauthorized)
+			}
+
+			// Add claims to the context so they can be retrieved later, and
+			// record the changes of the request as made by the subject.
+			ctx := context.WithValue(r.Context(), auth.Key, claims)
+			ctx = product.WithActor(ctx, claims.Subject)
+
+			return before(w, r.WithContext(ctx))
+		}
+
+		return h
+	}
+
+	return f
+}
+
+// Authorize validates that an authenticated user has at least one role from a
+// specified list. It must run after Authenticate.
+func Authorize(roles ...string) product.Middleware {
+
+	// This is the actual middleware function to be executed.
+	f := func(before product.Handler) product.Handler {
+
+		// Wrap this handler around the next one provided.
+		h := func(w http.ResponseWriter, r *http.Request) error {
+			claims, ok := claimsOf(r)
+			if !ok {
+				return errors.New("claims missing from context: Authorize called without Authenticate")
+			}
+
+			if !claims.Authorized(roles...) {
+				err := fmt.Errorf("you are not authorized for that action: requires one of %v", roles)
+				return NewRequestError(err, http.StatusForbidden)
+			}
+
+			return before(w, r)
+		}
+
+		return h
+	}
+
+	return f
+}
+
+// claimsOf returns the claims Authenticate stored on the request.
+func claimsOf(r *http.Request) (auth.Claims, bool) {
+	claims, ok := r.Context().Value(auth.Key).(auth.Claims)
+	return claims, ok
+}
+
+// Tokens issues tokens to the configured users.
+type Tokens struct {
+	Auth  *auth.Auth
+	KID   string
+	TTL   time.Duration
+	Users auth.Users
+	Log   *log.Logger
+}
+
+// Token issues a token signed with the active key to the user named by the
+// Basic auth credentials of the request. The token carries the roles and the
+// tenant of the user and expires after the configured TTL.
+func (t *Tokens) Token(w http.ResponseWriter, r *http.Request) error {
+	name, pass, ok := r.BasicAuth()
+	if !ok {
+		err := errors.New("must provide user name and password in Basic auth")
+		return NewRequestError(err, http.StatusUnauthorized)
+	}
+
+	user, err := t.Users.Authenticate(name, pass)
+	if err != nil {
+		switch err {
+		case auth.ErrAuthenticationFailure:
+			return NewRequestError(err, http.StatusUnauthorized)
+		default:
+			return errors.Wrap(err, "authenticating")
+		}
+	}
+
+	now := time.Now()
+	claims := auth.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    "bookstore",
+			Subject:   name,
+			ExpiresAt: now.Add(t.TTL).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		Roles:  user.Roles,
+		Tenant: user.Tenant,
+	}
+
+	var tkn struct {
+		Token string `json:"token"`
+	}
+	tkn.Token, err = t.Auth.GenerateToken(t.KID, claims)
+	if err != nil {
+		return errors.Wrap(err, "generating token")
+	}
+
+	return Respond(w, tkn, http.StatusOK)
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/author"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// Authors holds the logic related to Authors.
+type Authors struct {
+	DB       author.Store
+	Products product.Store
+	Log      *log.Logger
+}
+
+// List gets a page of Authors in name order. limit sets the page size and a
+// Link header with rel="next" points at the next page like for books.
+func (a *Authors) List(w http.ResponseWriter, r *http.Request) error {
+	limit, err := pageLimit(r)
+	if err != nil {
+		return err
+	}
+
+	q := author.Query{
+		Limit:  limit,
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+
+	list, next, err := author.List(r.Context(), a.DB, q)
+	if err != nil {
+		switch err {
+		case author.ErrInvalidCursor:
+			return NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "getting author list")
+		}
+	}
+
+	if next != "" {
+		setNextLink(w, r, next)
+	}
+
+	return Respond(w, list, http.StatusOK)
+}
+
+// Retrieve gets a single Author from the database.
+func (a *Authors) Retrieve(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	au, err := author.Retrieve(r.Context(), a.DB, id)
+	if err != nil {
+		return authorError(err, id)
+	}
+
+	return Respond(w, au, http.StatusOK)
+}
+
+// Create decodes the body of a request to create a new Author. Answers 409
+// Conflict when the name is another spelling of an existing Author.
+func (a *Authors) Create(w http.ResponseWriter, r *http.Request) error {
+	var na author.NewAuthor
+	if err := Decode(r, &na); err != nil {
+		return errors.Wrap(err, "decoding author")
+	}
+
+	au, err := author.Create(r.Context(), a.DB, na, time.Now())
+	if err != nil {
+		switch err {
+		case author.ErrInvalidName:
+			return NewRequestError(err, http.StatusBadRequest)
+		case author.ErrDuplicate:
+			return NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrap(err, "creating author")
+		}
+	}
+
+	return Respond(w, au, http.StatusCreated)
+}
+
+// Update decodes the body of a request to rename an Author. The books of the
+// Author are renamed with it.
+func (a *Authors) Update(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	var ua author.UpdateAuthor
+	if err := Decode(r, &ua); err != nil {
+		return errors.Wrap(err, "decoding author update")
+	}
+
+	au, err := author.Update(r.Context(), a.DB, a.Products, id, ua, time.Now())
+	if err != nil {
+		return authorError(err, id)
+	}
+
+	return Respond(w, au, http.StatusOK)
+}
+
+// Delete removes an Author. Answers 409 Conflict while books still reference
+// it.
+func (a *Authors) Delete(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	if err := author.Delete(r.Context(), a.DB, a.Products, id); err != nil {
+		return authorError(err, id)
+	}
+
+	return Respond(w, nil, http.StatusNoContent)
+}
+
+// Books lists the books of an Author. It takes the same filter, sort and
+// paging query parameters as the book list.
+func (a *Authors) Books(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	if _, err := author.Retrieve(r.Context(), a.DB, id); err != nil {
+		return authorError(err, id)
+	}
+
+	q := listQuery(r)
+	q.AuthorID = id
+
+	limit, err := pageLimit(r)
+	if err != nil {
+		return err
+	}
+	q.Limit = limit
+
+	list, next, err := product.List(r.Context(), a.Products, q)
+	if err != nil {
+		switch err {
+		case product.ErrInvalidSort, product.ErrInvalidCursor, product.ErrInvalidISBN:
+			return NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "getting books of author %q", id)
+		}
+	}
+
+	if next != "" {
+		setNextLink(w, r, next)
+	}
+
+	return Respond(w, list, http.StatusOK)
+}
+
+// authorError maps the errors of the author functions for the Author with
+// the given ID to responses.
+func authorError(err error, id string) error {
+	switch err {
+	case author.ErrNotFound:
+		return NewRequestError(err, http.StatusNotFound)
+	case author.ErrInvalidID, author.ErrInvalidName:
+		return NewRequestError(err, http.StatusBadRequest)
+	case author.ErrDuplicate, author.ErrHasBooks:
+		return NewRequestError(err, http.StatusConflict)
+	default:
+		return errors.Wrapf(err, "author %q", id)
+	}
+}
+
+// authorLinker links the authors of books like author.Linker, answering 400
+// Bad Request for author IDs that do not name an Author.
+type authorLinker struct {
+	*author.Linker
+}
+
+func newAuthorLinker(db author.Store) *authorLinker {
+	return &authorLinker{author.NewLinker(db)}
+}
+
+// link returns the author ID and name a book should be stored with.
+func (l *authorLinker) link(ctx context.Context, id, name string, now time.Time) (string, string, error) {
+	id, name, err := l.Link(ctx, id, name, now)
+	if err != nil {
+		return "", "", linkError(err)
+	}
+	return id, name, nil
+}
+
+// linkUpdate links the author of a book update.
+func (l *authorLinker) linkUpdate(ctx context.Context, update *product.UpdateProduct, now time.Time) error {
+	if err := l.LinkUpdate(ctx, update, now); err != nil {
+		return linkError(err)
+	}
+	return nil
+}
+
+// linkError maps the errors of linking an author to responses.
+func linkError(err error) error {
+	switch err {
+	case author.ErrNotFound, author.ErrInvalidID:
+		return NewRequestError(err, http.StatusBadRequest)
+	default:
+		return errors.Wrap(err, "linking author")
+	}
+}
@@ -0,0 +1,521 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// Media types accepted by Import and produced by Export.
+const (
+	mediaCSV    = "text/csv"
+	mediaNDJSON = "application/x-ndjson"
+)
+
+const (
+	// importBatchSize is the number of valid rows written per InsertMany.
+	importBatchSize = 500
+
+	// maxImportBytes caps the size of an import body.
+	maxImportBytes = 64 << 20
+
+	// exportFlushRows is how many rows are written between flushes of the
+	// response so the client receives the export as it is produced.
+	exportFlushRows = 100
+)
+
+// productColumns are the CSV columns written by Export.
+var productColumns = []string{"id", "name", "author", "author_id", "isbn", "genre", "price", "currency", "stock", "reserved", "rating", "review_count", "revision", "date_created", "date_updated"}
+
+// readOnlyColumns are Product fields that Import accepts and ignores so an
+// export can be imported again. New IDs, revisions and dates are assigned, no
+// copies are reserved and there are no reviews yet.
+var readOnlyColumns = map[string]bool{
+	"id":           true,
+	"reserved":     true,
+	"rating":       true,
+	"review_count": true,
+	"revision":     true,
+	"date_created": true,
+	"date_updated": true,
+}
+
+// ImportReport summarizes a bulk import.
+type ImportReport struct {
+	Imported int             `json:"imported"`
+	Failed   int             `json:"failed"`
+	Failures []ImportFailure `json:"failures,omitempty"`
+}
+
+// ImportFailure describes a row of an import that was not created. Rows are
+// numbered from 1 and do not count the CSV header or blank NDJSON lines.
+type ImportFailure struct {
+	Row    int          `json:"row"`
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// fail records a failed row in the report.
+func (ir *ImportReport) fail(row int, err error, fields []FieldError) {
+	ir.Failed++
+	ir.Failures = append(ir.Failures, ImportFailure{
+		Row:    row,
+		Error:  err.Error(),
+		Fields: fields,
+	})
+}
+
+// Import creates books in bulk from a CSV (text/csv) or NDJSON
+// (application/x-ndjson) body. Every row is validated like a POST /books body
+// and valid rows are written in batches. Invalid rows do not stop the import,
+// they are listed in the returned report. Authors are linked like on POST
+// /books, each distinct author is looked up once.
+func (p *Products) Import(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	rows, err := newRowReader(r)
+	if err != nil {
+		return err
+	}
+
+	authors := newAuthorLinker(p.Authors)
+
+	var report ImportReport
+	var batch []product.NewProduct
+	var batchRows []int
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		created, err := product.CreateMany(r.Context(), p.DB, batch, time.Now())
+		if err != nil {
+			berr, ok := err.(*product.BatchError)
+			if !ok {
+				return errors.Wrap(err, "importing products")
+			}
+			for i, err := range berr.Failed {
+				report.fail(batchRows[i], err, nil)
+			}
+		}
+		report.Imported += len(created)
+
+		batch = batch[:0]
+		batchRows = batchRows[:0]
+		return nil
+	}
+
+	for row := 1; ; row++ {
+		np, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if rerr, ok := err.(*rowError); ok {
+				report.fail(row, rerr.err, nil)
+				continue
+			}
+			return NewRequestError(errors.Wrap(err, "reading import body"), http.StatusBadRequest)
+		}
+
+		if err := Validate(&np); err != nil {
+			if verr, ok := err.(*Error); ok {
+				report.fail(row, verr.Err, verr.Fields)
+				continue
+			}
+			return err
+		}
+
+		np.AuthorID, np.Author, err = authors.link(r.Context(), np.AuthorID, np.Author, time.Now())
+		if err != nil {
+			if verr, ok := err.(*Error); ok {
+				report.fail(row, verr.Err, nil)
+				continue
+			}
+			return err
+		}
+
+		batch = append(batch, np)
+		batchRows = append(batchRows, row)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	sort.Slice(report.Failures, func(i, j int) bool {
+		return report.Failures[i].Row < report.Failures[j].Row
+	})
+
+	return Respond(w, report, http.StatusOK)
+}
+
+// Export streams the books matching the same filters and sort as List, as CSV
+// or NDJSON. The format query parameter ("csv" or "ndjson") picks the format,
+// otherwise an Accept header of text/csv selects CSV and NDJSON is the
+// default. Books are read through a database cursor and written as they
+// arrive, the whole catalog is never held in memory.
+func (p *Products) Export(w http.ResponseWriter, r *http.Request) error {
+	format, err := exportFormat(r)
+	if err != nil {
+		return err
+	}
+
+	q := listQuery(r)
+
+	var ew exportWriter
+	switch format {
+	case mediaCSV:
+		ew = newCSVExport(w)
+	default:
+		ew = newNDJSONExport(w)
+	}
+
+	flusher, _ := w.(http.Flusher)
+
+	// The status is only sent with the first book so that an invalid query
+	// can still be answered with an error response.
+	var started bool
+	start := func() error {
+		started = true
+
+		ext := "ndjson"
+		if format == mediaCSV {
+			ext = "csv"
+		}
+		w.Header().Set("Content-Type", format+"; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="books.`+ext+`"`)
+		w.WriteHeader(http.StatusOK)
+		return ew.header()
+	}
+
+	var n int
+	err = product.Walk(r.Context(), p.DB, q, func(prod product.Product) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		if err := ew.write(prod); err != nil {
+			return err
+		}
+
+		n++
+		if n%exportFlushRows == 0 {
+			if err := ew.flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	})
+
+	if err != nil && !started {
+		switch err {
+		case product.ErrInvalidSort, product.ErrInvalidISBN:
+			return NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "exporting products")
+		}
+	}
+
+	if err != nil {
+		// The status line is already sent, all that can be done is to cut the
+		// body short and log why.
+		p.Log.Printf("ERROR: exporting products after %d rows: %+v", n, err)
+		return nil
+	}
+
+	if !started {
+		if err := start(); err != nil {
+			return err
+		}
+	}
+
+	return ew.flush()
+}
+
+// exportFormat picks the media type of an export.
+func exportFormat(r *http.Request) (string, error) {
+	switch r.URL.Query().Get("format") {
+	case "csv":
+		return mediaCSV, nil
+	case "ndjson":
+		return mediaNDJSON, nil
+	case "":
+	default:
+		err := errors.New(`format must be "csv" or "ndjson"`)
+		return "", NewRequestError(err, http.StatusBadRequest)
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), mediaCSV) {
+		return mediaCSV, nil
+	}
+	return mediaNDJSON, nil
+}
+
+// =============================================================================
+
+// rowError is a problem with a single import row. Reading can continue with
+// the next row.
+type rowError struct {
+	err error
+}
+
+func (e *rowError) Error() string {
+	return e.err.Error()
+}
+
+// rowReader yields the rows of an import body one at a time. next returns
+// io.EOF after the last row.
+type rowReader interface {
+	next() (product.NewProduct, error)
+}
+
+// newRowReader returns the reader for the body format named by the request
+// Content-Type.
+func newRowReader(r *http.Request) (rowReader, error) {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mt = ""
+	}
+
+	switch mt {
+	case mediaCSV:
+		return newCSVRows(r.Body)
+	case mediaNDJSON, "application/ndjson":
+		return newNDJSONRows(r.Body), nil
+	}
+
+	err = errors.Errorf("import body must be %s or %s", mediaCSV, mediaNDJSON)
+	return nil, NewRequestError(err, http.StatusUnsupportedMediaType)
+}
+
+// csvRows reads import rows from CSV with a header naming the columns.
+type csvRows struct {
+	r       *csv.Reader
+	columns []string
+}
+
+func newCSVRows(body io.Reader) (*csvRows, error) {
+	r := csv.NewReader(body)
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		if err == io.EOF {
+			err = errors.New("CSV body has no header row")
+		}
+		return nil, NewRequestError(err, http.StatusBadRequest)
+	}
+
+	seen := make(map[string]bool)
+	columns := make([]string, len(header))
+	for i, h := range header {
+		name := strings.ToLower(strings.TrimSpace(h))
+		switch {
+		case seen[name]:
+			err = errors.Errorf("CSV column %q appears more than once", name)
+		case name == "name", name == "author", name == "author_id", name == "isbn", name == "genre",
+			name == "price", name == "currency", name == "stock", readOnlyColumns[name]:
+		default:
+			err = errors.Errorf("unknown CSV column %q", h)
+		}
+		if err != nil {
+			return nil, NewRequestError(err, http.StatusBadRequest)
+		}
+		seen[name] = true
+		columns[i] = name
+	}
+
+	if !seen["name"] {
+		err := errors.New(`CSV header must have a "name" column`)
+		return nil, NewRequestError(err, http.StatusBadRequest)
+	}
+
+	return &csvRows{r: r, columns: columns}, nil
+}
+
+func (c *csvRows) next() (product.NewProduct, error) {
+	var np product.NewProduct
+
+	rec, err := c.r.Read()
+	if err != nil {
+		if perr, ok := err.(*csv.ParseError); ok {
+			return np, &rowError{perr.Err}
+		}
+		return np, err
+	}
+
+	for i, v := range rec {
+		switch c.columns[i] {
+		case "name":
+			np.Name = v
+		case "author":
+			np.Author = v
+		case "author_id":
+			np.AuthorID = v
+		case "isbn":
+			np.ISBN = v
+		case "genre":
+			np.Genre = v
+		case "currency":
+			np.Currency = v
+		case "price":
+			if np.Price, err = parseAmount(v); err != nil {
+				return np, &rowError{errors.Wrap(err, "price")}
+			}
+		case "stock":
+			stock, err := parseAmount(v)
+			if err != nil {
+				return np, &rowError{errors.Wrap(err, "stock")}
+			}
+			np.Stock = int(stock)
+		}
+	}
+
+	return np, nil
+}
+
+// parseAmount reads a whole number CSV cell, an empty cell is zero.
+func parseAmount(v string) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// ndjsonRows reads import rows from newline delimited JSON objects.
+type ndjsonRows struct {
+	s *bufio.Scanner
+}
+
+func newNDJSONRows(body io.Reader) *ndjsonRows {
+	s := bufio.NewScanner(body)
+	s.Buffer(make([]byte, 64*1024), 1<<20)
+	return &ndjsonRows{s: s}
+}
+
+func (n *ndjsonRows) next() (product.NewProduct, error) {
+
+	// row accepts the read-only fields of an exported Product next to the
+	// NewProduct fields and ignores them.
+	var row struct {
+		product.NewProduct
+		ID          json.RawMessage `json:"id"`
+		Reserved    json.RawMessage `json:"reserved"`
+		Rating      json.RawMessage `json:"rating"`
+		ReviewCount json.RawMessage `json:"review_count"`
+		Revision    json.RawMessage `json:"revision"`
+		DateCreated json.RawMessage `json:"date_created"`
+		DateUpdated json.RawMessage `json:"date_updated"`
+	}
+
+	for n.s.Scan() {
+		line := bytes.TrimSpace(n.s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&row); err != nil {
+			return row.NewProduct, &rowError{err}
+		}
+		return row.NewProduct, nil
+	}
+
+	if err := n.s.Err(); err != nil {
+		return product.NewProduct{}, err
+	}
+	return product.NewProduct{}, io.EOF
+}
+
+// =============================================================================
+
+// exportWriter writes Products in one export format.
+type exportWriter interface {
+	header() error
+	write(p product.Product) error
+	flush() error
+}
+
+// csvExport writes Products as CSV with a header row.
+type csvExport struct {
+	w *csv.Writer
+}
+
+func newCSVExport(w io.Writer) *csvExport {
+	return &csvExport{w: csv.NewWriter(w)}
+}
+
+func (c *csvExport) header() error {
+	return c.w.Write(productColumns)
+}
+
+func (c *csvExport) write(p product.Product) error {
+	return c.w.Write([]string{
+		p.ID,
+		p.Name,
+		p.Author,
+		p.AuthorID,
+		p.ISBN,
+		p.Genre,
+		strconv.FormatInt(p.Price, 10),
+		p.Currency,
+		strconv.Itoa(p.Stock),
+		strconv.Itoa(p.Reserved),
+		strconv.FormatFloat(p.Rating, 'f', -1, 64),
+		strconv.Itoa(p.ReviewCount),
+		strconv.Itoa(p.Revision),
+		p.DateCreated.UTC().Format(time.RFC3339Nano),
+		p.DateUpdated.UTC().Format(time.RFC3339Nano),
+	})
+}
+
+func (c *csvExport) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// ndjsonExport writes Products as one JSON object per line.
+type ndjsonExport struct {
+	enc *json.Encoder
+}
+
+func newNDJSONExport(w io.Writer) *ndjsonExport {
+	return &ndjsonExport{enc: json.NewEncoder(w)}
+}
+
+func (n *ndjsonExport) header() error {
+	return nil
+}
+
+func (n *ndjsonExport) write(p product.Product) error {
+	return n.enc.Encode(p)
+}
+
+func (n *ndjsonExport) flush() error {
+	return nil
+}
@@ -5,12 +5,12 @@ import (
 	"net/http"
 	"time"
 
-	"go.mongodb.org/mongo-driver/mongo"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
 )
 
 // Check is for health check.
 type Check struct {
-	db *mongo.Client
+	db product.Store
 }
 
 // Health validates the service is healthy and ready to accept requests.
@@ -23,7 +23,7 @@ func (c *Check) Health(w http.ResponseWriter, r *http.Request) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	err := c.db.Ping(ctx, nil)
+	err := c.db.Ping(ctx)
 	if err != nil {
 		health.Status = "db not ready"
 		return Respond(w, health, http.StatusInternalServerError)
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/cover"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/tenant"
+)
+
+const (
+	// coverField names the file of a multipart cover upload.
+	coverField = "cover"
+
+	// maxMultipartOverhead is how much larger than cover.MaxSize a multipart
+	// upload may be, for its part headers and boundaries.
+	maxMultipartOverhead = 64 << 10
+)
+
+// Covers holds the logic related to the cover images of books.
+type Covers struct {
+	DB    product.Store
+	Blobs cover.Store
+	Log   *log.Logger
+}
+
+// Upload stores the cover image of the book identified in the URL, replacing
+// the one it had, and makes its thumbnails. The image is the body of the
+// request, or its cover file when the body is multipart/form-data. Answers
+// 413 for images over cover.MaxSize bytes and 415 for images that are not
+// JPEG, PNG or GIF.
+func (c *Covers) Upload(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	if err := c.live(r, id); err != nil {
+		return err
+	}
+
+	data, err := readCover(r)
+	if err != nil {
+		return err
+	}
+
+	cv, err := cover.Upload(r.Context(), c.Blobs, id, data, time.Now())
+	if err != nil {
+		switch err {
+		case cover.ErrTooLarge:
+			return NewRequestError(err, http.StatusRequestEntityTooLarge)
+		case cover.ErrUnsupportedType:
+			return NewRequestError(err, http.StatusUnsupportedMediaType)
+		case cover.ErrInvalidImage:
+			return NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "uploading cover of %q", id)
+		}
+	}
+
+	return Respond(w, cv, http.StatusOK)
+}
+
+// Retrieve serves the cover image of the book identified in the URL, or the
+// thumbnail named by the size query parameter. Responses carry ETag and
+// Last-Modified headers, and conditional requests get 304 Not Modified when
+// the image did not change.
+func (c *Covers) Retrieve(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	if err := c.live(r, id); err != nil {
+		return err
+	}
+
+	b, err := cover.Open(r.Context(), c.Blobs, id, r.URL.Query().Get("size"))
+	if err != nil {
+		switch err {
+		case cover.ErrNotFound:
+			return NewRequestError(err, http.StatusNotFound)
+		case cover.ErrInvalidSize:
+			return NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "getting cover of %q", id)
+		}
+	}
+
+	// The same URL serves the cover of each tenant.
+	if _, ok := tenant.IDFrom(r.Context()); ok {
+		w.Header().Add("Vary", tenantHeader)
+	}
+	w.Header().Set("Content-Type", b.ContentType)
+	w.Header().Set("ETag", b.ETag())
+	http.ServeContent(w, r, "", b.DateModified, bytes.NewReader(b.Data))
+
+	return nil
+}
+
+// live checks the book with the given ID exists and is not in the trash.
+func (c *Covers) live(r *http.Request, id string) error {
+	if _, err := product.Retrieve(r.Context(), c.DB, id); err != nil {
+		switch err {
+		case product.ErrNotFound:
+			return NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID:
+			return NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "getting product %q", id)
+		}
+	}
+
+	return nil
+}
+
+// readCover reads the image of a cover upload, from the cover file of a
+// multipart/form-data body or from a raw image body. It reads at most one
+// byte more than cover.MaxSize of the image, so that larger images are told
+// apart. Bodies too large to hold such an image are refused as a whole.
+func readCover(r *http.Request) ([]byte, error) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		err := errors.New("Content-Type must be multipart/form-data or an image type")
+		return nil, NewRequestError(err, http.StatusUnsupportedMediaType)
+	}
+
+	limit := int64(cover.MaxSize)
+	if mediaType == "multipart/form-data" {
+		limit += maxMultipartOverhead
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, NewRequestError(errors.Wrap(err, "reading cover"), http.StatusBadRequest)
+	}
+	if int64(len(body)) > limit {
+		return nil, NewRequestError(cover.ErrTooLarge, http.StatusRequestEntityTooLarge)
+	}
+
+	switch {
+	case mediaType == "multipart/form-data":
+		mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				err := errors.Errorf("multipart body has no %s file", coverField)
+				return nil, NewRequestError(err, http.StatusBadRequest)
+			}
+			if err != nil {
+				return nil, NewRequestError(errors.Wrap(err, "reading cover"), http.StatusBadRequest)
+			}
+			if part.FormName() != coverField {
+				continue
+			}
+
+			data, err := ioutil.ReadAll(io.LimitReader(part, cover.MaxSize+1))
+			if err != nil {
+				return nil, NewRequestError(errors.Wrap(err, "reading cover"), http.StatusBadRequest)
+			}
+			return data, nil
+		}
+
+	case strings.HasPrefix(mediaType, "image/"):
+		return body, nil
+
+	default:
+		err := errors.New("Content-Type must be multipart/form-data or an image type")
+		return nil, NewRequestError(err, http.StatusUnsupportedMediaType)
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/cover"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// TestCovers uploads the cover of a book and serves it with caching headers.
+func TestCovers(t *testing.T) {
+	app, a := newTestAPI(t)
+
+	token := newTestToken(t, a, "alice", auth.RoleUser, auth.RoleAdmin)
+
+	do := func(method, path, contentType string, body io.Reader, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, body)
+		r.Header.Set("Authorization", "Bearer "+token)
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do(http.MethodPost, "/books", "application/json", strings.NewReader(`{"name":"Dune"}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var created product.Product
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	path := "/books/" + created.ID + "/cover"
+
+	if w := do(http.MethodGet, path, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("before upload: expected 404, got %d: %s", w.Code, w.Body)
+	}
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 300, 400))); err != nil {
+		t.Fatal(err)
+	}
+
+	w = do(http.MethodPut, path, "image/png", bytes.NewReader(img.Bytes()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var cv cover.Cover
+	if err := json.Unmarshal(w.Body.Bytes(), &cv); err != nil {
+		t.Fatal(err)
+	}
+	if cv.Width != 300 || cv.Height != 400 || len(cv.Sizes) != len(cover.Sizes) {
+		t.Errorf("unexpected cover %+v", cv)
+	}
+
+	w = do(http.MethodGet, path, "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("get: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if !bytes.Equal(w.Body.Bytes(), img.Bytes()) {
+		t.Error("get: expected the uploaded image")
+	}
+	etag, modified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if etag == "" || modified == "" || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("get: expected ETag, Last-Modified and Content-Type headers, got %v", w.Header())
+	}
+
+	if w := do(http.MethodGet, path, "", nil, "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: expected 304, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, path, "", nil, "If-Modified-Since", modified); w.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since: expected 304, got %d", w.Code)
+	}
+
+	w = do(http.MethodGet, path+"?size=small", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("thumbnail: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if cfg, _, err := image.DecodeConfig(w.Body); err != nil || cfg.Height != cover.Sizes["small"] {
+		t.Errorf("thumbnail: expected height %d, got %+v, %v", cover.Sizes["small"], cfg, err)
+	}
+
+	// A form upload replaces the cover.
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	fw, err := mw.CreateFormFile("cover", "cover.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(fw, image.NewRGBA(image.Rect(0, 0, 20, 10))); err != nil {
+		t.Fatal(err)
+	}
+	mw.Close()
+
+	if w := do(http.MethodPut, path, mw.FormDataContentType(), &form); w.Code != http.StatusOK {
+		t.Fatalf("form upload: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodGet, path, "", nil, "If-None-Match", etag); w.Code != http.StatusOK {
+		t.Errorf("after replacing: expected 200 for the old ETag, got %d", w.Code)
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        io.Reader
+		status      int
+	}{
+		{"unknown size", http.MethodGet, path + "?size=huge", "", nil, http.StatusBadRequest},
+		{"not an image type", http.MethodPut, path, "text/plain", strings.NewReader("hello"), http.StatusUnsupportedMediaType},
+		{"not an image", http.MethodPut, path, "image/png", strings.NewReader("hello"), http.StatusUnsupportedMediaType},
+		{"too large", http.MethodPut, path, "image/png", bytes.NewReader(make([]byte, cover.MaxSize+1)), http.StatusRequestEntityTooLarge},
+		{"form too large", http.MethodPut, path, "multipart/form-data; boundary=x", bytes.NewReader(make([]byte, cover.MaxSize+maxMultipartOverhead+1)), http.StatusRequestEntityTooLarge},
+		{"form without cover", http.MethodPut, path, "multipart/form-data; boundary=x", strings.NewReader("--x--\r\n"), http.StatusBadRequest},
+		{"unknown book", http.MethodPut, "/books/0b0e4f5a-6b5e-4e57-9b5c-2c7b0ec1e0a1/cover", "image/png", bytes.NewReader(img.Bytes()), http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		if w := do(tt.method, tt.path, tt.contentType, tt.body); w.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.status, w.Code, w.Body)
+		}
+	}
+
+	// Books in the trash have no cover.
+	if w := do(http.MethodDelete, "/books/"+created.ID, "", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: expected 204, got %d: %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodGet, path, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("after delete: expected 404, got %d: %s", w.Code, w.Body)
+	}
+
+	// The cover is kept in the trash and comes back with the book.
+	if w := do(http.MethodPost, "/books/"+created.ID+"/restore", "", nil); w.Code != http.StatusOK {
+		t.Fatalf("restore: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodGet, path, "", nil); w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("after restore: expected the PNG cover, got %d %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// heartbeatInterval is how often an idle event stream sends a comment to keep
+// proxies from closing the connection.
+const heartbeatInterval = 15 * time.Second
+
+// Events holds the logic related to the product change feed.
+type Events struct {
+	Feed product.Feed
+	Log  *log.Logger
+}
+
+// Stream sends product changes as Server-Sent Events. Each event carries its
+// ID so a client reconnecting with a Last-Event-ID header (or last_event_id
+// query parameter) receives what it missed. When those events are no longer
+// available it gets 410 Gone and should reload the books before subscribing
+// again. A client that cannot keep up is disconnected and resumes the same
+// way.
+func (e *Events) Stream(w http.ResponseWriter, r *http.Request) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("response writer does not support streaming")
+	}
+
+	after := r.Header.Get("Last-Event-ID")
+	if after == "" {
+		after = r.URL.Query().Get("last_event_id")
+	}
+
+	ctx := r.Context()
+
+	events, err := e.Feed.Subscribe(ctx, after)
+	if err != nil {
+		switch err {
+		case product.ErrEventsExpired:
+			return NewRequestError(err, http.StatusGone)
+		default:
+			return errors.Wrap(err, "subscribing to product events")
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			flusher.Flush()
+
+		case ev, ok := <-events:
+			if !ok {
+				// The feed dropped this client, it reconnects with the ID of
+				// the last event it received.
+				return nil
+			}
+
+			data, err := json.Marshal(ev)
+			if err != nil {
+				e.Log.Printf("ERROR: encoding event %s: %v", ev.ID, err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		}
+	}
+}
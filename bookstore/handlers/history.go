@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// History lists the changes of the book identified in the URL, live or in the
+// trash, newest first. It takes the limit and cursor paging query parameters.
+func (p *Products) History(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	limit, err := pageLimit(r)
+	if err != nil {
+		return err
+	}
+
+	q := product.HistoryQuery{
+		Limit:  limit,
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+
+	list, next, err := product.ListHistory(r.Context(), p.DB, id, q)
+	if err != nil {
+		switch err {
+		case product.ErrNotFound:
+			return NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID, product.ErrInvalidCursor:
+			return NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "getting history of product %q", id)
+		}
+	}
+
+	if next != "" {
+		setNextLink(w, r, next)
+	}
+
+	return Respond(w, list, http.StatusOK)
+}
+
+// Revert sets the book identified in the URL back to the values it had at the
+// revision in the URL and sends it back. An If-Match header makes the revert
+// conditional on the book still having that ETag. Like on restore, a book
+// whose Author was renamed since takes the new name.
+func (p *Products) Revert(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	to, err := strconv.Atoi(chi.URLParam(r, "revision"))
+	if err != nil || to < 1 {
+		err := errors.New("revision must be a positive number")
+		return NewRequestError(err, http.StatusBadRequest)
+	}
+
+	rev, err := ifMatch(r)
+	if err != nil {
+		return err
+	}
+
+	prod, err := product.Revert(r.Context(), p.DB, id, to, rev, time.Now())
+	if err != nil {
+		if dup := duplicateISBN(err); dup != nil {
+			return dup
+		}
+		switch err {
+		case product.ErrNotFound, product.ErrHistoryNotFound:
+			return NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID:
+			return NewRequestError(err, http.StatusBadRequest)
+		case product.ErrRevisionMismatch:
+			return NewRequestError(err, http.StatusPreconditionFailed)
+		default:
+			return errors.Wrapf(err, "reverting product %q to revision %d", id, to)
+		}
+	}
+
+	if prod, err = p.renameAuthor(r.Context(), prod); err != nil {
+		return errors.Wrapf(err, "renaming author of product %q", id)
+	}
+
+	setETag(w, prod.Revision)
+	return Respond(w, prod, http.StatusOK)
+}
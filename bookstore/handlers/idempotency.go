@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/idempotency"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/tenant"
+)
+
+const (
+	// maxIdempotencyKey caps the length of an Idempotency-Key header.
+	maxIdempotencyKey = 255
+
+	// maxIdempotentBody caps the size of the request and response bodies of
+	// a request made with an Idempotency-Key.
+	maxIdempotentBody = 1 << 20
+
+	// idempotencyTimeout bounds recording the outcome of a request, which
+	// happens even when the client went away.
+	idempotencyTimeout = 5 * time.Second
+)
+
+// Idempotency lets clients retry POST and PATCH requests that they do not
+// know the outcome of. A request made with an Idempotency-Key header has its
+// response stored for Window, and a retry with the same key gets the stored
+// response instead of being handled again.
+type Idempotency struct {
+	Store  idempotency.Store
+	Window time.Duration
+	Log    *log.Logger
+}
+
+// Middleware honors the Idempotency-Key header of POST and PATCH requests.
+// Keys are scoped to the token subject and the tenant, so it must run after
+// Authenticate and the tenant Middleware.
+// Reusing a key for a request with another method, URI or body gets a 422,
+// and retrying while the first request is handled gets a 409. Requests that
+// fail with an error or a 5xx status are not stored and can be retried.
+func (i *Idempotency) Middleware() product.Middleware {
+
+	// This is the actual middleware function to be executed.
+	f := func(before product.Handler) product.Handler {
+
+		// Wrap this handler around the next one provided.
+		h := func(w http.ResponseWriter, r *http.Request) error {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+				return before(w, r)
+			}
+
+			if len(key) > maxIdempotencyKey {
+				err := errors.Errorf("Idempotency-Key must be at most %d characters", maxIdempotencyKey)
+				return NewRequestError(err, http.StatusBadRequest)
+			}
+
+			body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBody))
+			if err != nil {
+				err := errors.Errorf("request body must be at most %d bytes when sent with an Idempotency-Key", maxIdempotentBody)
+				return NewRequestError(err, http.StatusRequestEntityTooLarge)
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			if claims, ok := claimsOf(r); ok {
+				key = claims.Subject + "\n" + key
+			}
+			if id, ok := tenant.IDFrom(r.Context()); ok {
+				key = id + "\n" + key
+			}
+			fingerprint := idempotency.Fingerprint(r.Method, r.URL.RequestURI(), body)
+
+			prev, err := idempotency.Begin(r.Context(), i.Store, key, fingerprint, time.Now(), i.Window)
+			if err != nil {
+				switch err {
+				case idempotency.ErrMismatch:
+					return NewRequestError(err, http.StatusUnprocessableEntity)
+				case idempotency.ErrInProgress:
+					return NewRequestError(err, http.StatusConflict)
+				default:
+					return errors.Wrap(err, "claiming idempotency key")
+				}
+			}
+
+			if prev != nil {
+				for name, values := range prev.Header {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(prev.Status)
+				_, err := w.Write(prev.Body)
+				return err
+			}
+
+			rec := responseRecorder{ResponseWriter: w}
+			err = before(&rec, r)
+
+			// Record the outcome even when the client went away, as it is
+			// the client most likely to retry.
+			ctx, cancel := context.WithTimeout(context.Background(), idempotencyTimeout)
+			defer cancel()
+
+			if err != nil || rec.status >= http.StatusInternalServerError || rec.overflow {
+				if err := idempotency.Release(ctx, i.Store, key); err != nil {
+					i.Log.Printf("ERROR: releasing idempotency key : %v", err)
+				}
+				return err
+			}
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if err := idempotency.Complete(ctx, i.Store, key, status, rec.header, rec.body.Bytes()); err != nil {
+				i.Log.Printf("ERROR: storing idempotent response : %v", err)
+			}
+
+			return nil
+		}
+
+		return h
+	}
+
+	return f
+}
+
+// responseRecorder keeps a copy of the response it passes through, up to
+// maxIdempotentBody bytes of body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		w.header = w.ResponseWriter.Header().Clone()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.body.Len()+len(b) > maxIdempotentBody {
+		w.overflow = true
+	} else if !w.overflow {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+)
+
+// TestIdempotency replays the response of a retried POST and rejects a key
+// reused for another body.
+func TestIdempotency(t *testing.T) {
+	app, a := newTestAPI(t)
+
+	post := func(subject, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/books", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+newTestToken(t, a, subject, auth.RoleUser))
+		r.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w
+	}
+
+	first := post("alice", "k1", `{"name":"Dune"}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", first.Code, first.Body)
+	}
+
+	retry := post("alice", "k1", `{"name":"Dune"}`)
+	if retry.Code != http.StatusCreated {
+		t.Fatalf("retry: expected 201, got %d: %s", retry.Code, retry.Body)
+	}
+	if exp, got := first.Body.String(), retry.Body.String(); exp != got {
+		t.Errorf("retry: expected the first response %s, got %s", exp, got)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("retry: expected Idempotent-Replayed header")
+	}
+
+	if w := post("alice", "k1", `{"name":"Emma"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("other body: expected 422, got %d: %s", w.Code, w.Body)
+	}
+
+	// Keys are scoped to the token subject.
+	other := post("bob", "k1", `{"name":"Dune"}`)
+	if other.Code != http.StatusCreated {
+		t.Fatalf("other subject: expected 201, got %d: %s", other.Code, other.Body)
+	}
+	if other.Body.String() == first.Body.String() {
+		t.Error("other subject: expected a new book, got the first response")
+	}
+
+	// Failed requests are not stored.
+	if w := post("alice", "k2", `{"price":-1}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid book: expected 400, got %d: %s", w.Code, w.Body)
+	}
+	if w := post("alice", "k2", `{"name":"Emma"}`); w.Code != http.StatusCreated {
+		t.Errorf("after a failed request: expected 201, got %d: %s", w.Code, w.Body)
+	}
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/books", nil))
+	if n := strings.Count(w.Body.String(), `"id"`); n != 3 {
+		t.Errorf("expected 3 books, got %d: %s", n, w.Body)
+	}
+}
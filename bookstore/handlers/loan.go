@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// Loans holds the logic related to lending books to members. Members are the
+// subjects of the tokens. Admins may act for another member by naming it in
+// the member query parameter.
+type Loans struct {
+	DB     product.Store
+	Policy product.LoanPolicy
+	Log    *log.Logger
+}
+
+// Checkout lends a copy of the book identified by an ID in the request URL to
+// the member. Answers 409 Conflict when no copy is left, when the copies left
+// are kept for members queued first or when the member has the book already.
+func (ln *Loans) Checkout(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	member, err := memberOf(r)
+	if err != nil {
+		return err
+	}
+
+	loan, err := product.Checkout(r.Context(), ln.DB, id, member, ln.Policy, time.Now())
+	if err != nil {
+		switch err {
+		case product.ErrNotFound:
+			return NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID:
+			return NewRequestError(err, http.StatusBadRequest)
+		case product.ErrInsufficientStock, product.ErrHoldsWaiting, product.ErrAlreadyBorrowed:
+			return NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "checking out product %q", id)
+		}
+	}
+
+	return Respond(w, loan, http.StatusCreated)
+}
+
+// Return brings back the copy of the book identified in the URL the member
+// has on loan. Answers 404 Not Found when the member has none.
+func (ln *Loans) Return(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	member, err := memberOf(r)
+	if err != nil {
+		return err
+	}
+
+	loan, err := product.Return(r.Context(), ln.DB, id, member, ln.Policy, time.Now())
+	if err != nil {
+		switch err {
+		case product.ErrLoanNotFound:
+			return NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID:
+			return NewRequestError(err, http.StatusBadRequest)
+		case product.ErrLoanClosed:
+			return NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "returning product %q", id)
+		}
+	}
+
+	return Respond(w, loan, http.StatusOK)
+}
+
+// Renew extends the loan of the book identified in the URL by another loan
+// period. Answers 409 Conflict when the loan is overdue, was renewed as often
+// as allowed or other members wait for the book.
+func (ln *Loans) Renew(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	member, err := memberOf(r)
+	if err != nil {
+		return err
+	}
+
+	loan, err := product.Renew(r.Context(), ln.DB, id, member, ln.Policy, time.Now())
+	if err != nil {
+		switch err {
+		case product.ErrLoanNotFound:
+			return NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID:
+			return NewRequestError(err, http.StatusBadRequest)
+		case product.ErrLoanClosed, product.ErrLoanOverdue, product.ErrRenewalLimit, product.ErrHoldsWaiting:
+			return NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "renewing loan of product %q", id)
+		}
+	}
+
+	return Respond(w, loan, http.StatusOK)
+}
+
+// List gets the loans of the member named in the URL, newest first.
+// Members see their own loans, admins those of every member. active=true
+// leaves out the returned loans and limit and cursor page like for books.
+func (ln *Loans) List(w http.ResponseWriter, r *http.Request) error {
+	member := chi.URLParam(r, "member")
+
+	if claims, _ := claimsOf(r); claims.Subject != member && !claims.Authorized(auth.RoleAdmin) {
+		err := errors.New("loans of other members are only shown to admins")
+		return NewRequestError(err, http.StatusForbidden)
+	}
+
+	limit, err := pageLimit(r)
+	if err != nil {
+		return err
+	}
+
+	q := product.LoanQuery{
+		Limit:  limit,
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+	if v := r.URL.Query().Get("active"); v != "" {
+		if q.Active, err = strconv.ParseBool(v); err != nil {
+			err := errors.New("active must be true or false")
+			return NewRequestError(err, http.StatusBadRequest)
+		}
+	}
+
+	list, next, err := product.ListLoans(r.Context(), ln.DB, member, q)
+	if err != nil {
+		switch err {
+		case product.ErrInvalidCursor:
+			return NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "getting loans of member %q", member)
+		}
+	}
+
+	if next != "" {
+		setNextLink(w, r, next)
+	}
+
+	return Respond(w, list, http.StatusOK)
+}
+
+// PlaceHold queues the member for a copy of the book identified in the URL.
+// The hold is ready right away when a copy is in stock. Answers 409 Conflict
+// when the member holds or has the book already.
+func (ln *Loans) PlaceHold(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	member, err := memberOf(r)
+	if err != nil {
+		return err
+	}
+
+	hold, err := product.PlaceHold(r.Context(), ln.DB, id, member, ln.Policy, time.Now())
+	if err != nil {
+		switch err {
+		case product.ErrNotFound:
+			return NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID:
+			return NewRequestError(err, http.StatusBadRequest)
+		case product.ErrDuplicateHold, product.ErrAlreadyBorrowed:
+			return NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "placing hold on product %q", id)
+		}
+	}
+
+	return Respond(w, hold, http.StatusCreated)
+}
+
+// ListHolds gets the open holds of the book identified in the URL in queue
+// order, the ready ones included.
+func (ln *Loans) ListHolds(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	list, err := product.ListHolds(r.Context(), ln.DB, id)
+	if err != nil {
+		switch err {
+		case product.ErrNotFound:
+			return NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID:
+			return NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "getting holds of product %q", id)
+		}
+	}
+
+	return Respond(w, list, http.StatusOK)
+}
+
+// CancelHold takes a hold on the book identified in the URL out of the queue.
+// Members may only cancel their own holds, others get 403 Forbidden. Admins
+// may cancel any hold.
+func (ln *Loans) CancelHold(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+	hid := chi.URLParam(r, "hid")
+
+	member, err := memberOf(r)
+	if err != nil {
+		return err
+	}
+
+	hold, err := product.RetrieveHold(r.Context(), ln.DB, hid)
+	if err == nil && hold.ProductID != id {
+		err = product.ErrHoldNotFound
+	}
+	if err == nil {
+		if claims, _ := claimsOf(r); claims.Authorized(auth.RoleAdmin) {
+			member = hold.Member
+		}
+		hold, err = product.CancelHold(r.Context(), ln.DB, hid, member, ln.Policy, time.Now())
+	}
+	if err != nil {
+		switch err {
+		case product.ErrHoldNotFound:
+			return NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID:
+			return NewRequestError(err, http.StatusBadRequest)
+		case product.ErrNotHolder:
+			return NewRequestError(err, http.StatusForbidden)
+		case product.ErrHoldClosed:
+			return NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "cancelling hold %q", hid)
+		}
+	}
+
+	return Respond(w, hold, http.StatusOK)
+}
+
+// memberOf returns the member a request is made for: the subject of its
+// token, or the member query parameter when an admin names one.
+func memberOf(r *http.Request) (string, error) {
+	claims, ok := claimsOf(r)
+	if !ok || claims.Subject == "" {
+		err := errors.New("loans must be made with a token naming the member")
+		return "", NewRequestError(err, http.StatusUnauthorized)
+	}
+
+	member := r.URL.Query().Get("member")
+	if member == "" || member == claims.Subject {
+		return claims.Subject, nil
+	}
+	if !claims.Authorized(auth.RoleAdmin) {
+		err := errors.New("only admins act for other members")
+		return "", NewRequestError(err, http.StatusForbidden)
+	}
+
+	return member, nil
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// TestLoans lends a single copy to two members in turn through a hold and
+// checks who may see loans and act for other members.
+func TestLoans(t *testing.T) {
+	app, a := newTestAPI(t)
+
+	alice := newTestToken(t, a, "alice", auth.RoleUser)
+	bob := newTestToken(t, a, "bob", auth.RoleUser)
+	admin := newTestToken(t, a, "carol", auth.RoleUser, auth.RoleAdmin)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do(http.MethodPost, "/books", alice, `{"name":"Dune","stock":1}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var p product.Product
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	book := "/books/" + p.ID
+
+	if w := do(http.MethodPost, book+"/checkout", alice, ""); w.Code != http.StatusCreated {
+		t.Fatalf("checkout: expected 201, got %d: %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, book+"/checkout", bob, ""); w.Code != http.StatusConflict {
+		t.Fatalf("checkout without stock: expected 409, got %d: %s", w.Code, w.Body)
+	}
+
+	w = do(http.MethodPost, book+"/holds", bob, "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("hold: expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var hold product.Hold
+	if err := json.Unmarshal(w.Body.Bytes(), &hold); err != nil {
+		t.Fatal(err)
+	}
+	if hold.Member != "bob" || hold.Status != product.HoldWaiting {
+		t.Errorf("hold: expected a waiting hold of bob, got %+v", hold)
+	}
+	if w := do(http.MethodDelete, book+"/holds/"+hold.ID, alice, ""); w.Code != http.StatusForbidden {
+		t.Errorf("cancelling another member's hold: expected 403, got %d", w.Code)
+	}
+
+	if w := do(http.MethodGet, "/members/bob/loans", alice, ""); w.Code != http.StatusForbidden {
+		t.Errorf("loans of another member: expected 403, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, book+"/return?member=bob", alice, ""); w.Code != http.StatusForbidden {
+		t.Errorf("returning for another member: expected 403, got %d", w.Code)
+	}
+
+	// The returned copy goes to Bob, who is next in line.
+	if w := do(http.MethodPost, book+"/return?member=alice", admin, ""); w.Code != http.StatusOK {
+		t.Fatalf("return as admin: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, book+"/checkout", alice, ""); w.Code != http.StatusConflict {
+		t.Errorf("checkout ahead of the queue: expected 409, got %d: %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, book+"/checkout", bob, ""); w.Code != http.StatusCreated {
+		t.Fatalf("checkout of a held copy: expected 201, got %d: %s", w.Code, w.Body)
+	}
+
+	var loans []product.Loan
+	w = do(http.MethodGet, "/members/bob/loans?active=true", admin, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("loans: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &loans); err != nil {
+		t.Fatal(err)
+	}
+	if len(loans) != 1 || loans[0].ProductID != p.ID {
+		t.Errorf("loans: expected the loan of bob, got %+v", loans)
+	}
+
+	w = do(http.MethodGet, "/members/alice/loans?active=true", alice, "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("active loans: expected 200 with none, got %d: %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodGet, "/members/alice/loans?active=maybe", alice, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("loans with a bad filter: expected 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,861 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/author"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/cover"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/tenant"
+)
+
+// operation is the spec entry of a route. The OpenAPI document is generated
+// from the routes registered in API, so every route needs one in operations.
+type operation struct {
+	Summary string
+
+	// Roles lists the roles a token must carry, nil for anonymous routes.
+	Roles []string
+
+	// Basic marks routes authenticated with Basic auth credentials.
+	Basic bool
+
+	// Global marks routes outside the catalogs, which name no tenant.
+	Global bool
+
+	Params []param
+
+	// Body is a value of the JSON request body type, nil when the request
+	// has none. BodyMedia lists other media types the body may come in.
+	Body      interface{}
+	BodyMedia []string
+
+	// Status is the status of a successful response and Response a value of
+	// its JSON body type, nil when it has none. Media lists the media types
+	// of non JSON responses and Items a value of the type streamed one by one
+	// in them.
+	Status   int
+	Response interface{}
+	Media    []string
+	Items    interface{}
+
+	// Headers are the response headers of a successful response.
+	Headers []string
+
+	// Errors lists the statuses answered with an ErrorResponse.
+	Errors []int
+}
+
+// param is a query or header parameter of an operation. Path parameters are
+// taken from the route pattern and described in pathParams.
+type param struct {
+	Name        string
+	In          string
+	Description string
+	Type        string
+}
+
+// Parameters shared by several operations.
+var (
+	pageParams = []param{
+		{Name: "limit", In: "query", Type: "integer", Description: "Page size, at most " + strconv.Itoa(maxPageLimit) + ". Defaults to " + strconv.Itoa(defaultPageLimit) + "."},
+		{Name: "cursor", In: "query", Description: "Opaque position of the page, taken from the Link header of the previous page."},
+	}
+	filterParams = []param{
+		{Name: "author", In: "query", Description: "Only books of this author name."},
+		{Name: "author_id", In: "query", Description: "Only books of this author ID."},
+		{Name: "genre", In: "query", Description: "Only books of this genre."},
+		{Name: "isbn", In: "query", Description: "Only the book with this ISBN."},
+		{Name: "sort", In: "query", Description: "Field to order by, prefixed with - for descending order."},
+	}
+	listParams          = append(append([]param{}, filterParams...), pageParams...)
+	ifMatchParam        = param{Name: "If-Match", In: "header", Description: "ETag the book must still have for the request to apply."}
+	tenantParam         = param{Name: tenantHeader, In: "header", Description: "Tenant whose catalog the request works on. Defaults to the tenant of the token."}
+	memberParam         = param{Name: "member", In: "query", Description: "Member the request is made for, admins only. Defaults to the subject of the token."}
+	idempotencyKeyParam = param{Name: "Idempotency-Key", In: "header", Description: "Client chosen key, at most " + strconv.Itoa(maxIdempotencyKey) + " characters. A retry with the same key gets the stored response of the first request instead of being handled again."}
+)
+
+// pathParams describes the parameters of route patterns. They are UUIDs
+// unless they have a Type.
+var pathParams = map[string]param{
+	"id":       {Description: "ID of the book or author."},
+	"rid":      {Description: "ID of the reservation or review."},
+	"hid":      {Description: "ID of the hold."},
+	"member":   {Description: "Member, the subject of their tokens.", Type: "string"},
+	"revision": {Description: "Revision of the book.", Type: "integer"},
+	"tenant":   {Description: "ID of the tenant.", Type: "string"},
+}
+
+// operations holds the spec entry of every route registered in API, keyed by
+// method and route pattern.
+var operations = map[string]operation{
+	"GET /health": {
+		Summary: "Check the service can reach its database.",
+		Global:  true,
+		Status:  http.StatusOK,
+		Response: struct {
+			Status string `json:"status"`
+		}{},
+		Errors: []int{http.StatusInternalServerError},
+	},
+	"GET /token": {
+		Summary: "Issue a token to the user of the Basic auth credentials.",
+		Global:  true,
+		Basic:   true,
+		Status:  http.StatusOK,
+		Response: struct {
+			Token string `json:"token"`
+		}{},
+		Errors: []int{http.StatusUnauthorized},
+	},
+	"GET /openapi.json": {
+		Summary:  "Get this document.",
+		Global:   true,
+		Status:   http.StatusOK,
+		Response: map[string]interface{}{},
+	},
+	"GET /tenants": {
+		Summary:  "List the tenants.",
+		Global:   true,
+		Roles:    []string{auth.RoleAdmin},
+		Status:   http.StatusOK,
+		Response: []tenant.Tenant{},
+	},
+	"POST /tenants": {
+		Summary:  "Provision a tenant with an empty catalog.",
+		Global:   true,
+		Roles:    []string{auth.RoleAdmin},
+		Body:     tenant.NewTenant{},
+		Status:   http.StatusCreated,
+		Response: tenant.Tenant{},
+		Errors:   []int{http.StatusBadRequest, http.StatusConflict},
+	},
+	"GET /tenants/{tenant}": {
+		Summary:  "Get a tenant.",
+		Global:   true,
+		Roles:    []string{auth.RoleAdmin},
+		Status:   http.StatusOK,
+		Response: tenant.Tenant{},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"DELETE /tenants/{tenant}": {
+		Summary: "Tear down a tenant and remove its catalog.",
+		Global:  true,
+		Roles:   []string{auth.RoleAdmin},
+		Status:  http.StatusNoContent,
+		Errors:  []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"GET /books": {
+		Summary:  "List books.",
+		Params:   listParams,
+		Status:   http.StatusOK,
+		Response: []product.Product{},
+		Headers:  []string{"Link"},
+		Errors:   []int{http.StatusBadRequest},
+	},
+	"GET /books/search": {
+		Summary: "Search books by name, author and genre, most relevant first.",
+		Params: append([]param{
+			{Name: "q", In: "query", Description: "Words to search for."},
+			{Name: "min_score", In: "query", Type: "number", Description: "Drop matches scoring less."},
+		}, pageParams...),
+		Status:   http.StatusOK,
+		Response: []product.Match{},
+		Headers:  []string{"Link"},
+		Errors:   []int{http.StatusBadRequest},
+	},
+	"POST /books:import": {
+		Summary:   "Create books from CSV or NDJSON rows.",
+		Roles:     []string{auth.RoleUser},
+		BodyMedia: []string{mediaCSV, mediaNDJSON},
+		Status:    http.StatusOK,
+		Response:  ImportReport{},
+		Errors:    []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+	},
+	"GET /books:export": {
+		Summary: "Stream the books as CSV or NDJSON.",
+		Params: append([]param{
+			{Name: "format", In: "query", Description: "csv or ndjson, defaults to the Accept header."},
+		}, filterParams...),
+		Status: http.StatusOK,
+		Media:  []string{mediaCSV, mediaNDJSON},
+		Items:  product.Product{},
+		Errors: []int{http.StatusBadRequest},
+	},
+	"GET /books/trash": {
+		Summary:  "List deleted books that were not purged yet.",
+		Params:   listParams,
+		Status:   http.StatusOK,
+		Response: []product.Product{},
+		Headers:  []string{"Link"},
+		Errors:   []int{http.StatusBadRequest},
+	},
+	"GET /books/duplicates": {
+		Summary:  "Report live books sharing an ISBN, to merge before unique ISBNs are enforced.",
+		Roles:    []string{auth.RoleAdmin},
+		Status:   http.StatusOK,
+		Response: []product.Duplicate{},
+	},
+	"GET /books/events": {
+		Summary: "Stream book changes as Server-Sent Events of Event values.",
+		Params: []param{
+			{Name: "Last-Event-ID", In: "header", Description: "Resume after this event."},
+			{Name: "last_event_id", In: "query", Description: "Resume after this event."},
+		},
+		Status: http.StatusOK,
+		Media:  []string{"text/event-stream"},
+		Items:  product.Event{},
+		Errors: []int{http.StatusGone},
+	},
+	"GET /books/{id}": {
+		Summary:  "Get a book.",
+		Status:   http.StatusOK,
+		Response: product.Product{},
+		Headers:  []string{"ETag"},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"POST /books": {
+		Summary:  "Create a book.",
+		Roles:    []string{auth.RoleUser},
+		Body:     product.NewProduct{},
+		Status:   http.StatusCreated,
+		Response: product.Product{},
+		Headers:  []string{"ETag"},
+		Errors:   []int{http.StatusBadRequest, http.StatusConflict},
+	},
+	"PUT /books/{id}": {
+		Summary: "Update the given fields of a book.",
+		Roles:   []string{auth.RoleUser},
+		Params:  []param{ifMatchParam},
+		Body:    product.UpdateProduct{},
+		Status:  http.StatusNoContent,
+		Headers: []string{"ETag"},
+		Errors:  []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed},
+	},
+	"PATCH /books/{id}": {
+		Summary:   "Patch a book with a JSON Merge Patch or a JSON Patch, which can clear fields.",
+		Roles:     []string{auth.RoleUser},
+		Params:    []param{ifMatchParam},
+		BodyMedia: []string{mediaMergePatch, mediaJSONPatch},
+		Status:    http.StatusOK,
+		Response:  product.Product{},
+		Headers:   []string{"ETag"},
+		Errors:    []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity},
+	},
+	"DELETE /books/{id}": {
+		Summary: "Move a book to the trash.",
+		Roles:   []string{auth.RoleAdmin},
+		Params:  []param{ifMatchParam},
+		Status:  http.StatusNoContent,
+		Errors:  []int{http.StatusBadRequest, http.StatusNotFound, http.StatusPreconditionFailed},
+	},
+	"GET /books/{id}/cover": {
+		Summary: "Get the cover image of a book, or one of its thumbnails.",
+		Params: []param{
+			{Name: "size", In: "query", Description: "Thumbnail to get: small, medium or large. Defaults to the uploaded image."},
+			{Name: "If-None-Match", In: "header", Description: "ETag of a cached image, answered with 304 Not Modified while it is current."},
+		},
+		Status:  http.StatusOK,
+		Media:   []string{"image/jpeg", "image/png", "image/gif"},
+		Headers: []string{"ETag", "Last-Modified"},
+		Errors:  []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"PUT /books/{id}/cover": {
+		Summary:   "Upload the cover image of a book as the body or as the cover file of a form, and make its thumbnails.",
+		Roles:     []string{auth.RoleUser},
+		BodyMedia: []string{"image/jpeg", "image/png", "image/gif", "multipart/form-data"},
+		Status:    http.StatusOK,
+		Response:  cover.Cover{},
+		Errors:    []int{http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+	},
+	"POST /books/{id}/restore": {
+		Summary:  "Take a book out of the trash.",
+		Roles:    []string{auth.RoleAdmin},
+		Params:   []param{ifMatchParam},
+		Status:   http.StatusOK,
+		Response: product.Product{},
+		Headers:  []string{"ETag"},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed},
+	},
+	"GET /books/{id}/history": {
+		Summary:  "List the changes of a book, live or in the trash, newest first.",
+		Params:   pageParams,
+		Status:   http.StatusOK,
+		Response: []product.HistoryEntry{},
+		Headers:  []string{"Link"},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"POST /books/{id}/history/{revision}/revert": {
+		Summary:  "Set a book back to the values it had at a revision, except its stock.",
+		Roles:    []string{auth.RoleAdmin},
+		Params:   []param{ifMatchParam},
+		Status:   http.StatusOK,
+		Response: product.Product{},
+		Headers:  []string{"ETag"},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed},
+	},
+	"POST /books/{id}/reservations": {
+		Summary:  "Hold copies of a book.",
+		Roles:    []string{auth.RoleUser},
+		Body:     product.NewReservation{},
+		Status:   http.StatusCreated,
+		Response: product.Reservation{},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	"GET /books/{id}/reservations/{rid}": {
+		Summary:  "Get a reservation.",
+		Status:   http.StatusOK,
+		Response: product.Reservation{},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"POST /books/{id}/reservations/{rid}/commit": {
+		Summary:  "Sell the copies held by a reservation.",
+		Roles:    []string{auth.RoleUser},
+		Status:   http.StatusOK,
+		Response: product.Reservation{},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusGone},
+	},
+	"POST /books/{id}/reservations/{rid}/cancel": {
+		Summary:  "Put the copies held by a reservation back in stock.",
+		Roles:    []string{auth.RoleUser},
+		Status:   http.StatusOK,
+		Response: product.Reservation{},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	"POST /books/{id}/checkout": {
+		Summary:  "Borrow a copy of a book, the one kept for a ready hold of the member or one in stock when nobody waits for the book.",
+		Roles:    []string{auth.RoleUser},
+		Params:   []param{memberParam},
+		Status:   http.StatusCreated,
+		Response: product.Loan{},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+	},
+	"POST /books/{id}/return": {
+		Summary:  "Return the copy of a book the member has on loan.",
+		Roles:    []string{auth.RoleUser},
+		Params:   []param{memberParam},
+		Status:   http.StatusOK,
+		Response: product.Loan{},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+	},
+	"POST /books/{id}/renew": {
+		Summary:  "Extend the loan of a book by another loan period.",
+		Roles:    []string{auth.RoleUser},
+		Params:   []param{memberParam},
+		Status:   http.StatusOK,
+		Response: product.Loan{},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+	},
+	"GET /books/{id}/holds": {
+		Summary:  "List the open holds of a book in queue order.",
+		Roles:    []string{auth.RoleUser},
+		Status:   http.StatusOK,
+		Response: []product.Hold{},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"POST /books/{id}/holds": {
+		Summary:  "Queue the member for a copy of a book.",
+		Roles:    []string{auth.RoleUser},
+		Params:   []param{memberParam},
+		Status:   http.StatusCreated,
+		Response: product.Hold{},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+	},
+	"DELETE /books/{id}/holds/{hid}": {
+		Summary:  "Cancel a hold of the user of the token, or any hold as an admin.",
+		Roles:    []string{auth.RoleUser},
+		Status:   http.StatusOK,
+		Response: product.Hold{},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+	},
+	"GET /members/{member}/loans": {
+		Summary: "List the loans of a member, newest first. Members see their own loans, admins everyone's.",
+		Roles:   []string{auth.RoleUser},
+		Params: append([]param{
+			{Name: "active", In: "query", Type: "boolean", Description: "Only the loans that were not returned."},
+		}, pageParams...),
+		Status:   http.StatusOK,
+		Response: []product.Loan{},
+		Headers:  []string{"Link"},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden},
+	},
+	"GET /books/{id}/reviews": {
+		Summary:  "List the reviews of a book, newest first.",
+		Params:   pageParams,
+		Status:   http.StatusOK,
+		Response: []product.Review{},
+		Headers:  []string{"Link"},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"POST /books/{id}/reviews": {
+		Summary:  "Review a book as the user of the token.",
+		Roles:    []string{auth.RoleUser},
+		Body:     product.NewReview{},
+		Status:   http.StatusCreated,
+		Response: product.Review{},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	"DELETE /books/{id}/reviews/{rid}": {
+		Summary: "Delete a review of the user of the token, or any review as an admin.",
+		Roles:   []string{auth.RoleUser},
+		Status:  http.StatusNoContent,
+		Errors:  []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"GET /authors": {
+		Summary:  "List authors in name order.",
+		Params:   pageParams,
+		Status:   http.StatusOK,
+		Response: []author.Author{},
+		Headers:  []string{"Link"},
+		Errors:   []int{http.StatusBadRequest},
+	},
+	"POST /authors": {
+		Summary:  "Create an author.",
+		Roles:    []string{auth.RoleUser},
+		Body:     author.NewAuthor{},
+		Status:   http.StatusCreated,
+		Response: author.Author{},
+		Errors:   []int{http.StatusBadRequest, http.StatusConflict},
+	},
+	"GET /authors/{id}": {
+		Summary:  "Get an author.",
+		Status:   http.StatusOK,
+		Response: author.Author{},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"PUT /authors/{id}": {
+		Summary:  "Rename an author and its books.",
+		Roles:    []string{auth.RoleUser},
+		Body:     author.UpdateAuthor{},
+		Status:   http.StatusOK,
+		Response: author.Author{},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	"DELETE /authors/{id}": {
+		Summary: "Delete an author without books.",
+		Roles:   []string{auth.RoleAdmin},
+		Status:  http.StatusNoContent,
+		Errors:  []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	"GET /authors/{id}/books": {
+		Summary:  "List the books of an author.",
+		Params:   listParams,
+		Status:   http.StatusOK,
+		Response: []product.Product{},
+		Headers:  []string{"Link"},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+}
+
+// headerDescriptions describes the response headers of operations.
+var headerDescriptions = map[string]string{
+	"Link":          `Link with rel="next" to the next page, missing on the last page.`,
+	"ETag":          "Revision of the book, for If-Match, or version of the cover image, for If-None-Match.",
+	"Last-Modified": "Time the cover image was uploaded, for If-Modified-Since.",
+}
+
+// route is a method and pattern registered on the App.
+type route struct {
+	Method  string
+	Pattern string
+}
+
+// key returns the key of the route in operations.
+func (r route) key() string {
+	return r.Method + " " + r.Pattern
+}
+
+// OpenAPI is the handler serving the OpenAPI document of the routes of an App.
+type OpenAPI struct {
+	doc map[string]interface{}
+}
+
+// Serve sends the OpenAPI document.
+func (o *OpenAPI) Serve(w http.ResponseWriter, r *http.Request) error {
+	return Respond(w, o.doc, http.StatusOK)
+}
+
+// openAPI builds the OpenAPI 3 document of the given routes. It returns the
+// routes without an entry in operations, which are documented without any
+// details.
+func openAPI(routes []route, tenants bool) (map[string]interface{}, []string) {
+	g := schemaGenerator{schemas: make(map[string]*schema)}
+
+	var missing []string
+	paths := make(map[string]map[string]interface{})
+	for _, rt := range routes {
+		op, ok := operations[rt.key()]
+		if !ok {
+			missing = append(missing, rt.key())
+			op = operation{Summary: "Undocumented."}
+		}
+
+		if paths[rt.Pattern] == nil {
+			paths[rt.Pattern] = make(map[string]interface{})
+		}
+		paths[rt.Pattern][strings.ToLower(rt.Method)] = g.operation(rt, op, tenants)
+	}
+
+	errResponse := map[string]interface{}{
+		"description": "The error and, for validation failures, the offending fields.",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": g.schemaOf(reflect.TypeOf(ErrorResponse{}), false)},
+		},
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Bookstore API",
+			"version": "1",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas":   g.schemas,
+			"responses": map[string]interface{}{"Error": errResponse},
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"basic":  map[string]interface{}{"type": "http", "scheme": "basic"},
+			},
+		},
+	}
+
+	return doc, missing
+}
+
+// patternParam matches the parameters of a route pattern.
+var patternParam = regexp.MustCompile(`{([^}]+)}`)
+
+// operation builds the OpenAPI operation object of a route.
+func (g *schemaGenerator) operation(rt route, op operation, tenants bool) map[string]interface{} {
+	o := map[string]interface{}{
+		"summary": op.Summary,
+	}
+
+	var params []interface{}
+	for _, m := range patternParam.FindAllStringSubmatch(rt.Pattern, -1) {
+		p := pathParams[m[1]]
+		s := &schema{Type: "string", Format: "uuid"}
+		if p.Type != "" {
+			s = &schema{Type: p.Type}
+		}
+		params = append(params, map[string]interface{}{
+			"name":        m[1],
+			"in":          "path",
+			"required":    true,
+			"description": p.Description,
+			"schema":      s,
+		})
+	}
+	// Authenticated POST and PATCH routes run behind Idempotency.
+	idempotent := !op.Global && op.Roles != nil && (rt.Method == http.MethodPost || rt.Method == http.MethodPatch)
+	tenanted := tenants && !op.Global
+
+	opParams := op.Params
+	if tenanted {
+		opParams = append([]param{tenantParam}, opParams...)
+	}
+	if idempotent {
+		opParams = append(append([]param{}, opParams...), idempotencyKeyParam)
+	}
+	for _, p := range opParams {
+		typ := p.Type
+		if typ == "" {
+			typ = "string"
+		}
+		params = append(params, map[string]interface{}{
+			"name":        p.Name,
+			"in":          p.In,
+			"description": p.Description,
+			"schema":      &schema{Type: typ},
+		})
+	}
+	if params != nil {
+		o["parameters"] = params
+	}
+
+	if op.Body != nil || op.BodyMedia != nil {
+		content := make(map[string]interface{})
+		if op.Body != nil {
+			content["application/json"] = map[string]interface{}{"schema": g.schemaOf(reflect.TypeOf(op.Body), true)}
+		}
+		for _, mt := range op.BodyMedia {
+			content[mt] = map[string]interface{}{"schema": &schema{Type: "string"}}
+		}
+		o["requestBody"] = map[string]interface{}{"required": true, "content": content}
+	}
+
+	ok := map[string]interface{}{"description": http.StatusText(op.Status)}
+	if op.Response != nil || op.Media != nil {
+		content := make(map[string]interface{})
+		if op.Response != nil {
+			content["application/json"] = map[string]interface{}{"schema": g.schemaOf(reflect.TypeOf(op.Response), false)}
+		}
+		for _, mt := range op.Media {
+			item := &schema{Type: "string"}
+			if op.Items != nil && mt != mediaCSV {
+				item = g.schemaOf(reflect.TypeOf(op.Items), false)
+			}
+			content[mt] = map[string]interface{}{"schema": item}
+		}
+		ok["content"] = content
+	}
+	if op.Headers != nil {
+		headers := make(map[string]interface{})
+		for _, h := range op.Headers {
+			headers[h] = map[string]interface{}{
+				"description": headerDescriptions[h],
+				"schema":      &schema{Type: "string"},
+			}
+		}
+		ok["headers"] = headers
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	responses := map[string]interface{}{
+		strconv.Itoa(status): ok,
+	}
+
+	errs := op.Errors
+	switch {
+	case op.Basic:
+		o["security"] = []interface{}{map[string][]string{"basic": {}}}
+	case op.Roles != nil:
+		o["security"] = []interface{}{map[string][]string{"bearer": {}}}
+		o["description"] = "Requires a token with the " + strings.Join(op.Roles, " or ") + " role."
+		errs = append([]int{http.StatusUnauthorized, http.StatusForbidden}, errs...)
+	}
+	if idempotent {
+		errs = append(errs, http.StatusConflict, http.StatusUnprocessableEntity)
+	}
+	if tenanted {
+		errs = append(errs, http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+	}
+	for _, code := range errs {
+		responses[strconv.Itoa(code)] = map[string]interface{}{"$ref": "#/components/responses/Error"}
+	}
+	o["responses"] = responses
+
+	return o
+}
+
+// =============================================================================
+
+// schema is an OpenAPI schema object.
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+}
+
+// schemaGenerator derives schemas from Go types. Named structs are added to
+// the components of the document and referenced.
+type schemaGenerator struct {
+	schemas map[string]*schema
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// rawType is the type of JSON values of any type.
+var rawType = reflect.TypeOf(json.RawMessage{})
+
+// schemaOf returns the schema of values of t. Request types require the
+// fields their validate tags require, response types the fields that are
+// always sent.
+func (g *schemaGenerator) schemaOf(t reflect.Type, request bool) *schema {
+	switch {
+	case t == timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	case t == rawType:
+		return &schema{Nullable: true}
+	case t.Kind() == reflect.Ptr:
+		s := g.schemaOf(t.Elem(), request)
+		if s.Ref != "" {
+			return s
+		}
+		s.Nullable = true
+		return s
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &schema{Type: "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return &schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &schema{Type: "array", Items: g.schemaOf(t.Elem(), request)}
+	case reflect.Map:
+		s := &schema{Type: "object"}
+		if t.Elem().Kind() != reflect.Interface {
+			s.AdditionalProperties = g.schemaOf(t.Elem(), request)
+		}
+		return s
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t, request)
+		}
+		ref := &schema{Ref: "#/components/schemas/" + t.Name()}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// Reserve the name first, the type may refer to itself.
+			g.schemas[t.Name()] = nil
+			g.schemas[t.Name()] = g.structSchema(t, request)
+		}
+		return ref
+	}
+
+	return &schema{}
+}
+
+// structSchema returns the object schema of the struct type t.
+func (g *schemaGenerator) structSchema(t reflect.Type, request bool) *schema {
+	s := &schema{Type: "object", Properties: make(map[string]*schema)}
+	g.addFields(s, t, request)
+	sort.Strings(s.Required)
+	return s
+}
+
+// addFields adds the JSON fields of the struct type t to s. The fields of
+// embedded structs are promoted like encoding/json does.
+func (g *schemaGenerator) addFields(s *schema, t reflect.Type, request bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.addFields(s, f.Type, request)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fs := g.schemaOf(f.Type, request)
+		required := constrain(fs, f.Tag.Get("validate"))
+		if !request {
+			required = f.Type.Kind() != reflect.Ptr
+			for _, o := range opts[1:] {
+				if o == "omitempty" {
+					required = false
+				}
+			}
+		}
+
+		s.Properties[name] = fs
+		if required {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// constrain adds the constraints of a validate tag to the schema of a field
+// and reports whether the tag requires the field.
+func constrain(s *schema, tag string) bool {
+	if tag == "" {
+		return false
+	}
+
+	// Constraints apply to the items of arrays and to the value of pointers.
+	target := s
+	if s.Type == "array" && s.Items != nil {
+		target = s.Items
+	}
+
+	var required bool
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+
+		switch name {
+		case "required":
+			required = true
+		case "required_with":
+			describe(target, "Required with "+strings.ToLower(arg)+".")
+		case "min", "max", "len":
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				continue
+			}
+			bound(target, name, n)
+		case "oneof":
+			target.Enum = strings.Fields(arg)
+		case "uuid":
+			target.Format = "uuid"
+		case "email":
+			target.Format = "email"
+		case "isbn":
+			describe(target, "ISBN-10 or ISBN-13, with or without hyphens. Stored as ISBN-13.")
+		case "currency":
+			target.Pattern = "^[A-Za-z]{3}$"
+			describe(target, "ISO 4217 currency code.")
+		}
+	}
+
+	return required
+}
+
+// describe adds a sentence to the description of a schema.
+func describe(s *schema, text string) {
+	s.Description = strings.TrimSpace(s.Description + " " + text)
+}
+
+// bound sets a min, max or len constraint, which limits the length of strings
+// and the value of numbers.
+func bound(s *schema, rule string, n float64) {
+	if s.Type == "string" {
+		l := int(n)
+		if rule != "max" {
+			s.MinLength = &l
+		}
+		if rule != "min" {
+			s.MaxLength = &l
+		}
+		return
+	}
+
+	if rule != "max" {
+		s.Minimum = &n
+	}
+	if rule != "min" {
+		s.Maximum = &n
+	}
+}
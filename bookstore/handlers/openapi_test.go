@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/go-cmp/cmp"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/author"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/cover"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/idempotency"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/tests"
+)
+
+// newTestAuth returns an Auth signing tokens with a fresh key of id "test".
+func newTestAuth(t *testing.T) *auth.Auth {
+	t.Helper()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := auth.Keys{"test": privateKey}
+	a, err := auth.New("RS256", keys.Lookup, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// newTestAPI returns the API over in-memory stores and the Auth its tokens
+// are checked with.
+func newTestAPI(t *testing.T) (*App, *auth.Auth) {
+	t.Helper()
+
+	a := newTestAuth(t)
+	events := product.NewBroadcaster(8, 8)
+	db := product.WithEvents(product.NewMemoryStore(), events)
+	tk := Tokens{Auth: a, KID: "test", Users: auth.Users{}}
+	logger := log.New(ioutil.Discard, "", 0)
+	idem := Idempotency{Store: idempotency.NewMemoryStore(), Window: time.Hour, Log: logger}
+
+	return API(db, author.NewMemoryStore(), events, cover.NewMemoryStore(), &tk, &idem, nil, tests.LoanPolicy(), 0, logger).(*App), a
+}
+
+// newTestToken returns a token for subject with the given roles, signed for
+// the Auth of newTestAPI.
+func newTestToken(t *testing.T, a *auth.Auth, subject string, roles ...string) string {
+	t.Helper()
+
+	claims := auth.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   subject,
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		Roles: roles,
+	}
+	token, err := a.GenerateToken("test", claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// TestOpenAPIRoutes fails when a route is registered without a spec entry in
+// operations, or an entry is left for a route that is gone.
+func TestOpenAPIRoutes(t *testing.T) {
+	app, _ := newTenantAPI(t)
+
+	_, missing := openAPI(app.routes, true)
+	for _, key := range missing {
+		t.Errorf("route %s has no spec entry in operations", key)
+	}
+
+	registered := make(map[string]bool)
+	for _, rt := range app.routes {
+		registered[rt.key()] = true
+	}
+	for key := range operations {
+		if !registered[key] {
+			t.Errorf("spec entry %s has no route", key)
+		}
+	}
+
+	// Routes documented to require a role turn away anonymous requests.
+	for _, rt := range app.routes {
+		op := operations[rt.key()]
+		if op.Roles == nil {
+			continue
+		}
+
+		path := patternParam.ReplaceAllString(rt.Pattern, "0b0e4f5a-6b5e-4e57-9b5c-2c7b0ec1e0a1")
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(rt.Method, path, strings.NewReader("{}")))
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: documented to require %v, anonymous request got %d", rt.key(), op.Roles, w.Code)
+		}
+	}
+}
+
+// TestOpenAPIDocument checks the served document carries the request and
+// response types with their validation constraints.
+func TestOpenAPIDocument(t *testing.T) {
+	app, _ := newTestAPI(t)
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	var doc struct {
+		OpenAPI    string `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			Schemas map[string]schema
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decoding document: %s", err)
+	}
+
+	if doc.OpenAPI != "3.0.3" {
+		t.Errorf("expected openapi 3.0.3, got %q", doc.OpenAPI)
+	}
+	if _, ok := doc.Paths["/books/{id}"]["delete"]; !ok {
+		t.Error("expected DELETE /books/{id} to be documented")
+	}
+
+	schemas := doc.Components.Schemas
+	for _, name := range []string{"Product", "NewProduct", "UpdateProduct", "Author", "Review", "Event", "ErrorResponse", "FieldError"} {
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("expected schema %s", name)
+		}
+	}
+
+	np := schemas["NewProduct"]
+	if diff := cmp.Diff([]string{"name"}, np.Required); diff != "" {
+		t.Errorf("NewProduct required fields:\n%s", diff)
+	}
+	if exp, got := "uuid", np.Properties["author_id"].Format; exp != got {
+		t.Errorf("expected author_id format %q, got %q", exp, got)
+	}
+	if min := np.Properties["price"].Minimum; min == nil || *min != 0 {
+		t.Errorf("expected price minimum 0, got %v", min)
+	}
+
+	rating := schemas["NewReview"].Properties["rating"]
+	if rating.Minimum == nil || *rating.Minimum != 1 || rating.Maximum == nil || *rating.Maximum != 5 {
+		t.Errorf("expected rating between 1 and 5, got %v and %v", rating.Minimum, rating.Maximum)
+	}
+
+	if diff := cmp.Diff([]string{"error"}, schemas["ErrorResponse"].Required); diff != "" {
+		t.Errorf("ErrorResponse required fields:\n%s", diff)
+	}
+	if exp, got := "#/components/schemas/FieldError", schemas["ErrorResponse"].Properties["fields"].Items.Ref; exp != got {
+		t.Errorf("expected fields of %s, got %s", exp, got)
+	}
+}
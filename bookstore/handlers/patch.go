@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// Media types of the patch documents Patch accepts.
+const (
+	mediaMergePatch = "application/merge-patch+json"
+	mediaJSONPatch  = "application/json-patch+json"
+)
+
+// patchFields are the fields of a book a patch may change, by JSON name. The
+// other fields of the patched document must keep their values.
+var patchFields = map[string]bool{
+	"name":      true,
+	"author":    true,
+	"author_id": true,
+	"isbn":      true,
+	"genre":     true,
+	"price":     true,
+	"currency":  true,
+	"stock":     true,
+}
+
+// Patch changes the book identified in the URL with a JSON Merge Patch
+// (RFC 7396) or a JSON Patch (RFC 6902) document, depending on the
+// Content-Type, and sends the patched book back. The patch applies to the
+// book as it is served. Unlike an update it can clear fields, and the patched
+// book is validated like a new one. A JSON Patch whose test operations fail
+// gets a 409. An If-Match header makes the patch conditional on the book
+// still having that ETag.
+func (p *Products) Patch(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	rev, err := ifMatch(r)
+	if err != nil {
+		return err
+	}
+
+	apply, err := patcher(r)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	edit := func(old product.Product) (*product.UpdateProduct, error) {
+		doc, err := json.Marshal(old)
+		if err != nil {
+			return nil, errors.Wrap(err, "encoding product")
+		}
+
+		patched, err := apply(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		np, err := patchedProduct(doc, patched)
+		if err != nil {
+			return nil, err
+		}
+
+		update := patchUpdate(old, np)
+		if update == nil {
+			return nil, nil
+		}
+
+		if err := newAuthorLinker(p.Authors).linkUpdate(r.Context(), update, now); err != nil {
+			return nil, err
+		}
+
+		return update, nil
+	}
+
+	prod, err := product.Patch(r.Context(), p.DB, id, rev, edit, now)
+	if err != nil {
+		if dup := duplicateISBN(err); dup != nil {
+			return dup
+		}
+		switch err {
+		case product.ErrNotFound:
+			return NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID, product.ErrInvalidISBN, product.ErrInvalidCurrency, product.ErrNegativeAmount:
+			return NewRequestError(err, http.StatusBadRequest)
+		case product.ErrRevisionMismatch:
+			return NewRequestError(err, http.StatusPreconditionFailed)
+		default:
+			return errors.Wrapf(err, "patching product %q", id)
+		}
+	}
+
+	setETag(w, prod.Revision)
+	return Respond(w, prod, http.StatusOK)
+}
+
+// patcher reads the patch document of the request and returns the function
+// applying it to a JSON document.
+func patcher(r *http.Request) (func(doc []byte) ([]byte, error), error) {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mt != mediaMergePatch && mt != mediaJSONPatch) {
+		err := errors.Errorf("Content-Type must be %s or %s", mediaMergePatch, mediaJSONPatch)
+		return nil, NewRequestError(err, http.StatusUnsupportedMediaType)
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading patch")
+	}
+
+	if mt == mediaMergePatch {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(body, &obj); err != nil {
+			err := errors.New("merge patch must be a JSON object")
+			return nil, NewRequestError(err, http.StatusBadRequest)
+		}
+
+		apply := func(doc []byte) ([]byte, error) {
+			patched, err := jsonpatch.MergePatch(doc, body)
+			if err != nil {
+				return nil, NewRequestError(err, http.StatusBadRequest)
+			}
+			return patched, nil
+		}
+		return apply, nil
+	}
+
+	patch, err := jsonpatch.DecodePatch(body)
+	if err != nil {
+		return nil, NewRequestError(err, http.StatusBadRequest)
+	}
+
+	apply := func(doc []byte) ([]byte, error) {
+		patched, err := patch.Apply(doc)
+		switch {
+		case errors.Cause(err) == jsonpatch.ErrTestFailed:
+			return nil, NewRequestError(err, http.StatusConflict)
+		case err != nil:
+			return nil, NewRequestError(err, http.StatusUnprocessableEntity)
+		}
+		return patched, nil
+	}
+	return apply, nil
+}
+
+// patchedProduct checks that the patched document only changed the fields a
+// patch may change and returns them as a validated NewProduct.
+func patchedProduct(doc, patched []byte) (product.NewProduct, error) {
+	var np product.NewProduct
+
+	var before, after map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &before); err != nil {
+		return np, errors.Wrap(err, "decoding product")
+	}
+	if err := json.Unmarshal(patched, &after); err != nil {
+		err := errors.New("patched book must be a JSON object")
+		return np, NewRequestError(err, http.StatusBadRequest)
+	}
+
+	fields := make(map[string]json.RawMessage)
+	for name, v := range after {
+		if patchFields[name] {
+			fields[name] = v
+			continue
+		}
+		if _, ok := before[name]; !ok {
+			err := errors.Errorf("unknown field %q", name)
+			return np, NewRequestError(err, http.StatusBadRequest)
+		}
+	}
+	for name, v := range before {
+		if !patchFields[name] && !sameJSON(v, after[name]) {
+			err := errors.Errorf("field %q cannot be changed", name)
+			return np, NewRequestError(err, http.StatusBadRequest)
+		}
+	}
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return np, errors.Wrap(err, "encoding patched fields")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&np); err != nil {
+		return np, NewRequestError(err, http.StatusBadRequest)
+	}
+
+	return np, Validate(np)
+}
+
+// sameJSON reports whether two JSON values are equal. A missing value only
+// equals another missing value.
+func sameJSON(a, b json.RawMessage) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// patchUpdate returns the update changing old to the values of np, nil when
+// they are the same. Stock is only set when it changes, as reservations move
+// it without a new revision.
+func patchUpdate(old product.Product, np product.NewProduct) *product.UpdateProduct {
+	var update product.UpdateProduct
+	changed := false
+
+	str := func(dst **string, old, new string) {
+		if old != new {
+			*dst = &new
+			changed = true
+		}
+	}
+	str(&update.Name, old.Name, np.Name)
+	str(&update.Author, old.Author, np.Author)
+	str(&update.AuthorID, old.AuthorID, np.AuthorID)
+	str(&update.ISBN, old.ISBN, np.ISBN)
+	str(&update.Genre, old.Genre, np.Genre)
+	str(&update.Currency, old.Currency, np.Currency)
+
+	if old.Price != np.Price {
+		update.Price = &np.Price
+		changed = true
+	}
+	if old.Stock != np.Stock {
+		update.Stock = &np.Stock
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return &update
+}
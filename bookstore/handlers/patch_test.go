@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// TestPatch applies merge patches and JSON patches to a book.
+func TestPatch(t *testing.T) {
+	app, a := newTestAPI(t)
+
+	token := newTestToken(t, a, "alice", auth.RoleUser)
+
+	do := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do(http.MethodPost, "/books", "application/json", `{"name":"Dune","isbn":"9780441172719","genre":"sf","price":999,"currency":"USD","stock":3}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var created product.Product
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	path := "/books/" + created.ID
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"unsupported media type", "application/json", `{"genre":null}`, http.StatusUnsupportedMediaType},
+		{"malformed merge patch", mediaMergePatch, `[]`, http.StatusBadRequest},
+		{"read-only field", mediaMergePatch, `{"revision":7}`, http.StatusBadRequest},
+		{"unknown field", mediaMergePatch, `{"color":"red"}`, http.StatusBadRequest},
+		{"invalid result", mediaMergePatch, `{"name":null}`, http.StatusBadRequest},
+		{"price without currency", mediaMergePatch, `{"currency":null}`, http.StatusBadRequest},
+		{"failed test", mediaJSONPatch, `[{"op":"test","path":"/genre","value":"romance"},{"op":"remove","path":"/genre"}]`, http.StatusConflict},
+		{"missing path", mediaJSONPatch, `[{"op":"replace","path":"/nope/x","value":1}]`, http.StatusUnprocessableEntity},
+		{"clear with merge patch", mediaMergePatch, `{"isbn":null,"name":"Dune Messiah"}`, http.StatusOK},
+		{"clear with json patch", mediaJSONPatch, `[{"op":"test","path":"/genre","value":"sf"},{"op":"remove","path":"/genre"},{"op":"replace","path":"/stock","value":5}]`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		w := do(http.MethodPatch, path, tt.contentType, tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.status, w.Code, w.Body)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	var got product.Product
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Dune Messiah" || got.ISBN != "" || got.Genre != "" || got.Stock != 5 || got.Price != 999 {
+		t.Errorf("unexpected patched book %+v", got)
+	}
+	if exp := created.Revision + 2; got.Revision != exp {
+		t.Errorf("expected revision %d, got %d", exp, got.Revision)
+	}
+
+	// A patch without changes keeps the revision.
+	if w := do(http.MethodPatch, path, mediaMergePatch, `{"name":"Dune Messiah"}`); w.Code != http.StatusOK || w.Header().Get("ETag") != `"`+strconv.Itoa(got.Revision)+`"` {
+		t.Errorf("no-op patch: expected 200 with ETag of revision %d, got %d %q", got.Revision, w.Code, w.Header().Get("ETag"))
+	}
+}
@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,33 +14,121 @@ import (
 	"github.com/pkg/errors"
 
 	//"github.com/prometheus/client_golang/prometheus"
-	"go.mongodb.org/mongo-driver/mongo"
 
 	en "github.com/go-playground/locales/en"
 	ut "github.com/go-playground/universal-translator"
 	validator "gopkg.in/go-playground/validator.v9"
 	en_translations "gopkg.in/go-playground/validator.v9/translations/en"
 
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/author"
 	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
 )
 
-// Products holds the logic related to Products.
+// Products holds the logic related to Products. Authors holds the Author
+// records books are linked to as they are written.
 type Products struct {
-	DB  *mongo.Client
-	Log *log.Logger
+	DB      product.Store
+	Authors author.Store
+	Log     *log.Logger
 }
 
-// List gets all Products from the database.
+// List gets Products from the database. The author, author_id, genre and isbn
+// query parameters filter the result, sort names the field to order by (prefix it
+// with "-" for descending order) and limit sets the page size. When more
+// Products are available a Link header with rel="next" points at the next
+// page, which carries an opaque cursor parameter.
 func (p *Products) List(w http.ResponseWriter, r *http.Request) error {
-	list, err := product.List(r.Context(), p.DB)
+	q := listQuery(r)
 
+	limit, err := pageLimit(r)
 	if err != nil {
-		return errors.Wrap(err, "getting product list")
+		return err
+	}
+	q.Limit = limit
+
+	list, next, err := product.List(r.Context(), p.DB, q)
+	if err != nil {
+		switch err {
+		case product.ErrInvalidSort, product.ErrInvalidCursor, product.ErrInvalidISBN:
+			return NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "getting product list")
+		}
+	}
+
+	if next != "" {
+		setNextLink(w, r, next)
 	}
 
 	return Respond(w, list, http.StatusOK)
 }
 
+// listQuery reads the filter, sort and cursor query parameters shared by List
+// and Export.
+func listQuery(r *http.Request) product.Query {
+	params := r.URL.Query()
+
+	q := product.Query{
+		Author:   params.Get("author"),
+		AuthorID: params.Get("author_id"),
+		Genre:    params.Get("genre"),
+		ISBN:     params.Get("isbn"),
+		Sort:     params.Get("sort"),
+		Cursor:   params.Get("cursor"),
+	}
+
+	if strings.HasPrefix(q.Sort, "-") {
+		q.Sort = strings.TrimPrefix(q.Sort, "-")
+		q.Desc = true
+	}
+
+	return q
+}
+
+// Search finds Products whose name, author or genre match the q query
+// parameter, most relevant first. Each result carries its score and the
+// matching fields with the matched words highlighted. min_score drops weak
+// matches and limit and cursor page through results like List does.
+func (p *Products) Search(w http.ResponseWriter, r *http.Request) error {
+	params := r.URL.Query()
+
+	q := product.SearchQuery{
+		Text:   params.Get("q"),
+		Cursor: params.Get("cursor"),
+	}
+
+	if v := params.Get("min_score"); v != "" {
+		min, err := strconv.ParseFloat(v, 64)
+		if err != nil || min < 0 {
+			err := errors.New("min_score must be a positive number")
+			return NewRequestError(err, http.StatusBadRequest)
+		}
+		q.MinScore = min
+	}
+
+	limit, err := pageLimit(r)
+	if err != nil {
+		return err
+	}
+	q.Limit = limit
+
+	matches, next, err := product.Search(r.Context(), p.DB, q)
+	if err != nil {
+		switch err {
+		case product.ErrEmptySearch, product.ErrInvalidCursor:
+			return NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "searching products")
+		}
+	}
+
+	if next != "" {
+		setNextLink(w, r, next)
+	}
+
+	return Respond(w, matches, http.StatusOK)
+}
+
 // Retrieve gets a single Product from the database.
 func (p *Products) Retrieve(w http.ResponseWriter, r *http.Request) error {
 
@@ -57,57 +147,108 @@ func (p *Products) Retrieve(w http.ResponseWriter, r *http.Request) error {
 		}
 	}
 
+	setETag(w, prod.Revision)
 	return Respond(w, prod, http.StatusOK)
 }
 
 // Create decodes the body of a request to create a new product. The full
-// product with generated fields is sent back in the response.
+// product with generated fields is sent back in the response. The book is
+// linked to the Author given by author_id, or else to the Author its author
+// name refers to, which is created when needed.
 func (p *Products) Create(w http.ResponseWriter, r *http.Request) error {
 	var np product.NewProduct
 	if err := Decode(r, &np); err != nil {
 		return errors.Wrap(err, "decoding product")
 	}
 
-	prod, err := product.Create(r.Context(), p.DB, np, time.Now())
+	now := time.Now()
+
+	var err error
+	np.AuthorID, np.Author, err = newAuthorLinker(p.Authors).link(r.Context(), np.AuthorID, np.Author, now)
+	if err != nil {
+		return err
+	}
+
+	prod, err := product.Create(r.Context(), p.DB, np, now)
 	if err != nil {
-		return errors.Wrap(err, "creating product")
+		if dup := duplicateISBN(err); dup != nil {
+			return dup
+		}
+		switch err {
+		case product.ErrInvalidISBN, product.ErrInvalidCurrency, product.ErrNegativeAmount:
+			return NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "creating product")
+		}
 	}
 
+	setETag(w, prod.Revision)
 	return Respond(w, prod, http.StatusCreated)
 }
 
 // Update decodes the body of a request to update an existing product. The ID
-// of the product is part of the request URL.
+// of the product is part of the request URL. An If-Match header makes the
+// update conditional on the product still having that ETag. Authors are
+// linked like on Create, an empty author_id unlinks the book.
 func (p *Products) Update(w http.ResponseWriter, r *http.Request) error {
 	id := chi.URLParam(r, "id")
 
+	rev, err := ifMatch(r)
+	if err != nil {
+		return err
+	}
+
 	var update product.UpdateProduct
 	if err := Decode(r, &update); err != nil {
 		return errors.Wrap(err, "decoding product update")
 	}
 
-	if err := product.Update(r.Context(), p.DB, id, update, time.Now()); err != nil {
+	now := time.Now()
+	if err := newAuthorLinker(p.Authors).linkUpdate(r.Context(), &update, now); err != nil {
+		return err
+	}
+
+	prod, err := product.Update(r.Context(), p.DB, id, rev, update, now)
+	if err != nil {
+		if dup := duplicateISBN(err); dup != nil {
+			return dup
+		}
 		switch err {
 		case product.ErrNotFound:
 			return NewRequestError(err, http.StatusNotFound)
-		case product.ErrInvalidID:
+		case product.ErrInvalidID, product.ErrInvalidISBN, product.ErrInvalidCurrency, product.ErrNegativeAmount:
 			return NewRequestError(err, http.StatusBadRequest)
+		case product.ErrRevisionMismatch:
+			return NewRequestError(err, http.StatusPreconditionFailed)
 		default:
 			return errors.Wrapf(err, "updating product %q", id)
 		}
 	}
 
+	setETag(w, prod.Revision)
 	return Respond(w, nil, http.StatusNoContent)
 }
 
-// Delete removes a single product identified by an ID in the request URL.
+// Delete moves a single product identified by an ID in the request URL to the
+// trash. An If-Match header makes the delete conditional on the product still
+// having that ETag. The cover of the book is kept while it is in the trash, so
+// that a restore brings it back, and is removed when the book is purged.
 func (p *Products) Delete(w http.ResponseWriter, r *http.Request) error {
 	id := chi.URLParam(r, "id")
 
-	if err := product.Delete(r.Context(), p.DB, id); err != nil {
+	rev, err := ifMatch(r)
+	if err != nil {
+		return err
+	}
+
+	if err := product.Delete(r.Context(), p.DB, id, rev, time.Now()); err != nil {
 		switch err {
+		case product.ErrNotFound:
+			return NewRequestError(err, http.StatusNotFound)
 		case product.ErrInvalidID:
 			return NewRequestError(err, http.StatusBadRequest)
+		case product.ErrRevisionMismatch:
+			return NewRequestError(err, http.StatusPreconditionFailed)
 		default:
 			return errors.Wrapf(err, "deleting product %q", id)
 		}
@@ -116,6 +257,129 @@ func (p *Products) Delete(w http.ResponseWriter, r *http.Request) error {
 	return Respond(w, nil, http.StatusNoContent)
 }
 
+// Trash lists the deleted Products that have not been purged yet. It takes
+// the same filter, sort and paging query parameters as List.
+func (p *Products) Trash(w http.ResponseWriter, r *http.Request) error {
+	q := listQuery(r)
+
+	limit, err := pageLimit(r)
+	if err != nil {
+		return err
+	}
+	q.Limit = limit
+
+	list, next, err := product.Trash(r.Context(), p.DB, q)
+	if err != nil {
+		switch err {
+		case product.ErrInvalidSort, product.ErrInvalidCursor, product.ErrInvalidISBN:
+			return NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "getting trash list")
+		}
+	}
+
+	if next != "" {
+		setNextLink(w, r, next)
+	}
+
+	return Respond(w, list, http.StatusOK)
+}
+
+// Restore takes a product identified by an ID in the request URL out of the
+// trash and sends it back. An If-Match header makes the restore conditional
+// on the deleted product still having that ETag. A book whose Author was
+// renamed while it was in the trash takes the new name.
+func (p *Products) Restore(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	rev, err := ifMatch(r)
+	if err != nil {
+		return err
+	}
+
+	prod, err := product.Restore(r.Context(), p.DB, id, rev)
+	if err != nil {
+		if dup := duplicateISBN(err); dup != nil {
+			return dup
+		}
+		switch err {
+		case product.ErrNotFound:
+			return NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID:
+			return NewRequestError(err, http.StatusBadRequest)
+		case product.ErrRevisionMismatch:
+			return NewRequestError(err, http.StatusPreconditionFailed)
+		default:
+			return errors.Wrapf(err, "restoring product %q", id)
+		}
+	}
+
+	if prod, err = p.renameAuthor(r.Context(), prod); err != nil {
+		return errors.Wrapf(err, "renaming author of product %q", id)
+	}
+
+	setETag(w, prod.Revision)
+	return Respond(w, prod, http.StatusOK)
+}
+
+// renameAuthor gives a book the current name of its Author. Books of a deleted
+// Author keep their name.
+func (p *Products) renameAuthor(ctx context.Context, prod *product.Product) (*product.Product, error) {
+	if prod.AuthorID == "" {
+		return prod, nil
+	}
+
+	a, err := author.Retrieve(ctx, p.Authors, prod.AuthorID)
+	if err != nil {
+		if err == author.ErrNotFound {
+			return prod, nil
+		}
+		return nil, err
+	}
+	if a.Name == prod.Author {
+		return prod, nil
+	}
+
+	// A book changed since the restore was already written by someone who
+	// saw the restored name, it is left as it is.
+	update := product.UpdateProduct{Author: &a.Name}
+	renamed, err := product.Update(ctx, p.DB, prod.ID, prod.Revision, update, time.Now())
+	switch err {
+	case nil:
+		return renamed, nil
+	case product.ErrRevisionMismatch, product.ErrNotFound:
+		return prod, nil
+	}
+	return nil, err
+}
+
+// Duplicates reports the live books sharing an ISBN, by ISBN and oldest
+// first. The unique ISBN index is only enforced once they are merged.
+func (p *Products) Duplicates(w http.ResponseWriter, r *http.Request) error {
+	dups, err := product.Duplicates(r.Context(), p.DB)
+	if err != nil {
+		return errors.Wrap(err, "finding duplicate isbns")
+	}
+
+	return Respond(w, dups, http.StatusOK)
+}
+
+// duplicateISBN answers 409 Conflict, naming the book that has the ISBN, when
+// err is a *product.DuplicateISBNError. It returns nil for other errors.
+func duplicateISBN(err error) error {
+	var dup *product.DuplicateISBNError
+	if !errors.As(err, &dup) {
+		return nil
+	}
+
+	return &Error{
+		Err:    dup,
+		Status: http.StatusConflict,
+		Fields: []FieldError{{Field: "isbn", Error: dup.Error()}},
+		ID:     dup.ID,
+	}
+}
+
 // validate holds the settings and caches for validating request struct values.
 var validate = validator.New()
 
@@ -135,6 +399,29 @@ func init() {
 	lang, _ := translator.GetTranslator("en")
 	en_translations.RegisterDefaultTranslations(validate, lang)
 
+	// Replace the built in isbn validation with the one products are stored
+	// with, which also accepts lower case check digits and any hyphenation.
+	validate.RegisterValidation("isbn", func(fl validator.FieldLevel) bool {
+		return product.ValidISBN(fl.Field().String())
+	})
+	validate.RegisterTranslation("isbn", lang, func(ut ut.Translator) error {
+		return ut.Add("isbn", "{0} must be a valid ISBN-10 or ISBN-13", true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		t, _ := ut.T("isbn", fe.Field())
+		return t
+	})
+
+	validate.RegisterValidation("currency", func(fl validator.FieldLevel) bool {
+		_, err := product.NormalizeCurrency(fl.Field().String())
+		return err == nil
+	})
+	validate.RegisterTranslation("currency", lang, func(ut ut.Translator) error {
+		return ut.Add("currency", "{0} must be a three letter ISO 4217 currency code", true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		t, _ := ut.T("currency", fe.Field())
+		return t
+	})
+
 	// Use JSON tag names for errors instead of Go struct names.
 	validate.RegisterTagNameFunc(func(fld reflect.StructField) string {
 		name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
@@ -156,6 +443,12 @@ func Decode(r *http.Request, val interface{}) error {
 		return NewRequestError(err, http.StatusBadRequest)
 	}
 
+	return Validate(val)
+}
+
+// Validate checks the validation tags of a struct value. Failures are
+// returned as an *Error listing the offending fields.
+func Validate(val interface{}) error {
 	if err := validate.Struct(val); err != nil {
 
 		// Use a type assertion to get the real error value.
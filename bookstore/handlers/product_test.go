@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// TestDuplicateISBN answers 409 Conflict naming the book that has the ISBN,
+// and reports duplicates to admins only.
+func TestDuplicateISBN(t *testing.T) {
+	app, a := newTestAPI(t)
+
+	user := newTestToken(t, a, "alice", auth.RoleUser)
+	admin := newTestToken(t, a, "bob", auth.RoleAdmin)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do(http.MethodPost, "/books", user, `{"name":"Dune","isbn":"0-441-17271-7"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var created product.Product
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	w = do(http.MethodPost, "/books", user, `{"name":"Dune","isbn":"978-0-441-17271-9"}`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("duplicate: expected 409, got %d: %s", w.Code, w.Body)
+	}
+	var er ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &er); err != nil {
+		t.Fatal(err)
+	}
+	if er.ID != created.ID || len(er.Fields) != 1 || er.Fields[0].Field != "isbn" {
+		t.Errorf("duplicate: expected an isbn error naming %s, got %+v", created.ID, er)
+	}
+
+	if w := do(http.MethodGet, "/books/duplicates", user, ""); w.Code != http.StatusForbidden {
+		t.Errorf("report as user: expected 403, got %d", w.Code)
+	}
+	w = do(http.MethodGet, "/books/duplicates", admin, "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("report: expected 200 with no duplicates, got %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// Reservations holds the logic related to stock reservations.
+type Reservations struct {
+	DB  product.Store
+	Log *log.Logger
+}
+
+// Create holds copies of the book identified by an ID in the request URL. The
+// body gives the quantity and, optionally, how many seconds to hold them.
+// Answers 400 for a quantity under one or a TTL out of range and 409 Conflict
+// when fewer copies are in stock.
+func (rs *Reservations) Create(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	var nr product.NewReservation
+	if err := Decode(r, &nr); err != nil {
+		return errors.Wrap(err, "decoding reservation")
+	}
+
+	res, err := product.Reserve(r.Context(), rs.DB, id, nr, time.Now())
+	if err != nil {
+		switch err {
+		case product.ErrNotFound:
+			return NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID, product.ErrInvalidQuantity, product.ErrInvalidTTL:
+			return NewRequestError(err, http.StatusBadRequest)
+		case product.ErrInsufficientStock:
+			return NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "reserving product %q", id)
+		}
+	}
+
+	return Respond(w, res, http.StatusCreated)
+}
+
+// Retrieve gets a single reservation of the book identified in the URL.
+func (rs *Reservations) Retrieve(w http.ResponseWriter, r *http.Request) error {
+	res, err := rs.retrieve(r)
+	if err != nil {
+		return err
+	}
+
+	return Respond(w, res, http.StatusOK)
+}
+
+// Commit sells the copies held by a pending reservation. Answers 410 Gone once
+// the reservation expired and 409 Conflict when it is no longer pending.
+func (rs *Reservations) Commit(w http.ResponseWriter, r *http.Request) error {
+	return rs.close(w, r, product.CommitReservation)
+}
+
+// Cancel puts the copies held by a pending reservation back in stock. Answers
+// 409 Conflict when it is no longer pending.
+func (rs *Reservations) Cancel(w http.ResponseWriter, r *http.Request) error {
+	return rs.close(w, r, product.CancelReservation)
+}
+
+// closeFunc is the signature of the product functions closing a reservation.
+type closeFunc func(ctx context.Context, db product.Store, id string, now time.Time) (*product.Reservation, error)
+
+// close checks the reservation belongs to the book in the URL before closing
+// it with fn.
+func (rs *Reservations) close(w http.ResponseWriter, r *http.Request, fn closeFunc) error {
+	res, err := rs.retrieve(r)
+	if err != nil {
+		return err
+	}
+
+	res, err = fn(r.Context(), rs.DB, res.ID, time.Now())
+	if err != nil {
+		switch err {
+		case product.ErrReservationNotFound:
+			return NewRequestError(err, http.StatusNotFound)
+		case product.ErrReservationClosed:
+			return NewRequestError(err, http.StatusConflict)
+		case product.ErrReservationExpired:
+			return NewRequestError(err, http.StatusGone)
+		default:
+			return errors.Wrapf(err, "closing reservation %q", res.ID)
+		}
+	}
+
+	return Respond(w, res, http.StatusOK)
+}
+
+// retrieve gets the reservation named in the URL. A reservation of another
+// book is not found.
+func (rs *Reservations) retrieve(r *http.Request) (*product.Reservation, error) {
+	id := chi.URLParam(r, "id")
+	rid := chi.URLParam(r, "rid")
+
+	res, err := product.RetrieveReservation(r.Context(), rs.DB, rid)
+	if err != nil {
+		switch err {
+		case product.ErrReservationNotFound:
+			return nil, NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID:
+			return nil, NewRequestError(err, http.StatusBadRequest)
+		default:
+			return nil, errors.Wrapf(err, "getting reservation %q", rid)
+		}
+	}
+
+	if res.ProductID != id {
+		return nil, NewRequestError(product.ErrReservationNotFound, http.StatusNotFound)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// Reviews holds the logic related to book reviews.
+type Reviews struct {
+	DB  product.Store
+	Log *log.Logger
+}
+
+// Create reviews the book identified by an ID in the request URL on behalf
+// of the authenticated user. Answers 409 Conflict when the reviewer
+// already reviewed the book.
+func (rv *Reviews) Create(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	reviewer, err := reviewerOf(r)
+	if err != nil {
+		return err
+	}
+
+	var nr product.NewReview
+	if err := Decode(r, &nr); err != nil {
+		return errors.Wrap(err, "decoding review")
+	}
+
+	review, err := product.AddReview(r.Context(), rv.DB, id, reviewer, nr, time.Now())
+	if err != nil {
+		switch err {
+		case product.ErrNotFound:
+			return NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID, product.ErrInvalidRating:
+			return NewRequestError(err, http.StatusBadRequest)
+		case product.ErrDuplicateReview:
+			return NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "reviewing product %q", id)
+		}
+	}
+
+	return Respond(w, review, http.StatusCreated)
+}
+
+// List gets the reviews of the book identified in the URL, newest first.
+// limit sets the page size and a Link header with rel="next" points at the
+// next page like for books.
+func (rv *Reviews) List(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+
+	limit, err := pageLimit(r)
+	if err != nil {
+		return err
+	}
+
+	q := product.ReviewQuery{
+		Limit:  limit,
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+
+	list, next, err := product.ListReviews(r.Context(), rv.DB, id, q)
+	if err != nil {
+		switch err {
+		case product.ErrNotFound:
+			return NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID, product.ErrInvalidCursor:
+			return NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "getting reviews of product %q", id)
+		}
+	}
+
+	if next != "" {
+		setNextLink(w, r, next)
+	}
+
+	return Respond(w, list, http.StatusOK)
+}
+
+// Delete removes a review of the book identified in the URL. Reviewers may
+// only delete their own reviews, others get 403 Forbidden. Admins may delete
+// any review.
+func (rv *Reviews) Delete(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+	rid := chi.URLParam(r, "rid")
+
+	reviewer, err := reviewerOf(r)
+	if err != nil {
+		return err
+	}
+
+	review, err := product.RetrieveReview(r.Context(), rv.DB, rid)
+	if err == nil && review.ProductID != id {
+		err = product.ErrReviewNotFound
+	}
+	if err == nil {
+		if claims, _ := claimsOf(r); claims.Authorized(auth.RoleAdmin) {
+			reviewer = review.Reviewer
+		}
+		err = product.DeleteReview(r.Context(), rv.DB, rid, reviewer)
+	}
+	if err != nil {
+		switch err {
+		case product.ErrReviewNotFound:
+			return NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID:
+			return NewRequestError(err, http.StatusBadRequest)
+		case product.ErrNotReviewer:
+			return NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "deleting review %q", rid)
+		}
+	}
+
+	return Respond(w, nil, http.StatusNoContent)
+}
+
+// reviewerOf returns the reviewer a request is made by, the subject of its
+// token.
+func reviewerOf(r *http.Request) (string, error) {
+	claims, ok := claimsOf(r)
+	if !ok || claims.Subject == "" {
+		err := errors.New("reviews must be made with a token naming the reviewer")
+		return "", NewRequestError(err, http.StatusUnauthorized)
+	}
+
+	return claims.Subject, nil
+}
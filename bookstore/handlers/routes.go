@@ -2,31 +2,113 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/pkg/errors"
-	"go.mongodb.org/mongo-driver/mongo"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/author"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/cover"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
 	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
 )
 
-// API add routes for the handlers
-func API(client *mongo.Client, log *log.Logger) http.Handler {
-	app := NewApp(log, product.Metrics())
+// API add routes for the handlers. Reads are anonymous, writes require a
+// token with the USER role and deletes and reverts one with the ADMIN role.
+// Writes honor the Idempotency-Key header. With tenants, the book and author
+// routes work on the catalog of the tenant of the request and ADMIN tokens
+// that are not scoped to a tenant manage the tenants. Books are lent under
+// policy. Responses that are not streamed are cut after writeTimeout, when it
+// is set.
+func API(db product.Store, authors author.Store, feed product.Feed, covers cover.Store, tk *Tokens, idem *Idempotency, tn *Tenants, policy product.LoanPolicy, writeTimeout time.Duration, log *log.Logger) http.Handler {
+	app := NewApp(log, product.Metrics(), Errors(log))
+	app.timeout = writeTimeout
+
+	read := []product.Middleware{tn.Middleware()}
+	user := []product.Middleware{Authenticate(tk.Auth), Authorize(auth.RoleUser), tn.Middleware(), idem.Middleware()}
+	admin := []product.Middleware{Authenticate(tk.Auth), Authorize(auth.RoleAdmin), tn.Middleware(), idem.Middleware()}
 
 	{
-		c := Check{db: client}
+		c := Check{db: db}
 		app.Handle(http.MethodGet, "/health", c.Health)
 	}
 
-	p := Products{DB: client, Log: log}
+	app.Handle(http.MethodGet, "/token", tk.Token)
+
+	if tn != nil {
+		unscoped := []product.Middleware{Authenticate(tk.Auth), Authorize(auth.RoleAdmin), Unscoped()}
+		app.Handle(http.MethodGet, "/tenants", tn.List, unscoped...)
+		app.Handle(http.MethodPost, "/tenants", tn.Create, unscoped...)
+		app.Handle(http.MethodGet, "/tenants/{tenant}", tn.Retrieve, unscoped...)
+		app.Handle(http.MethodDelete, "/tenants/{tenant}", tn.Delete, unscoped...)
+	}
+
+	p := Products{DB: db, Authors: authors, Log: log}
+
+	app.Handle(http.MethodGet, "/books", p.List, read...)
+	app.Handle(http.MethodGet, "/books/search", p.Search, read...)
+	app.Handle(http.MethodPost, "/books:import", p.Import, user...)
+	app.Stream(http.MethodGet, "/books:export", p.Export, read...)
+	app.Handle(http.MethodGet, "/books/trash", p.Trash, read...)
+	app.Handle(http.MethodGet, "/books/duplicates", p.Duplicates, admin...)
+
+	e := Events{Feed: feed, Log: log}
+	app.Stream(http.MethodGet, "/books/events", e.Stream, read...)
+	app.Handle(http.MethodGet, "/books/{id}", p.Retrieve, read...)
+	app.Handle(http.MethodPost, "/books", p.Create, user...)
+	app.Handle(http.MethodPut, "/books/{id}", p.Update, user...)
+	app.Handle(http.MethodPatch, "/books/{id}", p.Patch, user...)
+	app.Handle(http.MethodDelete, "/books/{id}", p.Delete, admin...)
+	app.Handle(http.MethodPost, "/books/{id}/restore", p.Restore, admin...)
+	app.Handle(http.MethodGet, "/books/{id}/history", p.History, read...)
+	app.Handle(http.MethodPost, "/books/{id}/history/{revision}/revert", p.Revert, admin...)
+
+	cv := Covers{DB: db, Blobs: covers, Log: log}
+	app.Handle(http.MethodGet, "/books/{id}/cover", cv.Retrieve, read...)
+	app.Handle(http.MethodPut, "/books/{id}/cover", cv.Upload, user...)
 
-	app.Handle(http.MethodGet, "/books", p.List)
-	app.Handle(http.MethodGet, "/books/{id}", p.Retrieve)
-	app.Handle(http.MethodPost, "/books", p.Create)
-	app.Handle(http.MethodPut, "/books/{id}", p.Update)
-	app.Handle(http.MethodDelete, "/books/{id}", p.Delete)
+	rs := Reservations{DB: db, Log: log}
+	app.Handle(http.MethodPost, "/books/{id}/reservations", rs.Create, user...)
+	app.Handle(http.MethodGet, "/books/{id}/reservations/{rid}", rs.Retrieve, read...)
+	app.Handle(http.MethodPost, "/books/{id}/reservations/{rid}/commit", rs.Commit, user...)
+	app.Handle(http.MethodPost, "/books/{id}/reservations/{rid}/cancel", rs.Cancel, user...)
+
+	ln := Loans{DB: db, Policy: policy, Log: log}
+	app.Handle(http.MethodPost, "/books/{id}/checkout", ln.Checkout, user...)
+	app.Handle(http.MethodPost, "/books/{id}/return", ln.Return, user...)
+	app.Handle(http.MethodPost, "/books/{id}/renew", ln.Renew, user...)
+	app.Handle(http.MethodGet, "/books/{id}/holds", ln.ListHolds, user...)
+	app.Handle(http.MethodPost, "/books/{id}/holds", ln.PlaceHold, user...)
+	app.Handle(http.MethodDelete, "/books/{id}/holds/{hid}", ln.CancelHold, user...)
+	app.Handle(http.MethodGet, "/members/{member}/loans", ln.List, user...)
+
+	rv := Reviews{DB: db, Log: log}
+	app.Handle(http.MethodGet, "/books/{id}/reviews", rv.List, read...)
+	app.Handle(http.MethodPost, "/books/{id}/reviews", rv.Create, user...)
+	app.Handle(http.MethodDelete, "/books/{id}/reviews/{rid}", rv.Delete, user...)
+
+	a := Authors{DB: authors, Products: db, Log: log}
+	app.Handle(http.MethodGet, "/authors", a.List, read...)
+	app.Handle(http.MethodPost, "/authors", a.Create, user...)
+	app.Handle(http.MethodGet, "/authors/{id}", a.Retrieve, read...)
+	app.Handle(http.MethodPut, "/authors/{id}", a.Update, user...)
+	app.Handle(http.MethodDelete, "/authors/{id}", a.Delete, admin...)
+	app.Handle(http.MethodGet, "/authors/{id}/books", a.Books, read...)
+
+	// The document covers every route registered above and itself.
+	o := OpenAPI{}
+	app.Handle(http.MethodGet, "/openapi.json", o.Serve)
+
+	var missing []string
+	o.doc, missing = openAPI(app.routes, tn != nil)
+	for _, key := range missing {
+		log.Printf("handlers : Route %s has no OpenAPI spec entry", key)
+	}
 
 	return app
 }
@@ -37,9 +119,14 @@ type Handler func(http.ResponseWriter, *http.Request) error
 // App is the entrypoint into our application and what controls the context of
 // each request. Feel free to add any configuration data/logic on this type.
 type App struct {
-	log *log.Logger
-	mux *chi.Mux
-	mw  []product.Middleware
+	log    *log.Logger
+	mux    *chi.Mux
+	mw     []product.Middleware
+	routes []route
+
+	// timeout bounds the time a handler registered with Handle has to
+	// respond. Zero leaves the handlers unbounded.
+	timeout time.Duration
 }
 
 // NewApp constructs an App to handle a set of routes.
@@ -52,7 +139,27 @@ func NewApp(log *log.Logger, mw ...product.Middleware) *App {
 }
 
 // Handle associates a handler function with an HTTP Method and URL pattern.
-func (a *App) Handle(method, url string, h product.Handler) {
+// The middleware given here runs inside the middleware of the App.
+func (a *App) Handle(method, url string, h product.Handler, mw ...product.Middleware) {
+	a.handle(method, url, h, false, mw)
+}
+
+// Stream is like Handle for a handler that streams its response for longer
+// than a regular request, such as an export or an event stream. The App
+// timeout does not apply to it.
+func (a *App) Stream(method, url string, h product.Handler, mw ...product.Middleware) {
+	a.handle(method, url, h, true, mw)
+}
+
+// timeoutBody is the response sent when a handler runs out of time.
+const timeoutBody = `{"error":"request timed out"}`
+
+func (a *App) handle(method, url string, h product.Handler, stream bool, mw []product.Middleware) {
+
+	// First wrap handler specific middleware around this handler.
+	h = product.WrapMiddleware(mw, h)
+
+	// Add the application's general middleware to the handler chain.
 	h = product.WrapMiddleware(a.mw, h)
 
 	fn := func(w http.ResponseWriter, r *http.Request) {
@@ -66,7 +173,13 @@ func (a *App) Handle(method, url string, h product.Handler) {
 		}
 	}
 
-	a.mux.MethodFunc(method, url, fn)
+	var hf http.Handler = http.HandlerFunc(fn)
+	if a.timeout > 0 && !stream {
+		hf = http.TimeoutHandler(hf, a.timeout, timeoutBody)
+	}
+
+	a.mux.Method(method, url, hf)
+	a.routes = append(a.routes, route{Method: method, Pattern: url})
 }
 
 // Respond converts a Go value to JSON and sends it to the client.
@@ -93,6 +206,65 @@ func Respond(w http.ResponseWriter, data interface{}, statusCode int) error {
 	return nil
 }
 
+// Page sizes used by list endpoints when the client does not ask for one and
+// the largest page a client may ask for.
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// pageLimit reads the limit query parameter of a list request. It returns the
+// default page size when the parameter is missing.
+func pageLimit(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultPageLimit, nil
+	}
+
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		err := fmt.Errorf("limit must be a number between 1 and %d", maxPageLimit)
+		return 0, NewRequestError(err, http.StatusBadRequest)
+	}
+
+	return limit, nil
+}
+
+// setNextLink adds a Link header pointing at the next page of the current
+// request. The next page repeats the request query with the cursor replaced.
+func setNextLink(w http.ResponseWriter, r *http.Request, cursor string) {
+	q := r.URL.Query()
+	q.Set("cursor", cursor)
+
+	next := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.String()))
+}
+
+// setETag sets the ETag header for a product revision.
+func setETag(w http.ResponseWriter, rev int) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(rev)))
+}
+
+// ifMatch returns the product revision named by the If-Match header of the
+// request. It returns product.AnyRevision when the header is missing or "*".
+func ifMatch(r *http.Request) (int, error) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" || v == "*" {
+		return product.AnyRevision, nil
+	}
+
+	tag, err := strconv.Unquote(v)
+	if err == nil {
+		var rev int
+		if rev, err = strconv.Atoi(tag); err == nil && rev >= 0 {
+			return rev, nil
+		}
+	}
+
+	err = errors.New("If-Match must be a single ETag returned by the service")
+	return 0, NewRequestError(err, http.StatusBadRequest)
+}
+
 // FieldError is used to indicate an error with a specific request field.
 type FieldError struct {
 	Field string `json:"field"`
@@ -100,9 +272,11 @@ type FieldError struct {
 }
 
 // ErrorResponse is the form used for API responses from failures in the API.
+// ID names the existing resource a 409 Conflict is about, when there is one.
 type ErrorResponse struct {
 	Error  string       `json:"error"`
 	Fields []FieldError `json:"fields,omitempty"`
+	ID     string       `json:"id,omitempty"`
 }
 
 // Error is used to pass an error during the request through the
@@ -111,12 +285,13 @@ type Error struct {
 	Err    error
 	Status int
 	Fields []FieldError
+	ID     string
 }
 
 // NewRequestError wraps a provided error with an HTTP status code. This
 // function should be used when handlers encounter expected errors.
 func NewRequestError(err error, status int) error {
-	return &Error{err, status, nil}
+	return &Error{Err: err, Status: status}
 }
 
 // Error implements the error interface. It uses the default message of the
@@ -134,6 +309,7 @@ func RespondError(w http.ResponseWriter, err error) error {
 		er := ErrorResponse{
 			Error:  webErr.Err.Error(),
 			Fields: webErr.Fields,
+			ID:     webErr.ID,
 		}
 		if err := Respond(w, er, webErr.Status); err != nil {
 			return err
@@ -151,6 +327,38 @@ func RespondError(w http.ResponseWriter, err error) error {
 	return nil
 }
 
+// Errors handles errors coming out of the call chain. It responds to them in
+// the uniform ErrorResponse form inside the middleware chain, so middleware
+// running before it sees the status code that was sent.
+func Errors(log *log.Logger) product.Middleware {
+
+	// This is the actual middleware function to be executed.
+	f := func(before product.Handler) product.Handler {
+
+		h := func(w http.ResponseWriter, r *http.Request) error {
+
+			// Run the handler chain and catch any propagated error.
+			if err := before(w, r); err != nil {
+
+				// Log the error.
+				log.Printf("ERROR: %+v", err)
+
+				// Respond to the error.
+				if err := RespondError(w, err); err != nil {
+					return err
+				}
+			}
+
+			// Return nil to indicate the error has been handled.
+			return nil
+		}
+
+		return h
+	}
+
+	return f
+}
+
 // ServeHTTP implements the http.Handler interface.
 func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.mux.ServeHTTP(w, r)
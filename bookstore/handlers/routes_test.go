@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestTimeout cuts a slow handler after the App timeout but leaves a
+// streaming handler running.
+func TestTimeout(t *testing.T) {
+	app := NewApp(log.New(ioutil.Discard, "", 0))
+	app.timeout = 20 * time.Millisecond
+
+	slow := func(w http.ResponseWriter, r *http.Request) error {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(100 * time.Millisecond):
+		}
+		return Respond(w, "done", http.StatusOK)
+	}
+	app.Handle(http.MethodGet, "/slow", slow)
+	app.Stream(http.MethodGet, "/stream", slow)
+
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	if w := get("/slow"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("handle: expected 503, got %d: %s", w.Code, w.Body)
+	}
+	if w := get("/stream"); w.Code != http.StatusOK {
+		t.Errorf("stream: expected 200, got %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/tenant"
+)
+
+// tenantHeader names the tenant whose catalog a request works on.
+const tenantHeader = "X-Tenant-ID"
+
+// Tenants holds the logic related to tenants. A nil *Tenants serves a single
+// catalog.
+type Tenants struct {
+	Catalogs *tenant.Catalogs
+	Auth     *auth.Auth
+	Log      *log.Logger
+}
+
+// Middleware resolves the tenant of catalog requests from the X-Tenant-ID
+// header or the tenant claim of the token, and rejects requests naming none
+// or an unknown one. A token scoped to a tenant cannot be used for another.
+// On authenticated routes it must run after Authenticate. It is nil for a
+// nil *Tenants.
+func (t *Tenants) Middleware() product.Middleware {
+	if t == nil {
+		return nil
+	}
+
+	// This is the actual middleware function to be executed.
+	f := func(before product.Handler) product.Handler {
+
+		// Wrap this handler around the next one provided.
+		h := func(w http.ResponseWriter, r *http.Request) error {
+			id := r.Header.Get(tenantHeader)
+			claimed := t.claimedTenant(r)
+
+			switch {
+			case id == "":
+				id = claimed
+			case claimed != "" && claimed != id:
+				err := errors.New("the token is scoped to another tenant")
+				return NewRequestError(err, http.StatusForbidden)
+			}
+
+			if id == "" {
+				err := errors.Errorf("the tenant must be named by the %s header or the token", tenantHeader)
+				return NewRequestError(err, http.StatusBadRequest)
+			}
+
+			if _, err := t.Catalogs.Resolve(r.Context(), id); err != nil {
+				switch err {
+				case tenant.ErrNotFound:
+					return NewRequestError(err, http.StatusNotFound)
+				case tenant.ErrInvalidID:
+					return NewRequestError(err, http.StatusBadRequest)
+				default:
+					return errors.Wrapf(err, "resolving tenant %q", id)
+				}
+			}
+
+			ctx := tenant.WithID(r.Context(), id)
+			return before(w, r.WithContext(ctx))
+		}
+
+		return h
+	}
+
+	return f
+}
+
+// claimedTenant returns the tenant claim of the token of the request. Routes
+// without Authenticate read it from a valid token when there is one.
+func (t *Tenants) claimedTenant(r *http.Request) string {
+	if claims, ok := claimsOf(r); ok {
+		return claims.Tenant
+	}
+
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return ""
+	}
+
+	claims, err := t.Auth.ValidateToken(parts[1])
+	if err != nil {
+		return ""
+	}
+	return claims.Tenant
+}
+
+// Unscoped rejects tokens scoped to a tenant, which may not manage tenants.
+// It must run after Authenticate.
+func Unscoped() product.Middleware {
+
+	// This is the actual middleware function to be executed.
+	f := func(before product.Handler) product.Handler {
+
+		// Wrap this handler around the next one provided.
+		h := func(w http.ResponseWriter, r *http.Request) error {
+			claims, ok := claimsOf(r)
+			if !ok {
+				return errors.New("claims missing from context: Unscoped called without Authenticate")
+			}
+
+			if claims.Tenant != "" {
+				err := errors.New("tokens scoped to a tenant cannot manage tenants")
+				return NewRequestError(err, http.StatusForbidden)
+			}
+
+			return before(w, r)
+		}
+
+		return h
+	}
+
+	return f
+}
+
+// List returns every tenant.
+func (t *Tenants) List(w http.ResponseWriter, r *http.Request) error {
+	list, err := t.Catalogs.List(r.Context())
+	if err != nil {
+		return errors.Wrap(err, "listing tenants")
+	}
+
+	return Respond(w, list, http.StatusOK)
+}
+
+// Retrieve returns the tenant identified in the URL.
+func (t *Tenants) Retrieve(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "tenant")
+
+	tn, err := t.Catalogs.Retrieve(r.Context(), id)
+	if err != nil {
+		return tenantError(err, id)
+	}
+
+	return Respond(w, tn, http.StatusOK)
+}
+
+// Create provisions a tenant with an empty catalog. Answers 409 Conflict when
+// the ID is taken.
+func (t *Tenants) Create(w http.ResponseWriter, r *http.Request) error {
+	var nt tenant.NewTenant
+	if err := Decode(r, &nt); err != nil {
+		return errors.Wrap(err, "decoding tenant")
+	}
+
+	tn, err := t.Catalogs.Provision(r.Context(), nt, time.Now())
+	if err != nil {
+		return tenantError(err, nt.ID)
+	}
+
+	return Respond(w, tn, http.StatusCreated)
+}
+
+// Delete tears down the tenant identified in the URL and removes its whole
+// catalog for good.
+func (t *Tenants) Delete(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "tenant")
+
+	if err := t.Catalogs.Teardown(r.Context(), id); err != nil {
+		return tenantError(err, id)
+	}
+
+	return Respond(w, nil, http.StatusNoContent)
+}
+
+// tenantError maps the errors of the tenant functions to responses.
+func tenantError(err error, id string) error {
+	switch err {
+	case tenant.ErrNotFound:
+		return NewRequestError(err, http.StatusNotFound)
+	case tenant.ErrInvalidID:
+		return NewRequestError(err, http.StatusBadRequest)
+	case tenant.ErrDuplicate:
+		return NewRequestError(err, http.StatusConflict)
+	default:
+		return errors.Wrapf(err, "tenant %q", id)
+	}
+}
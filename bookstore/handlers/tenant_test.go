@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/idempotency"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/tenant"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/tests"
+)
+
+// newTenantAPI returns the API serving a catalog per tenant from memory and
+// the Auth its tokens are checked with.
+func newTenantAPI(t *testing.T) (*App, *auth.Auth) {
+	t.Helper()
+
+	a := newTestAuth(t)
+	logger := log.New(ioutil.Discard, "", 0)
+	cats := tenant.NewCatalogs(tenant.NewMemoryRegistry(), tenant.NewMemoryBackend(8, 8), logger)
+	tk := Tokens{Auth: a, KID: "test", Users: auth.Users{}}
+	idem := Idempotency{Store: idempotency.NewMemoryStore(), Window: time.Hour, Log: logger}
+	tn := Tenants{Catalogs: cats, Auth: a, Log: logger}
+
+	app := API(tenant.Products{Catalogs: cats}, tenant.Authors{Catalogs: cats}, tenant.Feed{Catalogs: cats}, tenant.Covers{Catalogs: cats}, &tk, &idem, &tn, tests.LoanPolicy(), 0, logger)
+	return app.(*App), a
+}
+
+// newTenantToken returns a token for subject scoped to a tenant.
+func newTenantToken(t *testing.T, a *auth.Auth, subject, tenant string, roles ...string) string {
+	t.Helper()
+
+	claims := auth.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   subject,
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		Roles:  roles,
+		Tenant: tenant,
+	}
+	token, err := a.GenerateToken("test", claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// TestTenants provisions tenants, keeps their catalogs apart and tears them
+// down.
+func TestTenants(t *testing.T) {
+	app, a := newTenantAPI(t)
+	admin := newTestToken(t, a, "root", auth.RoleAdmin, auth.RoleUser)
+
+	do := func(method, path, tenant, token, body string) *httptest.ResponseRecorder {
+		var rd io.Reader
+		if body != "" {
+			rd = strings.NewReader(body)
+		}
+		r := httptest.NewRequest(method, path, rd)
+		if tenant != "" {
+			r.Header.Set(tenantHeader, tenant)
+		}
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, id := range []string{"north", "south"} {
+		if w := do(http.MethodPost, "/tenants", "", admin, `{"id":"`+id+`","name":"Shop"}`); w.Code != http.StatusCreated {
+			t.Fatalf("provisioning %s: expected 201, got %d: %s", id, w.Code, w.Body)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		tenant string
+		token  string
+		body   string
+		status int
+	}{
+		{"duplicate tenant", http.MethodPost, "/tenants", "", admin, `{"id":"north","name":"Shop"}`, http.StatusConflict},
+		{"invalid tenant ID", http.MethodPost, "/tenants", "", admin, `{"id":"North!","name":"Shop"}`, http.StatusBadRequest},
+		{"scoped token managing tenants", http.MethodGet, "/tenants", "", newTenantToken(t, a, "root", "north", auth.RoleAdmin), "", http.StatusForbidden},
+		{"user managing tenants", http.MethodGet, "/tenants", "", newTestToken(t, a, "bob", auth.RoleUser), "", http.StatusForbidden},
+		{"missing tenant", http.MethodGet, "/books", "", "", "", http.StatusBadRequest},
+		{"unknown tenant", http.MethodGet, "/books", "east", "", "", http.StatusNotFound},
+		{"invalid tenant", http.MethodGet, "/books", "East!", "", "", http.StatusBadRequest},
+		{"token of another tenant", http.MethodPost, "/books", "south", newTenantToken(t, a, "bob", "north", auth.RoleUser), `{"name":"Dune"}`, http.StatusForbidden},
+		{"anonymous read with a token of another tenant", http.MethodGet, "/books", "south", newTenantToken(t, a, "bob", "north"), "", http.StatusForbidden},
+		{"tenant of the token", http.MethodPost, "/books", "", newTenantToken(t, a, "bob", "north", auth.RoleUser), `{"name":"Dune"}`, http.StatusCreated},
+		{"tenant of the header", http.MethodPost, "/books", "south", admin, `{"name":"Emma"}`, http.StatusCreated},
+		{"documents are global", http.MethodGet, "/openapi.json", "", "", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		if w := do(tt.method, tt.path, tt.tenant, tt.token, tt.body); w.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.status, w.Code, w.Body)
+		}
+	}
+
+	// Each tenant only sees its own books.
+	for id, name := range map[string]string{"north": "Dune", "south": "Emma"} {
+		w := do(http.MethodGet, "/books", id, "", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("listing %s: expected 200, got %d: %s", id, w.Code, w.Body)
+		}
+		var list []product.Product
+		if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+			t.Fatalf("listing %s: %s", id, err)
+		}
+		if len(list) != 1 || list[0].Name != name {
+			t.Errorf("listing %s: expected only %s, got %+v", id, name, list)
+		}
+	}
+
+	if w := do(http.MethodDelete, "/tenants/north", "", admin, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("teardown: expected 204, got %d: %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodGet, "/books", "north", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("after teardown: expected 404, got %d: %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodDelete, "/tenants/north", "", admin, ""); w.Code != http.StatusNotFound {
+		t.Errorf("second teardown: expected 404, got %d: %s", w.Code, w.Body)
+	}
+
+	// A tenant provisioned again starts from an empty catalog.
+	if w := do(http.MethodPost, "/tenants", "", admin, `{"id":"north","name":"Shop"}`); w.Code != http.StatusCreated {
+		t.Fatalf("provisioning again: expected 201, got %d: %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodGet, "/books", "north", "", ""); w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("provisioned again: expected an empty catalog, got %d: %s", w.Code, w.Body)
+	}
+}
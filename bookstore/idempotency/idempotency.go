@@ -0,0 +1,124 @@
+// Package idempotency remembers the requests made with an idempotency key and
+// their responses, so that a client retrying a request it does not know the
+// outcome of gets the original response instead of repeating the request.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Predefined errors identify expected failure conditions.
+var (
+	// ErrNotFound is used when a key is requested but was not used or has
+	// expired.
+	ErrNotFound = errors.New("idempotency key not found")
+
+	// ErrDuplicate is used when a key is stored while an unexpired Record
+	// has it.
+	ErrDuplicate = errors.New("idempotency key is already in use")
+
+	// ErrMismatch is used when a key is reused for a different request.
+	ErrMismatch = errors.New("idempotency key was used for a different request")
+
+	// ErrInProgress is used when a key is reused while the request first
+	// made with it has not completed.
+	ErrInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+// Record is a request made with an idempotency key and, once it completed,
+// its response. Status is zero while the request is in progress. The key
+// cannot be used for another request until the Record expires.
+type Record struct {
+	Key         string      `db:"key"`
+	Fingerprint string      `db:"fingerprint"`
+	Status      int         `db:"status"`
+	Header      http.Header `db:"header"`
+	Body        []byte      `db:"body"`
+	DateCreated time.Time   `db:"datecreated"`
+	DateExpires time.Time   `db:"dateexpires"`
+}
+
+// Store is the persistence layer behind the idempotency functions. Records
+// past their DateExpires are treated as missing and may be removed at any
+// time.
+type Store interface {
+
+	// Insert stores a new Record. It returns ErrDuplicate when an unexpired
+	// Record has its key.
+	Insert(ctx context.Context, r Record, now time.Time) error
+
+	// Retrieve returns the unexpired Record with the given key or
+	// ErrNotFound.
+	Retrieve(ctx context.Context, key string, now time.Time) (*Record, error)
+
+	// Complete stores the response of the Record with the given key or
+	// returns ErrNotFound.
+	Complete(ctx context.Context, key string, status int, header http.Header, body []byte) error
+
+	// Delete removes the Record with the given key. Removing a missing
+	// Record is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Fingerprint identifies a request by its method, URI and body.
+func Fingerprint(method, uri string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + uri + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Begin claims key for the request with the given fingerprint until now plus
+// window. It returns nil when the request is to be made, and the completed
+// Record of the same request made before to replay its response. It returns
+// ErrMismatch when the key was used for another request and ErrInProgress
+// when the request made before has not completed.
+func Begin(ctx context.Context, db Store, key, fingerprint string, now time.Time, window time.Duration) (*Record, error) {
+	r := Record{
+		Key:         key,
+		Fingerprint: fingerprint,
+		DateCreated: now.UTC(),
+		DateExpires: now.Add(window).UTC(),
+	}
+
+	for {
+		err := db.Insert(ctx, r, now)
+		if err != ErrDuplicate {
+			return nil, err
+		}
+
+		prev, err := db.Retrieve(ctx, key, now)
+		switch {
+		case err == ErrNotFound:
+
+			// The Record was released or expired in between, claim the key
+			// again.
+			continue
+		case err != nil:
+			return nil, err
+		case prev.Fingerprint != fingerprint:
+			return nil, ErrMismatch
+		case prev.Status == 0:
+			return nil, ErrInProgress
+		}
+
+		return prev, nil
+	}
+}
+
+// Complete records the response of the request made with key.
+func Complete(ctx context.Context, db Store, key string, status int, header http.Header, body []byte) error {
+	return db.Complete(ctx, key, status, header, body)
+}
+
+// Release forgets key, so the request made with it can be made again. It is
+// used when the request failed without a response worth replaying.
+func Release(ctx context.Context, db Store, key string) error {
+	return db.Delete(ctx, key)
+}
@@ -0,0 +1,53 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBegin(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryStore()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	prev, err := Begin(ctx, db, "k", "a", now, time.Hour)
+	if err != nil || prev != nil {
+		t.Fatalf("first request: expected to proceed, got %v, %v", prev, err)
+	}
+
+	if _, err := Begin(ctx, db, "k", "a", now, time.Hour); err != ErrInProgress {
+		t.Errorf("in progress: expected %v, got %v", ErrInProgress, err)
+	}
+
+	header := http.Header{"Etag": {`"1"`}}
+	if err := Complete(ctx, db, "k", http.StatusCreated, header, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	prev, err = Begin(ctx, db, "k", "a", now.Add(time.Minute), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prev == nil || prev.Status != http.StatusCreated || string(prev.Body) != "{}" || prev.Header.Get("ETag") != `"1"` {
+		t.Errorf("retry: expected the stored response, got %+v", prev)
+	}
+
+	if _, err := Begin(ctx, db, "k", "b", now, time.Hour); err != ErrMismatch {
+		t.Errorf("other request: expected %v, got %v", ErrMismatch, err)
+	}
+
+	// The key is free again once expired or released.
+	prev, err = Begin(ctx, db, "k", "b", now.Add(time.Hour), time.Hour)
+	if err != nil || prev != nil {
+		t.Errorf("expired: expected to proceed, got %v, %v", prev, err)
+	}
+	if err := Release(ctx, db, "k"); err != nil {
+		t.Fatal(err)
+	}
+	prev, err = Begin(ctx, db, "k", "c", now.Add(time.Hour), time.Hour)
+	if err != nil || prev != nil {
+		t.Errorf("released: expected to proceed, got %v, %v", prev, err)
+	}
+}
@@ -0,0 +1,83 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps records in process memory. It is safe for
+// concurrent use and is intended for tests and for running the service
+// without a database.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: make(map[string]Record),
+	}
+}
+
+// Insert adds a Record. Expired Records are removed first.
+func (s *MemoryStore) Insert(ctx context.Context, r Record, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, other := range s.records {
+		if !other.DateExpires.After(now) {
+			delete(s.records, key)
+		}
+	}
+
+	if _, ok := s.records[r.Key]; ok {
+		return ErrDuplicate
+	}
+	s.records[r.Key] = r
+
+	return nil
+}
+
+// Retrieve gets a single unexpired Record.
+func (s *MemoryStore) Retrieve(ctx context.Context, key string, now time.Time) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[key]
+	if !ok || !r.DateExpires.After(now) {
+		return nil, ErrNotFound
+	}
+
+	return &r, nil
+}
+
+// Complete stores the response of a Record.
+func (s *MemoryStore) Complete(ctx context.Context, key string, status int, header http.Header, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[key]
+	if !ok {
+		return ErrNotFound
+	}
+
+	r.Status = status
+	r.Header = header
+	r.Body = body
+	s.records[key] = r
+
+	return nil
+}
+
+// Delete removes a Record.
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+
+	return nil
+}
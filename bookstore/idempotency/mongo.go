@@ -0,0 +1,112 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/database"
+)
+
+// MongoStore is a Store backed by a MongoDB collection.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+// document is how a Record is stored. The key doubles as the Mongo _id.
+type document struct {
+	MongoID string `bson:"_id"`
+	Record  `bson:",inline"`
+}
+
+// NewMongoStore returns a Store that keeps records in the named database and
+// collection of the provided client.
+func NewMongoStore(client *mongo.Client, database, collection string) *MongoStore {
+	return &MongoStore{
+		collection: client.Database(database).Collection(collection),
+	}
+}
+
+// EnsureIndexes creates the TTL index that has the server remove expired
+// Records. Creating an index that already exists is a no-op.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	expiry := mongo.IndexModel{
+		Keys:    bson.D{{Key: "dateexpires", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+
+	if _, err := s.collection.Indexes().CreateOne(ctx, expiry); err != nil {
+		return errors.Wrap(err, "creating indexes")
+	}
+
+	return nil
+}
+
+// Insert adds a Record. The server removes expired Records only once a
+// minute, one that is still there is replaced.
+func (s *MongoStore) Insert(ctx context.Context, r Record, now time.Time) error {
+	doc := document{r.Key, r}
+
+	_, err := s.collection.InsertOne(ctx, doc)
+	if err == nil {
+		return nil
+	}
+	if !database.IsDuplicateKey(err) {
+		return errors.Wrap(err, "inserting idempotency record")
+	}
+
+	filter := bson.M{"_id": r.Key, "dateexpires": bson.M{"$lte": now}}
+	res, err := s.collection.ReplaceOne(ctx, filter, doc)
+	if err != nil {
+		return errors.Wrap(err, "replacing expired idempotency record")
+	}
+	if res.MatchedCount == 0 {
+		return ErrDuplicate
+	}
+
+	return nil
+}
+
+// Retrieve gets a single unexpired Record from the collection.
+func (s *MongoStore) Retrieve(ctx context.Context, key string, now time.Time) (*Record, error) {
+	var r Record
+
+	err := s.collection.FindOne(ctx, bson.M{"_id": key, "dateexpires": bson.M{"$gt": now}}).Decode(&r)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrap(err, "get idempotency record")
+	}
+
+	return &r, nil
+}
+
+// Complete stores the response of a Record.
+func (s *MongoStore) Complete(ctx context.Context, key string, status int, header http.Header, body []byte) error {
+	change := bson.M{"$set": bson.M{"status": status, "header": header, "body": body}}
+
+	res, err := s.collection.UpdateOne(ctx, bson.M{"_id": key}, change)
+	if err != nil {
+		return errors.Wrap(err, "completing idempotency record")
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Delete removes a Record.
+func (s *MongoStore) Delete(ctx context.Context, key string) error {
+	if _, err := s.collection.DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+		return errors.Wrap(err, "delete idempotency record")
+	}
+
+	return nil
+}
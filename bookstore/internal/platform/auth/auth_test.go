@@ -0,0 +1,195 @@
+package auth_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/crypto/bcrypt"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestAuth(t *testing.T) {
+	t.Log("Given the need to be able to authenticate and authorize access.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a single user.", testID)
+		{
+			privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a private key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create a private key.", success, testID)
+
+			// The key id we are stating represents the public key in the
+			// public key store.
+			const keyID = "54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"
+			lookup := func(kid string) (*rsa.PublicKey, error) {
+				switch kid {
+				case keyID:
+					return &privateKey.PublicKey, nil
+				}
+				return nil, fmt.Errorf("no public key found for the specified kid: %s", kid)
+			}
+
+			a, err := auth.New("RS256", lookup, auth.Keys{keyID: privateKey})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create an authenticator: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create an authenticator.", success, testID)
+
+			claims := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "service project",
+					Subject:   "5cf37266-3473-4006-984f-9325122678b7",
+					Audience:  "students",
+					ExpiresAt: time.Now().Add(8760 * time.Hour).Unix(),
+					IssuedAt:  time.Now().Unix(),
+				},
+				Roles: []string{auth.RoleAdmin},
+			}
+
+			token, err := a.GenerateToken(keyID, claims)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a JWT: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to generate a JWT.", success, testID)
+
+			parsedClaims, err := a.ValidateToken(token)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to parse the claims: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to parse the claims.", success, testID)
+
+			if exp, got := len(claims.Roles), len(parsedClaims.Roles); exp != got {
+				t.Logf("\t\tTest %d:\texp: %d", testID, exp)
+				t.Logf("\t\tTest %d:\tgot: %d", testID, got)
+				t.Fatalf("\t%s\tTest %d:\tShould have the expected number of roles: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould have the expected number of roles.", success, testID)
+
+			if exp, got := claims.Roles[0], parsedClaims.Roles[0]; exp != got {
+				t.Logf("\t\tTest %d:\texp: %v", testID, exp)
+				t.Logf("\t\tTest %d:\tgot: %v", testID, got)
+				t.Fatalf("\t%s\tTest %d:\tShould have the expected roles: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould have the expected roles.", success, testID)
+		}
+	}
+}
+
+func TestReadKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keys, err := auth.ReadKeys(dir)
+	if err != nil {
+		t.Fatalf("reading empty key set: %s", err)
+	}
+	if _, err := keys.Active(""); err == nil {
+		t.Fatal("expected an empty key set to have no active key")
+	}
+
+	for _, kid := range []string{"old", "new"} {
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}
+		if err := ioutil.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(&block), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err = auth.ReadKeys(dir)
+	if err != nil {
+		t.Fatalf("reading key set: %s", err)
+	}
+	if _, err := keys.Active(""); err == nil {
+		t.Fatal("expected the active key of two keys to need a kid")
+	}
+	if _, err := keys.Active("other"); err == nil {
+		t.Fatal("expected an unknown active kid to fail")
+	}
+	kid, err := keys.Active("new")
+	if err != nil {
+		t.Fatalf("choosing active key: %s", err)
+	}
+
+	// A token signed with a key being rotated out still validates.
+	a, err := auth.New("RS256", keys.Lookup, keys)
+	if err != nil {
+		t.Fatalf("creating authenticator: %s", err)
+	}
+	for _, kid := range []string{kid, "old"} {
+		token, err := a.GenerateToken(kid, auth.Claims{Roles: []string{auth.RoleUser}})
+		if err != nil {
+			t.Fatalf("generating token with %s: %s", kid, err)
+		}
+		if _, err := a.ValidateToken(token); err != nil {
+			t.Fatalf("validating token of %s: %s", kid, err)
+		}
+	}
+}
+
+func TestUsers(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ioutil.TempFile("", "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	fmt.Fprintf(f, "# name:hash:roles[:tenant]\n\nalice:%s:ADMIN, USER\nbob:%s:\ncarol:%s:USER:shop\n", hash, hash, hash)
+	f.Close()
+
+	users, err := auth.ReadUsers(f.Name())
+	if err != nil {
+		t.Fatalf("reading users: %s", err)
+	}
+
+	alice, err := users.Authenticate("alice", "secret")
+	if err != nil {
+		t.Fatalf("authenticating: %s", err)
+	}
+	if roles := alice.Roles; len(roles) != 2 || roles[0] != auth.RoleAdmin || roles[1] != auth.RoleUser {
+		t.Fatalf("expected roles ADMIN and USER, got %v", alice.Roles)
+	}
+	if alice.Tenant != "" {
+		t.Fatalf("expected alice without tenant, got %q", alice.Tenant)
+	}
+
+	if bob, err := users.Authenticate("bob", "secret"); err != nil || len(bob.Roles) != 0 {
+		t.Fatalf("expected bob without roles, got %v %v", bob.Roles, err)
+	}
+	if carol, err := users.Authenticate("carol", "secret"); err != nil || carol.Tenant != "shop" {
+		t.Fatalf("expected carol of tenant shop, got %q %v", carol.Tenant, err)
+	}
+	if _, err := users.Authenticate("alice", "wrong"); err != auth.ErrAuthenticationFailure {
+		t.Fatalf("wrong password: expected %v, got %v", auth.ErrAuthenticationFailure, err)
+	}
+	if _, err := users.Authenticate("dave", "secret"); err != auth.ErrAuthenticationFailure {
+		t.Fatalf("unknown user: expected %v, got %v", auth.ErrAuthenticationFailure, err)
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// ReadKeys loads the key set kept in a folder. Every file named <kid>.pem
+// holds the PEM encoded RSA private key with that key id. Keeping the keys
+// being rotated out next to the active one lets the tokens signed with them
+// validate until they expire.
+func ReadKeys(folder string) (Keys, error) {
+	files, err := filepath.Glob(filepath.Join(folder, "*.pem"))
+	if err != nil {
+		return nil, errors.Wrap(err, "listing keys")
+	}
+
+	keys := make(Keys, len(files))
+	for _, file := range files {
+		privatePEM, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading key")
+		}
+
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing key %s", file)
+		}
+
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+		keys[kid] = privateKey
+	}
+
+	return keys, nil
+}
+
+// Lookup is the PublicKeyLookup of the key set.
+func (k Keys) Lookup(kid string) (*rsa.PublicKey, error) {
+	privateKey, ok := k[kid]
+	if !ok {
+		return nil, errors.Errorf("no public key found for the specified kid: %s", kid)
+	}
+	return &privateKey.PublicKey, nil
+}
+
+// Active returns the key id new tokens are signed with. It is kid when set,
+// which must be in the key set, and otherwise the only key of the set.
+func (k Keys) Active(kid string) (string, error) {
+	if kid == "" {
+		if len(k) != 1 {
+			return "", errors.Errorf("the key set must hold exactly one key when no active kid is set, found %d", len(k))
+		}
+		for id := range k {
+			kid = id
+		}
+	}
+
+	if _, ok := k[kid]; !ok {
+		return "", errors.Errorf("active kid %q is not in the key set", kid)
+	}
+
+	return kid, nil
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrAuthenticationFailure occurs when a user name or password is wrong.
+var ErrAuthenticationFailure = errors.New("authentication failed")
+
+// User is someone a token may be issued to. The tokens of a User with a
+// Tenant are scoped to the catalog of that tenant.
+type User struct {
+	PasswordHash []byte
+	Roles        []string
+	Tenant       string
+}
+
+// Users holds the users a token may be issued to by name.
+type Users map[string]User
+
+// ReadUsers loads users from a file with a line per user of the form
+//
+//	name:bcrypt-password-hash:ROLE,ROLE[:tenant]
+//
+// Empty lines and lines starting with # are ignored.
+func ReadUsers(path string) (Users, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening users")
+	}
+	defer f.Close()
+
+	users := make(Users)
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.Split(line, ":")
+		if len(parts) < 3 || len(parts) > 4 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("line %d: expected name:password-hash:roles[:tenant]", n)
+		}
+
+		var roles []string
+		for _, role := range strings.Split(parts[2], ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				roles = append(roles, role)
+			}
+		}
+
+		user := User{PasswordHash: []byte(parts[1]), Roles: roles}
+		if len(parts) == 4 {
+			user.Tenant = strings.TrimSpace(parts[3])
+		}
+		users[parts[0]] = user
+	}
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading users")
+	}
+
+	return users, nil
+}
+
+// Authenticate checks the password of the named user and returns it.
+func (u Users) Authenticate(name, password string) (User, error) {
+	user, ok := u[name]
+	if !ok {
+		return User{}, ErrAuthenticationFailure
+	}
+
+	if err := bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password)); err != nil {
+		return User{}, ErrAuthenticationFailure
+	}
+
+	return user, nil
+}
@@ -0,0 +1,46 @@
+// Package database provides support for the errors of the mongo database
+// shared by the stores.
+package database
+
+import (
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DuplicateKeyCode is the server error code of a write violating a unique
+// index.
+const DuplicateKeyCode = 11000
+
+// IsDuplicateKey reports whether err is a write rejected by a unique index.
+func IsDuplicateKey(err error) bool {
+	return IsDuplicateKeyOn(err, "")
+}
+
+// IsDuplicateKeyOn reports whether err is a write rejected by the unique
+// index with the given name. An empty name matches any unique index.
+func IsDuplicateKeyOn(err error, index string) bool {
+	switch err := err.(type) {
+	case mongo.WriteException:
+		for _, we := range err.WriteErrors {
+			if isDuplicateKey(we.Code, we.Message, index) {
+				return true
+			}
+		}
+	case mongo.BulkWriteException:
+		for _, we := range err.WriteErrors {
+			if isDuplicateKey(we.Code, we.Message, index) {
+				return true
+			}
+		}
+	case mongo.CommandError:
+		return isDuplicateKey(int(err.Code), err.Message, index)
+	}
+	return false
+}
+
+// isDuplicateKey reports whether a server error code and message are those
+// of a write rejected by the named unique index.
+func isDuplicateKey(code int, message, index string) bool {
+	return code == DuplicateKeyCode && strings.Contains(message, index)
+}
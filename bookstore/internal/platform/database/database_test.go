@@ -0,0 +1,39 @@
+package database_test
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/database"
+)
+
+// TestIsDuplicateKey tests duplicate keys are told apart in each error type
+// the driver reports writes with.
+func TestIsDuplicateKey(t *testing.T) {
+	dup := mongo.WriteError{Code: database.DuplicateKeyCode, Message: "E11000 duplicate key error index: isbn_unique"}
+	other := mongo.WriteError{Code: 2, Message: "bad value"}
+
+	tests := []struct {
+		name  string
+		err   error
+		index string
+		exp   bool
+	}{
+		{"write", mongo.WriteException{WriteErrors: mongo.WriteErrors{other, dup}}, "", true},
+		{"write on index", mongo.WriteException{WriteErrors: mongo.WriteErrors{dup}}, "isbn_unique", true},
+		{"write on other index", mongo.WriteException{WriteErrors: mongo.WriteErrors{dup}}, "id_unique", false},
+		{"write other code", mongo.WriteException{WriteErrors: mongo.WriteErrors{other}}, "", false},
+		{"bulk write", mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: dup}}}, "", true},
+		{"command", mongo.CommandError{Code: database.DuplicateKeyCode, Message: dup.Message}, "isbn_unique", true},
+		{"command other code", mongo.CommandError{Code: 2}, "", false},
+		{"other error", errors.New("E11000"), "", false},
+		{"nil", nil, "", false},
+	}
+
+	for _, tt := range tests {
+		if got := database.IsDuplicateKeyOn(tt.err, tt.index); got != tt.exp {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.exp, got)
+		}
+	}
+}
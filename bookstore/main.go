@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 
@@ -21,149 +23,494 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/author"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/cover"
 	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/handlers"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/idempotency"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/conf"
 	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/rpc"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/tenant"
 )
 
 func main() {
-	log.Println(os.Args)
 	if err := run(); err != nil {
 		log.Fatalf("error: run get : %v", err)
 	}
 }
 
 func run() error {
-	log.Println("start main")
-	defer log.Println("end main")
 
-	var url string
-	var addr string
-	var debugAddr string
+	// =========================================================================
+	// Configuration
 
-	// Standalone is for running without minikube, with docker-compose.
-	standalone := false
+	log := log.New(os.Stdout, "Bookstore : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile)
 
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
-		case "standalone":
-			standalone = true
-		default:
-			log.Println("Unknown args: ", os.Args[1:])
+	// The defaults are for running standalone next to the mongodb of
+	// docker-compose. In the cluster the addresses and the mongo URI are set
+	// through the environment. Tokens need a key in the keys folder, which
+	// for a standalone run is made with
+	//   bookstore-admin --auth-keys-folder keys keygen
+	// and passed with --auth-keys-folder keys.
+	var cfg struct {
+		Web struct {
+			Address         string        `conf:"default:127.0.0.1:8888"`
+			GRPC            string        `conf:"default:127.0.0.1:9999,help:address of the gRPC Books service"`
+			Debug           string        `conf:"default:127.0.0.1:6060"`
+			Metrics         string        `conf:"default::2112"`
+			ReadTimeout     time.Duration `conf:"default:5s"`
+			WriteTimeout    time.Duration `conf:"default:5s"`
+			ShutdownTimeout time.Duration `conf:"default:5s"`
+		}
+		Auth struct {
+			KeysFolder string        `conf:"default:/etc/bookstore/keys,help:folder of the <kid>.pem RSA private keys tokens are signed and checked with"`
+			ActiveKID  string        `conf:"help:key id new tokens are signed with. Defaults to the only key of the folder"`
+			Algorithm  string        `conf:"default:RS256"`
+			UsersFile  string        `conf:"help:file of name:bcrypt-hash:roles lines the token endpoint issues tokens to"`
+			TokenTTL   time.Duration `conf:"default:24h"`
+		}
+		Store struct {
+			Backend string `conf:"default:mongo,help:mongo or memory. Memory keeps books in process memory and loses them on restart"`
+		}
+		Mongo struct {
+			URI         string        `conf:"default:mongodb://localhost:27017,noprint"`
+			Database    string        `conf:"default:test"`
+			Collection  string        `conf:"default:books"`
+			Authors     string        `conf:"default:authors,help:collection of the author records books reference"`
+			Idempotency string        `conf:"default:idempotency_keys,help:collection of the idempotency keys of recent writes"`
+			Covers      string        `conf:"default:covers,help:GridFS bucket of the cover images"`
+			DialTimeout time.Duration `conf:"default:10s"`
+		}
+		Covers struct {
+			Backend string `conf:"default:file,help:file or gridfs. Tenants keep their covers in their mongo database, or in memory with the memory store"`
+			Folder  string `conf:"default:/var/lib/bookstore/covers,help:folder of the cover images of the file backend"`
+		}
+		Metrics struct {
+			CacheTTL      time.Duration `conf:"default:15s,help:how long book counts are reused between scrapes"`
+			ScrapeTimeout time.Duration `conf:"default:5s"`
+		}
+		Events struct {
+			History int `conf:"default:1024,help:number of past events kept for clients resuming the stream"`
+			Buffer  int `conf:"default:64,help:number of events a client may fall behind before it is dropped"`
+		}
+		Reservations struct {
+			SweepInterval time.Duration `conf:"default:1m,help:how often expired reservations are put back in stock"`
+		}
+		Loans struct {
+			Period        time.Duration `conf:"default:336h,help:how long a book is lent for, and how much longer each renewal keeps it"`
+			MaxRenewals   int           `conf:"default:2,help:how often a loan may be renewed"`
+			Pickup        time.Duration `conf:"default:72h,help:how long a copy is kept for a ready hold"`
+			SweepInterval time.Duration `conf:"default:1m,help:how often overdue loans are flagged and copies handed to waiting holds"`
+		}
+		Idempotency struct {
+			Window time.Duration `conf:"default:24h,help:how long the response of a write made with an Idempotency-Key is replayed to retries"`
+		}
+		Tenants struct {
+			Enabled         bool          `conf:"default:false,help:serve a catalog per tenant named by the X-Tenant-ID header or the token"`
+			DatabasePrefix  string        `conf:"default:bookstore_,help:prefix of the mongo database of each tenant, followed by the tenant ID"`
+			Collection      string        `conf:"default:tenants,help:collection of the provisioned tenants"`
+			RefreshInterval time.Duration `conf:"default:30s,help:how often tenants torn down by other instances are closed"`
+		}
+		Trash struct {
+			Retention     time.Duration `conf:"default:720h,help:how long deleted books are kept. Zero keeps them forever"`
+			PurgeInterval time.Duration `conf:"default:1h"`
 		}
 	}
 
-	log := log.New(os.Stdout, "Bookstore : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile)
+	if err := conf.Parse(os.Args[1:], "BOOKSTORE", &cfg); err != nil {
+		if err == conf.ErrHelpWanted {
+			usage, err := conf.Usage("BOOKSTORE", &cfg)
+			if err != nil {
+				return errors.Wrap(err, "generating config usage")
+			}
+			fmt.Println(usage)
+			return nil
+		}
+		return errors.Wrap(err, "parsing config")
+	}
+
+	out, err := conf.String(&cfg)
+	if err != nil {
+		return errors.Wrap(err, "generating config for output")
+	}
+	log.Printf("main : Config :\n%v\n", out)
+
+	if cfg.Trash.Retention > 0 && cfg.Trash.PurgeInterval <= 0 {
+		return errors.New("trash purge interval must be positive")
+	}
+	if cfg.Reservations.SweepInterval <= 0 {
+		return errors.New("reservation sweep interval must be positive")
+	}
+	if cfg.Loans.SweepInterval <= 0 {
+		return errors.New("loan sweep interval must be positive")
+	}
+	if cfg.Loans.Period <= 0 || cfg.Loans.Pickup <= 0 || cfg.Loans.MaxRenewals < 0 {
+		return errors.New("loan period and pickup time must be positive and max renewals not negative")
+	}
+	if cfg.Tenants.Enabled && cfg.Tenants.RefreshInterval <= 0 {
+		return errors.New("tenant refresh interval must be positive")
+	}
+
+	// =========================================================================
+	// Initialize authentication support
+
+	log.Println("main : Started : Initializing authentication support")
 
-	// For minikube case to get mongodb url.
-	if standalone != true {
-		// Get mongodb service url from environments.
-		mongoSVC := os.Getenv("MONGODB_SVC_PORT_27017_TCP")
-		if mongoSVC == "" {
-			err := errors.New("failed to get mongo service")
-			return err
+	keys, err := auth.ReadKeys(cfg.Auth.KeysFolder)
+	if err != nil {
+		return errors.Wrap(err, "reading auth keys")
+	}
+
+	kid, err := keys.Active(cfg.Auth.ActiveKID)
+	if err != nil {
+		return errors.Wrapf(err, "choosing auth key of %s, keys are made with bookstore-admin keygen", cfg.Auth.KeysFolder)
+	}
+
+	authenticator, err := auth.New(cfg.Auth.Algorithm, keys.Lookup, keys)
+	if err != nil {
+		return errors.Wrap(err, "constructing auth")
+	}
 
+	users := auth.Users{}
+	if cfg.Auth.UsersFile != "" {
+		if users, err = auth.ReadUsers(cfg.Auth.UsersFile); err != nil {
+			return errors.Wrap(err, "reading auth users")
 		}
-		mongoSVC = strings.Replace(mongoSVC, "tcp", "mongodb", -1)
-		log.Println("mongo url: ", mongoSVC)
+	}
+	log.Printf("main : Signing tokens with key %s for %d users", kid, len(users))
+
+	tokens := handlers.Tokens{
+		Auth:  authenticator,
+		KID:   kid,
+		TTL:   cfg.Auth.TokenTTL,
+		Users: users,
+		Log:   log,
+	}
 
-		// Below gets the mongodb service url from configmap.
-		/*
-			kclient, err := k8s.NewInClusterClient()
-			if err != nil {
-				log.Fatal(err)
-			}
+	// =========================================================================
+	// Start Database
+
+	var db product.Store
+	var authors author.Store
+	var idemKeys idempotency.Store
+	var feed product.Feed
+	var covers cover.Store
+	var registry tenant.Registry
+	var backend tenant.Backend
+
+	// Changes are published in-process unless mongodb can stream them with
+	// change streams, which also covers writes made by other instances.
+	events := product.NewBroadcaster(cfg.Events.History, cfg.Events.Buffer)
+
+	switch cfg.Store.Backend {
+	case "memory":
+		log.Println("main : Using in-memory product store")
+		db = product.NewMemoryStore()
+		authors = author.NewMemoryStore()
+		idemKeys = idempotency.NewMemoryStore()
+		registry = tenant.NewMemoryRegistry()
+		backend = tenant.NewMemoryBackend(cfg.Events.History, cfg.Events.Buffer)
+
+	case "mongo":
+		log.Printf("main : Connecting to mongo %s", redactURI(cfg.Mongo.URI))
+		mclient, err := mongo.NewClient(options.Client().ApplyURI(cfg.Mongo.URI))
+		if err != nil {
+			return errors.Wrap(err, "creating mongo client")
+		}
 
-			var nodes corev1.NodeList
-			if err := kclient.List(context.Background(), "", &nodes); err != nil {
-				log.Fatal(err)
-			}
-			for _, node := range nodes.Items {
-				fmt.Printf("name=%q schedulable=%t\n", *node.Metadata.Name, !*node.Spec.Unschedulable)
-			}
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Mongo.DialTimeout)
+		defer cancel()
 
-			var configMap corev1.ConfigMap
-			err = kclient.Get(context.Background(), "default", "mongodb-configmap", &configMap)
-			if err != nil {
-				log.Fatalf("error failed to get configMap %v", err)
+		if err := mclient.Connect(ctx); err != nil {
+			return errors.Wrap(err, "connecting to mongo")
+		}
+		defer func() {
+			if err := mclient.Disconnect(context.Background()); err != nil {
+				log.Printf("main : Mongo disconnect failed : %v", err)
 			}
+		}()
 
-			log.Printf("get configMap %#v", configMap)
+		ms := product.NewMongoStore(mclient, cfg.Mongo.Database, cfg.Mongo.Collection)
+		switch err := ms.EnsureIndexes(ctx); err {
+		case nil:
+		case product.ErrDuplicateISBNs:
+			log.Printf("main : ISBNs are not unique : %v : GET /books/duplicates lists them", err)
+		default:
+			return errors.Wrap(err, "creating mongo indexes")
+		}
+		db = ms
 
-			var mongodbSVC corev1.Service
-			err = kclient.Get(context.Background(), "default", "mongodb-svc", &mongodbSVC)
-			if err != nil {
-				log.Fatalf("error failed to get svc %v", err)
+		as := author.NewMongoStore(mclient, cfg.Mongo.Database, cfg.Mongo.Authors)
+		if err := as.EnsureIndexes(ctx); err != nil {
+			return errors.Wrap(err, "creating mongo author indexes")
+		}
+		authors = as
+
+		ks := idempotency.NewMongoStore(mclient, cfg.Mongo.Database, cfg.Mongo.Idempotency)
+		if err := ks.EnsureIndexes(ctx); err != nil {
+			return errors.Wrap(err, "creating mongo idempotency indexes")
+		}
+		idemKeys = ks
+
+		registry = tenant.NewMongoRegistry(mclient, cfg.Mongo.Database, cfg.Tenants.Collection)
+		backend = tenant.NewMongoBackend(mclient, cfg.Tenants.DatabasePrefix, cfg.Mongo.Collection, cfg.Mongo.Authors, cfg.Mongo.Covers, cfg.Events.History, cfg.Events.Buffer)
+
+		if cfg.Covers.Backend == "gridfs" {
+			log.Println("main : Keeping covers in gridfs")
+			covers = cover.NewGridFSStore(mclient, cfg.Mongo.Database, cfg.Mongo.Covers)
+		}
+
+		if err := ms.CheckChangeStreams(ctx); err != nil {
+			log.Printf("main : Change streams unavailable, using in-process events : %v", err)
+		} else {
+			log.Println("main : Using mongo change streams for events")
+			feed = ms
+		}
+
+	default:
+		return errors.Errorf("unknown store backend %q", cfg.Store.Backend)
+	}
+
+	if feed == nil {
+		db = product.WithEvents(db, events)
+		feed = events
+	}
+
+	switch cfg.Covers.Backend {
+	case "file":
+		log.Printf("main : Keeping covers in %s", cfg.Covers.Folder)
+		covers = cover.NewFileStore(cfg.Covers.Folder)
+	case "gridfs":
+		if covers == nil {
+			return errors.New("gridfs covers require the mongo store backend")
+		}
+	default:
+		return errors.Errorf("unknown covers backend %q", cfg.Covers.Backend)
+	}
+
+	idem := handlers.Idempotency{
+		Store:  idemKeys,
+		Window: cfg.Idempotency.Window,
+		Log:    log,
+	}
+
+	// =========================================================================
+	// Start Tenants
+	//
+	// With tenants enabled every catalog request is served from the catalog
+	// of its tenant, and the single catalog above is left unused.
+
+	var cats *tenant.Catalogs
+	var tn *handlers.Tenants
+
+	if cfg.Tenants.Enabled {
+		cats = tenant.NewCatalogs(registry, backend, log)
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Mongo.DialTimeout)
+		err := cats.Refresh(ctx)
+		cancel()
+		if err != nil {
+			return errors.Wrap(err, "opening tenant catalogs")
+		}
+
+		db = tenant.Products{Catalogs: cats}
+		authors = tenant.Authors{Catalogs: cats}
+		feed = tenant.Feed{Catalogs: cats}
+		covers = tenant.Covers{Catalogs: cats}
+		tn = &handlers.Tenants{Catalogs: cats, Auth: authenticator, Log: log}
+
+		go func() {
+			ticker := time.NewTicker(cfg.Tenants.RefreshInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				ctx, cancel := context.WithTimeout(context.Background(), cfg.Tenants.RefreshInterval)
+				err := cats.Refresh(ctx)
+				cancel()
+
+				if err != nil {
+					log.Printf("main : Refreshing tenants : %v", err)
+				}
 			}
+		}()
+	}
 
-			//log.Printf("svc is %v", *mongodbSVC.Spec.ClusterIP)
+	// A change is kept when its history entry cannot be written, the failure
+	// is only logged.
+	db = product.WithHistoryLog(db, log)
 
-			url = fmt.Sprintf("mongodb://%s:27017", *mongodbSVC.Spec.ClusterIP)
-		*/
-		url = mongoSVC
-		addr = "0.0.0.0:8888"
-		debugAddr = "0.0.0.0:6060"
+	// eachCatalog calls fn with every catalog served.
+	eachCatalog := func(fn func(name string, c *tenant.Catalog)) {
+		if cats == nil {
+			fn("", &tenant.Catalog{Products: db, Authors: authors, Feed: feed, Covers: covers})
+			return
+		}
+		cats.Each(func(id string, c *tenant.Catalog) {
+			fn(" of tenant "+id, c)
+		})
+	}
+
+	// =========================================================================
+	// Start Metrics Service
+
+	if cats != nil {
+		if err := cats.CollectMetrics(prometheus.DefaultRegisterer, cfg.Metrics.CacheTTL, cfg.Metrics.ScrapeTimeout); err != nil {
+			return errors.Wrap(err, "registering tenant metrics")
+		}
 	} else {
-		url = "mongodb://localhost:27017"
-		addr = "127.0.0.1:8888"
-		debugAddr = "127.0.0.1:6060"
+		bc := product.NewBookCollector(db, cfg.Metrics.CacheTTL, cfg.Metrics.ScrapeTimeout, log, nil)
+		prometheus.MustRegister(bc)
 	}
 
-	log.Printf("getting new mongo client with url %v", url)
-	mclient, err := mongo.NewClient(options.Client().ApplyURI(url))
-	if err != nil {
-		err = errors.Wrap(err, "failed to create client")
-		return err
+	go func() {
+		log.Println("prometheus metric on", cfg.Web.Metrics)
+		http.Handle("/metrics", promhttp.Handler())
+		err := http.ListenAndServe(cfg.Web.Metrics, nil)
+		log.Println("metrics service closed", err)
+	}()
+
+	// =========================================================================
+	// Start Trash Purger
+
+	if cfg.Trash.Retention > 0 {
+		go func() {
+			log.Printf("main : Purging books deleted more than %v ago", cfg.Trash.Retention)
+			ticker := time.NewTicker(cfg.Trash.PurgeInterval)
+			defer ticker.Stop()
+
+			for {
+				eachCatalog(func(name string, c *tenant.Catalog) {
+					ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+					defer cancel()
+
+					ids, err := product.Purge(ctx, c.Products, time.Now().Add(-cfg.Trash.Retention))
+					if err != nil {
+						log.Printf("main : Purging trash%s : %v", name, err)
+						return
+					}
+					if len(ids) > 0 {
+						log.Printf("main : Purged %d books from the trash%s", len(ids), name)
+					}
+
+					// Covers go with their books.
+					for _, id := range ids {
+						if err := cover.Remove(ctx, c.Covers, id); err != nil {
+							log.Printf("main : Removing cover of purged book %s%s : %v", id, name, err)
+						}
+					}
+				})
+
+				<-ticker.C
+			}
+		}()
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	err = mclient.Connect(ctx)
+	// =========================================================================
+	// Start Reservation Sweeper
 
-	defer func() {
-		if err = mclient.Disconnect(ctx); err != nil {
-			log.Printf("mongodb disconnect failed: %v", err)
+	go func() {
+		ticker := time.NewTicker(cfg.Reservations.SweepInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			eachCatalog(func(name string, c *tenant.Catalog) {
+				ctx, cancel := context.WithTimeout(context.Background(), cfg.Reservations.SweepInterval)
+				n, err := product.SweepReservations(ctx, c.Products, time.Now())
+				cancel()
+
+				if err != nil {
+					log.Printf("main : Sweeping reservations%s : %v", name, err)
+				}
+				if n > 0 {
+					log.Printf("main : Expired %d reservations%s", n, name)
+				}
+			})
 		}
-		cancel()
 	}()
 
-	// Start metrics
-	go func() {
-		bc := product.NewBookCollector(mclient)
-		prometheus.MustRegister(bc)
+	// =========================================================================
+	// Start Loan Sweeper
 
-		log.Println("prometheus metric on 2112")
-		http.Handle("/metrics", promhttp.Handler())
-		http.ListenAndServe(":2112", nil)
+	policy := product.LoanPolicy{
+		Period:      cfg.Loans.Period,
+		MaxRenewals: cfg.Loans.MaxRenewals,
+		Pickup:      cfg.Loans.Pickup,
+	}
+
+	go func() {
+		ticker := time.NewTicker(cfg.Loans.SweepInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			eachCatalog(func(name string, c *tenant.Catalog) {
+				ctx, cancel := context.WithTimeout(context.Background(), cfg.Loans.SweepInterval)
+				sw, err := product.SweepLoans(ctx, c.Products, policy, time.Now())
+				cancel()
+
+				if err != nil {
+					log.Printf("main : Sweeping loans%s : %v", name, err)
+				}
+				if sw.Overdue > 0 || sw.Expired > 0 || sw.Promoted > 0 {
+					log.Printf("main : Found %d overdue loans, expired %d holds and readied %d holds%s", sw.Overdue, sw.Expired, sw.Promoted, name)
+				}
+			})
+		}
 	}()
 
-	// Start debug Service
+	// =========================================================================
+	// Start Debug Service
+	//
+	// /debug/pprof - Added to the default mux by importing the net/http/pprof package.
+	// /debug/vars - Added to the default mux by importing the expvar package.
+	//
+	// Not concerned with shutting this down when the application is shutdown.
 	go func() {
-		log.Println("debug service listening on", debugAddr)
-		err := http.ListenAndServe(debugAddr, http.DefaultServeMux)
+		log.Println("debug service listening on", cfg.Web.Debug)
+		err := http.ListenAndServe(cfg.Web.Debug, http.DefaultServeMux)
 		log.Println("debug service closed", err)
 	}()
 
+	// =========================================================================
 	// Start API Service
 
 	api := http.Server{
-		Addr:         addr,
-		Handler:      handlers.API(mclient, log),
-		ReadTimeout:  time.Second * 5,
-		WriteTimeout: time.Second * 5,
+		Addr:        cfg.Web.Address,
+		Handler:     handlers.API(db, authors, feed, covers, &tokens, &idem, tn, policy, cfg.Web.WriteTimeout, log),
+		ReadTimeout: cfg.Web.ReadTimeout,
 	}
 
 	// Make a channel to get server errors.
-	serverErrors := make(chan error, 1)
+	serverErrors := make(chan error, 2)
 
 	go func() {
 		log.Printf("main : API listening on %s", api.Addr)
 		serverErrors <- api.ListenAndServe()
 	}()
 
+	// =========================================================================
+	// Start gRPC Service
+
+	grpcListener, err := net.Listen("tcp", cfg.Web.GRPC)
+	if err != nil {
+		return errors.Wrap(err, "listening for grpc")
+	}
+
+	grpcServer := rpc.NewServer(db, authors, feed, authenticator, cats, log)
+
+	go func() {
+		log.Printf("main : gRPC listening on %s", grpcListener.Addr())
+		serverErrors <- grpcServer.Serve(grpcListener)
+	}()
+
 	// Make a channel to listen for an interrupt or terminate signal from the OS.
 	// Use a buffered channel because the signal package requires it.
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
+	// =========================================================================
+	// Shutdown
+
 	// Blocking main and waiting for shutdown.
 	select {
 	case err := <-serverErrors:
@@ -173,13 +520,28 @@ func run() error {
 		log.Println("main : Start shutdown")
 
 		// Give outstanding requests a deadline for completion.
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Web.ShutdownTimeout)
 		defer cancel()
 
+		// Stop the gRPC server alongside. Watch streams never end on their
+		// own, so the server is stopped hard when they outlast the deadline.
+		grpcStopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(grpcStopped)
+		}()
+		go func() {
+			select {
+			case <-grpcStopped:
+			case <-ctx.Done():
+				grpcServer.Stop()
+			}
+		}()
+
 		// Asking listener to shutdown and load shed.
 		err := api.Shutdown(ctx)
 		if err != nil {
-			log.Printf("main : Graceful shutdown did not complete in %v : %v", time.Second*5, err)
+			log.Printf("main : Graceful shutdown did not complete in %v : %v", cfg.Web.ShutdownTimeout, err)
 			err = api.Close()
 		}
 
@@ -189,5 +551,17 @@ func run() error {
 	}
 
 	return nil
+}
 
+// redactURI hides the password of a mongo URI so it can be logged. The URI is
+// not printed with the rest of the config as it may carry credentials.
+func redactURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "(unparsable URI)"
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
 }
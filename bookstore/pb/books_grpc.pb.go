@@ -0,0 +1,345 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion7
+
+// BooksClient is the client API for Books service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type BooksClient interface {
+	// Get gets a single book.
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Book, error)
+	// List streams the books matching the filters in the requested order.
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (Books_ListClient, error)
+	// Create creates a book linked to its author.
+	Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*Book, error)
+	// Update changes the fields of a book named by the update mask.
+	Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*Book, error)
+	// Delete moves a book to the trash.
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Watch streams the changes of books as they happen.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Books_WatchClient, error)
+}
+
+type booksClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBooksClient(cc grpc.ClientConnInterface) BooksClient {
+	return &booksClient{cc}
+}
+
+func (c *booksClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Book, error) {
+	out := new(Book)
+	err := c.cc.Invoke(ctx, "/bookstore.v1.Books/Get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *booksClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (Books_ListClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Books_serviceDesc.Streams[0], "/bookstore.v1.Books/List", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &booksListClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Books_ListClient interface {
+	Recv() (*Book, error)
+	grpc.ClientStream
+}
+
+type booksListClient struct {
+	grpc.ClientStream
+}
+
+func (x *booksListClient) Recv() (*Book, error) {
+	m := new(Book)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *booksClient) Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*Book, error) {
+	out := new(Book)
+	err := c.cc.Invoke(ctx, "/bookstore.v1.Books/Create", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *booksClient) Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*Book, error) {
+	out := new(Book)
+	err := c.cc.Invoke(ctx, "/bookstore.v1.Books/Update", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *booksClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/bookstore.v1.Books/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *booksClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Books_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Books_serviceDesc.Streams[1], "/bookstore.v1.Books/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &booksWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Books_WatchClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type booksWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *booksWatchClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// BooksServer is the server API for Books service.
+// All implementations must embed UnimplementedBooksServer
+// for forward compatibility
+type BooksServer interface {
+	// Get gets a single book.
+	Get(context.Context, *GetRequest) (*Book, error)
+	// List streams the books matching the filters in the requested order.
+	List(*ListRequest, Books_ListServer) error
+	// Create creates a book linked to its author.
+	Create(context.Context, *CreateRequest) (*Book, error)
+	// Update changes the fields of a book named by the update mask.
+	Update(context.Context, *UpdateRequest) (*Book, error)
+	// Delete moves a book to the trash.
+	Delete(context.Context, *DeleteRequest) (*emptypb.Empty, error)
+	// Watch streams the changes of books as they happen.
+	Watch(*WatchRequest, Books_WatchServer) error
+	mustEmbedUnimplementedBooksServer()
+}
+
+// UnimplementedBooksServer must be embedded to have forward compatible implementations.
+type UnimplementedBooksServer struct {
+}
+
+func (UnimplementedBooksServer) Get(context.Context, *GetRequest) (*Book, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedBooksServer) List(*ListRequest, Books_ListServer) error {
+	return status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedBooksServer) Create(context.Context, *CreateRequest) (*Book, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
+}
+func (UnimplementedBooksServer) Update(context.Context, *UpdateRequest) (*Book, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
+}
+func (UnimplementedBooksServer) Delete(context.Context, *DeleteRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedBooksServer) Watch(*WatchRequest, Books_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedBooksServer) mustEmbedUnimplementedBooksServer() {}
+
+// UnsafeBooksServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BooksServer will
+// result in compilation errors.
+type UnsafeBooksServer interface {
+	mustEmbedUnimplementedBooksServer()
+}
+
+func RegisterBooksServer(s grpc.ServiceRegistrar, srv BooksServer) {
+	s.RegisterService(&_Books_serviceDesc, srv)
+}
+
+func _Books_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BooksServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/bookstore.v1.Books/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BooksServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Books_List_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BooksServer).List(m, &booksListServer{stream})
+}
+
+type Books_ListServer interface {
+	Send(*Book) error
+	grpc.ServerStream
+}
+
+type booksListServer struct {
+	grpc.ServerStream
+}
+
+func (x *booksListServer) Send(m *Book) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Books_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BooksServer).Create(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/bookstore.v1.Books/Create",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BooksServer).Create(ctx, req.(*CreateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Books_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BooksServer).Update(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/bookstore.v1.Books/Update",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BooksServer).Update(ctx, req.(*UpdateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Books_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BooksServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/bookstore.v1.Books/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BooksServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Books_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BooksServer).Watch(m, &booksWatchServer{stream})
+}
+
+type Books_WatchServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type booksWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *booksWatchServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Books_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "bookstore.v1.Books",
+	HandlerType: (*BooksServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _Books_Get_Handler,
+		},
+		{
+			MethodName: "Create",
+			Handler:    _Books_Create_Handler,
+		},
+		{
+			MethodName: "Update",
+			Handler:    _Books_Update_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Books_Delete_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "List",
+			Handler:       _Books_List_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _Books_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "books.proto",
+}
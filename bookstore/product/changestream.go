@@ -0,0 +1,147 @@
+package product
+
+import (
+	"context"
+	"encoding/base64"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Server error codes returned when a change stream cannot be resumed.
+const (
+	codeChangeStreamFatal       = 280
+	codeChangeStreamHistoryLost = 286
+)
+
+// changeEvent is the part of a change stream document Subscribe uses.
+type changeEvent struct {
+	OperationType string              `bson:"operationType"`
+	FullDocument  *Product            `bson:"fullDocument"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+	DocumentKey   struct {
+		ID interface{} `bson:"_id"`
+	} `bson:"documentKey"`
+	UpdateDescription struct {
+		UpdatedFields bson.M `bson:"updatedFields"`
+	} `bson:"updateDescription"`
+}
+
+// CheckChangeStreams reports whether the server supports change streams,
+// which needs a replica set or a sharded cluster.
+func (s *MongoStore) CheckChangeStreams(ctx context.Context) error {
+	cs, err := s.collection.Watch(ctx, mongo.Pipeline{})
+	if err != nil {
+		return errors.Wrap(err, "opening change stream")
+	}
+	return cs.Close(ctx)
+}
+
+// Subscribe implements Feed with a change stream on the collection, so it
+// sees the writes of every instance of the service. Event IDs are change
+// stream resume tokens. Every subscriber has its own change stream, events
+// are only read from the server as fast as the subscriber takes them.
+func (s *MongoStore) Subscribe(ctx context.Context, after string) (<-chan Event, error) {
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+
+	if after != "" {
+		token, err := base64.RawURLEncoding.DecodeString(after)
+		if err != nil || bson.Raw(token).Validate() != nil {
+			return nil, ErrEventsExpired
+		}
+		opts.SetResumeAfter(bson.Raw(token))
+	}
+
+	cs, err := s.collection.Watch(ctx, mongo.Pipeline{}, opts)
+	if err != nil {
+		if cerr, ok := err.(mongo.CommandError); ok && after != "" {
+			if cerr.Code == codeChangeStreamHistoryLost || cerr.Code == codeChangeStreamFatal {
+				return nil, ErrEventsExpired
+			}
+		}
+		return nil, errors.Wrap(err, "opening change stream")
+	}
+
+	ch := make(chan Event)
+
+	go func() {
+		defer close(ch)
+		defer cs.Close(context.Background())
+
+		for cs.Next(ctx) {
+			var ce changeEvent
+			if err := cs.Decode(&ce); err != nil {
+				return
+			}
+
+			e, ok := ce.event()
+			if !ok {
+				continue
+			}
+			e.ID = base64.RawURLEncoding.EncodeToString(cs.ResumeToken())
+
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// event converts a change stream document. Deleting and restoring a Product
+// are updates of its datedeleted field, and a Loan marked overdue is an
+// update of the overdue field alone, as returns also change the copies on
+// loan. It returns false for changes that do
+// not describe a single product, such as dropping the collection, and for
+// purges, which only remove Products that were already deleted.
+func (ce *changeEvent) event() (Event, bool) {
+	e := Event{
+		Time: time.Unix(int64(ce.ClusterTime.T), 0).UTC(),
+	}
+
+	switch ce.OperationType {
+	case "insert":
+		e.Type = EventCreated
+	case "update", "replace":
+		e.Type = EventUpdated
+		fields := ce.UpdateDescription.UpdatedFields
+		if _, ok := fields["overdue"]; ok && len(fields) == 1 {
+			e.Type = EventOverdue
+		}
+		if deleted, ok := fields["datedeleted"]; ok {
+			e.Type = EventRestored
+			if deleted != nil {
+				e.Type = EventDeleted
+			}
+		}
+	default:
+		return Event{}, false
+	}
+
+	if ce.FullDocument != nil {
+		e.ProductID = ce.FullDocument.ID
+		if e.Type != EventDeleted {
+			e.Product = ce.FullDocument
+		}
+	}
+
+	// The full document is missing when the Product was purged before it
+	// could be looked up, only the _id is left. Products stored before the
+	// product ID was used as the _id cannot be named and are skipped.
+	if e.ProductID == "" {
+		id, ok := ce.DocumentKey.ID.(string)
+		if !ok {
+			return Event{}, false
+		}
+		e.ProductID = id
+	}
+
+	return e, true
+}
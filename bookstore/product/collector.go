@@ -2,34 +2,85 @@ package product
 
 import (
 	"context"
-	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// BookCollector defines collections for prometheus.
+// recentWindow is how far back the recently created books gauge looks.
+const recentWindow = 24 * time.Hour
+
+// BookCollector defines collections for prometheus. The counts come from a
+// single Store.Stats call whose result, failures included, is cached for TTL
+// so that frequent or concurrent scrapes share one database query.
 type BookCollector struct {
-	DB                   *mongo.Client
+	DB      Store
+	Log     *log.Logger
+	TTL     time.Duration
+	Timeout time.Duration
+
 	BookCount            *prometheus.Desc
 	BookGenreUniqueCount *prometheus.Desc
 	BookInfo             *prometheus.Desc
+	AuthorBookCount      *prometheus.Desc
+	RecentBookCount      *prometheus.Desc
+	RatingCount          *prometheus.Desc
+	ActiveLoanCount      *prometheus.Desc
+	OverdueLoanCount     *prometheus.Desc
+	Up                   *prometheus.Desc
+	Errors               *prometheus.Desc
+
+	mu       sync.Mutex
+	stats    *Stats
+	err      error
+	expires  time.Time
+	failures int
 }
 
-//NewBookCollector returns a BookCollector instance.
-func NewBookCollector(client *mongo.Client) *BookCollector {
+// NewBookCollector returns a BookCollector instance. Stats are cached for ttl
+// and each query of the Store is given timeout to complete. The labels, such
+// as the tenant of the Store, are added to every metric.
+func NewBookCollector(db Store, ttl, timeout time.Duration, log *log.Logger, labels prometheus.Labels) *BookCollector {
 	return &BookCollector{
-		DB: client,
+		DB:      db,
+		Log:     log,
+		TTL:     ttl,
+		Timeout: timeout,
 		BookCount: prometheus.NewDesc(
-			"Bookstore_bookcount", "Shows bookstore number of books.", nil, nil,
+			"Bookstore_bookcount", "Shows bookstore number of books.", nil, labels,
 		),
 		BookGenreUniqueCount: prometheus.NewDesc(
-			"Bookstore_genrecount", "Shows unique genre counts.", nil, nil,
+			"Bookstore_genrecount", "Shows unique genre counts.", nil, labels,
 		),
 		BookInfo: prometheus.NewDesc(
 			"Bookstore_bookinfo", "Shows books information.",
-			[]string{"genre"}, nil,
+			[]string{"genre"}, labels,
+		),
+		AuthorBookCount: prometheus.NewDesc(
+			"bookstore_author_books", "Shows number of books per author.",
+			[]string{"author"}, labels,
+		),
+		RecentBookCount: prometheus.NewDesc(
+			"bookstore_books_created_24h", "Shows number of books created in the last 24 hours.", nil, labels,
+		),
+		RatingCount: prometheus.NewDesc(
+			"bookstore_review_ratings", "Shows number of reviews giving each rating.",
+			[]string{"rating"}, labels,
+		),
+		ActiveLoanCount: prometheus.NewDesc(
+			"bookstore_loans_active", "Shows number of copies on loan.", nil, labels,
+		),
+		OverdueLoanCount: prometheus.NewDesc(
+			"bookstore_loans_overdue", "Shows number of overdue loans.", nil, labels,
+		),
+		Up: prometheus.NewDesc(
+			"bookstore_collector_up", "Whether the last collection of book metrics succeeded.", nil, labels,
+		),
+		Errors: prometheus.NewDesc(
+			"bookstore_collector_errors_total", "Shows number of failed collections of book metrics.", nil, labels,
 		),
 	}
 }
@@ -39,52 +90,67 @@ func (bc *BookCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- bc.BookCount
 	ch <- bc.BookGenreUniqueCount
 	ch <- bc.BookInfo
+	ch <- bc.AuthorBookCount
+	ch <- bc.RecentBookCount
+	ch <- bc.RatingCount
+	ch <- bc.ActiveLoanCount
+	ch <- bc.OverdueLoanCount
+	ch <- bc.Up
+	ch <- bc.Errors
 }
 
-// Collect gets the metrics and send to the channel.
+// Collect gets the metrics and send to the channel. When the stats cannot be
+// read only the up and error metrics are sent.
 func (bc *BookCollector) Collect(ch chan<- prometheus.Metric) {
-	products := []Product{}
+	st, failures, err := bc.load()
 
-	collection := bc.DB.Database("test").Collection("books")
-
-	ctx := context.Background()
-	cursor, err := collection.Find(ctx, bson.M{})
+	ch <- prometheus.MustNewConstMetric(bc.Errors, prometheus.CounterValue, float64(failures))
 	if err != nil {
-		fmt.Printf("find products error: %v", err)
+		ch <- prometheus.MustNewConstMetric(bc.Up, prometheus.GaugeValue, 0)
 		return
-		//return nil, errors.Wrap(err, "selecting products")
 	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var p Product
-		if err = cursor.Decode(&p); err != nil {
-			fmt.Printf("decode product error: %v", err)
-			return
-			//return nil, errors.Wrap(err, "decoding produces")
-		}
-		products = append(products, p)
+	ch <- prometheus.MustNewConstMetric(bc.Up, prometheus.GaugeValue, 1)
+
+	for genre, n := range st.ByGenre {
+		ch <- prometheus.MustNewConstMetric(bc.BookInfo, prometheus.GaugeValue, float64(n), genre)
+	}
+	for author, n := range st.ByAuthor {
+		ch <- prometheus.MustNewConstMetric(bc.AuthorBookCount, prometheus.GaugeValue, float64(n), author)
 	}
 
-	productCount := len(products)
-	genreMap := make(map[string]int)
-	genreConut := 0
-
-	for i := 0; i < productCount; i++ {
-		prod := products[i]
-		if _, ok := genreMap[prod.Genre]; !ok {
-			genreMap[prod.Genre] = 1
-			genreConut++
-		} else {
-			genreMap[prod.Genre]++
-		}
+	// Every rating is sent, the distribution has no gaps.
+	for rating := MinRating; rating <= MaxRating; rating++ {
+		ch <- prometheus.MustNewConstMetric(bc.RatingCount, prometheus.GaugeValue, float64(st.Ratings[rating]), strconv.Itoa(rating))
 	}
 
-	for k, v := range genreMap {
-		ch <- prometheus.MustNewConstMetric(bc.BookInfo, prometheus.GaugeValue, float64(v), k)
+	ch <- prometheus.MustNewConstMetric(bc.BookCount, prometheus.GaugeValue, float64(st.Total))
+	ch <- prometheus.MustNewConstMetric(bc.BookGenreUniqueCount, prometheus.GaugeValue, float64(len(st.ByGenre)))
+	ch <- prometheus.MustNewConstMetric(bc.RecentBookCount, prometheus.GaugeValue, float64(st.CreatedSince))
+	ch <- prometheus.MustNewConstMetric(bc.ActiveLoanCount, prometheus.GaugeValue, float64(st.ActiveLoans))
+	ch <- prometheus.MustNewConstMetric(bc.OverdueLoanCount, prometheus.GaugeValue, float64(st.OverdueLoans))
+}
+
+// load returns the cached stats, refreshing them once they expire. The lock
+// is held during the refresh so concurrent scrapes wait for the same query
+// instead of starting their own.
+func (bc *BookCollector) load() (*Stats, int, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(bc.expires) {
+		return bc.stats, bc.failures, bc.err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), bc.Timeout)
+	defer cancel()
+
+	bc.stats, bc.err = bc.DB.Stats(ctx, now.Add(-recentWindow))
+	if bc.err != nil {
+		bc.failures++
+		bc.Log.Printf("ERROR: collecting book metrics: %v", bc.err)
 	}
+	bc.expires = now.Add(bc.TTL)
 
-	ch <- prometheus.MustNewConstMetric(bc.BookCount, prometheus.GaugeValue, float64(productCount))
-	ch <- prometheus.MustNewConstMetric(bc.BookGenreUniqueCount, prometheus.GaugeValue, float64(genreConut))
-	//ch <-
+	return bc.stats, bc.failures, bc.err
 }
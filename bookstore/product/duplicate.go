@@ -0,0 +1,70 @@
+package product
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// ErrDuplicateISBNs is returned by EnsureIndexes when live Products already
+// share an ISBN, so that the unique ISBN index cannot be created. The other
+// indexes are created. Duplicates lists the Products to merge.
+var ErrDuplicateISBNs = errors.New("books share ISBNs, merge them to enforce unique ISBNs")
+
+// DuplicateISBNError is used when a live Product is given the ISBN of
+// another live Product. ID names that other Product, it is empty when it
+// could not be found anymore.
+type DuplicateISBNError struct {
+	ISBN string
+	ID   string
+}
+
+// Error implements the error interface.
+func (err *DuplicateISBNError) Error() string {
+	if err.ID == "" {
+		return fmt.Sprintf("ISBN %s is already used by another book", err.ISBN)
+	}
+	return fmt.Sprintf("ISBN %s is already used by book %s", err.ISBN, err.ID)
+}
+
+// Duplicate is a set of live Products sharing an ISBN, oldest first.
+type Duplicate struct {
+	ISBN     string    `json:"isbn"`
+	Products []Product `json:"products"`
+}
+
+// Duplicates returns the live Products that share an ISBN, by ISBN. ISBNs
+// stored before they were normalized are compared in their normalized form,
+// so these are reported even though the unique index misses them.
+func Duplicates(ctx context.Context, db Store) ([]Duplicate, error) {
+	groups := make(map[string][]Product)
+
+	err := Walk(ctx, db, Query{Sort: "date_created"}, func(p Product) error {
+		if p.ISBN == "" {
+			return nil
+		}
+		isbn, err := NormalizeISBN(p.ISBN)
+		if err != nil {
+			isbn = p.ISBN
+		}
+		groups[isbn] = append(groups[isbn], p)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "walking products")
+	}
+
+	dups := []Duplicate{}
+	for isbn, ps := range groups {
+		if len(ps) > 1 {
+			dups = append(dups, Duplicate{ISBN: isbn, Products: ps})
+		}
+	}
+	sort.Slice(dups, func(i, j int) bool {
+		return dups[i].ISBN < dups[j].ISBN
+	})
+
+	return dups, nil
+}
@@ -0,0 +1,251 @@
+package product
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrEventsExpired is used when a feed is resumed from an event that is no
+// longer available. The subscriber has missed changes and must reload.
+var ErrEventsExpired = errors.New("events after the given ID are no longer available")
+
+// Types of change an Event describes.
+const (
+	EventCreated  = "created"
+	EventUpdated  = "updated"
+	EventDeleted  = "deleted"
+	EventRestored = "restored"
+	EventOverdue  = "overdue"
+)
+
+// Event describes a change to a Product. The ID identifies the position of
+// the event in its feed and can be used to resume a subscription. Product is
+// the state after the change and is nil for deletes. An overdue event is sent
+// when the sweeper finds a Loan of the Product overdue. Purging the trash does
+// not produce events.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	ProductID string    `json:"product_id"`
+	Product   *Product  `json:"product,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Feed is a source of Product change events.
+type Feed interface {
+
+	// Subscribe delivers the events that happen after the event with the
+	// given ID, or from now on when after is empty. The channel is closed
+	// when ctx is done or when the subscriber falls too far behind, in which
+	// case it can subscribe again from the last event it received.
+	Subscribe(ctx context.Context, after string) (<-chan Event, error)
+}
+
+// Broadcaster is an in-process Feed. It keeps a bounded history of recent
+// events so subscribers can resume after a reconnect.
+type Broadcaster struct {
+	mu      sync.Mutex
+	epoch   string
+	seq     uint64
+	history []Event
+	size    int
+	buffer  int
+	subs    map[chan Event]struct{}
+}
+
+// NewBroadcaster returns a Broadcaster remembering the last history events.
+// Each subscriber may fall up to buffer events behind before it is dropped.
+func NewBroadcaster(history, buffer int) *Broadcaster {
+	return &Broadcaster{
+
+		// The epoch makes IDs from before a restart unusable, as the
+		// sequence starts over.
+		epoch:  strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:   history,
+		buffer: buffer,
+		subs:   make(map[chan Event]struct{}),
+	}
+}
+
+// Publish assigns the next ID to the event and sends it to every subscriber.
+// It never blocks: a subscriber whose buffer is full is dropped.
+func (b *Broadcaster) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	e.ID = b.epoch + "-" + strconv.FormatUint(b.seq, 10)
+
+	b.history = append(b.history, e)
+	if len(b.history) > b.size {
+		b.history = b.history[len(b.history)-b.size:]
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe implements Feed.
+func (b *Broadcaster) Subscribe(ctx context.Context, after string) (<-chan Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	replay, err := b.since(after)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Event, b.buffer+len(replay))
+	for _, e := range replay {
+		ch <- e
+	}
+	b.subs[ch] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}()
+
+	return ch, nil
+}
+
+// since returns the remembered events after the given ID. The caller must
+// hold the lock.
+func (b *Broadcaster) since(after string) ([]Event, error) {
+	if after == "" {
+		return nil, nil
+	}
+
+	i := strings.LastIndex(after, "-")
+	if i < 0 || after[:i] != b.epoch {
+		return nil, ErrEventsExpired
+	}
+	seq, err := strconv.ParseUint(after[i+1:], 10, 64)
+	if err != nil || seq > b.seq {
+		return nil, ErrEventsExpired
+	}
+
+	// The history holds the events numbered oldest to b.seq.
+	oldest := b.seq - uint64(len(b.history)) + 1
+	if seq+1 < oldest {
+		return nil, ErrEventsExpired
+	}
+
+	replay := make([]Event, len(b.history)-int(seq+1-oldest))
+	copy(replay, b.history[seq+1-oldest:])
+	return replay, nil
+}
+
+// WithEvents returns a Store that publishes an Event to b for every Product
+// created, updated, deleted or restored through it, and for every Loan marked
+// overdue.
+func WithEvents(db Store, b *Broadcaster) Store {
+	return &eventStore{Store: db, b: b}
+}
+
+// eventStore publishes the writes made through the embedded Store.
+type eventStore struct {
+	Store
+	b *Broadcaster
+}
+
+func (s *eventStore) Insert(ctx context.Context, p Product) error {
+	if err := s.Store.Insert(ctx, p); err != nil {
+		return err
+	}
+
+	s.publish(EventCreated, p.ID, &p)
+	return nil
+}
+
+func (s *eventStore) InsertMany(ctx context.Context, ps []Product) error {
+	err := s.Store.InsertMany(ctx, ps)
+
+	var failed map[int]error
+	if err != nil {
+		berr, ok := err.(*BatchError)
+		if !ok {
+			return err
+		}
+		failed = berr.Failed
+	}
+
+	for i := range ps {
+		if _, ok := failed[i]; !ok {
+			s.publish(EventCreated, ps[i].ID, &ps[i])
+		}
+	}
+	return err
+}
+
+func (s *eventStore) Update(ctx context.Context, id string, rev int, update UpdateProduct, now time.Time) (*Product, error) {
+	p, err := s.Store.Update(ctx, id, rev, update, now)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(EventUpdated, id, p)
+	return p, nil
+}
+
+func (s *eventStore) Delete(ctx context.Context, id string, rev int, now time.Time) error {
+	if err := s.Store.Delete(ctx, id, rev, now); err != nil {
+		return err
+	}
+
+	s.publish(EventDeleted, id, nil)
+	return nil
+}
+
+func (s *eventStore) Restore(ctx context.Context, id string, rev int) (*Product, error) {
+	p, err := s.Store.Restore(ctx, id, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(EventRestored, id, p)
+	return p, nil
+}
+
+func (s *eventStore) MarkOverdue(ctx context.Context, id string, now time.Time) (*Loan, error) {
+	l, err := s.Store.MarkOverdue(ctx, id, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// The Product is left out when it is in the trash.
+	p, _ := s.Store.Retrieve(ctx, l.ProductID)
+	s.publish(EventOverdue, l.ProductID, p)
+	return l, nil
+}
+
+func (s *eventStore) publish(typ, id string, p *Product) {
+	e := Event{
+		Type:      typ,
+		ProductID: id,
+		Time:      time.Now().UTC(),
+	}
+	if p != nil {
+		cp := *p
+		e.Product = &cp
+	}
+
+	s.b.Publish(e)
+}
@@ -0,0 +1,334 @@
+package product
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// ActionReverted is the action of a history entry recording a revert. The
+// other actions are the Event types of the change.
+const ActionReverted = "reverted"
+
+// ErrHistoryNotFound is used when a specific revision is requested from the
+// history of a Product but was not recorded.
+var ErrHistoryNotFound = errors.New("revision not found in the product history")
+
+// WithHistoryLog returns a Store that logs to log the history entries it
+// cannot record instead of failing. An entry is written after the change it
+// describes is stored, so through it a change whose entry is lost is kept and
+// reported as made.
+func WithHistoryLog(db Store, log *log.Logger) Store {
+	return &historyLogStore{Store: db, log: log}
+}
+
+// historyLogStore logs the failures to record history of the embedded Store.
+type historyLogStore struct {
+	Store
+	log *log.Logger
+}
+
+func (s *historyLogStore) AddHistory(ctx context.Context, e HistoryEntry) error {
+	if err := s.Store.AddHistory(ctx, e); err != nil {
+		s.log.Printf("ERROR: recording revision %d of product %s : %v", e.Revision, e.ProductID, err)
+	}
+	return nil
+}
+
+// HistoryEntry records a change that gave a Product a new revision: who made
+// it, when, and the old and new values of the fields it changed. Entries are
+// never changed once recorded and outlive the Product they describe.
+//
+// Actor is the subject of the token of the request that made the change. It
+// is empty for changes the service makes on its own, such as migrations.
+// Reverted is the revision a revert went back to. Product is the state after
+// the change, which reverts go back to.
+//
+// Reservations and reviews change a Product without a new revision and are
+// not recorded.
+type HistoryEntry struct {
+	ProductID string    `db:"product_id" json:"product_id"`
+	Revision  int       `db:"revision" json:"revision"`
+	Action    string    `db:"action" json:"action"`
+	Actor     string    `db:"actor" json:"actor"`
+	Time      time.Time `db:"time" json:"time"`
+	Changes   []Change  `db:"changes" json:"changes"`
+	Reverted  int       `db:"reverted" json:"reverted,omitempty"`
+	Product   Product   `db:"product" json:"-"`
+}
+
+// Change is the old and new JSON value of a Product field. Old is null for
+// the fields of a created Product.
+type Change struct {
+	Field string          `json:"field"`
+	Old   json.RawMessage `json:"old"`
+	New   json.RawMessage `json:"new"`
+}
+
+// HistoryQuery describes which page of the history of a Product ListHistory
+// returns. Entries are ordered newest first.
+type HistoryQuery struct {
+
+	// Limit caps the number of entries returned, zero means no limit.
+	Limit int
+
+	// Cursor is the opaque value returned by a previous ListHistory call.
+	// When set only entries before that position are returned.
+	Cursor string
+
+	// before is the revision decoded from Cursor, populated by prepare.
+	before int
+}
+
+// historyCursor is the position of the last entry of a page.
+type historyCursor struct {
+	Revision int `json:"r"`
+}
+
+// prepare decodes the cursor of the query.
+func (q *HistoryQuery) prepare() error {
+	q.before = 0
+	if q.Cursor == "" {
+		return nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	var c historyCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Revision < 1 {
+		return ErrInvalidCursor
+	}
+
+	q.before = c.Revision
+	return nil
+}
+
+// actorKey is the context key of the actor of a change.
+type actorKey struct{}
+
+// WithActor returns a context naming who the changes made with it are
+// recorded as.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorOf returns the actor set on ctx by WithActor.
+func actorOf(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// ListHistory gets a page of the history of the Product with the given ID,
+// live or in the trash, newest first. When more entries are available, the
+// returned cursor can be set on the next query to continue after the last
+// returned entry. It is empty on the last page.
+func ListHistory(ctx context.Context, db Store, productID string, q HistoryQuery) ([]HistoryEntry, string, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, "", ErrInvalidID
+	}
+
+	if err := q.prepare(); err != nil {
+		return nil, "", err
+	}
+
+	// Ask for one extra entry to learn whether there is a next page.
+	limit := q.Limit
+	if limit > 0 {
+		q.Limit = limit + 1
+	}
+
+	entries, err := db.ListHistory(ctx, productID, q)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// A live Product recorded before history existed has none, any other
+	// Product without history does not exist.
+	if len(entries) == 0 && q.Cursor == "" {
+		if _, err := db.Retrieve(ctx, productID); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var next string
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+
+		b, _ := json.Marshal(historyCursor{Revision: entries[limit-1].Revision})
+		next = base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	return entries, next, nil
+}
+
+// Revert sets the fields of the live Product with the given ID back to the
+// values they had at revision to, which becomes a new revision. Stock is not
+// reverted, as reservations move it between revisions. When rev is not
+// AnyRevision the Product is only reverted if the stored revision still
+// equals rev.
+func Revert(ctx context.Context, db Store, id string, to, rev int, now time.Time) (*Product, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	e, err := db.RetrieveHistory(ctx, id, to)
+	if err != nil {
+		return nil, err
+	}
+
+	old := e.Product
+	update := UpdateProduct{
+		Name:     &old.Name,
+		Author:   &old.Author,
+		AuthorID: &old.AuthorID,
+		ISBN:     &old.ISBN,
+		Genre:    &old.Genre,
+		Price:    &old.Price,
+		Currency: &old.Currency,
+	}
+
+	return change(ctx, db, id, rev, fixed(update), now.UTC(), ActionReverted, to)
+}
+
+// change applies the update edit derives from the live Product with the given
+// ID and records the change as action. The Product is read first to record
+// the old values, and written on the condition that it did not change since.
+// Without an expected revision, a Product changed in between is read and
+// edited again. When edit returns no update the Product is left as it is.
+func change(ctx context.Context, db Store, id string, rev int, edit func(old Product) (*UpdateProduct, error), now time.Time, action string, reverted int) (*Product, error) {
+	for {
+		old, err := db.Retrieve(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if rev != AnyRevision && old.Revision != rev {
+			return nil, ErrRevisionMismatch
+		}
+
+		update, err := edit(*old)
+		if err != nil {
+			return nil, err
+		}
+		if update == nil {
+			return old, nil
+		}
+
+		p, err := db.Update(ctx, id, old.Revision, *update, now)
+		if err == ErrRevisionMismatch && rev == AnyRevision {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		e := newHistoryEntry(ctx, action, old, *p, update.fields(), now)
+		e.Reverted = reverted
+		if err := db.AddHistory(ctx, e); err != nil {
+			return nil, errors.Wrap(err, "recording history")
+		}
+
+		return p, nil
+	}
+}
+
+// fixed returns an edit for change that makes the same update whatever the
+// old Product.
+func fixed(update UpdateProduct) func(Product) (*UpdateProduct, error) {
+	return func(Product) (*UpdateProduct, error) {
+		return &update, nil
+	}
+}
+
+// fields returns the names of the fields update sets.
+func (u UpdateProduct) fields() []string {
+	var fields []string
+	add := func(name string, set bool) {
+		if set {
+			fields = append(fields, name)
+		}
+	}
+
+	add("name", u.Name != nil)
+	add("author", u.Author != nil)
+	add("author_id", u.AuthorID != nil)
+	add("isbn", u.ISBN != nil)
+	add("genre", u.Genre != nil)
+	add("price", u.Price != nil)
+	add("currency", u.Currency != nil)
+	add("stock", u.Stock != nil)
+
+	return fields
+}
+
+// historyFields are the Product fields history entries record changes of,
+// by JSON name.
+var historyFields = []struct {
+	name  string
+	value func(p Product) interface{}
+}{
+	{"name", func(p Product) interface{} { return p.Name }},
+	{"author", func(p Product) interface{} { return p.Author }},
+	{"author_id", func(p Product) interface{} { return p.AuthorID }},
+	{"isbn", func(p Product) interface{} { return p.ISBN }},
+	{"genre", func(p Product) interface{} { return p.Genre }},
+	{"price", func(p Product) interface{} { return p.Price }},
+	{"currency", func(p Product) interface{} { return p.Currency }},
+	{"stock", func(p Product) interface{} { return p.Stock }},
+	{"date_deleted", func(p Product) interface{} { return p.DateDeleted }},
+}
+
+// createdFields are the fields recorded for a created Product.
+var createdFields = []string{"name", "author", "author_id", "isbn", "genre", "price", "currency", "stock"}
+
+// newHistoryEntry builds the entry of a change from old to p made by the
+// actor of ctx, recording the named fields that changed. A nil old is a
+// created Product, for which the fields that are set are recorded.
+func newHistoryEntry(ctx context.Context, action string, old *Product, p Product, fields []string, now time.Time) HistoryEntry {
+	named := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		named[f] = true
+	}
+
+	changes := []Change{}
+	for _, f := range historyFields {
+		if !named[f.name] {
+			continue
+		}
+
+		c := Change{Field: f.name}
+		c.New, _ = json.Marshal(f.value(p))
+
+		if old == nil {
+			zero, _ := json.Marshal(f.value(Product{}))
+			if bytes.Equal(zero, c.New) {
+				continue
+			}
+		} else {
+			c.Old, _ = json.Marshal(f.value(*old))
+			if bytes.Equal(c.Old, c.New) {
+				continue
+			}
+		}
+
+		changes = append(changes, c)
+	}
+
+	return HistoryEntry{
+		ProductID: p.ID,
+		Revision:  p.Revision,
+		Action:    action,
+		Actor:     actorOf(ctx),
+		Time:      now,
+		Changes:   changes,
+		Product:   p,
+	}
+}
@@ -0,0 +1,122 @@
+package product
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidISBN is used when a value is not a valid ISBN-10 or ISBN-13.
+var ErrInvalidISBN = errors.New("ISBN is not a valid ISBN-10 or ISBN-13")
+
+// ValidISBN reports whether s is an ISBN-10 or ISBN-13 with a correct check
+// digit. Hyphens and spaces between digits are ignored.
+func ValidISBN(s string) bool {
+	_, err := NormalizeISBN(s)
+	return err == nil
+}
+
+// NormalizeISBN returns the canonical form of an ISBN-10 or ISBN-13, which is
+// the ISBN-13 without hyphens or spaces. ISBN-10 values are converted by
+// adding the 978 prefix and computing the new check digit.
+func NormalizeISBN(s string) (string, error) {
+	digits := isbnDigits(s)
+
+	switch len(digits) {
+	case 10:
+		if !validISBN10(digits) {
+			return "", ErrInvalidISBN
+		}
+		body := "978" + digits[:9]
+		return body + isbn13CheckDigit(body), nil
+
+	case 13:
+		if !validISBN13(digits) {
+			return "", ErrInvalidISBN
+		}
+		return digits, nil
+	}
+
+	return "", ErrInvalidISBN
+}
+
+// ISBN10 returns the ISBN-10 form of an ISBN. It returns false when the value
+// is not a valid ISBN or has no ISBN-10 form, which is the case for every
+// ISBN-13 outside the 978 prefix.
+func ISBN10(s string) (string, bool) {
+	isbn, err := NormalizeISBN(s)
+	if err != nil || !strings.HasPrefix(isbn, "978") {
+		return "", false
+	}
+
+	body := isbn[3:12]
+	return body + isbn10CheckDigit(body), true
+}
+
+// isbnDigits strips hyphens and spaces from s and upper cases a trailing x.
+// Any other character is kept so the length and digit checks reject it.
+func isbnDigits(s string) string {
+	s = strings.NewReplacer("-", "", " ", "").Replace(s)
+	return strings.ToUpper(s)
+}
+
+// validISBN10 checks the characters and the mod 11 check digit of an
+// ISBN-10. The check digit may be X for ten.
+func validISBN10(s string) bool {
+	for i := 0; i < 9; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	if (s[9] < '0' || s[9] > '9') && s[9] != 'X' {
+		return false
+	}
+
+	return isbn10CheckDigit(s[:9]) == s[9:]
+}
+
+// validISBN13 checks the characters, the prefix and the mod 10 check digit of
+// an ISBN-13.
+func validISBN13(s string) bool {
+	for i := 0; i < 13; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	if !strings.HasPrefix(s, "978") && !strings.HasPrefix(s, "979") {
+		return false
+	}
+
+	return isbn13CheckDigit(s[:12]) == s[12:]
+}
+
+// isbn10CheckDigit computes the check digit for the first nine digits of an
+// ISBN-10.
+func isbn10CheckDigit(body string) string {
+	var sum int
+	for i := 0; i < 9; i++ {
+		sum += (10 - i) * int(body[i]-'0')
+	}
+
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return "X"
+	}
+	return string(rune('0' + check))
+}
+
+// isbn13CheckDigit computes the check digit for the first twelve digits of an
+// ISBN-13.
+func isbn13CheckDigit(body string) string {
+	var sum int
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(body[i]-'0')
+	}
+
+	check := (10 - sum%10) % 10
+	return string(rune('0' + check))
+}
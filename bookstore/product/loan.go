@@ -0,0 +1,503 @@
+package product
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Statuses of a Loan. A loan is active until its copy is returned.
+const (
+	LoanActive   = "active"
+	LoanReturned = "returned"
+)
+
+// Statuses of a Hold. A hold waits in the queue of its Product until a copy
+// is kept for it, it is then ready until the member checks the copy out,
+// which fulfills it, or it expires. Fulfilled, cancelled and expired are
+// final.
+const (
+	HoldWaiting   = "waiting"
+	HoldReady     = "ready"
+	HoldFulfilled = "fulfilled"
+	HoldCancelled = "cancelled"
+	HoldExpired   = "expired"
+)
+
+// LoanPolicy sets how long copies are lent and kept for holds.
+type LoanPolicy struct {
+
+	// Period is how long a copy is lent for, and how much longer each
+	// renewal keeps it.
+	Period time.Duration
+
+	// MaxRenewals caps how often a Loan is renewed.
+	MaxRenewals int
+
+	// Pickup is how long a copy is kept for a ready Hold before the hold
+	// expires and the copy goes to the next member.
+	Pickup time.Duration
+}
+
+// Predefined errors identify expected failure conditions of loans and holds.
+var (
+	// ErrLoanNotFound is used when a specific Loan is requested but does
+	// not exist.
+	ErrLoanNotFound = errors.New("loan not found")
+
+	// ErrLoanClosed is used when a Loan that was returned is returned or
+	// renewed.
+	ErrLoanClosed = errors.New("loan was already returned")
+
+	// ErrLoanOverdue is used when an overdue Loan is renewed.
+	ErrLoanOverdue = errors.New("loan is overdue")
+
+	// ErrRenewalLimit is used when a Loan was renewed as often as the
+	// policy allows.
+	ErrRenewalLimit = errors.New("loan cannot be renewed again")
+
+	// ErrAlreadyBorrowed is used when a member checks out or places a hold
+	// on a Product they have on loan.
+	ErrAlreadyBorrowed = errors.New("product is already on loan to this member")
+
+	// ErrHoldsWaiting is used when a Product is checked out by a member
+	// while other members wait for it.
+	ErrHoldsWaiting = errors.New("product is held for other members")
+
+	// ErrHoldNotFound is used when a specific Hold is requested but does
+	// not exist.
+	ErrHoldNotFound = errors.New("hold not found")
+
+	// ErrDuplicateHold is used when a member places a second hold on the
+	// same Product.
+	ErrDuplicateHold = errors.New("product is already held for this member")
+
+	// ErrHoldClosed is used when a Hold that was fulfilled, cancelled or
+	// expired is closed again.
+	ErrHoldClosed = errors.New("hold is no longer open")
+
+	// ErrNotHolder is used when a Hold is cancelled by someone other than
+	// its member.
+	ErrNotHolder = errors.New("hold belongs to another member")
+
+	// errLoanNotDue is used when a Loan that is not due yet, or already
+	// overdue, is marked overdue.
+	errLoanNotDue = errors.New("loan is not due")
+
+	// errHoldLive is used when a Hold that is not ready or whose pickup
+	// time did not run out yet is expired.
+	errHoldLive = errors.New("hold has not expired")
+)
+
+// Loan lends a copy of a Product to a member until it is returned. It is
+// Overdue once it was not returned by DateDue.
+type Loan struct {
+	ID           string     `db:"loan_id" json:"id"`
+	ProductID    string     `db:"product_id" json:"product_id"`
+	Member       string     `db:"member" json:"member"`
+	Status       string     `db:"status" json:"status"`
+	Overdue      bool       `db:"overdue" json:"overdue"`
+	Renewals     int        `db:"renewals" json:"renewals"`
+	DateCreated  time.Time  `db:"datecreated" json:"date_created"`
+	DateDue      time.Time  `db:"datedue" json:"date_due"`
+	DateReturned *time.Time `db:"datereturned" json:"date_returned,omitempty"`
+}
+
+// Hold queues a member for a copy of a Product. Holds are served oldest
+// first. A ready Hold has a copy kept for it until DateExpires.
+type Hold struct {
+	ID          string     `db:"hold_id" json:"id"`
+	ProductID   string     `db:"product_id" json:"product_id"`
+	Member      string     `db:"member" json:"member"`
+	Status      string     `db:"status" json:"status"`
+	DateCreated time.Time  `db:"datecreated" json:"date_created"`
+	DateReady   *time.Time `db:"dateready" json:"date_ready,omitempty"`
+	DateExpires *time.Time `db:"dateexpires" json:"date_expires,omitempty"`
+	DateClosed  *time.Time `db:"dateclosed" json:"date_closed,omitempty"`
+}
+
+// open reports whether h is still waiting or ready.
+func (h Hold) open() bool {
+	return h.Status == HoldWaiting || h.Status == HoldReady
+}
+
+// LoanQuery describes which page of the Loans of a member ListLoans returns.
+// Loans are ordered newest first.
+type LoanQuery struct {
+
+	// Active limits the result to the Loans that were not returned.
+	Active bool
+
+	// Limit caps the number of Loans returned, zero means no limit.
+	Limit int
+
+	// Cursor is the opaque value returned by a previous ListLoans call.
+	// When set only Loans after that position are returned.
+	Cursor string
+
+	// after is the decoded Cursor, populated by prepare.
+	after *loanCursor
+}
+
+// loanCursor is the position of the last Loan of a page.
+type loanCursor struct {
+	Time time.Time `json:"t"`
+	ID   string    `json:"id"`
+}
+
+// prepare decodes the cursor of the query.
+func (q *LoanQuery) prepare() error {
+	q.after = nil
+	if q.Cursor == "" {
+		return nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	var c loanCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return ErrInvalidCursor
+	}
+
+	q.after = &c
+	return nil
+}
+
+// matches reports whether l is on the page q asks for, leaving out the
+// limit.
+func (q LoanQuery) matches(l Loan) bool {
+	if q.Active && l.Status != LoanActive {
+		return false
+	}
+	return q.after == nil || loanBefore(Loan{ID: q.after.ID, DateCreated: q.after.Time}, l)
+}
+
+// loanBefore reports whether a sorts before b, newest first and then by ID.
+func loanBefore(a, b Loan) bool {
+	if !a.DateCreated.Equal(b.DateCreated) {
+		return a.DateCreated.After(b.DateCreated)
+	}
+	return a.ID < b.ID
+}
+
+// holdBefore reports whether a is ahead of b in the queue, oldest first and
+// then by ID.
+func holdBefore(a, b Hold) bool {
+	if !a.DateCreated.Equal(b.DateCreated) {
+		return a.DateCreated.Before(b.DateCreated)
+	}
+	return a.ID < b.ID
+}
+
+// Checkout lends a copy of the live Product with the given ID to member. A
+// member whose Hold is ready gets the copy kept for it, other members get
+// one from Stock as long as nobody is waiting for the Product. It fails with
+// ErrInsufficientStock when no copy is left and ErrHoldsWaiting when the
+// copies left are due to the members queued first.
+func Checkout(ctx context.Context, db Store, productID, member string, policy LoanPolicy, now time.Time) (*Loan, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	now = now.UTC()
+
+	// Copies in stock go to the queue first, which may be this member.
+	if _, err := promoteHolds(ctx, db, productID, policy, now); err != nil {
+		return nil, err
+	}
+
+	l := Loan{
+		ID:          uuid.New().String(),
+		ProductID:   productID,
+		Member:      member,
+		Status:      LoanActive,
+		DateCreated: now,
+		DateDue:     now.Add(policy.Period),
+	}
+
+	if err := db.Checkout(ctx, l); err != nil {
+		return nil, err
+	}
+
+	return &l, nil
+}
+
+// Return brings the copy of the Product with the given ID that member has on
+// loan back. The copy goes to the next waiting Hold, if any; should that
+// fail, the sweeper hands it over later.
+func Return(ctx context.Context, db Store, productID, member string, policy LoanPolicy, now time.Time) (*Loan, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	now = now.UTC()
+
+	cur, err := db.ActiveLoan(ctx, productID, member)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := db.ReturnLoan(ctx, cur.ID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	promoteHolds(ctx, db, productID, policy, now)
+
+	return l, nil
+}
+
+// Renew extends the Loan member has of the Product with the given ID by the
+// loan period, counted from its current due date. Overdue loans and loans
+// renewed policy.MaxRenewals times cannot be renewed, neither can loans of
+// Products other members wait for.
+func Renew(ctx context.Context, db Store, productID, member string, policy LoanPolicy, now time.Time) (*Loan, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	now = now.UTC()
+
+	cur, err := db.ActiveLoan(ctx, productID, member)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRenew(*cur, policy.MaxRenewals, now); err != nil {
+		return nil, err
+	}
+
+	holds, err := db.ListHolds(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range holds {
+		if h.Status == HoldWaiting {
+			return nil, ErrHoldsWaiting
+		}
+	}
+
+	return db.RenewLoan(ctx, cur.ID, cur.DateDue.Add(policy.Period), policy.MaxRenewals, now)
+}
+
+// ListLoans gets a page of the Loans of member, newest first. When more Loans
+// are available, the returned cursor can be set on the next query to
+// continue after the last returned Loan. It is empty on the last page.
+func ListLoans(ctx context.Context, db Store, member string, q LoanQuery) ([]Loan, string, error) {
+	if err := q.prepare(); err != nil {
+		return nil, "", err
+	}
+
+	// Ask for one extra Loan to learn whether there is a next page.
+	limit := q.Limit
+	if limit > 0 {
+		q.Limit = limit + 1
+	}
+
+	loans, err := db.ListLoans(ctx, member, q)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if limit > 0 && len(loans) > limit {
+		loans = loans[:limit]
+
+		last := loans[limit-1]
+		b, _ := json.Marshal(loanCursor{Time: last.DateCreated, ID: last.ID})
+		next = base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	return loans, next, nil
+}
+
+// PlaceHold queues member for a copy of the live Product with the given ID.
+// When a copy is in stock the Hold is ready right away.
+func PlaceHold(ctx context.Context, db Store, productID, member string, policy LoanPolicy, now time.Time) (*Hold, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	now = now.UTC()
+
+	h := Hold{
+		ID:          uuid.New().String(),
+		ProductID:   productID,
+		Member:      member,
+		Status:      HoldWaiting,
+		DateCreated: now,
+	}
+
+	if err := db.PlaceHold(ctx, h); err != nil {
+		return nil, err
+	}
+
+	if _, err := promoteHolds(ctx, db, productID, policy, now); err != nil {
+		return nil, err
+	}
+
+	return db.RetrieveHold(ctx, h.ID)
+}
+
+// RetrieveHold gets a single Hold from the database.
+func RetrieveHold(ctx context.Context, db Store, id string) (*Hold, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	return db.RetrieveHold(ctx, id)
+}
+
+// ListHolds gets the open Holds of the live Product with the given ID in
+// queue order.
+func ListHolds(ctx context.Context, db Store, productID string) ([]Hold, error) {
+	if _, err := Retrieve(ctx, db, productID); err != nil {
+		return nil, err
+	}
+
+	return db.ListHolds(ctx, productID)
+}
+
+// CancelHold takes the Hold with the given ID of member out of the queue. The
+// copy kept for a ready Hold goes to the next member.
+func CancelHold(ctx context.Context, db Store, id, member string, policy LoanPolicy, now time.Time) (*Hold, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+	now = now.UTC()
+
+	cur, err := db.RetrieveHold(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cur.Member != member {
+		return nil, ErrNotHolder
+	}
+
+	h, err := db.CloseHold(ctx, id, HoldCancelled, now)
+	if err != nil {
+		return nil, err
+	}
+
+	promoteHolds(ctx, db, h.ProductID, policy, now)
+
+	return h, nil
+}
+
+// LoanSweep counts what SweepLoans did.
+type LoanSweep struct {
+	Overdue  int
+	Expired  int
+	Promoted int
+}
+
+// SweepLoans marks the Loans not returned by their due date overdue, expires
+// the ready Holds whose copy was not picked up in time and hands the copies
+// in stock to the waiting Holds. Loans and Holds that change while the sweep
+// runs are skipped.
+func SweepLoans(ctx context.Context, db Store, policy LoanPolicy, now time.Time) (LoanSweep, error) {
+	now = now.UTC()
+
+	var sw LoanSweep
+
+	ids, err := db.OverdueLoans(ctx, now)
+	if err != nil {
+		return sw, err
+	}
+	for _, id := range ids {
+		_, err := db.MarkOverdue(ctx, id, now)
+		switch err {
+		case nil:
+			sw.Overdue++
+		case ErrLoanClosed, ErrLoanNotFound, errLoanNotDue:
+		default:
+			return sw, errors.Wrapf(err, "marking loan %q overdue", id)
+		}
+	}
+
+	ids, err = db.ExpiredHolds(ctx, now)
+	if err != nil {
+		return sw, err
+	}
+	for _, id := range ids {
+		_, err := db.CloseHold(ctx, id, HoldExpired, now)
+		switch err {
+		case nil:
+			sw.Expired++
+		case ErrHoldClosed, ErrHoldNotFound, errHoldLive:
+		default:
+			return sw, errors.Wrapf(err, "expiring hold %q", id)
+		}
+	}
+
+	ids, err = db.WaitingHolds(ctx)
+	if err != nil {
+		return sw, err
+	}
+	for _, id := range ids {
+		n, err := promoteHolds(ctx, db, id, policy, now)
+		sw.Promoted += n
+		if err != nil {
+			return sw, errors.Wrapf(err, "promoting holds of product %q", id)
+		}
+	}
+
+	return sw, nil
+}
+
+// promoteHolds keeps copies in stock of the Product with the given ID for
+// its waiting Holds, oldest first, until either runs out. It returns how
+// many Holds became ready.
+func promoteHolds(ctx context.Context, db Store, productID string, policy LoanPolicy, now time.Time) (int, error) {
+	var n int
+	for {
+		_, err := db.PromoteHold(ctx, productID, now, now.Add(policy.Pickup))
+		switch err {
+		case nil:
+			n++
+		case ErrHoldNotFound, ErrInsufficientStock, ErrNotFound:
+			return n, nil
+		default:
+			return n, err
+		}
+	}
+}
+
+// checkRenew reports why l cannot be renewed at now when loans may be
+// renewed max times.
+func checkRenew(l Loan, max int, now time.Time) error {
+	switch {
+	case l.Status != LoanActive:
+		return ErrLoanClosed
+	case l.Overdue || !now.Before(l.DateDue):
+		return ErrLoanOverdue
+	case l.Renewals >= max:
+		return ErrRenewalLimit
+	}
+	return nil
+}
+
+// checkOverdue reports why l cannot be marked overdue at now.
+func checkOverdue(l Loan, now time.Time) error {
+	switch {
+	case l.Status != LoanActive:
+		return ErrLoanClosed
+	case l.Overdue || now.Before(l.DateDue):
+		return errLoanNotDue
+	}
+	return nil
+}
+
+// checkCloseHold reports why h cannot move to status at now. Open holds can
+// be cancelled, only ready holds whose pickup time ran out can expire.
+func checkCloseHold(h Hold, status string, now time.Time) error {
+	if !h.open() {
+		return ErrHoldClosed
+	}
+	if status == HoldExpired && (h.Status != HoldReady || h.DateExpires == nil || now.Before(*h.DateExpires)) {
+		return errHoldLive
+	}
+	return nil
+}
@@ -0,0 +1,844 @@
+package product
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps products in process memory. It is safe
+// for concurrent use and is intended for tests and for running the service
+// without a database.
+type MemoryStore struct {
+	mu           sync.RWMutex
+	products     map[string]Product
+	reservations map[string]Reservation
+	loans        map[string]Loan
+	holds        map[string]Hold
+	reviews      map[string]Review
+	history      map[string][]HistoryEntry
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		products:     make(map[string]Product),
+		reservations: make(map[string]Reservation),
+		loans:        make(map[string]Loan),
+		holds:        make(map[string]Hold),
+		reviews:      make(map[string]Review),
+		history:      make(map[string][]HistoryEntry),
+	}
+}
+
+// Ping always succeeds for the in-memory store.
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// List gets the Products matching the query in the requested order.
+func (s *MemoryStore) List(ctx context.Context, q Query) ([]Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	products := make([]Product, 0, len(s.products))
+	for _, p := range s.products {
+		if !q.matches(p) {
+			continue
+		}
+		if q.after != nil {
+			c := compareCursor(p, q.after)
+			if q.Desc {
+				c = -c
+			}
+			if c <= 0 {
+				continue
+			}
+		}
+		products = append(products, p)
+	}
+
+	sort.Slice(products, func(i, j int) bool {
+		c := compareProducts(products[i], products[j], q.Sort)
+		if q.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	if q.Limit > 0 && len(products) > q.Limit {
+		products = products[:q.Limit]
+	}
+
+	return products, nil
+}
+
+// Walk calls fn for each Product matching the query. It works on a snapshot
+// so fn may use the store.
+func (s *MemoryStore) Walk(ctx context.Context, q Query, fn func(Product) error) error {
+	products, err := s.List(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range products {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Search scores every Product against the search text. The scores follow the
+// same field weights as the Mongo text index but are not equal to the scores
+// Mongo computes.
+func (s *MemoryStore) Search(ctx context.Context, q SearchQuery) ([]Match, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	terms := searchTerms(q.Text)
+
+	var matches []Match
+	for _, p := range s.products {
+		if p.DateDeleted != nil {
+			continue
+		}
+		m := Match{Product: p, Score: score(p, terms)}
+		if m.Score == 0 || m.Score < q.MinScore {
+			continue
+		}
+		if q.after != nil && !searchAfter(m, q.after) {
+			continue
+		}
+		matches = append(matches, m)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ID < matches[j].ID
+	})
+
+	if q.Limit > 0 && len(matches) > q.Limit {
+		matches = matches[:q.Limit]
+	}
+
+	return matches, nil
+}
+
+// searchAfter reports whether m sorts after the cursor position c.
+func searchAfter(m Match, c *searchCursor) bool {
+	if m.Score != c.Score {
+		return m.Score < c.Score
+	}
+	return m.ID > c.ID
+}
+
+// Retrieve gets a single Product.
+func (s *MemoryStore) Retrieve(ctx context.Context, id string) (*Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.products[id]
+	if !ok || p.DateDeleted != nil {
+		return nil, ErrNotFound
+	}
+
+	return &p, nil
+}
+
+// Insert adds a Product.
+func (s *MemoryStore) Insert(ctx context.Context, p Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkISBN(p.ID, p.ISBN); err != nil {
+		return err
+	}
+	s.products[p.ID] = p
+
+	return nil
+}
+
+// InsertMany adds a batch of Products. Like on MongoDB, a Product failing
+// does not stop the rest of the batch.
+func (s *MemoryStore) InsertMany(ctx context.Context, ps []Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failed := make(map[int]error)
+	for i, p := range ps {
+		if err := s.checkISBN(p.ID, p.ISBN); err != nil {
+			failed[i] = err
+			continue
+		}
+		s.products[p.ID] = p
+	}
+
+	if len(failed) > 0 {
+		return &BatchError{Failed: failed}
+	}
+	return nil
+}
+
+// Update applies a change to an existing Product.
+func (s *MemoryStore) Update(ctx context.Context, id string, rev int, update UpdateProduct, now time.Time) (*Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := s.find(id, rev, false)
+	if err != nil {
+		return nil, err
+	}
+	if update.ISBN != nil {
+		if err := s.checkISBN(id, *update.ISBN); err != nil {
+			return nil, err
+		}
+	}
+
+	apply(&p, update, now)
+	s.products[id] = p
+
+	return &p, nil
+}
+
+// Delete moves the Product identified by a given ID to the trash.
+func (s *MemoryStore) Delete(ctx context.Context, id string, rev int, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := s.find(id, rev, false)
+	if err != nil {
+		return err
+	}
+
+	p.DateDeleted = &now
+	p.Revision++
+	s.products[id] = p
+
+	return nil
+}
+
+// Restore takes the Product identified by a given ID out of the trash.
+func (s *MemoryStore) Restore(ctx context.Context, id string, rev int) (*Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := s.find(id, rev, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkISBN(id, p.ISBN); err != nil {
+		return nil, err
+	}
+
+	p.DateDeleted = nil
+	p.Revision++
+	s.products[id] = p
+
+	return &p, nil
+}
+
+// Purge removes the Products deleted before the given time.
+func (s *MemoryStore) Purge(ctx context.Context, before time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	for id, p := range s.products {
+		if p.DateDeleted != nil && p.DateDeleted.Before(before) {
+			delete(s.products, id)
+			ids = append(ids, id)
+		}
+	}
+
+	for id, r := range s.reviews {
+		if _, ok := s.products[r.ProductID]; !ok {
+			delete(s.reviews, id)
+		}
+	}
+	for id, h := range s.holds {
+		if _, ok := s.products[h.ProductID]; !ok {
+			delete(s.holds, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// find returns the Product with the given ID, from the trash when deleted is
+// true, checking its revision against rev. The caller must hold the lock.
+func (s *MemoryStore) find(id string, rev int, deleted bool) (Product, error) {
+	p, ok := s.products[id]
+	if !ok || (p.DateDeleted != nil) != deleted {
+		return Product{}, ErrNotFound
+	}
+	if rev != AnyRevision && p.Revision != rev {
+		return Product{}, ErrRevisionMismatch
+	}
+
+	return p, nil
+}
+
+// checkISBN returns a *DuplicateISBNError when a live Product other than the
+// one with the given ID has the ISBN. The caller must hold the lock.
+func (s *MemoryStore) checkISBN(id, isbn string) error {
+	if isbn == "" {
+		return nil
+	}
+
+	for _, p := range s.products {
+		if p.ID != id && p.ISBN == isbn && p.DateDeleted == nil {
+			return &DuplicateISBNError{ISBN: isbn, ID: p.ID}
+		}
+	}
+
+	return nil
+}
+
+// Reserve holds copies of a Product for a new Reservation.
+func (s *MemoryStore) Reserve(ctx context.Context, r Reservation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := s.find(r.ProductID, AnyRevision, false)
+	if err != nil {
+		return err
+	}
+	if p.Stock < r.Quantity {
+		return ErrInsufficientStock
+	}
+
+	p.Stock -= r.Quantity
+	p.Reserved += r.Quantity
+	s.products[p.ID] = p
+	s.reservations[r.ID] = r
+
+	return nil
+}
+
+// RetrieveReservation gets a single Reservation.
+func (s *MemoryStore) RetrieveReservation(ctx context.Context, id string) (*Reservation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.reservations[id]
+	if !ok {
+		return nil, ErrReservationNotFound
+	}
+
+	return &r, nil
+}
+
+// CloseReservation closes a pending Reservation and releases its copies.
+func (s *MemoryStore) CloseReservation(ctx context.Context, id string, status string, now time.Time) (*Reservation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.reservations[id]
+	if !ok {
+		return nil, ErrReservationNotFound
+	}
+	if err := checkClose(r, status, now); err != nil {
+		return nil, err
+	}
+
+	r.Status = status
+	r.DateClosed = &now
+	s.reservations[id] = r
+
+	// The Product may be in the trash, its stock is kept up to date for a
+	// restore. Only a purged Product is gone.
+	if p, ok := s.products[r.ProductID]; ok {
+		p.Reserved -= r.Quantity
+		p.Stock += releasedStock(status, r.Quantity)
+		s.products[p.ID] = p
+	}
+
+	return &r, nil
+}
+
+// ExpiredReservations lists the pending Reservations that expired.
+func (s *MemoryStore) ExpiredReservations(ctx context.Context, now time.Time) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []string
+	for id, r := range s.reservations {
+		if r.Status == ReservationPending && !now.Before(r.DateExpires) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// Checkout takes a copy of a Product for a new Loan.
+func (s *MemoryStore) Checkout(ctx context.Context, l Loan) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := s.find(l.ProductID, AnyRevision, false)
+	if err != nil {
+		return err
+	}
+	if _, err := s.activeLoan(l.ProductID, l.Member); err == nil {
+		return ErrAlreadyBorrowed
+	}
+
+	var ready *Hold
+	waiting := false
+	for _, h := range s.holds {
+		if h.ProductID != l.ProductID {
+			continue
+		}
+		switch {
+		case h.Status == HoldReady && h.Member == l.Member:
+			h := h
+			ready = &h
+		case h.Status == HoldWaiting:
+			waiting = true
+		}
+	}
+
+	switch {
+	case ready != nil:
+		ready.Status = HoldFulfilled
+		ready.DateClosed = &l.DateCreated
+		s.holds[ready.ID] = *ready
+		p.Held--
+	case waiting:
+		return ErrHoldsWaiting
+	case p.Stock < 1:
+		return ErrInsufficientStock
+	default:
+		p.Stock--
+	}
+
+	p.OnLoan++
+	s.products[p.ID] = p
+	s.loans[l.ID] = l
+
+	return nil
+}
+
+// ActiveLoan gets the active Loan of a member for a Product.
+func (s *MemoryStore) ActiveLoan(ctx context.Context, productID, member string) (*Loan, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.activeLoan(productID, member)
+}
+
+// activeLoan returns the active Loan of member for the Product with the
+// given ID. The caller must hold the lock.
+func (s *MemoryStore) activeLoan(productID, member string) (*Loan, error) {
+	for _, l := range s.loans {
+		if l.ProductID == productID && l.Member == member && l.Status == LoanActive {
+			return &l, nil
+		}
+	}
+
+	return nil, ErrLoanNotFound
+}
+
+// ReturnLoan closes an active Loan and puts its copy back in stock.
+func (s *MemoryStore) ReturnLoan(ctx context.Context, id string, now time.Time) (*Loan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.loans[id]
+	if !ok {
+		return nil, ErrLoanNotFound
+	}
+	if l.Status != LoanActive {
+		return nil, ErrLoanClosed
+	}
+
+	l.Status = LoanReturned
+	l.DateReturned = &now
+	s.loans[id] = l
+
+	// Like reservations, the copy goes back to a Product in the trash too.
+	if p, ok := s.products[l.ProductID]; ok {
+		p.OnLoan--
+		p.Stock++
+		if l.Overdue {
+			p.Overdue--
+		}
+		s.products[p.ID] = p
+	}
+
+	return &l, nil
+}
+
+// RenewLoan moves the due date of an active Loan.
+func (s *MemoryStore) RenewLoan(ctx context.Context, id string, due time.Time, max int, now time.Time) (*Loan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.loans[id]
+	if !ok {
+		return nil, ErrLoanNotFound
+	}
+	if err := checkRenew(l, max, now); err != nil {
+		return nil, err
+	}
+
+	l.DateDue = due
+	l.Renewals++
+	s.loans[id] = l
+
+	return &l, nil
+}
+
+// ListLoans gets a page of the Loans of a member.
+func (s *MemoryStore) ListLoans(ctx context.Context, member string, q LoanQuery) ([]Loan, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	loans := []Loan{}
+	for _, l := range s.loans {
+		if l.Member == member && q.matches(l) {
+			loans = append(loans, l)
+		}
+	}
+
+	sort.Slice(loans, func(i, j int) bool {
+		return loanBefore(loans[i], loans[j])
+	})
+
+	if q.Limit > 0 && len(loans) > q.Limit {
+		loans = loans[:q.Limit]
+	}
+
+	return loans, nil
+}
+
+// OverdueLoans lists the active Loans that are due and not marked overdue.
+func (s *MemoryStore) OverdueLoans(ctx context.Context, now time.Time) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []string
+	for id, l := range s.loans {
+		if checkOverdue(l, now) == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// MarkOverdue marks a due Loan overdue.
+func (s *MemoryStore) MarkOverdue(ctx context.Context, id string, now time.Time) (*Loan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.loans[id]
+	if !ok {
+		return nil, ErrLoanNotFound
+	}
+	if err := checkOverdue(l, now); err != nil {
+		return nil, err
+	}
+
+	l.Overdue = true
+	s.loans[id] = l
+
+	if p, ok := s.products[l.ProductID]; ok {
+		p.Overdue++
+		s.products[p.ID] = p
+	}
+
+	return &l, nil
+}
+
+// PlaceHold stores a waiting Hold.
+func (s *MemoryStore) PlaceHold(ctx context.Context, h Hold) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.find(h.ProductID, AnyRevision, false); err != nil {
+		return err
+	}
+	if _, err := s.activeLoan(h.ProductID, h.Member); err == nil {
+		return ErrAlreadyBorrowed
+	}
+	for _, other := range s.holds {
+		if other.ProductID == h.ProductID && other.Member == h.Member && other.open() {
+			return ErrDuplicateHold
+		}
+	}
+
+	s.holds[h.ID] = h
+
+	return nil
+}
+
+// RetrieveHold gets a single Hold.
+func (s *MemoryStore) RetrieveHold(ctx context.Context, id string) (*Hold, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	h, ok := s.holds[id]
+	if !ok {
+		return nil, ErrHoldNotFound
+	}
+
+	return &h, nil
+}
+
+// ListHolds gets the open Holds of a Product in queue order.
+func (s *MemoryStore) ListHolds(ctx context.Context, productID string) ([]Hold, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.openHolds(productID), nil
+}
+
+// openHolds returns the open Holds of the Product with the given ID in queue
+// order. The caller must hold the lock.
+func (s *MemoryStore) openHolds(productID string) []Hold {
+	holds := []Hold{}
+	for _, h := range s.holds {
+		if h.ProductID == productID && h.open() {
+			holds = append(holds, h)
+		}
+	}
+
+	sort.Slice(holds, func(i, j int) bool {
+		return holdBefore(holds[i], holds[j])
+	})
+
+	return holds
+}
+
+// CloseHold closes an open Hold and releases the copy kept for it.
+func (s *MemoryStore) CloseHold(ctx context.Context, id string, status string, now time.Time) (*Hold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, ok := s.holds[id]
+	if !ok {
+		return nil, ErrHoldNotFound
+	}
+	if err := checkCloseHold(h, status, now); err != nil {
+		return nil, err
+	}
+
+	ready := h.Status == HoldReady
+	h.Status = status
+	h.DateClosed = &now
+	s.holds[id] = h
+
+	if p, ok := s.products[h.ProductID]; ok && ready {
+		p.Held--
+		p.Stock++
+		s.products[p.ID] = p
+	}
+
+	return &h, nil
+}
+
+// PromoteHold keeps a copy in stock for the oldest waiting Hold of a Product.
+func (s *MemoryStore) PromoteHold(ctx context.Context, productID string, now, expires time.Time) (*Hold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next *Hold
+	for _, h := range s.openHolds(productID) {
+		if h.Status == HoldWaiting {
+			next = &h
+			break
+		}
+	}
+	if next == nil {
+		return nil, ErrHoldNotFound
+	}
+
+	p, err := s.find(productID, AnyRevision, false)
+	if err != nil {
+		return nil, err
+	}
+	if p.Stock < 1 {
+		return nil, ErrInsufficientStock
+	}
+
+	p.Stock--
+	p.Held++
+	s.products[p.ID] = p
+
+	next.Status = HoldReady
+	next.DateReady = &now
+	next.DateExpires = &expires
+	s.holds[next.ID] = *next
+
+	return next, nil
+}
+
+// ExpiredHolds lists the ready Holds whose pickup time ran out.
+func (s *MemoryStore) ExpiredHolds(ctx context.Context, now time.Time) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []string
+	for id, h := range s.holds {
+		if checkCloseHold(h, HoldExpired, now) == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// WaitingHolds lists the Products with waiting Holds.
+func (s *MemoryStore) WaitingHolds(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var ids []string
+	for _, h := range s.holds {
+		if h.Status == HoldWaiting && !seen[h.ProductID] {
+			seen[h.ProductID] = true
+			ids = append(ids, h.ProductID)
+		}
+	}
+
+	return ids, nil
+}
+
+// AddReview stores a Review and rates its Product with it.
+func (s *MemoryStore) AddReview(ctx context.Context, r Review) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := s.find(r.ProductID, AnyRevision, false)
+	if err != nil {
+		return err
+	}
+
+	for _, other := range s.reviews {
+		if other.ProductID == r.ProductID && other.Reviewer == r.Reviewer {
+			return ErrDuplicateReview
+		}
+	}
+
+	p.rate(r.Rating, 1)
+	s.products[p.ID] = p
+	s.reviews[r.ID] = r
+
+	return nil
+}
+
+// ListReviews gets a page of the Reviews of a Product, newest first.
+func (s *MemoryStore) ListReviews(ctx context.Context, productID string, q ReviewQuery) ([]Review, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reviews := []Review{}
+	for _, r := range s.reviews {
+		if r.ProductID != productID {
+			continue
+		}
+		if q.after != nil && !reviewBefore(Review{ID: q.after.ID, DateCreated: q.after.Time}, r) {
+			continue
+		}
+		reviews = append(reviews, r)
+	}
+
+	sort.Slice(reviews, func(i, j int) bool {
+		return reviewBefore(reviews[i], reviews[j])
+	})
+
+	if q.Limit > 0 && len(reviews) > q.Limit {
+		reviews = reviews[:q.Limit]
+	}
+
+	return reviews, nil
+}
+
+// RetrieveReview gets a single Review.
+func (s *MemoryStore) RetrieveReview(ctx context.Context, id string) (*Review, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.reviews[id]
+	if !ok {
+		return nil, ErrReviewNotFound
+	}
+
+	return &r, nil
+}
+
+// DeleteReview removes a Review and takes it out of the rating of its
+// Product.
+func (s *MemoryStore) DeleteReview(ctx context.Context, id, reviewer string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.reviews[id]
+	if !ok || r.Reviewer != reviewer {
+		return ErrReviewNotFound
+	}
+
+	delete(s.reviews, id)
+	if p, ok := s.products[r.ProductID]; ok {
+		p.rate(r.Rating, -1)
+		s.products[p.ID] = p
+	}
+
+	return nil
+}
+
+// AddHistory stores a HistoryEntry.
+func (s *MemoryStore) AddHistory(ctx context.Context, e HistoryEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.history[e.ProductID] = append(s.history[e.ProductID], e)
+
+	return nil
+}
+
+// ListHistory gets a page of the history of a Product, newest first.
+func (s *MemoryStore) ListHistory(ctx context.Context, productID string, q HistoryQuery) ([]HistoryEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := []HistoryEntry{}
+	for _, e := range s.history[productID] {
+		if q.before > 0 && e.Revision >= q.before {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Revision > entries[j].Revision
+	})
+
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[:q.Limit]
+	}
+
+	return entries, nil
+}
+
+// RetrieveHistory gets the entry of a revision of a Product.
+func (s *MemoryStore) RetrieveHistory(ctx context.Context, productID string, rev int) (*HistoryEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, e := range s.history[productID] {
+		if e.Revision == rev {
+			return &e, nil
+		}
+	}
+
+	return nil, ErrHistoryNotFound
+}
@@ -2,13 +2,15 @@ package product
 
 import (
 	"expvar"
+	"io"
 	"net/http"
 	"runtime"
+	"strconv"
 	"time"
 
+	"github.com/go-chi/chi"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
-	//"github.com/struCoder/pidusage"
 )
 
 // m contains the global program counters for the application.
@@ -22,66 +24,115 @@ var m = struct {
 	err: expvar.NewInt("errors"),
 }
 
+// sizeBuckets spread request and response sizes from 100 bytes to 10 MB.
+var sizeBuckets = prometheus.ExponentialBuckets(100, 10, 6)
+
+// HTTP metrics are labelled with the chi route pattern, such as /books/{id},
+// so that every book does not get its own series.
 var (
-	bookstoreResponseLatency = promauto.NewHistogramVec(
+	httpRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bookstore_http_requests_total",
+			Help: "The number of http requests handled.",
+		},
+		[]string{"route", "method", "code"},
+	)
+
+	httpInFlight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bookstore_http_requests_in_flight",
+			Help: "The number of http requests being handled.",
+		},
+		[]string{"route", "method"},
+	)
+
+	httpDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "bookstore_http_request_duration_seconds",
+			Help:    "The http response latency.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"route", "method", "code"},
+	)
+
+	httpRequestSize = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
-			Name: "Bookstore_response_latency",
-			Help: "The http response latency",
-			//ConstLabels: "Method",
-			Buckets: []float64{1, 2, 5, 10, 20, 60},
+			Name:    "bookstore_http_request_size_bytes",
+			Help:    "The size of http request bodies.",
+			Buckets: sizeBuckets,
 		},
-		[]string{"GET"},
+		[]string{"route", "method", "code"},
 	)
 
-	bookstoreRequestNumber = promauto.NewCounter(prometheus.CounterOpts{
-		Name: "Bookstore_request_number",
-		Help: "The http request number",
-	})
-	bookstoreErrorNumber = promauto.NewCounter(prometheus.CounterOpts{
-		Name: "Bookstore_error_number",
-		Help: "The http error number",
-	})
-	bookstoreSuccessResponseNumber = promauto.NewCounter(prometheus.CounterOpts{
-		Name: "Bookstore_success_response_number",
-		Help: "The success response number",
-	})
+	httpResponseSize = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "bookstore_http_response_size_bytes",
+			Help:    "The size of http response bodies.",
+			Buckets: sizeBuckets,
+		},
+		[]string{"route", "method", "code"},
+	)
 )
 
-// Metrics updates program counters.
+// Metrics updates program counters. It must run before any middleware that
+// writes error responses so that their status codes are recorded.
 func Metrics() Middleware {
 	// This is the actual middleware function to be executed.
 	f := func(before Handler) Handler {
 
 		// Wrap this handler around the next one provided.
 		h := func(w http.ResponseWriter, r *http.Request) error {
+			route := chi.RouteContext(r.Context()).RoutePattern()
+
+			inFlight := httpInFlight.WithLabelValues(route, r.Method)
+			inFlight.Inc()
+			defer inFlight.Dec()
+
+			sw := statusWriter{ResponseWriter: w}
+			var body countingReader
+			if r.Body != nil {
+				body.ReadCloser = r.Body
+				r.Body = &body
+			}
 
 			start := time.Now()
 
-			err := before(w, r)
+			err := before(&sw, r)
 
 			duration := time.Since(start)
 
-			bookstoreResponseLatency.WithLabelValues(r.Method).Observe(float64(duration.Milliseconds()))
+			// An error returned here never reached the client, it is
+			// answered further up the chain with a 500.
+			status := sw.status
+			switch {
+			case err != nil:
+				status = http.StatusInternalServerError
+			case status == 0:
+				status = http.StatusOK
+			}
+
+			reqSize := r.ContentLength
+			if reqSize < 0 {
+				reqSize = body.n
+			}
+
+			code := strconv.Itoa(status)
+			httpRequests.WithLabelValues(route, r.Method, code).Inc()
+			httpDuration.WithLabelValues(route, r.Method, code).Observe(duration.Seconds())
+			httpRequestSize.WithLabelValues(route, r.Method, code).Observe(float64(reqSize))
+			httpResponseSize.WithLabelValues(route, r.Method, code).Observe(float64(sw.size))
+
 			// Increment the request counter.
 			m.req.Add(1)
-			//fmt.Println("url path: ", r.URL.Path)
-			if r.URL.Path == "/books" {
-				bookstoreRequestNumber.Inc()
-			}
 
 			// Update the count for the number of active goroutines every 100 requests.
 			if m.req.Value()%100 == 0 {
 				m.gr.Set(int64(runtime.NumGoroutine()))
 			}
 
-			// Increment the errors counter if an error occurred on this request.
-			if err != nil {
+			// Increment the errors counter if the request failed.
+			if status >= http.StatusBadRequest {
 				m.err.Add(1)
-				bookstoreErrorNumber.Inc()
-			} else { // Increment success response number.
-				if r.URL.Path == "/books" {
-					bookstoreSuccessResponseNumber.Inc()
-				}
 			}
 
 			// Return the error so it can be handled further up the chain.
@@ -93,3 +144,52 @@ func Metrics() Middleware {
 
 	return f
 }
+
+// statusWriter records the status code and body size of a response. It
+// passes flushes through, as an http.Flusher, so that streaming handlers keep
+// working behind it.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher. It does nothing when the wrapped writer
+// cannot flush.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// countingReader counts the bytes read from a request body, which is its size
+// when the request does not declare a Content-Length.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
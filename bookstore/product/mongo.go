@@ -0,0 +1,1336 @@
+package product
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/database"
+)
+
+// isbnIndex names the unique index on the ISBN of live Products. Duplicate
+// key errors name the index they come from.
+const isbnIndex = "isbn_unique"
+
+// MongoStore is a Store backed by a MongoDB collection. Reservations, loans,
+// holds, reviews and history are kept in collections named after the first.
+type MongoStore struct {
+	client       *mongo.Client
+	collection   *mongo.Collection
+	reservations *mongo.Collection
+	loans        *mongo.Collection
+	holds        *mongo.Collection
+	reviews      *mongo.Collection
+	history      *mongo.Collection
+}
+
+// document is how a Product is stored. The product ID doubles as the Mongo
+// _id so that change stream events without a full document, such as updates
+// of a Product purged since, can still name the Product.
+type document struct {
+	MongoID string `bson:"_id"`
+	Product `bson:",inline"`
+}
+
+// reviewDocument is how a Review is stored, with the review ID as the Mongo
+// _id.
+type reviewDocument struct {
+	MongoID string `bson:"_id"`
+	Review  `bson:",inline"`
+}
+
+// historyDocument is how a HistoryEntry is stored. Its Mongo _id is made of
+// the product ID and the revision, so a revision is recorded at most once.
+type historyDocument struct {
+	MongoID      string `bson:"_id"`
+	HistoryEntry `bson:",inline"`
+}
+
+// reservationDocument is how a Reservation is stored, with the reservation ID
+// as the Mongo _id.
+type reservationDocument struct {
+	MongoID     string `bson:"_id"`
+	Reservation `bson:",inline"`
+}
+
+// loanDocument is how a Loan is stored, with the loan ID as the Mongo _id.
+type loanDocument struct {
+	MongoID string `bson:"_id"`
+	Loan    `bson:",inline"`
+}
+
+// holdDocument is how a Hold is stored, with the hold ID as the Mongo _id.
+type holdDocument struct {
+	MongoID string `bson:"_id"`
+	Hold    `bson:",inline"`
+}
+
+// NewMongoStore returns a Store that keeps products in the named database and
+// collection of the provided client, and reservations, loans, holds, reviews
+// and history in the collections with the "_reservations", "_loans",
+// "_holds", "_reviews" and "_history" suffixes.
+func NewMongoStore(client *mongo.Client, database, collection string) *MongoStore {
+	db := client.Database(database)
+	return &MongoStore{
+		client:       client,
+		collection:   db.Collection(collection),
+		reservations: db.Collection(collection + "_reservations"),
+		loans:        db.Collection(collection + "_loans"),
+		holds:        db.Collection(collection + "_holds"),
+		reviews:      db.Collection(collection + "_reviews"),
+		history:      db.Collection(collection + "_history"),
+	}
+}
+
+// EnsureIndexes creates the indexes List, Search, Purge, the reservation
+// and loan sweepers, loans, holds, reviews and history rely on. Every sortable field is indexed together with id, which
+// also serves the author, genre and isbn filters, and the ID and author ID
+// have indexes of their own. Creating an index that already exists is a
+// no-op.
+//
+// The ISBN of live Products is kept unique by a partial index, created last.
+// While live Products share an ISBN it cannot be created and
+// ErrDuplicateISBNs is returned.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	models := []mongo.IndexModel{{
+		Keys: bson.D{{Key: "id", Value: 1}},
+	}}
+	for _, field := range sortFields {
+		models = append(models, mongo.IndexModel{
+			Keys: bson.D{{Key: field, Value: 1}, {Key: "id", Value: 1}},
+		})
+	}
+	models = append(models, mongo.IndexModel{
+		Keys: bson.D{{Key: "datedeleted", Value: 1}},
+	}, mongo.IndexModel{
+		Keys: bson.D{{Key: "authorid", Value: 1}, {Key: "id", Value: 1}},
+	})
+
+	// A collection can only have one text index, it covers every searched
+	// field.
+	text := bson.D{}
+	weights := bson.M{}
+	for _, field := range searchFieldNames {
+		text = append(text, bson.E{Key: field, Value: "text"})
+		weights[field] = searchWeights[field]
+	}
+	models = append(models, mongo.IndexModel{
+		Keys:    text,
+		Options: options.Index().SetName("books_text").SetWeights(weights),
+	})
+
+	if _, err := s.collection.Indexes().CreateMany(ctx, models); err != nil {
+		return errors.Wrap(err, "creating indexes")
+	}
+
+	expiry := mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "dateexpires", Value: 1}},
+	}
+	if _, err := s.reservations.Indexes().CreateOne(ctx, expiry); err != nil {
+		return errors.Wrap(err, "creating reservation indexes")
+	}
+
+	// The unique indexes allow a single active loan and a single open hold
+	// per member and Product. Closed ones have their date set.
+	loans := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "productid", Value: 1}, {Key: "member", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"datereturned": bson.M{"$type": "null"},
+			}),
+		},
+		{
+			Keys: bson.D{{Key: "member", Value: 1}, {Key: "datecreated", Value: -1}, {Key: "id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "datedue", Value: 1}},
+		},
+	}
+	if _, err := s.loans.Indexes().CreateMany(ctx, loans); err != nil {
+		return errors.Wrap(err, "creating loan indexes")
+	}
+
+	holds := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "productid", Value: 1}, {Key: "member", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"dateclosed": bson.M{"$type": "null"},
+			}),
+		},
+		{
+			Keys: bson.D{{Key: "productid", Value: 1}, {Key: "status", Value: 1}, {Key: "datecreated", Value: 1}, {Key: "id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "dateexpires", Value: 1}},
+		},
+	}
+	if _, err := s.holds.Indexes().CreateMany(ctx, holds); err != nil {
+		return errors.Wrap(err, "creating hold indexes")
+	}
+
+	// The unique index allows a single review per reviewer and Product.
+	reviews := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "productid", Value: 1}, {Key: "reviewer", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "productid", Value: 1}, {Key: "datecreated", Value: -1}, {Key: "id", Value: 1}},
+		},
+	}
+	if _, err := s.reviews.Indexes().CreateMany(ctx, reviews); err != nil {
+		return errors.Wrap(err, "creating review indexes")
+	}
+
+	history := mongo.IndexModel{
+		Keys: bson.D{{Key: "productid", Value: 1}, {Key: "revision", Value: -1}},
+	}
+	if _, err := s.history.Indexes().CreateOne(ctx, history); err != nil {
+		return errors.Wrap(err, "creating history indexes")
+	}
+
+	// Products stored before the trash existed have no datedeleted field.
+	// They get a null one, the value the partial index selects live
+	// Products by.
+	legacy := bson.M{"datedeleted": bson.M{"$exists": false}}
+	if _, err := s.collection.UpdateMany(ctx, legacy, bson.M{"$set": bson.M{"datedeleted": nil}}); err != nil {
+		return errors.Wrap(err, "marking products live")
+	}
+
+	isbn := mongo.IndexModel{
+		Keys: bson.D{{Key: "isbn", Value: 1}},
+		Options: options.Index().SetName(isbnIndex).SetUnique(true).SetPartialFilterExpression(bson.M{
+			"isbn":        bson.M{"$gt": ""},
+			"datedeleted": bson.M{"$type": "null"},
+		}),
+	}
+	if _, err := s.collection.Indexes().CreateOne(ctx, isbn); err != nil {
+		if database.IsDuplicateKey(err) {
+			return ErrDuplicateISBNs
+		}
+		return errors.Wrap(err, "creating isbn index")
+	}
+
+	return nil
+}
+
+// Ping verifies the MongoDB server is reachable.
+func (s *MongoStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx, nil)
+}
+
+// List gets the Products matching the query in the requested order. Filters
+// and the cursor position are part of the Mongo query so the indexes created
+// by EnsureIndexes are used for both filtering and sorting.
+func (s *MongoStore) List(ctx context.Context, q Query) ([]Product, error) {
+	products := []Product{}
+
+	err := s.Walk(ctx, q, func(p Product) error {
+		products = append(products, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+// Walk streams the Products matching the query through the Mongo cursor, so
+// only one batch of documents is held in memory at a time.
+func (s *MongoStore) Walk(ctx context.Context, q Query, fn func(Product) error) error {
+	filter := bson.M{"datedeleted": nil}
+	if q.Deleted {
+		filter["datedeleted"] = bson.M{"$ne": nil}
+	}
+	if q.Author != "" {
+		filter["author"] = q.Author
+	}
+	if q.AuthorID != "" {
+		filter["authorid"] = q.AuthorID
+	}
+	if q.Genre != "" {
+		filter["genre"] = q.Genre
+	}
+	if q.ISBN != "" {
+		filter["isbn"] = q.ISBN
+	}
+
+	field := sortFields[q.Sort]
+	dir, op := 1, "$gt"
+	if q.Desc {
+		dir, op = -1, "$lt"
+	}
+
+	if q.after != nil {
+		v := q.after.afterValue()
+		filter["$or"] = bson.A{
+			bson.M{field: bson.M{op: v}},
+			bson.M{field: v, "id": bson.M{op: q.after.ID}},
+		}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: field, Value: dir}, {Key: "id", Value: dir}})
+	if q.Limit > 0 {
+		opts.SetLimit(int64(q.Limit))
+	}
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return errors.Wrap(err, "selecting products")
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var p Product
+		if err := cursor.Decode(&p); err != nil {
+			return errors.Wrap(err, "decoding products")
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return errors.Wrap(err, "iterating products")
+	}
+
+	return nil
+}
+
+// Search runs a $text query against the text index. The score cutoff and the
+// cursor position are applied on the text score inside an aggregation so only
+// the requested page leaves the server.
+func (s *MongoStore) Search(ctx context.Context, q SearchQuery) ([]Match, error) {
+	matches := []Match{}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$text": bson.M{"$search": q.Text}, "datedeleted": nil}}},
+		{{Key: "$addFields", Value: bson.M{"score": bson.M{"$meta": "textScore"}}}},
+	}
+
+	match := bson.M{}
+	if q.MinScore > 0 {
+		match["score"] = bson.M{"$gte": q.MinScore}
+	}
+	if q.after != nil {
+		match["$or"] = bson.A{
+			bson.M{"score": bson.M{"$lt": q.after.Score}},
+			bson.M{"score": q.after.Score, "id": bson.M{"$gt": q.after.ID}},
+		}
+	}
+	if len(match) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: match}})
+	}
+
+	pipeline = append(pipeline, bson.D{{Key: "$sort", Value: bson.D{{Key: "score", Value: -1}, {Key: "id", Value: 1}}}})
+	if q.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: q.Limit}})
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, errors.Wrap(err, "searching products")
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &matches); err != nil {
+		return nil, errors.Wrap(err, "decoding matches")
+	}
+
+	return matches, nil
+}
+
+// Retrieve gets a single Product from the collection.
+func (s *MongoStore) Retrieve(ctx context.Context, id string) (*Product, error) {
+	var p Product
+
+	err := s.collection.FindOne(ctx, revisionFilter(id, AnyRevision, false)).Decode(&p)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrap(err, "get product")
+	}
+
+	return &p, nil
+}
+
+// Insert adds a Product to the collection.
+func (s *MongoStore) Insert(ctx context.Context, p Product) error {
+	if _, err := s.collection.InsertOne(ctx, document{p.ID, p}); err != nil {
+		if database.IsDuplicateKeyOn(err, isbnIndex) {
+			return s.duplicateISBN(ctx, p.ID, p.ISBN)
+		}
+		return errors.Wrap(err, "inserting product")
+	}
+
+	return nil
+}
+
+// InsertMany adds a batch of Products in a single unordered bulk insert, so a
+// failing document does not stop the rest of the batch.
+func (s *MongoStore) InsertMany(ctx context.Context, ps []Product) error {
+	if len(ps) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(ps))
+	for i, p := range ps {
+		docs[i] = document{p.ID, p}
+	}
+
+	_, err := s.collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil {
+		bwe, ok := err.(mongo.BulkWriteException)
+		if !ok || bwe.WriteConcernError != nil || len(bwe.WriteErrors) == 0 {
+			return errors.Wrap(err, "inserting products")
+		}
+
+		berr := BatchError{Failed: make(map[int]error)}
+		for _, we := range bwe.WriteErrors {
+			if we.Code == database.DuplicateKeyCode && strings.Contains(we.Message, isbnIndex) {
+				p := ps[we.Index]
+				berr.Failed[we.Index] = s.duplicateISBN(ctx, p.ID, p.ISBN)
+				continue
+			}
+			berr.Failed[we.Index] = errors.New(we.Message)
+		}
+		return &berr
+	}
+
+	return nil
+}
+
+// Update applies a change to an existing Product. The revision check is part
+// of the update filter so a concurrent writer can never be overwritten. Only
+// when nothing matched is the Product read to tell a missing Product from a
+// revision mismatch.
+func (s *MongoStore) Update(ctx context.Context, id string, rev int, update UpdateProduct, now time.Time) (*Product, error) {
+	set := bson.M{"dateupdated": now}
+	if update.Name != nil {
+		set["name"] = *update.Name
+	}
+	if update.Author != nil {
+		set["author"] = *update.Author
+	}
+	if update.AuthorID != nil {
+		set["authorid"] = *update.AuthorID
+	}
+	if update.ISBN != nil {
+		set["isbn"] = *update.ISBN
+	}
+	if update.Genre != nil {
+		set["genre"] = *update.Genre
+	}
+	if update.Price != nil {
+		set["price"] = *update.Price
+	}
+	if update.Currency != nil {
+		set["currency"] = *update.Currency
+	}
+	if update.Stock != nil {
+		set["stock"] = *update.Stock
+	}
+
+	change := bson.M{
+		"$set": set,
+		"$inc": bson.M{"revision": 1},
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var p Product
+	err := s.collection.FindOneAndUpdate(ctx, revisionFilter(id, rev, false), change, opts).Decode(&p)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, s.conflict(ctx, id, rev, false)
+		}
+		if database.IsDuplicateKeyOn(err, isbnIndex) && update.ISBN != nil {
+			return nil, s.duplicateISBN(ctx, id, *update.ISBN)
+		}
+		return nil, errors.Wrap(err, "updating product")
+	}
+
+	return &p, nil
+}
+
+// Delete moves the Product identified by a given ID to the trash.
+func (s *MongoStore) Delete(ctx context.Context, id string, rev int, now time.Time) error {
+	change := bson.M{
+		"$set": bson.M{"datedeleted": now},
+		"$inc": bson.M{"revision": 1},
+	}
+
+	res, err := s.collection.UpdateOne(ctx, revisionFilter(id, rev, false), change)
+	if err != nil {
+		return errors.Wrap(err, "delete product")
+	}
+
+	if res.MatchedCount == 0 {
+		return s.conflict(ctx, id, rev, false)
+	}
+
+	return nil
+}
+
+// Restore takes the Product identified by a given ID out of the trash.
+func (s *MongoStore) Restore(ctx context.Context, id string, rev int) (*Product, error) {
+	change := bson.M{
+		"$set": bson.M{"datedeleted": nil},
+		"$inc": bson.M{"revision": 1},
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var p Product
+	err := s.collection.FindOneAndUpdate(ctx, revisionFilter(id, rev, true), change, opts).Decode(&p)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, s.conflict(ctx, id, rev, true)
+		}
+		if database.IsDuplicateKeyOn(err, isbnIndex) {
+			if err := s.collection.FindOne(ctx, bson.M{"id": id}).Decode(&p); err != nil {
+				return nil, errors.Wrap(err, "get product")
+			}
+			return nil, s.duplicateISBN(ctx, id, p.ISBN)
+		}
+		return nil, errors.Wrap(err, "restoring product")
+	}
+
+	return &p, nil
+}
+
+// Purge removes the Products deleted before the given time. Their Reviews are
+// removed after them, a Product restored in between keeps its Reviews.
+func (s *MongoStore) Purge(ctx context.Context, before time.Time) ([]string, error) {
+	filter := bson.M{"datedeleted": bson.M{"$lt": before}}
+
+	ids, err := s.collection.Distinct(ctx, "id", filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting products to purge")
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	filter["id"] = bson.M{"$in": ids}
+
+	if _, err := s.collection.DeleteMany(ctx, filter); err != nil {
+		return nil, errors.Wrap(err, "purging products")
+	}
+
+	kept, err := s.collection.Distinct(ctx, "id", bson.M{"id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting purged products")
+	}
+	filter = bson.M{"productid": bson.M{"$in": ids, "$nin": kept}}
+
+	if _, err := s.reviews.DeleteMany(ctx, filter); err != nil {
+		return nil, errors.Wrap(err, "purging reviews")
+	}
+	if _, err := s.holds.DeleteMany(ctx, filter); err != nil {
+		return nil, errors.Wrap(err, "purging holds")
+	}
+
+	restored := make(map[interface{}]bool, len(kept))
+	for _, id := range kept {
+		restored[id] = true
+	}
+
+	var purged []string
+	for _, id := range ids {
+		if sid, ok := id.(string); ok && !restored[id] {
+			purged = append(purged, sid)
+		}
+	}
+
+	return purged, nil
+}
+
+// conflict explains why a conditional write on the Product with the given ID,
+// live or in the trash, matched nothing.
+func (s *MongoStore) conflict(ctx context.Context, id string, rev int, deleted bool) error {
+	if rev == AnyRevision {
+		return ErrNotFound
+	}
+
+	n, err := s.collection.CountDocuments(ctx, revisionFilter(id, AnyRevision, deleted))
+	if err != nil {
+		return errors.Wrap(err, "get product")
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return ErrRevisionMismatch
+}
+
+// revisionFilter matches the Product with the given ID at revision rev, in
+// the trash when deleted is true. Products stored before revisions existed
+// have no revision field and match revision 0, like those stored before the
+// trash existed have no datedeleted field and are live.
+func revisionFilter(id string, rev int, deleted bool) bson.M {
+	filter := bson.M{"id": id, "datedeleted": nil}
+	if deleted {
+		filter["datedeleted"] = bson.M{"$ne": nil}
+	}
+
+	switch rev {
+	case AnyRevision:
+	case 0:
+		filter["revision"] = bson.M{"$in": bson.A{0, nil}}
+	default:
+		filter["revision"] = rev
+	}
+
+	return filter
+}
+
+// Reserve holds copies of a Product for a new Reservation. The stock check is
+// part of the update filter, so concurrent reservations can never take the
+// stock below zero. Should storing the Reservation fail the copies are put
+// back.
+func (s *MongoStore) Reserve(ctx context.Context, r Reservation) error {
+	filter := revisionFilter(r.ProductID, AnyRevision, false)
+	filter["stock"] = bson.M{"$gte": r.Quantity}
+
+	change := bson.M{
+		"$inc": bson.M{"stock": -r.Quantity, "reserved": r.Quantity},
+	}
+
+	res, err := s.collection.UpdateOne(ctx, filter, change)
+	if err != nil {
+		return errors.Wrap(err, "reserving stock")
+	}
+	if res.MatchedCount == 0 {
+		if _, err := s.Retrieve(ctx, r.ProductID); err != nil {
+			return err
+		}
+		return ErrInsufficientStock
+	}
+
+	if _, err := s.reservations.InsertOne(ctx, reservationDocument{r.ID, r}); err != nil {
+		undo := bson.M{
+			"$inc": bson.M{"stock": r.Quantity, "reserved": -r.Quantity},
+		}
+		if _, uerr := s.collection.UpdateOne(ctx, bson.M{"id": r.ProductID}, undo); uerr != nil {
+			return errors.Wrapf(err, "inserting reservation, %d copies of product %q stay reserved: %v", r.Quantity, r.ProductID, uerr)
+		}
+		return errors.Wrap(err, "inserting reservation")
+	}
+
+	return nil
+}
+
+// RetrieveReservation gets a single Reservation from the collection.
+func (s *MongoStore) RetrieveReservation(ctx context.Context, id string) (*Reservation, error) {
+	var r Reservation
+
+	err := s.reservations.FindOne(ctx, bson.M{"_id": id}).Decode(&r)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrReservationNotFound
+		}
+		return nil, errors.Wrap(err, "get reservation")
+	}
+
+	return &r, nil
+}
+
+// CloseReservation closes a pending Reservation and releases its copies. The
+// status and expiry checks are part of the update filter so a Reservation is
+// closed exactly once. Only when nothing matched is it read to explain why.
+func (s *MongoStore) CloseReservation(ctx context.Context, id string, status string, now time.Time) (*Reservation, error) {
+	filter := bson.M{"_id": id, "status": ReservationPending}
+	switch status {
+	case ReservationCommitted:
+		filter["dateexpires"] = bson.M{"$gt": now}
+	case ReservationExpired:
+		filter["dateexpires"] = bson.M{"$lte": now}
+	}
+
+	change := bson.M{
+		"$set": bson.M{"status": status, "dateclosed": now},
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var r Reservation
+	err := s.reservations.FindOneAndUpdate(ctx, filter, change, opts).Decode(&r)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			cur, err := s.RetrieveReservation(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkClose(*cur, status, now); err != nil {
+				return nil, err
+			}
+			return nil, ErrReservationClosed
+		}
+		return nil, errors.Wrap(err, "closing reservation")
+	}
+
+	// The Product may be in the trash, its stock is kept up to date for a
+	// restore.
+	release := bson.M{
+		"$inc": bson.M{"stock": releasedStock(status, r.Quantity), "reserved": -r.Quantity},
+	}
+	if _, err := s.collection.UpdateOne(ctx, bson.M{"id": r.ProductID}, release); err != nil {
+		return nil, errors.Wrapf(err, "releasing %d copies of product %q", r.Quantity, r.ProductID)
+	}
+
+	return &r, nil
+}
+
+// ExpiredReservations lists the pending Reservations that expired.
+func (s *MongoStore) ExpiredReservations(ctx context.Context, now time.Time) ([]string, error) {
+	filter := bson.M{"status": ReservationPending, "dateexpires": bson.M{"$lte": now}}
+	return s.ids(ctx, s.reservations, filter, "expired reservations")
+}
+
+// Checkout takes a copy of a Product for a new Loan. The copy kept for a
+// ready Hold of the member is taken by fulfilling the hold, which happens
+// once, and a copy in stock by an update whose filter checks the stock.
+// Should storing the Loan fail the copy and the hold are put back.
+func (s *MongoStore) Checkout(ctx context.Context, l Loan) error {
+	if _, err := s.ActiveLoan(ctx, l.ProductID, l.Member); err != ErrLoanNotFound {
+		if err != nil {
+			return err
+		}
+		return ErrAlreadyBorrowed
+	}
+
+	var h Hold
+
+	filter := bson.M{"productid": l.ProductID, "member": l.Member, "status": HoldReady}
+	change := bson.M{"$set": bson.M{"status": HoldFulfilled, "dateclosed": l.DateCreated}}
+
+	err := s.holds.FindOneAndUpdate(ctx, filter, change).Decode(&h)
+	switch err {
+	case nil:
+		if err := s.takeCopy(ctx, l.ProductID, "held"); err != nil {
+			s.reopenHold(ctx, h.ID)
+			return err
+		}
+	case mongo.ErrNoDocuments:
+		n, err := s.holds.CountDocuments(ctx, bson.M{"productid": l.ProductID, "status": HoldWaiting})
+		if err != nil {
+			return errors.Wrap(err, "counting waiting holds")
+		}
+		if n > 0 {
+			if _, err := s.Retrieve(ctx, l.ProductID); err != nil {
+				return err
+			}
+			return ErrHoldsWaiting
+		}
+		if err := s.takeCopy(ctx, l.ProductID, "stock"); err != nil {
+			return err
+		}
+	default:
+		return errors.Wrap(err, "fulfilling hold")
+	}
+
+	if _, err := s.loans.InsertOne(ctx, loanDocument{l.ID, l}); err != nil {
+		from := "stock"
+		if h.ID != "" {
+			from = "held"
+		}
+		undo := bson.M{"$inc": bson.M{from: 1, "onloan": -1}}
+		if _, uerr := s.collection.UpdateOne(ctx, bson.M{"id": l.ProductID}, undo); uerr != nil {
+			return errors.Wrapf(err, "inserting loan, a copy of product %q stays on loan: %v", l.ProductID, uerr)
+		}
+		if h.ID != "" {
+			s.reopenHold(ctx, h.ID)
+		}
+		if database.IsDuplicateKey(err) {
+			return ErrAlreadyBorrowed
+		}
+		return errors.Wrap(err, "inserting loan")
+	}
+
+	return nil
+}
+
+// takeCopy moves a copy of the live Product with the given ID from field,
+// the stock or the held copies, to the copies on loan.
+func (s *MongoStore) takeCopy(ctx context.Context, productID, field string) error {
+	filter := revisionFilter(productID, AnyRevision, false)
+	filter[field] = bson.M{"$gte": 1}
+
+	res, err := s.collection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{field: -1, "onloan": 1}})
+	if err != nil {
+		return errors.Wrap(err, "lending copy")
+	}
+	if res.MatchedCount == 0 {
+		if _, err := s.Retrieve(ctx, productID); err != nil {
+			return err
+		}
+		return ErrInsufficientStock
+	}
+
+	return nil
+}
+
+// reopenHold makes a Hold that was fulfilled for a failed checkout ready
+// again. Should that fail too the sweeper never expires it, as it is
+// closed, and the copy kept for it stays held.
+func (s *MongoStore) reopenHold(ctx context.Context, id string) {
+	change := bson.M{"$set": bson.M{"status": HoldReady, "dateclosed": nil}}
+	s.holds.UpdateOne(ctx, bson.M{"_id": id, "status": HoldFulfilled}, change)
+}
+
+// ActiveLoan gets the active Loan of a member for a Product from the
+// collection.
+func (s *MongoStore) ActiveLoan(ctx context.Context, productID, member string) (*Loan, error) {
+	var l Loan
+
+	filter := bson.M{"productid": productID, "member": member, "status": LoanActive}
+	if err := s.loans.FindOne(ctx, filter).Decode(&l); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrLoanNotFound
+		}
+		return nil, errors.Wrap(err, "get loan")
+	}
+
+	return &l, nil
+}
+
+// retrieveLoan gets a single Loan from the collection.
+func (s *MongoStore) retrieveLoan(ctx context.Context, id string) (*Loan, error) {
+	var l Loan
+
+	if err := s.loans.FindOne(ctx, bson.M{"_id": id}).Decode(&l); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrLoanNotFound
+		}
+		return nil, errors.Wrap(err, "get loan")
+	}
+
+	return &l, nil
+}
+
+// ReturnLoan closes an active Loan and puts its copy back in stock. The status
+// check is part of the update filter so a copy is returned exactly once.
+// Should putting the copy back fail the Loan is made active again.
+func (s *MongoStore) ReturnLoan(ctx context.Context, id string, now time.Time) (*Loan, error) {
+	filter := bson.M{"_id": id, "status": LoanActive}
+	change := bson.M{"$set": bson.M{"status": LoanReturned, "datereturned": now}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var l Loan
+	if err := s.loans.FindOneAndUpdate(ctx, filter, change, opts).Decode(&l); err != nil {
+		if err == mongo.ErrNoDocuments {
+			if _, err := s.retrieveLoan(ctx, id); err != nil {
+				return nil, err
+			}
+			return nil, ErrLoanClosed
+		}
+		return nil, errors.Wrap(err, "returning loan")
+	}
+
+	// The Product may be in the trash, its stock is kept up to date for a
+	// restore.
+	inc := bson.M{"stock": 1, "onloan": -1}
+	if l.Overdue {
+		inc["overdue"] = -1
+	}
+	if _, err := s.collection.UpdateOne(ctx, bson.M{"id": l.ProductID}, bson.M{"$inc": inc}); err != nil {
+		undo := bson.M{"$set": bson.M{"status": LoanActive, "datereturned": nil}}
+		if _, uerr := s.loans.UpdateOne(ctx, bson.M{"_id": id, "status": LoanReturned}, undo); uerr != nil {
+			return nil, errors.Wrapf(err, "returning a copy of product %q, loan %q stays returned: %v", l.ProductID, id, uerr)
+		}
+		return nil, errors.Wrapf(err, "returning a copy of product %q", l.ProductID)
+	}
+
+	return &l, nil
+}
+
+// RenewLoan moves the due date of an active Loan. The renewal checks are part
+// of the update filter, only when nothing matched is the Loan read to explain
+// why.
+func (s *MongoStore) RenewLoan(ctx context.Context, id string, due time.Time, max int, now time.Time) (*Loan, error) {
+	filter := bson.M{
+		"_id":      id,
+		"status":   LoanActive,
+		"overdue":  false,
+		"datedue":  bson.M{"$gt": now},
+		"renewals": bson.M{"$lt": max},
+	}
+	change := bson.M{
+		"$set": bson.M{"datedue": due},
+		"$inc": bson.M{"renewals": 1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var l Loan
+	if err := s.loans.FindOneAndUpdate(ctx, filter, change, opts).Decode(&l); err != nil {
+		if err == mongo.ErrNoDocuments {
+			cur, err := s.retrieveLoan(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkRenew(*cur, max, now); err != nil {
+				return nil, err
+			}
+			return nil, ErrLoanClosed
+		}
+		return nil, errors.Wrap(err, "renewing loan")
+	}
+
+	return &l, nil
+}
+
+// ListLoans gets a page of the Loans of a member from the collection.
+func (s *MongoStore) ListLoans(ctx context.Context, member string, q LoanQuery) ([]Loan, error) {
+	loans := []Loan{}
+
+	filter := bson.M{"member": member}
+	if q.Active {
+		filter["status"] = LoanActive
+	}
+	if q.after != nil {
+		filter["$or"] = bson.A{
+			bson.M{"datecreated": bson.M{"$lt": q.after.Time}},
+			bson.M{"datecreated": q.after.Time, "id": bson.M{"$gt": q.after.ID}},
+		}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "datecreated", Value: -1}, {Key: "id", Value: 1}})
+	if q.Limit > 0 {
+		opts.SetLimit(int64(q.Limit))
+	}
+
+	cursor, err := s.loans.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting loans")
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &loans); err != nil {
+		return nil, errors.Wrap(err, "decoding loans")
+	}
+
+	return loans, nil
+}
+
+// OverdueLoans lists the active Loans that are due and not marked overdue.
+func (s *MongoStore) OverdueLoans(ctx context.Context, now time.Time) ([]string, error) {
+	filter := bson.M{"status": LoanActive, "overdue": false, "datedue": bson.M{"$lte": now}}
+	return s.ids(ctx, s.loans, filter, "overdue loans")
+}
+
+// MarkOverdue marks a due Loan overdue. The checks are part of the update
+// filter so a Loan is counted overdue once. Should counting it on the Product
+// fail the Loan is no longer marked, so that the next sweep tries again.
+func (s *MongoStore) MarkOverdue(ctx context.Context, id string, now time.Time) (*Loan, error) {
+	filter := bson.M{"_id": id, "status": LoanActive, "overdue": false, "datedue": bson.M{"$lte": now}}
+	change := bson.M{"$set": bson.M{"overdue": true}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var l Loan
+	if err := s.loans.FindOneAndUpdate(ctx, filter, change, opts).Decode(&l); err != nil {
+		if err == mongo.ErrNoDocuments {
+			cur, err := s.retrieveLoan(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkOverdue(*cur, now); err != nil {
+				return nil, err
+			}
+			return nil, ErrLoanClosed
+		}
+		return nil, errors.Wrap(err, "marking loan overdue")
+	}
+
+	if _, err := s.collection.UpdateOne(ctx, bson.M{"id": l.ProductID}, bson.M{"$inc": bson.M{"overdue": 1}}); err != nil {
+		undo := bson.M{"$set": bson.M{"overdue": false}}
+		if _, uerr := s.loans.UpdateOne(ctx, bson.M{"_id": id, "status": LoanActive, "overdue": true}, undo); uerr != nil {
+			return nil, errors.Wrapf(err, "counting an overdue copy of product %q, loan %q stays marked: %v", l.ProductID, id, uerr)
+		}
+		return nil, errors.Wrapf(err, "counting an overdue copy of product %q", l.ProductID)
+	}
+
+	return &l, nil
+}
+
+// PlaceHold stores a waiting Hold. The unique index on the open Holds keeps a
+// member from queueing twice for a Product.
+func (s *MongoStore) PlaceHold(ctx context.Context, h Hold) error {
+	if _, err := s.Retrieve(ctx, h.ProductID); err != nil {
+		return err
+	}
+	if _, err := s.ActiveLoan(ctx, h.ProductID, h.Member); err != ErrLoanNotFound {
+		if err != nil {
+			return err
+		}
+		return ErrAlreadyBorrowed
+	}
+
+	if _, err := s.holds.InsertOne(ctx, holdDocument{h.ID, h}); err != nil {
+		if database.IsDuplicateKey(err) {
+			return ErrDuplicateHold
+		}
+		return errors.Wrap(err, "inserting hold")
+	}
+
+	return nil
+}
+
+// RetrieveHold gets a single Hold from the collection.
+func (s *MongoStore) RetrieveHold(ctx context.Context, id string) (*Hold, error) {
+	var h Hold
+
+	if err := s.holds.FindOne(ctx, bson.M{"_id": id}).Decode(&h); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrHoldNotFound
+		}
+		return nil, errors.Wrap(err, "get hold")
+	}
+
+	return &h, nil
+}
+
+// ListHolds gets the open Holds of a Product in queue order.
+func (s *MongoStore) ListHolds(ctx context.Context, productID string) ([]Hold, error) {
+	holds := []Hold{}
+
+	filter := bson.M{"productid": productID, "status": bson.M{"$in": bson.A{HoldWaiting, HoldReady}}}
+	opts := options.Find().SetSort(bson.D{{Key: "datecreated", Value: 1}, {Key: "id", Value: 1}})
+
+	cursor, err := s.holds.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting holds")
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &holds); err != nil {
+		return nil, errors.Wrap(err, "decoding holds")
+	}
+
+	return holds, nil
+}
+
+// CloseHold closes an open Hold and releases the copy kept for it. The status
+// and expiry checks are part of the update filter so a Hold is closed exactly
+// once.
+func (s *MongoStore) CloseHold(ctx context.Context, id string, status string, now time.Time) (*Hold, error) {
+	filter := bson.M{"_id": id, "status": bson.M{"$in": bson.A{HoldWaiting, HoldReady}}}
+	if status == HoldExpired {
+		filter["status"] = HoldReady
+		filter["dateexpires"] = bson.M{"$lte": now}
+	}
+	change := bson.M{"$set": bson.M{"status": status, "dateclosed": now}}
+
+	// The Hold as it was tells whether a copy was kept for it.
+	var h Hold
+	if err := s.holds.FindOneAndUpdate(ctx, filter, change).Decode(&h); err != nil {
+		if err == mongo.ErrNoDocuments {
+			cur, err := s.RetrieveHold(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkCloseHold(*cur, status, now); err != nil {
+				return nil, err
+			}
+			return nil, ErrHoldClosed
+		}
+		return nil, errors.Wrap(err, "closing hold")
+	}
+	ready := h.Status == HoldReady
+	h.Status = status
+	h.DateClosed = &now
+
+	if ready {
+		release := bson.M{"$inc": bson.M{"stock": 1, "held": -1}}
+		if _, err := s.collection.UpdateOne(ctx, bson.M{"id": h.ProductID}, release); err != nil {
+			return nil, errors.Wrapf(err, "releasing the copy of product %q held for hold %q", h.ProductID, id)
+		}
+	}
+
+	return &h, nil
+}
+
+// PromoteHold keeps a copy in stock for the oldest waiting Hold of a Product.
+// The copy is taken before the Hold is made ready. When the Hold was closed
+// in between the copy is put back and the next Hold is tried.
+func (s *MongoStore) PromoteHold(ctx context.Context, productID string, now, expires time.Time) (*Hold, error) {
+	waiting := bson.M{"productid": productID, "status": HoldWaiting}
+	first := options.FindOne().SetSort(bson.D{{Key: "datecreated", Value: 1}, {Key: "id", Value: 1}})
+
+	for {
+		var h Hold
+		if err := s.holds.FindOne(ctx, waiting, first).Decode(&h); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, ErrHoldNotFound
+			}
+			return nil, errors.Wrap(err, "selecting waiting hold")
+		}
+
+		filter := revisionFilter(productID, AnyRevision, false)
+		filter["stock"] = bson.M{"$gte": 1}
+		res, err := s.collection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"stock": -1, "held": 1}})
+		if err != nil {
+			return nil, errors.Wrap(err, "holding copy")
+		}
+		if res.MatchedCount == 0 {
+			if _, err := s.Retrieve(ctx, productID); err != nil {
+				return nil, err
+			}
+			return nil, ErrInsufficientStock
+		}
+
+		change := bson.M{"$set": bson.M{"status": HoldReady, "dateready": now, "dateexpires": expires}}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+		err = s.holds.FindOneAndUpdate(ctx, bson.M{"_id": h.ID, "status": HoldWaiting}, change, opts).Decode(&h)
+		if err == nil {
+			return &h, nil
+		}
+
+		undo := bson.M{"$inc": bson.M{"stock": 1, "held": -1}}
+		if _, uerr := s.collection.UpdateOne(ctx, bson.M{"id": productID}, undo); uerr != nil {
+			return nil, errors.Wrapf(err, "readying hold, a copy of product %q stays held: %v", productID, uerr)
+		}
+		if err != mongo.ErrNoDocuments {
+			return nil, errors.Wrap(err, "readying hold")
+		}
+	}
+}
+
+// ExpiredHolds lists the ready Holds whose pickup time ran out.
+func (s *MongoStore) ExpiredHolds(ctx context.Context, now time.Time) ([]string, error) {
+	filter := bson.M{"status": HoldReady, "dateexpires": bson.M{"$lte": now}}
+	return s.ids(ctx, s.holds, filter, "expired holds")
+}
+
+// WaitingHolds lists the Products with waiting Holds.
+func (s *MongoStore) WaitingHolds(ctx context.Context) ([]string, error) {
+	values, err := s.holds.Distinct(ctx, "productid", bson.M{"status": HoldWaiting})
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting waiting holds")
+	}
+
+	var ids []string
+	for _, v := range values {
+		if id, ok := v.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// ids returns the Mongo _id of the documents of coll matching filter. what
+// names them in errors.
+func (s *MongoStore) ids(ctx context.Context, coll *mongo.Collection, filter bson.M, what string) ([]string, error) {
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "selecting %s", what)
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, errors.Wrapf(err, "decoding %s", what)
+	}
+
+	ids := make([]string, len(docs))
+	for i, d := range docs {
+		ids[i] = d.ID
+	}
+
+	return ids, nil
+}
+
+// AddReview stores a Review and rates its Product with it. The Product is
+// rated first, so a missing Product is found without storing anything, and
+// the rating is taken back should storing the Review fail.
+func (s *MongoStore) AddReview(ctx context.Context, r Review) error {
+	res, err := s.collection.UpdateOne(ctx, revisionFilter(r.ProductID, AnyRevision, false), rateChange(r.Rating, 1))
+	if err != nil {
+		return errors.Wrap(err, "rating product")
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := s.reviews.InsertOne(ctx, reviewDocument{r.ID, r}); err != nil {
+		if _, uerr := s.collection.UpdateOne(ctx, bson.M{"id": r.ProductID}, rateChange(r.Rating, -1)); uerr != nil {
+			return errors.Wrapf(err, "inserting review, the rating of product %q keeps it: %v", r.ProductID, uerr)
+		}
+		if database.IsDuplicateKey(err) {
+			return ErrDuplicateReview
+		}
+		return errors.Wrap(err, "inserting review")
+	}
+
+	return nil
+}
+
+// ListReviews gets a page of the Reviews of a Product, newest first.
+func (s *MongoStore) ListReviews(ctx context.Context, productID string, q ReviewQuery) ([]Review, error) {
+	reviews := []Review{}
+
+	filter := bson.M{"productid": productID}
+	if q.after != nil {
+		filter["$or"] = bson.A{
+			bson.M{"datecreated": bson.M{"$lt": q.after.Time}},
+			bson.M{"datecreated": q.after.Time, "id": bson.M{"$gt": q.after.ID}},
+		}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "datecreated", Value: -1}, {Key: "id", Value: 1}})
+	if q.Limit > 0 {
+		opts.SetLimit(int64(q.Limit))
+	}
+
+	cursor, err := s.reviews.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting reviews")
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &reviews); err != nil {
+		return nil, errors.Wrap(err, "decoding reviews")
+	}
+
+	return reviews, nil
+}
+
+// RetrieveReview gets a single Review from the collection.
+func (s *MongoStore) RetrieveReview(ctx context.Context, id string) (*Review, error) {
+	var r Review
+
+	err := s.reviews.FindOne(ctx, bson.M{"_id": id}).Decode(&r)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrReviewNotFound
+		}
+		return nil, errors.Wrap(err, "get review")
+	}
+
+	return &r, nil
+}
+
+// DeleteReview removes a Review and takes it out of the rating of its
+// Product. Deleting the Review first makes sure its rating is taken out once.
+func (s *MongoStore) DeleteReview(ctx context.Context, id, reviewer string) error {
+	var r Review
+
+	err := s.reviews.FindOneAndDelete(ctx, bson.M{"_id": id, "reviewer": reviewer}).Decode(&r)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrReviewNotFound
+		}
+		return errors.Wrap(err, "delete review")
+	}
+
+	if _, err := s.collection.UpdateOne(ctx, bson.M{"id": r.ProductID}, rateChange(r.Rating, -1)); err != nil {
+		return errors.Wrapf(err, "taking review %q out of the rating of product %q", id, r.ProductID)
+	}
+
+	return nil
+}
+
+// rateChange is the update pipeline adding delta reviews with the given
+// rating to a Product. The average is computed from the updated totals in
+// the same write. Products stored before reviews existed have no rating
+// fields, which count as zero.
+func rateChange(rating, delta int) mongo.Pipeline {
+	add := func(field string, n int) bson.M {
+		return bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$" + field, 0}}, n}}
+	}
+
+	count := "ratings." + strconv.Itoa(rating)
+
+	return mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			count:         add(count, delta),
+			"ratingsum":   add("ratingsum", rating*delta),
+			"reviewcount": add("reviewcount", delta),
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"rating": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$reviewcount", 0}},
+				bson.M{"$divide": bson.A{"$ratingsum", "$reviewcount"}},
+				0,
+			}},
+		}}},
+	}
+}
+
+// AddHistory stores a HistoryEntry.
+func (s *MongoStore) AddHistory(ctx context.Context, e HistoryEntry) error {
+	id := e.ProductID + "/" + strconv.Itoa(e.Revision)
+	if _, err := s.history.InsertOne(ctx, historyDocument{id, e}); err != nil {
+		return errors.Wrap(err, "inserting history entry")
+	}
+
+	return nil
+}
+
+// ListHistory gets a page of the history of a Product, newest first.
+func (s *MongoStore) ListHistory(ctx context.Context, productID string, q HistoryQuery) ([]HistoryEntry, error) {
+	entries := []HistoryEntry{}
+
+	filter := bson.M{"productid": productID}
+	if q.before > 0 {
+		filter["revision"] = bson.M{"$lt": q.before}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "revision", Value: -1}})
+	if q.Limit > 0 {
+		opts.SetLimit(int64(q.Limit))
+	}
+
+	cursor, err := s.history.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting history")
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, errors.Wrap(err, "decoding history")
+	}
+
+	return entries, nil
+}
+
+// RetrieveHistory gets the entry of a revision of a Product.
+func (s *MongoStore) RetrieveHistory(ctx context.Context, productID string, rev int) (*HistoryEntry, error) {
+	var e HistoryEntry
+
+	err := s.history.FindOne(ctx, bson.M{"productid": productID, "revision": rev}).Decode(&e)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrHistoryNotFound
+		}
+		return nil, errors.Wrap(err, "get history entry")
+	}
+
+	return &e, nil
+}
+
+// duplicateISBN returns the error of a write giving the Product with the
+// given ID an ISBN taken by another live Product, naming that Product.
+func (s *MongoStore) duplicateISBN(ctx context.Context, id, isbn string) error {
+	filter := bson.M{"isbn": isbn, "datedeleted": nil, "id": bson.M{"$ne": id}}
+
+	var p Product
+	err := s.collection.FindOne(ctx, filter).Decode(&p)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return errors.Wrap(err, "finding product with duplicate isbn")
+	}
+
+	return &DuplicateISBNError{ISBN: isbn, ID: p.ID}
+}
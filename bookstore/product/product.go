@@ -2,40 +2,84 @@ package product
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// Product is the book item.
+// Product is the book item. Revision starts at 1 and is incremented by every
+// update, it is what clients use for optimistic concurrency. DateDeleted is
+// set while the Product is in the trash.
+//
+// Price is in the minor unit of Currency, such as cents. Stock is the number
+// of copies that can still be reserved and Reserved the number held by
+// pending reservations. Reservations change them without a new revision.
+// Loans do the same with OnLoan, the number of copies lent to members, Held,
+// the number kept for ready holds, and Overdue, the number of loans past
+// their due date.
+//
+// Rating is the average rating of the ReviewCount reviews of the Product.
+// RatingSum is the total of their ratings and Ratings counts the reviews
+// giving each rating, keyed by the rating. Like stock, reviews change them
+// without a new revision.
+//
+// AuthorID references the author record of the book and Author is the display
+// name of that record, kept in the Product so that it can be filtered, sorted
+// and searched on. Books created before authors were records may only have
+// the name.
 type Product struct {
-	ID          string    `db:"product_id" json:"id"`
-	Name        string    `db:"name" json:"name"`
-	Author      string    `db:"author" json:"author"`
-	ISBN        string    `db:"isbn" json:"isbn"`
-	Genre       string    `db:"genre" json:"genre"`
-	DateCreated time.Time `db:"datecreated" json:"date_created"`
-	DateUpdated time.Time `db:"dateupdated" json:"date_updated"`
+	ID          string         `db:"product_id" json:"id"`
+	Name        string         `db:"name" json:"name"`
+	Author      string         `db:"author" json:"author"`
+	AuthorID    string         `db:"author_id" json:"author_id,omitempty"`
+	ISBN        string         `db:"isbn" json:"isbn"`
+	Genre       string         `db:"genre" json:"genre"`
+	Price       int64          `db:"price" json:"price"`
+	Currency    string         `db:"currency" json:"currency"`
+	Stock       int            `db:"stock" json:"stock"`
+	Reserved    int            `db:"reserved" json:"reserved"`
+	OnLoan      int            `db:"onloan" json:"on_loan"`
+	Held        int            `db:"held" json:"held"`
+	Overdue     int            `db:"overdue" json:"overdue"`
+	Rating      float64        `db:"rating" json:"rating"`
+	ReviewCount int            `db:"reviewcount" json:"review_count"`
+	RatingSum   int            `db:"ratingsum" json:"-"`
+	Ratings     map[string]int `db:"ratings" json:"-"`
+	Revision    int            `db:"revision" json:"revision"`
+	DateCreated time.Time      `db:"datecreated" json:"date_created"`
+	DateUpdated time.Time      `db:"dateupdated" json:"date_updated"`
+	DateDeleted *time.Time     `db:"datedeleted" json:"date_deleted,omitempty"`
 }
 
-// NewProduct get new product from user.
+// NewProduct get new product from user. The ISBN may be given as ISBN-10 or
+// ISBN-13 and is stored as ISBN-13. A Currency is needed when there is a
+// Price.
 type NewProduct struct {
-	Name   string `db:"name" json:"name" validate:"required"`
-	Author string `db:"author" json:"author"`
-	ISBN   string `db:"isbn" json:"isbn"`
-	Genre  string `db:"genre" json:"genre"`
+	Name     string `db:"name" json:"name" validate:"required"`
+	Author   string `db:"author" json:"author"`
+	AuthorID string `db:"author_id" json:"author_id" validate:"omitempty,uuid"`
+	ISBN     string `db:"isbn" json:"isbn" validate:"omitempty,isbn"`
+	Genre    string `db:"genre" json:"genre"`
+	Price    int64  `db:"price" json:"price" validate:"min=0"`
+	Currency string `db:"currency" json:"currency" validate:"required_with=Price,omitempty,currency"`
+	Stock    int    `db:"stock" json:"stock" validate:"min=0"`
 }
 
 // UpdateProduct defines what information may be provided to modify an
-// existing Product.
+// existing Product. Setting Stock replaces the number of copies available,
+// copies held by reservations are not affected.
 type UpdateProduct struct {
-	Name   *string `json:"name"`
-	Author *string `json:"author"`
-	ISBN   *string `json:"isbn"`
-	Genre  *string `json:"genre"`
+	Name     *string `json:"name"`
+	Author   *string `json:"author"`
+	AuthorID *string `json:"author_id"`
+	ISBN     *string `json:"isbn" validate:"omitempty,isbn"`
+	Genre    *string `json:"genre"`
+	Price    *int64  `json:"price" validate:"omitempty,min=0"`
+	Currency *string `json:"currency" validate:"omitempty,currency"`
+	Stock    *int    `json:"stock" validate:"omitempty,min=0"`
 }
 
 // Predefined errors identify expected failure conditions.
@@ -45,133 +89,403 @@ var (
 
 	// ErrInvalidID is used when an invalid UUID is provided.
 	ErrInvalidID = errors.New("ID is not in its proper form")
-)
 
-// List gets all Products from the database.
-func List(ctx context.Context, db *mongo.Client) ([]Product, error) {
-	products := []Product{}
+	// ErrRevisionMismatch is used when a Product is changed based on a
+	// revision that is no longer the stored one.
+	ErrRevisionMismatch = errors.New("product revision does not match")
 
-	collection := db.Database("test").Collection("books")
+	// ErrInvalidCurrency is used when a currency is not a three letter code.
+	ErrInvalidCurrency = errors.New("currency is not a three letter ISO 4217 code")
 
-	cursor, err := collection.Find(ctx, bson.M{})
-	if err != nil {
-		return nil, errors.Wrap(err, "selecting products")
+	// ErrNegativeAmount is used when a price or a stock is below zero.
+	ErrNegativeAmount = errors.New("price and stock must not be negative")
+)
+
+// NormalizeCurrency returns the upper case form of a three letter ISO 4217
+// currency code.
+func NormalizeCurrency(s string) (string, error) {
+	if len(s) != 3 {
+		return "", ErrInvalidCurrency
 	}
-	defer cursor.Close(ctx)
 
-	for cursor.Next(ctx) {
-		var p Product
-		if err = cursor.Decode(&p); err != nil {
-			return nil, errors.Wrap(err, "decoding produces")
+	s = strings.ToUpper(s)
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'A' || s[i] > 'Z' {
+			return "", ErrInvalidCurrency
 		}
-		products = append(products, p)
 	}
 
-	return products, nil
+	return s, nil
 }
 
-// Retrieve gets a single Product from the database.
-func Retrieve(ctx context.Context, db *mongo.Client, id string) (*Product, error) {
-	if _, err := uuid.Parse(id); err != nil {
-		return nil, ErrInvalidID
+// normalizeOptionalCurrency normalizes a currency that may be left empty.
+func normalizeOptionalCurrency(currency string) (string, error) {
+	if currency == "" {
+		return "", nil
 	}
+	return NormalizeCurrency(currency)
+}
 
-	var p Product
-
-	collection := db.Database("test").Collection("books")
+// AnyRevision is passed as the expected revision to Update and Delete to
+// apply the change whatever the stored revision is.
+const AnyRevision = -1
+
+// List gets the Products matching q from the database. When q has a Limit and
+// more Products are available, the returned cursor can be set on the next
+// query to continue after the last returned Product. It is empty on the last
+// page.
+func List(ctx context.Context, db Store, q Query) ([]Product, string, error) {
+	if err := q.prepare(); err != nil {
+		return nil, "", err
+	}
 
-	filter := bson.D{{"id", id}}
+	// Ask for one extra Product to learn whether there is a next page.
+	limit := q.Limit
+	if limit > 0 {
+		q.Limit = limit + 1
+	}
 
-	err := collection.FindOne(ctx, filter).Decode(&p)
+	products, err := db.List(ctx, q)
 	if err != nil {
-		return nil, errors.Wrap(err, "get product")
+		return nil, "", err
 	}
 
-	return &p, nil
+	var next string
+	if limit > 0 && len(products) > limit {
+		products = products[:limit]
+		next = q.cursorAfter(products[limit-1])
+	}
+
+	return products, next, nil
+}
+
+// Trash gets the deleted Products that have not been purged yet. Filters,
+// sorting and paging work as they do for List.
+func Trash(ctx context.Context, db Store, q Query) ([]Product, string, error) {
+	q.Deleted = true
+	return List(ctx, db, q)
+}
+
+// Retrieve gets a single Product from the database. Products in the trash are
+// not found.
+func Retrieve(ctx context.Context, db Store, id string) (*Product, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	return db.Retrieve(ctx, id)
 }
 
 // Create adds a Product to the database. It returns the created Product with
 // fields like ID and DateCreated populated..
-func Create(ctx context.Context, db *mongo.Client, np NewProduct, now time.Time) (*Product, error) {
-	p := Product{
-		ID:          uuid.New().String(),
-		Name:        np.Name,
-		Author:      np.Author,
-		ISBN:        np.ISBN,
-		Genre:       np.Genre,
-		DateCreated: now.UTC(),
-		DateUpdated: now.UTC(),
+func Create(ctx context.Context, db Store, np NewProduct, now time.Time) (*Product, error) {
+	p, err := newProduct(np, now)
+	if err != nil {
+		return nil, err
 	}
 
-	collection := db.Database("test").Collection("books")
+	if err := db.Insert(ctx, p); err != nil {
+		return nil, err
+	}
 
-	_, err := collection.InsertOne(ctx, p)
-	if err != nil {
-		return nil, errors.Wrap(err, "inserting product")
+	if err := db.AddHistory(ctx, newHistoryEntry(ctx, EventCreated, nil, p, createdFields, p.DateCreated)); err != nil {
+		return nil, errors.Wrap(err, "recording history")
 	}
 
 	return &p, nil
 }
 
-// Update modifies data about a Product. It will error if the specified ID is
-// invalid or does not reference an existing Product.
-func Update(ctx context.Context, db *mongo.Client, id string, update UpdateProduct, now time.Time) error {
-	p, err := Retrieve(ctx, db, id)
+// BatchError reports the Products of a batch that could not be created. The
+// failures are keyed by the index of the Product in the batch.
+type BatchError struct {
+	Failed map[int]error
+}
+
+// Error implements the error interface.
+func (err *BatchError) Error() string {
+	return fmt.Sprintf("%d products of the batch failed", len(err.Failed))
+}
+
+// CreateMany adds a batch of Products to the database in one write. It
+// returns the Products that were created. When only some of the batch could
+// be created the error is a *BatchError keyed by index into nps.
+func CreateMany(ctx context.Context, db Store, nps []NewProduct, now time.Time) ([]Product, error) {
+	failed := make(map[int]error)
+
+	// index maps the position of each built Product back to its NewProduct.
+	var ps []Product
+	var index []int
+	for i, np := range nps {
+		p, err := newProduct(np, now)
+		if err != nil {
+			failed[i] = err
+			continue
+		}
+
+		ps = append(ps, p)
+		index = append(index, i)
+	}
+
+	err := db.InsertMany(ctx, ps)
 	if err != nil {
+		berr, ok := err.(*BatchError)
+		if !ok {
+			return nil, err
+		}
+		for i, err := range berr.Failed {
+			failed[index[i]] = err
+		}
+	}
+
+	created := make([]Product, 0, len(ps))
+	for i, p := range ps {
+		if _, ok := failed[index[i]]; !ok {
+			created = append(created, p)
+		}
+	}
+
+	for _, p := range created {
+		if err := db.AddHistory(ctx, newHistoryEntry(ctx, EventCreated, nil, p, createdFields, p.DateCreated)); err != nil {
+			return nil, errors.Wrap(err, "recording history")
+		}
+	}
+
+	if len(failed) > 0 {
+		return created, &BatchError{Failed: failed}
+	}
+	return created, nil
+}
+
+// Walk calls fn for every Product matching q without loading them all into
+// memory. Limit and Cursor work as they do for List.
+func Walk(ctx context.Context, db Store, q Query, fn func(Product) error) error {
+	if err := q.prepare(); err != nil {
 		return err
 	}
 
+	return db.Walk(ctx, q, fn)
+}
+
+// Update modifies data about a Product and returns it with its new revision.
+// When rev is not AnyRevision the change is only applied if the stored
+// revision still equals rev, otherwise ErrRevisionMismatch is returned. It
+// will error if the specified ID is invalid or does not reference an existing
+// Product.
+func Update(ctx context.Context, db Store, id string, rev int, update UpdateProduct, now time.Time) (*Product, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	if err := update.normalize(); err != nil {
+		return nil, err
+	}
+
+	return change(ctx, db, id, rev, fixed(update), now.UTC(), EventUpdated, 0)
+}
+
+// Patch changes the live Product with the given ID to the values edit derives
+// from it, in one conditional write. edit is given the stored Product and
+// returns the fields to change, nil when there are none. Without an expected
+// revision edit is called again when the Product changes in between; with
+// one the Product is only patched if the stored revision still equals rev.
+// Errors from edit are returned as they are.
+func Patch(ctx context.Context, db Store, id string, rev int, edit func(Product) (*UpdateProduct, error), now time.Time) (*Product, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	normalized := func(old Product) (*UpdateProduct, error) {
+		update, err := edit(old)
+		if err != nil || update == nil {
+			return nil, err
+		}
+		if err := update.normalize(); err != nil {
+			return nil, err
+		}
+		return update, nil
+	}
+
+	return change(ctx, db, id, rev, normalized, now.UTC(), EventUpdated, 0)
+}
+
+// normalize checks the values of an update and brings the ISBN and Currency
+// to their stored form.
+func (u *UpdateProduct) normalize() error {
+	if u.AuthorID != nil && *u.AuthorID != "" {
+		if _, err := uuid.Parse(*u.AuthorID); err != nil {
+			return ErrInvalidID
+		}
+	}
+	if u.ISBN != nil {
+		isbn, err := normalizeOptionalISBN(*u.ISBN)
+		if err != nil {
+			return err
+		}
+		u.ISBN = &isbn
+	}
+	if u.Currency != nil {
+		currency, err := normalizeOptionalCurrency(*u.Currency)
+		if err != nil {
+			return err
+		}
+		u.Currency = &currency
+	}
+	if (u.Price != nil && *u.Price < 0) || (u.Stock != nil && *u.Stock < 0) {
+		return ErrNegativeAmount
+	}
+
+	return nil
+}
+
+// Delete moves the product identified by a given ID to the trash, where it
+// stays until it is restored or purged. When rev is not AnyRevision the
+// Product is only deleted if the stored revision still equals rev. Like for
+// Update, the Product is read first to record the change.
+func Delete(ctx context.Context, db Store, id string, rev int, now time.Time) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidID
+	}
+	now = now.UTC()
+
+	for {
+		old, err := db.Retrieve(ctx, id)
+		if err != nil {
+			return err
+		}
+		if rev != AnyRevision && old.Revision != rev {
+			return ErrRevisionMismatch
+		}
+
+		err = db.Delete(ctx, id, old.Revision, now)
+		if err == ErrRevisionMismatch && rev == AnyRevision {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		p := *old
+		p.DateDeleted = &now
+		p.Revision++
+
+		e := newHistoryEntry(ctx, EventDeleted, old, p, []string{"date_deleted"}, now)
+		if err := db.AddHistory(ctx, e); err != nil {
+			return errors.Wrap(err, "recording history")
+		}
+
+		return nil
+	}
+}
+
+// Restore takes the product identified by a given ID out of the trash and
+// returns it with its new revision. When rev is not AnyRevision the Product
+// is only restored if the stored revision still equals rev.
+func Restore(ctx context.Context, db Store, id string, rev int) (*Product, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	p, err := db.Restore(ctx, id, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	// The Product in the trash is the one its deletion recorded.
+	old := *p
+	if e, err := db.RetrieveHistory(ctx, id, p.Revision-1); err == nil {
+		old = e.Product
+	}
+
+	e := newHistoryEntry(ctx, EventRestored, &old, *p, []string{"date_deleted"}, time.Now().UTC())
+	if err := db.AddHistory(ctx, e); err != nil {
+		return nil, errors.Wrap(err, "recording history")
+	}
+
+	return p, nil
+}
+
+// Purge permanently removes the Products that were moved to the trash before
+// the given time. It returns the IDs of those removed, so that data kept
+// outside the Store can go with them.
+func Purge(ctx context.Context, db Store, before time.Time) ([]string, error) {
+	return db.Purge(ctx, before.UTC())
+}
+
+// apply sets the fields given in update on p and stamps it as a new revision.
+func apply(p *Product, update UpdateProduct, now time.Time) {
 	if update.Name != nil {
 		p.Name = *update.Name
 	}
-
 	if update.Author != nil {
 		p.Author = *update.Author
 	}
+	if update.AuthorID != nil {
+		p.AuthorID = *update.AuthorID
+	}
 	if update.ISBN != nil {
 		p.ISBN = *update.ISBN
 	}
 	if update.Genre != nil {
 		p.Genre = *update.Genre
 	}
+	if update.Price != nil {
+		p.Price = *update.Price
+	}
+	if update.Currency != nil {
+		p.Currency = *update.Currency
+	}
+	if update.Stock != nil {
+		p.Stock = *update.Stock
+	}
 
+	p.Revision++
 	p.DateUpdated = now
+}
 
-	collection := db.Database("test").Collection("books")
-
-	filter := bson.D{{"id", id}}
+// newProduct builds a Product from the fields given by the user.
+func newProduct(np NewProduct, now time.Time) (Product, error) {
+	if np.AuthorID != "" {
+		if _, err := uuid.Parse(np.AuthorID); err != nil {
+			return Product{}, ErrInvalidID
+		}
+	}
 
-	_, err = collection.UpdateOne(ctx, filter,
-		bson.D{
-			{"$set", bson.D{
-				{"name", p.Name},
-				{"author", p.Author},
-				{"isbn", p.ISBN},
-				{"grene", p.DateUpdated},
-				{"dateupdated", p.DateUpdated},
-			}},
-		})
+	isbn, err := normalizeOptionalISBN(np.ISBN)
 	if err != nil {
-		return errors.Wrap(err, "get product")
+		return Product{}, err
 	}
 
-	return nil
-}
+	currency, err := normalizeOptionalCurrency(np.Currency)
+	if err != nil {
+		return Product{}, err
+	}
 
-// Delete removes the product identified by a given ID.
-func Delete(ctx context.Context, db *mongo.Client, id string) error {
-	if _, err := uuid.Parse(id); err != nil {
-		return ErrInvalidID
+	if np.Price < 0 || np.Stock < 0 {
+		return Product{}, ErrNegativeAmount
 	}
 
-	collection := db.Database("test").Collection("books")
+	p := Product{
+		ID:          uuid.New().String(),
+		Name:        np.Name,
+		Author:      np.Author,
+		AuthorID:    np.AuthorID,
+		ISBN:        isbn,
+		Genre:       np.Genre,
+		Price:       np.Price,
+		Currency:    currency,
+		Stock:       np.Stock,
+		Revision:    1,
+		DateCreated: now.UTC(),
+		DateUpdated: now.UTC(),
+	}
 
-	filter := bson.D{{"id", id}}
+	return p, nil
+}
 
-	_, err := collection.DeleteOne(ctx, filter)
-	if err != nil {
-		return errors.Wrap(err, "delete product")
+// normalizeOptionalISBN normalizes an ISBN that may be left empty.
+func normalizeOptionalISBN(isbn string) (string, error) {
+	if isbn == "" {
+		return "", nil
 	}
-
-	return nil
+	return NormalizeISBN(isbn)
 }
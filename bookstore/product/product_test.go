@@ -2,28 +2,63 @@ package product_test
 
 import (
 	"context"
+	"errors"
+	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi"
 	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
 	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
 	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/tests"
 )
 
-// TestProducts tests product CRUD APIs.
+// TestProducts tests product CRUD APIs against mongodb.
 func TestProducts(t *testing.T) {
 	//Create mongodb container for testing.
-	db, teardown := tests.NewUnit(t)
+	client, teardown := tests.NewUnit(t)
 	defer teardown()
 
+	db := product.NewMongoStore(client, "test", "books")
+	if err := db.EnsureIndexes(context.Background()); err != nil {
+		t.Fatalf("creating indexes: %s", err)
+	}
+	testProducts(t, db)
+	testReservations(t, db)
+	testLoans(t, db)
+	testReviews(t, db)
+	testHistory(t, db)
+	testDuplicateISBN(t, db)
+}
+
+// TestProductsMemory tests product CRUD APIs against the in-memory store.
+func TestProductsMemory(t *testing.T) {
+	testProducts(t, product.NewMemoryStore())
+	testReservations(t, product.NewMemoryStore())
+	testLoans(t, product.NewMemoryStore())
+	testReviews(t, product.NewMemoryStore())
+	testHistory(t, product.NewMemoryStore())
+	testDuplicateISBN(t, product.NewMemoryStore())
+}
+
+func testProducts(t *testing.T, db product.Store) {
+	t.Helper()
+
 	ctx := context.Background()
 
 	// Create NewProduct to test product.Create() function.
 	newP1 := product.NewProduct{
 		Name:   "Funny Book",
 		Author: "Mike",
-		ISBN:   "123456",
+		ISBN:   "0-306-40615-2",
 		Genre:  "funny",
 	}
 	now1 := time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC)
@@ -49,7 +84,7 @@ func TestProducts(t *testing.T) {
 	newP2 := product.NewProduct{
 		Name:   "Fiction Book",
 		Author: "Mike",
-		ISBN:   "345678",
+		ISBN:   "978-3-16-148410-0",
 		Genre:  "fiction",
 	}
 
@@ -73,7 +108,7 @@ func TestProducts(t *testing.T) {
 	updateP4 := product.UpdateProduct{
 		Author: &updateAuthor,
 	}
-	if err := product.Update(ctx, db, p2.ID, updateP4, now2); err != nil {
+	if _, err := product.Update(ctx, db, p2.ID, product.AnyRevision, updateP4, now2); err != nil {
 		t.Fatalf("updating product %v: %s", updateP4, err)
 	}
 
@@ -86,8 +121,24 @@ func TestProducts(t *testing.T) {
 		t.Fatalf("expected product %v, got %v", exp, got)
 	}
 
+	// Test case for the Stats() summary used by the metrics collector.
+	st, err := db.Stats(ctx, now2)
+	if err != nil {
+		t.Fatalf("getting stats: %s", err)
+	}
+	expStats := &product.Stats{
+		Total:        2,
+		ByGenre:      map[string]int{"funny": 1, "fiction": 1},
+		ByAuthor:     map[string]int{"Mike": 1, "Ben": 1},
+		Ratings:      map[int]int{},
+		CreatedSince: 1,
+	}
+	if diff := cmp.Diff(expStats, st); diff != "" {
+		t.Fatalf("stats differ:\n%s", diff)
+	}
+
 	// Test case for product.List() function.
-	ps, err := product.List(ctx, db)
+	ps, _, err := product.List(ctx, db, product.Query{})
 	if err != nil {
 		t.Fatalf("listing products: %s", err)
 	}
@@ -95,19 +146,1326 @@ func TestProducts(t *testing.T) {
 		t.Fatalf("expected product list size %v, got %v", exp, got)
 	}
 
-	if err = product.Delete(ctx, db, p0.ID); err != nil {
-		log.Fatalf("deleting product %v: %s", p0.ID, err)
+	if err = product.Delete(ctx, db, p0.ID, product.AnyRevision, time.Now()); err != nil {
+		t.Fatalf("deleting product %v: %s", p0.ID, err)
 	}
 
-	if err = product.Delete(ctx, db, p2.ID); err != nil {
-		log.Fatalf("deleting product %v: %s", p2.ID, err)
+	if err = product.Delete(ctx, db, p2.ID, product.AnyRevision, time.Now()); err != nil {
+		t.Fatalf("deleting product %v: %s", p2.ID, err)
 	}
 
-	ps, err = product.List(ctx, db)
+	ps, _, err = product.List(ctx, db, product.Query{})
 	if err != nil {
 		t.Fatalf("listing products: %s", err)
 	}
 	if exp, got := 0, len(ps); exp != got {
 		t.Fatalf("expected product list size %v, got %v", exp, got)
 	}
+
+	// Deleted products are in the trash until they are restored or purged.
+	if _, err := product.Retrieve(ctx, db, p0.ID); err != product.ErrNotFound {
+		t.Fatalf("expected %v getting a deleted product, got %v", product.ErrNotFound, err)
+	}
+	if err := product.Delete(ctx, db, p0.ID, product.AnyRevision, time.Now()); err != product.ErrNotFound {
+		t.Fatalf("expected %v deleting a deleted product, got %v", product.ErrNotFound, err)
+	}
+
+	trash, _, err := product.Trash(ctx, db, product.Query{})
+	if err != nil {
+		t.Fatalf("listing trash: %s", err)
+	}
+	if exp, got := 2, len(trash); exp != got {
+		t.Fatalf("expected trash size %v, got %v", exp, got)
+	}
+	for _, p := range trash {
+		if p.DateDeleted == nil {
+			t.Fatalf("expected product %v in the trash to have a deletion date", p.ID)
+		}
+	}
+
+	restored, err := product.Restore(ctx, db, p0.ID, product.AnyRevision)
+	if err != nil {
+		t.Fatalf("restoring product %v: %s", p0.ID, err)
+	}
+	if restored.DateDeleted != nil {
+		t.Fatalf("expected restored product to have no deletion date, got %v", restored.DateDeleted)
+	}
+	if _, err := product.Retrieve(ctx, db, p0.ID); err != nil {
+		t.Fatalf("getting restored product %v: %s", p0.ID, err)
+	}
+	if _, err := product.Restore(ctx, db, p0.ID, product.AnyRevision); err != product.ErrNotFound {
+		t.Fatalf("expected %v restoring a live product, got %v", product.ErrNotFound, err)
+	}
+
+	purged, err := product.Purge(ctx, db, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("purging trash: %s", err)
+	}
+	if exp, got := 1, len(purged); exp != got {
+		t.Fatalf("expected %v purged products, got %v", exp, got)
+	}
+	if _, err := product.Restore(ctx, db, p2.ID, product.AnyRevision); err != product.ErrNotFound {
+		t.Fatalf("expected %v restoring a purged product, got %v", product.ErrNotFound, err)
+	}
+}
+
+// TestListQuery tests filtering, sorting and paging through product.List().
+func TestListQuery(t *testing.T) {
+	db := product.NewMemoryStore()
+	ctx := context.Background()
+
+	// Create books by two authors with names in a known order.
+	now := time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC)
+	names := []string{"e", "a", "d", "b", "c"}
+	for i, name := range names {
+		np := product.NewProduct{
+			Name:   name,
+			Author: "Mike",
+			Genre:  "funny",
+		}
+		if i%2 == 1 {
+			np.Author = "Ben"
+		}
+		if _, err := product.Create(ctx, db, np, now.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("creating product %q: %s", name, err)
+		}
+	}
+
+	// Page through all books sorted by name descending, two at a time.
+	q := product.Query{Sort: "name", Desc: true, Limit: 2}
+	var got []string
+	for page := 0; ; page++ {
+		if page > len(names) {
+			t.Fatalf("paging did not stop after %d pages", page)
+		}
+
+		ps, next, err := product.List(ctx, db, q)
+		if err != nil {
+			t.Fatalf("listing products: %s", err)
+		}
+		for _, p := range ps {
+			got = append(got, p.Name)
+		}
+		if next == "" {
+			break
+		}
+		q.Cursor = next
+	}
+
+	if diff := cmp.Diff([]string{"e", "d", "c", "b", "a"}, got); diff != "" {
+		t.Fatalf("paged names differ:\n%s", diff)
+	}
+
+	// Filter by author, using the default creation time order.
+	ps, next, err := product.List(ctx, db, product.Query{Author: "Ben"})
+	if err != nil {
+		t.Fatalf("listing products: %s", err)
+	}
+	if next != "" {
+		t.Fatalf("expected no next page for an unlimited query, got %q", next)
+	}
+	got = nil
+	for _, p := range ps {
+		got = append(got, p.Name)
+	}
+	if diff := cmp.Diff([]string{"a", "b"}, got); diff != "" {
+		t.Fatalf("filtered names differ:\n%s", diff)
+	}
+
+	// A cursor must not be accepted for a different sort order.
+	if _, _, err := product.List(ctx, db, product.Query{Sort: "genre", Cursor: q.Cursor}); err != product.ErrInvalidCursor {
+		t.Fatalf("expected %v for a mismatched cursor, got %v", product.ErrInvalidCursor, err)
+	}
+
+	if _, _, err := product.List(ctx, db, product.Query{Sort: "publisher"}); err != product.ErrInvalidSort {
+		t.Fatalf("expected %v for an unknown sort field, got %v", product.ErrInvalidSort, err)
+	}
+}
+
+// TestSearch tests relevance ordering, highlighting and paging of
+// product.Search().
+func TestSearch(t *testing.T) {
+	db := product.NewMemoryStore()
+	ctx := context.Background()
+
+	now := time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC)
+	nps := []product.NewProduct{
+		{Name: "Dragons of Autumn", Author: "Margaret Weis", Genre: "fantasy"},
+		{Name: "Cooking for One", Author: "Dragon Chef", Genre: "cooking"},
+		{Name: "Space Opera", Author: "Mike", Genre: "science fiction"},
+	}
+	for _, np := range nps {
+		if _, err := product.Create(ctx, db, np, now); err != nil {
+			t.Fatalf("creating product %q: %s", np.Name, err)
+		}
+	}
+
+	ms, next, err := product.Search(ctx, db, product.SearchQuery{Text: "dragon", Limit: 1})
+	if err != nil {
+		t.Fatalf("searching products: %s", err)
+	}
+	if exp, got := 1, len(ms); exp != got {
+		t.Fatalf("expected %d match on the first page, got %d", exp, got)
+	}
+
+	// A match in the name outweighs a match in the author.
+	if exp, got := "Dragons of Autumn", ms[0].Name; exp != got {
+		t.Fatalf("expected best match %q, got %q", exp, got)
+	}
+	if exp, got := "<em>Dragons</em> of Autumn", ms[0].Highlights["name"]; exp != got {
+		t.Fatalf("expected highlight %q, got %q", exp, got)
+	}
+
+	ms, next, err = product.Search(ctx, db, product.SearchQuery{Text: "dragon", Limit: 1, Cursor: next})
+	if err != nil {
+		t.Fatalf("searching products: %s", err)
+	}
+	if exp, got := "Cooking for One", ms[0].Name; exp != got {
+		t.Fatalf("expected second match %q, got %q", exp, got)
+	}
+	if next != "" {
+		t.Fatalf("expected no page after the last match, got %q", next)
+	}
+
+	// A score cutoff drops the weaker author match.
+	ms, _, err = product.Search(ctx, db, product.SearchQuery{Text: "dragon", MinScore: 3})
+	if err != nil {
+		t.Fatalf("searching products: %s", err)
+	}
+	if exp, got := 1, len(ms); exp != got {
+		t.Fatalf("expected %d match above the cutoff, got %d", exp, got)
+	}
+
+	// Markup in the fields is escaped around the highlights.
+	if _, err := product.Create(ctx, db, product.NewProduct{Name: "<script>Wyverns</script> & Co"}, now); err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	ms, _, err = product.Search(ctx, db, product.SearchQuery{Text: "wyverns"})
+	if err != nil {
+		t.Fatalf("searching products: %s", err)
+	}
+	if len(ms) != 1 {
+		t.Fatalf("expected 1 match, got %d", len(ms))
+	}
+	if exp, got := "&lt;script&gt;<em>Wyverns</em>&lt;/script&gt; &amp; Co", ms[0].Highlights["name"]; exp != got {
+		t.Fatalf("expected highlight %q, got %q", exp, got)
+	}
+
+	if _, _, err := product.Search(ctx, db, product.SearchQuery{Text: " "}); err != product.ErrEmptySearch {
+		t.Fatalf("expected %v for empty search text, got %v", product.ErrEmptySearch, err)
+	}
+}
+
+// TestISBN tests ISBN validation, normalization and lookup by either form.
+func TestISBN(t *testing.T) {
+	tests := []struct {
+		in     string
+		isbn13 string
+		isbn10 string
+	}{
+		{"0-306-40615-2", "9780306406157", "0306406152"},
+		{"978-0-306-40615-7", "9780306406157", "0306406152"},
+		{"080442957x", "9780804429573", "080442957X"},
+		{"979-10-90636-07-1", "9791090636071", ""},
+		{"0-306-40615-3", "", ""},
+		{"978-0-306-40615-8", "", ""},
+		{"123-0-306-40615-7", "", ""},
+		{"123456", "", ""},
+	}
+
+	for _, tt := range tests {
+		isbn13, err := product.NormalizeISBN(tt.in)
+		if tt.isbn13 == "" {
+			if err != product.ErrInvalidISBN {
+				t.Fatalf("expected %q to be invalid, got %q, %v", tt.in, isbn13, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("normalizing %q: %s", tt.in, err)
+		}
+		if isbn13 != tt.isbn13 {
+			t.Fatalf("expected %q to normalize to %q, got %q", tt.in, tt.isbn13, isbn13)
+		}
+
+		isbn10, ok := product.ISBN10(tt.in)
+		if ok != (tt.isbn10 != "") || isbn10 != tt.isbn10 {
+			t.Fatalf("expected ISBN-10 of %q to be %q, got %q", tt.in, tt.isbn10, isbn10)
+		}
+	}
+
+	db := product.NewMemoryStore()
+	ctx := context.Background()
+
+	np := product.NewProduct{Name: "Funny Book", ISBN: "0-306-40615-2"}
+	p, err := product.Create(ctx, db, np, time.Now())
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	if exp, got := "9780306406157", p.ISBN; exp != got {
+		t.Fatalf("expected stored ISBN %q, got %q", exp, got)
+	}
+
+	for _, isbn := range []string{"0306406152", "978-0-306-40615-7"} {
+		ps, _, err := product.List(ctx, db, product.Query{ISBN: isbn})
+		if err != nil {
+			t.Fatalf("listing products by ISBN %q: %s", isbn, err)
+		}
+		if len(ps) != 1 || ps[0].ID != p.ID {
+			t.Fatalf("expected to find product %s by ISBN %q, got %v", p.ID, isbn, ps)
+		}
+	}
+
+	bad := "12345"
+	if _, err := product.Update(ctx, db, p.ID, product.AnyRevision, product.UpdateProduct{ISBN: &bad}, time.Now()); err != product.ErrInvalidISBN {
+		t.Fatalf("expected %v updating to an invalid ISBN, got %v", product.ErrInvalidISBN, err)
+	}
+}
+
+// TestRevision tests that updates and deletes based on a stale revision are
+// rejected.
+func TestRevision(t *testing.T) {
+	db := product.NewMemoryStore()
+	ctx := context.Background()
+
+	p, err := product.Create(ctx, db, product.NewProduct{Name: "Funny Book"}, time.Now())
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	if exp, got := 1, p.Revision; exp != got {
+		t.Fatalf("expected new product revision %d, got %d", exp, got)
+	}
+
+	name := "Funnier Book"
+	up, err := product.Update(ctx, db, p.ID, 1, product.UpdateProduct{Name: &name}, time.Now())
+	if err != nil {
+		t.Fatalf("updating product at revision 1: %s", err)
+	}
+	if exp, got := 2, up.Revision; exp != got {
+		t.Fatalf("expected updated product revision %d, got %d", exp, got)
+	}
+
+	// A second writer still holding revision 1 must not overwrite the change.
+	name = "Stale Book"
+	if _, err := product.Update(ctx, db, p.ID, 1, product.UpdateProduct{Name: &name}, time.Now()); err != product.ErrRevisionMismatch {
+		t.Fatalf("expected %v updating a stale revision, got %v", product.ErrRevisionMismatch, err)
+	}
+	if err := product.Delete(ctx, db, p.ID, 1, time.Now()); err != product.ErrRevisionMismatch {
+		t.Fatalf("expected %v deleting a stale revision, got %v", product.ErrRevisionMismatch, err)
+	}
+
+	got, err := product.Retrieve(ctx, db, p.ID)
+	if err != nil {
+		t.Fatalf("getting product: %s", err)
+	}
+	if exp := "Funnier Book"; got.Name != exp {
+		t.Fatalf("expected name %q after stale writes, got %q", exp, got.Name)
+	}
+
+	if err := product.Delete(ctx, db, p.ID, 2, time.Now()); err != nil {
+		t.Fatalf("deleting product at revision 2: %s", err)
+	}
+	if err := product.Delete(ctx, db, p.ID, 3, time.Now()); err != product.ErrNotFound {
+		t.Fatalf("expected %v deleting a deleted product at a revision, got %v", product.ErrNotFound, err)
+	}
+
+	// Deleting made revision 3, the restore must be based on it.
+	if _, err := product.Restore(ctx, db, p.ID, 2); err != product.ErrRevisionMismatch {
+		t.Fatalf("expected %v restoring a stale revision, got %v", product.ErrRevisionMismatch, err)
+	}
+	if _, err := product.Restore(ctx, db, p.ID, 3); err != nil {
+		t.Fatalf("restoring product at revision 3: %s", err)
+	}
+}
+
+// TestCreateMany tests batch creation with a partly invalid batch and
+// streaming the result back with product.Walk().
+func TestCreateMany(t *testing.T) {
+	db := product.NewMemoryStore()
+	ctx := context.Background()
+
+	nps := []product.NewProduct{
+		{Name: "Funny Book", ISBN: "0-306-40615-2"},
+		{Name: "Bad ISBN", ISBN: "0-306-40615-3"},
+		{Name: "Fiction Book"},
+	}
+
+	created, err := product.CreateMany(ctx, db, nps, time.Now())
+	berr, ok := err.(*product.BatchError)
+	if !ok {
+		t.Fatalf("expected a batch error, got %v", err)
+	}
+	if exp, got := product.ErrInvalidISBN, berr.Failed[1]; exp != got || len(berr.Failed) != 1 {
+		t.Fatalf("expected only row 1 to fail with %v, got %v", exp, berr.Failed)
+	}
+	if exp, got := 2, len(created); exp != got {
+		t.Fatalf("expected %d created products, got %d", exp, got)
+	}
+
+	var names []string
+	err = product.Walk(ctx, db, product.Query{Sort: "name"}, func(p product.Product) error {
+		names = append(names, p.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walking products: %s", err)
+	}
+	if diff := cmp.Diff([]string{"Fiction Book", "Funny Book"}, names); diff != "" {
+		t.Fatalf("walked names differ:\n%s", diff)
+	}
+}
+
+// TestBroadcaster tests publishing writes to subscribers, resuming a feed
+// and dropping a subscriber that falls behind.
+func TestBroadcaster(t *testing.T) {
+	b := product.NewBroadcaster(2, 1)
+	db := product.WithEvents(product.NewMemoryStore(), b)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := b.Subscribe(ctx, "")
+	if err != nil {
+		t.Fatalf("subscribing: %s", err)
+	}
+
+	p, err := product.Create(ctx, db, product.NewProduct{Name: "Funny Book"}, time.Now())
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+
+	first := <-events
+	if first.Type != product.EventCreated || first.ProductID != p.ID {
+		t.Fatalf("expected a created event for %s, got %+v", p.ID, first)
+	}
+
+	// The subscriber buffers one event, the second unread one drops it.
+	if err := product.Delete(ctx, db, p.ID, product.AnyRevision, time.Now()); err != nil {
+		t.Fatalf("deleting product: %s", err)
+	}
+	b.Publish(product.Event{Type: product.EventUpdated, ProductID: "other"})
+
+	if ev := <-events; ev.Type != product.EventDeleted {
+		t.Fatalf("expected a deleted event, got %+v", ev)
+	}
+	if _, ok := <-events; ok {
+		t.Fatal("expected the lagging subscriber to be dropped")
+	}
+
+	resumed, err := b.Subscribe(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("resuming from %s: %s", first.ID, err)
+	}
+	if ev := <-resumed; ev.Type != product.EventDeleted || ev.ProductID != p.ID {
+		t.Fatalf("expected the deleted event to be replayed, got %+v", ev)
+	}
+
+	// Only the last two events are remembered.
+	b.Publish(product.Event{Type: product.EventUpdated, ProductID: "other"})
+	if _, err := b.Subscribe(ctx, first.ID); err != product.ErrEventsExpired {
+		t.Fatalf("expected %v resuming from an old event, got %v", product.ErrEventsExpired, err)
+	}
+	if _, err := b.Subscribe(ctx, "unknown-1"); err != product.ErrEventsExpired {
+		t.Fatalf("expected %v resuming from an unknown feed, got %v", product.ErrEventsExpired, err)
+	}
+}
+
+// failingStore is a Store whose Stats always fails and counts its calls.
+type failingStore struct {
+	product.Store
+	calls int
+}
+
+func (s *failingStore) Stats(ctx context.Context, since time.Time) (*product.Stats, error) {
+	s.calls++
+	return nil, errors.New("database unavailable")
+}
+
+// historyFailingStore is a Store that cannot record history.
+type historyFailingStore struct {
+	product.Store
+}
+
+func (s historyFailingStore) AddHistory(ctx context.Context, e product.HistoryEntry) error {
+	return errors.New("database unavailable")
+}
+
+// TestHistoryFailure tests that changes made through WithHistoryLog stay
+// made and are reported as made when their history cannot be recorded, and
+// that the failure is logged.
+func TestHistoryFailure(t *testing.T) {
+	ctx := context.Background()
+	failing := historyFailingStore{Store: product.NewMemoryStore()}
+	now := time.Now()
+
+	if _, err := product.Create(ctx, failing, product.NewProduct{Name: "Dune"}, now); err == nil {
+		t.Fatal("expected an error creating a product without its history")
+	}
+
+	var logged strings.Builder
+	db := product.WithHistoryLog(failing, log.New(&logged, "", 0))
+
+	p, err := product.Create(ctx, db, product.NewProduct{Name: "Dune"}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	name := "Dune Messiah"
+	if _, err := product.Update(ctx, db, p.ID, p.Revision, product.UpdateProduct{Name: &name}, now); err != nil {
+		t.Fatalf("updating product: %s", err)
+	}
+	if err := product.Delete(ctx, db, p.ID, product.AnyRevision, now); err != nil {
+		t.Fatalf("deleting product: %s", err)
+	}
+	if _, err := product.Restore(ctx, db, p.ID, product.AnyRevision); err != nil {
+		t.Fatalf("restoring product: %s", err)
+	}
+
+	got, err := product.Retrieve(ctx, db, p.ID)
+	if err != nil {
+		t.Fatalf("getting product: %s", err)
+	}
+	if exp := 4; got.Name != name || got.Revision != exp {
+		t.Errorf("expected %q at revision %d, got %q at %d", name, exp, got.Name, got.Revision)
+	}
+	if exp, got := 4, strings.Count(logged.String(), "recording revision"); exp != got {
+		t.Errorf("expected %d logged failures, got %d:\n%s", exp, got, logged.String())
+	}
+}
+
+// TestBookCollector tests the metrics of the BookCollector, the caching of
+// the stats and reporting a failed collection.
+func TestBookCollector(t *testing.T) {
+	db := product.NewMemoryStore()
+	ctx := context.Background()
+	logger := log.New(ioutil.Discard, "", 0)
+
+	nps := []product.NewProduct{
+		{Name: "Funny Book", Author: "Mike", Genre: "funny"},
+		{Name: "Fiction Book", Author: "Mike", Genre: "fiction"},
+	}
+	if _, err := product.CreateMany(ctx, db, nps, time.Now()); err != nil {
+		t.Fatalf("creating products: %s", err)
+	}
+	old, err := product.Create(ctx, db, product.NewProduct{Name: "Old Book", Author: "Ben", Genre: "funny", Stock: 2}, time.Now().Add(-48*time.Hour))
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	for i, rating := range []int{5, 5, 2} {
+		nr := product.NewReview{Rating: rating}
+		if _, err := product.AddReview(ctx, db, old.ID, strconv.Itoa(i), nr, time.Now()); err != nil {
+			t.Fatalf("reviewing product: %s", err)
+		}
+	}
+
+	// One of the two loans is overdue.
+	policy := tests.LoanPolicy()
+	if _, err := product.Checkout(ctx, db, old.ID, "alice", policy, time.Now().Add(-policy.Period-time.Hour)); err != nil {
+		t.Fatalf("checking out: %s", err)
+	}
+	if _, err := product.Checkout(ctx, db, old.ID, "bob", policy, time.Now()); err != nil {
+		t.Fatalf("checking out: %s", err)
+	}
+	if _, err := product.SweepLoans(ctx, db, policy, time.Now()); err != nil {
+		t.Fatalf("sweeping loans: %s", err)
+	}
+
+	// Copies on loan count after their book went to the trash.
+	lost, err := product.Create(ctx, db, product.NewProduct{Name: "Lost Book", Genre: "lost", Stock: 1}, time.Now())
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	if _, err := product.Checkout(ctx, db, lost.ID, "carol", policy, time.Now()); err != nil {
+		t.Fatalf("checking out: %s", err)
+	}
+	if err := product.Delete(ctx, db, lost.ID, product.AnyRevision, time.Now()); err != nil {
+		t.Fatalf("deleting product: %s", err)
+	}
+
+	gather := func(bc *product.BookCollector) map[string]float64 {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(bc)
+
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("gathering metrics: %s", err)
+		}
+
+		got := make(map[string]float64)
+		for _, mf := range mfs {
+			for _, m := range mf.GetMetric() {
+				name := mf.GetName()
+				for _, l := range m.GetLabel() {
+					name += "/" + l.GetValue()
+				}
+				got[name] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+			}
+		}
+		return got
+	}
+
+	exp := map[string]float64{
+		"Bookstore_bookcount":              3,
+		"Bookstore_genrecount":             2,
+		"Bookstore_bookinfo/fiction":       1,
+		"Bookstore_bookinfo/funny":         2,
+		"bookstore_author_books/Ben":       1,
+		"bookstore_author_books/Mike":      2,
+		"bookstore_books_created_24h":      2,
+		"bookstore_review_ratings/1":       0,
+		"bookstore_review_ratings/2":       1,
+		"bookstore_review_ratings/3":       0,
+		"bookstore_review_ratings/4":       0,
+		"bookstore_review_ratings/5":       2,
+		"bookstore_loans_active":           3,
+		"bookstore_loans_overdue":          1,
+		"bookstore_collector_up":           1,
+		"bookstore_collector_errors_total": 0,
+	}
+	bc := product.NewBookCollector(db, time.Minute, time.Second, logger, nil)
+	if diff := cmp.Diff(exp, gather(bc)); diff != "" {
+		t.Fatalf("metrics differ:\n%s", diff)
+	}
+
+	// Books created within the TTL are not counted until the cache expires.
+	if _, err := product.Create(ctx, db, product.NewProduct{Name: "New Book"}, time.Now()); err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	if exp, got := 3.0, gather(bc)["Bookstore_bookcount"]; exp != got {
+		t.Fatalf("expected cached book count %v, got %v", exp, got)
+	}
+
+	fs := &failingStore{Store: db}
+	bc = product.NewBookCollector(fs, time.Minute, time.Second, logger, nil)
+	exp = map[string]float64{
+		"bookstore_collector_up":           0,
+		"bookstore_collector_errors_total": 1,
+	}
+	for i := 0; i < 2; i++ {
+		if diff := cmp.Diff(exp, gather(bc)); diff != "" {
+			t.Fatalf("metrics of a failed collection differ:\n%s", diff)
+		}
+	}
+	if exp, got := 1, fs.calls; exp != got {
+		t.Fatalf("expected the failure to be cached after %d query, got %d", exp, got)
+	}
+}
+
+// TestMetrics tests the HTTP metrics are labelled with the route pattern and
+// the status code sent.
+func TestMetrics(t *testing.T) {
+	h := product.WrapMiddleware([]product.Middleware{product.Metrics()}, func(w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusNotFound)
+		_, err := io.WriteString(w, "missing")
+		return err
+	})
+
+	mux := chi.NewRouter()
+	mux.Get("/metrics-test/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if err := h(w, r); err != nil {
+			t.Errorf("handling request: %s", err)
+		}
+	})
+
+	for i := 0; i < 2; i++ {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics-test/"+strconv.Itoa(i), nil))
+	}
+
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %s", err)
+	}
+
+	got := make(map[string]float64)
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["route"] != "/metrics-test/{id}" {
+				continue
+			}
+			got[mf.GetName()+"/"+labels["code"]] = m.GetCounter().GetValue() + m.GetGauge().GetValue() + m.GetHistogram().GetSampleSum()
+		}
+	}
+
+	exp := map[string]float64{
+		"bookstore_http_requests_total/404":      2,
+		"bookstore_http_requests_in_flight/":     0,
+		"bookstore_http_request_size_bytes/404":  0,
+		"bookstore_http_response_size_bytes/404": 2 * float64(len("missing")),
+	}
+	delete(got, "bookstore_http_request_duration_seconds/404")
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Fatalf("metrics differ:\n%s", diff)
+	}
+}
+
+// testReservations tests holding stock with reservations, committing,
+// cancelling and expiring them, and that concurrent reservations never take
+// the stock below zero.
+func testReservations(t *testing.T, db product.Store) {
+	t.Helper()
+
+	ctx := context.Background()
+	now := time.Now()
+
+	np := product.NewProduct{Name: "Funny Book", Price: 1299, Currency: "usd", Stock: 10}
+	p, err := product.Create(ctx, db, np, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	if exp, got := "USD", p.Currency; exp != got {
+		t.Fatalf("expected currency %q, got %q", exp, got)
+	}
+
+	// Twenty buyers race for the ten copies, one copy each.
+	var wg sync.WaitGroup
+	results := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := product.Reserve(ctx, db, p.ID, product.NewReservation{Quantity: 1}, now)
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	var reserved, refused int
+	for err := range results {
+		switch err {
+		case nil:
+			reserved++
+		case product.ErrInsufficientStock:
+			refused++
+		default:
+			t.Fatalf("reserving a copy: %s", err)
+		}
+	}
+	if reserved != 10 || refused != 10 {
+		t.Fatalf("expected 10 reserved and 10 refused copies, got %d and %d", reserved, refused)
+	}
+
+	stock := func(expStock, expReserved int) {
+		t.Helper()
+		got, err := product.Retrieve(ctx, db, p.ID)
+		if err != nil {
+			t.Fatalf("getting product: %s", err)
+		}
+		if got.Stock != expStock || got.Reserved != expReserved {
+			t.Fatalf("expected stock %d and reserved %d, got %d and %d", expStock, expReserved, got.Stock, got.Reserved)
+		}
+	}
+	stock(0, 10)
+
+	// Restock to test closing reservations of more than one copy.
+	five := 5
+	if _, err := product.Update(ctx, db, p.ID, product.AnyRevision, product.UpdateProduct{Stock: &five}, now); err != nil {
+		t.Fatalf("restocking product: %s", err)
+	}
+
+	committed, err := product.Reserve(ctx, db, p.ID, product.NewReservation{Quantity: 2}, now)
+	if err != nil {
+		t.Fatalf("reserving copies: %s", err)
+	}
+	cancelled, err := product.Reserve(ctx, db, p.ID, product.NewReservation{Quantity: 2}, now)
+	if err != nil {
+		t.Fatalf("reserving copies: %s", err)
+	}
+	expired, err := product.Reserve(ctx, db, p.ID, product.NewReservation{Quantity: 1, TTLSeconds: 60}, now)
+	if err != nil {
+		t.Fatalf("reserving copies: %s", err)
+	}
+	stock(0, 15)
+
+	if _, err := product.CommitReservation(ctx, db, committed.ID, now); err != nil {
+		t.Fatalf("committing reservation: %s", err)
+	}
+	if _, err := product.CancelReservation(ctx, db, committed.ID, now); err != product.ErrReservationClosed {
+		t.Fatalf("expected %v cancelling a committed reservation, got %v", product.ErrReservationClosed, err)
+	}
+	stock(0, 13)
+
+	got, err := product.CancelReservation(ctx, db, cancelled.ID, now)
+	if err != nil {
+		t.Fatalf("cancelling reservation: %s", err)
+	}
+	if exp := product.ReservationCancelled; got.Status != exp || got.DateClosed == nil {
+		t.Fatalf("expected a closed %s reservation, got %+v", exp, got)
+	}
+	stock(2, 11)
+
+	later := now.Add(2 * time.Minute)
+	if _, err := product.CommitReservation(ctx, db, expired.ID, later); err != product.ErrReservationExpired {
+		t.Fatalf("expected %v committing an expired reservation, got %v", product.ErrReservationExpired, err)
+	}
+
+	// Only the one minute reservation has expired two minutes later.
+	n, err := product.SweepReservations(ctx, db, later)
+	if err != nil {
+		t.Fatalf("sweeping reservations: %s", err)
+	}
+	if exp := 1; n != exp {
+		t.Fatalf("expected %d expired reservations, got %d", exp, n)
+	}
+	stock(3, 10)
+
+	got, err = product.RetrieveReservation(ctx, db, expired.ID)
+	if err != nil {
+		t.Fatalf("getting reservation: %s", err)
+	}
+	if exp := product.ReservationExpired; got.Status != exp {
+		t.Fatalf("expected reservation status %q, got %q", exp, got.Status)
+	}
+
+	if _, err := product.Reserve(ctx, db, p.ID, product.NewReservation{Quantity: 4}, now); err != product.ErrInsufficientStock {
+		t.Fatalf("expected %v reserving more than the stock, got %v", product.ErrInsufficientStock, err)
+	}
+	if _, err := product.Reserve(ctx, db, p.ID, product.NewReservation{Quantity: 0}, now); err != product.ErrInvalidQuantity {
+		t.Fatalf("expected %v reserving no copy, got %v", product.ErrInvalidQuantity, err)
+	}
+	if _, err := product.Reserve(ctx, db, p.ID, product.NewReservation{Quantity: 1, TTLSeconds: -1}, now); err != product.ErrInvalidTTL {
+		t.Fatalf("expected %v reserving for a negative TTL, got %v", product.ErrInvalidTTL, err)
+	}
+	stock(3, 10)
+}
+
+// testReviews tests reviewing products, paging through and deleting reviews,
+// and that concurrent reviews all count in the rating.
+func testReviews(t *testing.T, db product.Store) {
+	t.Helper()
+
+	ctx := context.Background()
+	now := time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC)
+
+	p, err := product.Create(ctx, db, product.NewProduct{Name: "Funny Book"}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+
+	// Twenty reviewers rate the book at once, half with 5 and half with 2.
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			nr := product.NewReview{Rating: 2 + 3*(i%2), Text: "review " + strconv.Itoa(i)}
+			_, err := product.AddReview(ctx, db, p.ID, strconv.Itoa(i), nr, now.Add(time.Duration(i)*time.Second))
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("reviewing product: %s", err)
+		}
+	}
+
+	rating := func(expRating float64, expCount int) {
+		t.Helper()
+		got, err := product.Retrieve(ctx, db, p.ID)
+		if err != nil {
+			t.Fatalf("getting product: %s", err)
+		}
+		if got.Rating != expRating || got.ReviewCount != expCount {
+			t.Fatalf("expected rating %v of %d reviews, got %v of %d", expRating, expCount, got.Rating, got.ReviewCount)
+		}
+		if got.Revision != p.Revision {
+			t.Fatalf("expected reviews to keep revision %d, got %d", p.Revision, got.Revision)
+		}
+	}
+	rating(3.5, 20)
+
+	if _, err := product.AddReview(ctx, db, p.ID, "3", product.NewReview{Rating: 1}, now); err != product.ErrDuplicateReview {
+		t.Fatalf("expected %v reviewing twice, got %v", product.ErrDuplicateReview, err)
+	}
+	if _, err := product.AddReview(ctx, db, p.ID, "x", product.NewReview{Rating: 6}, now); err != product.ErrInvalidRating {
+		t.Fatalf("expected %v for a rating of 6, got %v", product.ErrInvalidRating, err)
+	}
+	rating(3.5, 20)
+
+	// Page through the reviews, newest first.
+	var seen []string
+	var cursor string
+	for {
+		page, next, err := product.ListReviews(ctx, db, p.ID, product.ReviewQuery{Limit: 7, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("listing reviews: %s", err)
+		}
+		for _, r := range page {
+			seen = append(seen, r.Reviewer)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if exp, got := 20, len(seen); exp != got {
+		t.Fatalf("expected %d reviews, got %d", exp, got)
+	}
+	if seen[0] != "19" || seen[19] != "0" {
+		t.Fatalf("expected reviews newest first, got %v", seen)
+	}
+
+	page, _, err := product.ListReviews(ctx, db, p.ID, product.ReviewQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("listing reviews: %s", err)
+	}
+	newest := page[0]
+
+	if err := product.DeleteReview(ctx, db, newest.ID, "0"); err != product.ErrNotReviewer {
+		t.Fatalf("expected %v deleting the review of another reviewer, got %v", product.ErrNotReviewer, err)
+	}
+	if err := product.DeleteReview(ctx, db, newest.ID, newest.Reviewer); err != nil {
+		t.Fatalf("deleting review: %s", err)
+	}
+	if err := product.DeleteReview(ctx, db, newest.ID, newest.Reviewer); err != product.ErrReviewNotFound {
+		t.Fatalf("expected %v deleting a deleted review, got %v", product.ErrReviewNotFound, err)
+	}
+	rating(65.0/19, 19)
+
+	page, _, err = product.ListReviews(ctx, db, p.ID, product.ReviewQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("listing reviews: %s", err)
+	}
+
+	// Reviews go with their purged product.
+	if err := product.Delete(ctx, db, p.ID, product.AnyRevision, now); err != nil {
+		t.Fatalf("deleting product: %s", err)
+	}
+	if _, err := product.Purge(ctx, db, now.Add(time.Minute)); err != nil {
+		t.Fatalf("purging trash: %s", err)
+	}
+	if _, err := product.RetrieveReview(ctx, db, page[0].ID); err != product.ErrReviewNotFound {
+		t.Fatalf("expected %v getting a review of a purged product, got %v", product.ErrReviewNotFound, err)
+	}
+}
+
+func testHistory(t *testing.T, db product.Store) {
+	t.Helper()
+
+	ctx := product.WithActor(context.Background(), "alice")
+	now := time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC)
+
+	p, err := product.Create(ctx, db, product.NewProduct{Name: "Funny Book", Genre: "funny", Stock: 3}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+
+	name := "Funnier Book"
+	price := int64(1500)
+	currency := "usd"
+	update := product.UpdateProduct{Name: &name, Price: &price, Currency: &currency}
+	if _, err := product.Update(product.WithActor(ctx, "bob"), db, p.ID, product.AnyRevision, update, now.Add(time.Hour)); err != nil {
+		t.Fatalf("updating product: %s", err)
+	}
+	if err := product.Delete(ctx, db, p.ID, product.AnyRevision, now.Add(2*time.Hour)); err != nil {
+		t.Fatalf("deleting product: %s", err)
+	}
+
+	// The history of a product in the trash is still there.
+	entries, _, err := product.ListHistory(ctx, db, p.ID, product.HistoryQuery{})
+	if err != nil {
+		t.Fatalf("listing history: %s", err)
+	}
+	type entry struct {
+		Revision int
+		Action   string
+		Actor    string
+		Changes  map[string]string
+	}
+	var got []entry
+	for _, e := range entries {
+		changes := make(map[string]string)
+		for _, c := range e.Changes {
+			changes[c.Field] = string(c.Old) + " -> " + string(c.New)
+		}
+		got = append(got, entry{e.Revision, e.Action, e.Actor, changes})
+	}
+	exp := []entry{
+		{3, product.EventDeleted, "alice", map[string]string{"date_deleted": `null -> "2021-01-04T02:00:00Z"`}},
+		{2, product.EventUpdated, "bob", map[string]string{"name": `"Funny Book" -> "Funnier Book"`, "price": `0 -> 1500`, "currency": `"" -> "USD"`}},
+		{1, product.EventCreated, "alice", map[string]string{"name": ` -> "Funny Book"`, "genre": ` -> "funny"`, "stock": ` -> 3`}},
+	}
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Fatalf("history mismatch:\n%s", diff)
+	}
+
+	if _, err := product.Revert(ctx, db, p.ID, 1, product.AnyRevision, now); err != product.ErrNotFound {
+		t.Fatalf("expected %v reverting a product in the trash, got %v", product.ErrNotFound, err)
+	}
+	restored, err := product.Restore(ctx, db, p.ID, product.AnyRevision)
+	if err != nil {
+		t.Fatalf("restoring product: %s", err)
+	}
+
+	// Reverting to the first revision takes back the update, but not the
+	// stock changed since.
+	stock := 7
+	if _, err := product.Update(ctx, db, p.ID, product.AnyRevision, product.UpdateProduct{Stock: &stock}, now); err != nil {
+		t.Fatalf("updating stock: %s", err)
+	}
+	if _, err := product.Revert(ctx, db, p.ID, 1, restored.Revision, now); err != product.ErrRevisionMismatch {
+		t.Fatalf("expected %v reverting from a stale revision, got %v", product.ErrRevisionMismatch, err)
+	}
+	if _, err := product.Revert(ctx, db, p.ID, 42, product.AnyRevision, now); err != product.ErrHistoryNotFound {
+		t.Fatalf("expected %v reverting to an unknown revision, got %v", product.ErrHistoryNotFound, err)
+	}
+	reverted, err := product.Revert(ctx, db, p.ID, 1, product.AnyRevision, now)
+	if err != nil {
+		t.Fatalf("reverting product: %s", err)
+	}
+	if reverted.Name != "Funny Book" || reverted.Price != 0 || reverted.Currency != "" || reverted.Stock != 7 {
+		t.Fatalf("expected the first revision with the current stock, got %+v", reverted)
+	}
+
+	// Page through the history, newest first.
+	var revisions []int
+	var cursor string
+	for {
+		page, next, err := product.ListHistory(ctx, db, p.ID, product.HistoryQuery{Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("listing history: %s", err)
+		}
+		for _, e := range page {
+			revisions = append(revisions, e.Revision)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if diff := cmp.Diff([]int{6, 5, 4, 3, 2, 1}, revisions); diff != "" {
+		t.Fatalf("history revisions mismatch:\n%s", diff)
+	}
+
+	last, _, err := product.ListHistory(ctx, db, p.ID, product.HistoryQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("listing history: %s", err)
+	}
+	if last[0].Action != product.ActionReverted || last[0].Reverted != 1 {
+		t.Fatalf("expected a revert to revision 1, got %+v", last[0])
+	}
+
+	if _, _, err := product.ListHistory(ctx, db, "0b0e4f5a-6b5e-4e57-9b5c-2c7b0ec1e0a1", product.HistoryQuery{}); err != product.ErrNotFound {
+		t.Fatalf("expected %v listing the history of an unknown product, got %v", product.ErrNotFound, err)
+	}
+	if _, _, err := product.ListHistory(ctx, db, p.ID, product.HistoryQuery{Cursor: "bogus"}); err != product.ErrInvalidCursor {
+		t.Fatalf("expected %v for a bogus cursor, got %v", product.ErrInvalidCursor, err)
+	}
+}
+
+// testDuplicateISBN checks that live books never share an ISBN and that the
+// duplicates stored before are reported.
+func testDuplicateISBN(t *testing.T, db product.Store) {
+	t.Helper()
+
+	ctx := context.Background()
+	now := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	duplicate := func(err error, id string) {
+		t.Helper()
+		var dup *product.DuplicateISBNError
+		if !errors.As(err, &dup) || dup.ISBN != "9781402894626" || dup.ID != id {
+			t.Fatalf("expected the ISBN to be taken by %s, got %v", id, err)
+		}
+	}
+
+	first, err := product.Create(ctx, db, product.NewProduct{Name: "First", ISBN: "1-4028-9462-7"}, now)
+	if err != nil {
+		t.Fatalf("creating first: %s", err)
+	}
+
+	_, err = product.Create(ctx, db, product.NewProduct{Name: "Second", ISBN: "978-1-4028-9462-6"}, now)
+	duplicate(err, first.ID)
+
+	second, err := product.Create(ctx, db, product.NewProduct{Name: "Second"}, now)
+	if err != nil {
+		t.Fatalf("creating second: %s", err)
+	}
+	isbn := "9781402894626"
+	_, err = product.Update(ctx, db, second.ID, product.AnyRevision, product.UpdateProduct{ISBN: &isbn}, now)
+	duplicate(err, first.ID)
+
+	nps := []product.NewProduct{{Name: "Third", ISBN: "9781402894626"}, {Name: "Fourth"}}
+	created, err := product.CreateMany(ctx, db, nps, now)
+	berr, ok := err.(*product.BatchError)
+	if !ok || len(berr.Failed) != 1 || len(created) != 1 {
+		t.Fatalf("expected only the third to fail, got %v", err)
+	}
+	duplicate(berr.Failed[0], first.ID)
+
+	// The trash does not hold on to ISBNs, restoring a book does.
+	if err := product.Delete(ctx, db, first.ID, product.AnyRevision, now); err != nil {
+		t.Fatalf("deleting first: %s", err)
+	}
+	if _, err := product.Update(ctx, db, second.ID, product.AnyRevision, product.UpdateProduct{ISBN: &isbn}, now); err != nil {
+		t.Fatalf("taking the ISBN of a deleted book: %s", err)
+	}
+	_, err = product.Restore(ctx, db, first.ID, product.AnyRevision)
+	duplicate(err, second.ID)
+
+	// ISBNs stored before they were normalized escape the check, but not
+	// the report.
+	legacy := product.Product{ID: "0b0e4f5a-6b5e-4e57-9b5c-2c7b0ec1e0a1", Name: "Legacy", ISBN: "1402894627", DateCreated: now.Add(-time.Hour)}
+	if err := db.Insert(ctx, legacy); err != nil {
+		t.Fatalf("inserting legacy book: %s", err)
+	}
+
+	dups, err := product.Duplicates(ctx, db)
+	if err != nil {
+		t.Fatalf("listing duplicates: %s", err)
+	}
+	if len(dups) != 1 || dups[0].ISBN != isbn || len(dups[0].Products) != 2 ||
+		dups[0].Products[0].ID != legacy.ID || dups[0].Products[1].ID != second.ID {
+		t.Fatalf("expected the legacy and second books as duplicates, got %+v", dups)
+	}
+}
+
+// testLoans tests lending copies, the queue of holds, renewals and the
+// sweeper marking loans overdue and expiring holds, and that concurrent
+// checkouts never lend more copies than there are.
+func testLoans(t *testing.T, db product.Store) {
+	t.Helper()
+
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	policy := product.LoanPolicy{Period: time.Hour, MaxRenewals: 1, Pickup: 30 * time.Minute}
+
+	p, err := product.Create(ctx, db, product.NewProduct{Name: "Library Book", Stock: 2}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+
+	copies := func(expStock, expOnLoan, expHeld, expOverdue int) {
+		t.Helper()
+		got, err := product.Retrieve(ctx, db, p.ID)
+		if err != nil {
+			t.Fatalf("getting product: %s", err)
+		}
+		if got.Stock != expStock || got.OnLoan != expOnLoan || got.Held != expHeld || got.Overdue != expOverdue {
+			t.Fatalf("expected stock %d, on loan %d, held %d and overdue %d, got %d, %d, %d and %d",
+				expStock, expOnLoan, expHeld, expOverdue, got.Stock, got.OnLoan, got.Held, got.Overdue)
+		}
+	}
+
+	// Six members race for the two copies.
+	var wg sync.WaitGroup
+	type result struct {
+		loan *product.Loan
+		err  error
+	}
+	results := make(chan result, 6)
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(member string) {
+			defer wg.Done()
+			l, err := product.Checkout(ctx, db, p.ID, member, policy, now)
+			results <- result{l, err}
+		}("member" + strconv.Itoa(i))
+	}
+	wg.Wait()
+	close(results)
+
+	var borrowers []string
+	for r := range results {
+		switch r.err {
+		case nil:
+			borrowers = append(borrowers, r.loan.Member)
+		case product.ErrInsufficientStock:
+		default:
+			t.Fatalf("checking out a copy: %s", r.err)
+		}
+	}
+	if len(borrowers) != 2 {
+		t.Fatalf("expected 2 loans, got %d", len(borrowers))
+	}
+	copies(0, 2, 0, 0)
+	first, second := borrowers[0], borrowers[1]
+
+	if _, err := product.Checkout(ctx, db, p.ID, first, policy, now); err != product.ErrAlreadyBorrowed {
+		t.Fatalf("expected %v checking out twice, got %v", product.ErrAlreadyBorrowed, err)
+	}
+
+	// Alice and Bob queue up, in that order.
+	alice, err := product.PlaceHold(ctx, db, p.ID, "alice", policy, now)
+	if err != nil {
+		t.Fatalf("placing hold: %s", err)
+	}
+	bob, err := product.PlaceHold(ctx, db, p.ID, "bob", policy, now.Add(time.Second))
+	if err != nil {
+		t.Fatalf("placing hold: %s", err)
+	}
+	if alice.Status != product.HoldWaiting || bob.Status != product.HoldWaiting {
+		t.Fatalf("expected waiting holds, got %q and %q", alice.Status, bob.Status)
+	}
+	if _, err := product.PlaceHold(ctx, db, p.ID, "alice", policy, now); err != product.ErrDuplicateHold {
+		t.Fatalf("expected %v holding twice, got %v", product.ErrDuplicateHold, err)
+	}
+	if _, err := product.PlaceHold(ctx, db, p.ID, first, policy, now); err != product.ErrAlreadyBorrowed {
+		t.Fatalf("expected %v holding a borrowed book, got %v", product.ErrAlreadyBorrowed, err)
+	}
+	if _, err := product.Renew(ctx, db, p.ID, first, policy, now); err != product.ErrHoldsWaiting {
+		t.Fatalf("expected %v renewing a book others wait for, got %v", product.ErrHoldsWaiting, err)
+	}
+
+	// The returned copy is kept for Alice, Bob has to wait for the next.
+	if _, err := product.Return(ctx, db, p.ID, first, policy, now); err != nil {
+		t.Fatalf("returning: %s", err)
+	}
+	copies(0, 1, 1, 0)
+	if _, err := product.Return(ctx, db, p.ID, first, policy, now); err != product.ErrLoanNotFound {
+		t.Fatalf("expected %v returning twice, got %v", product.ErrLoanNotFound, err)
+	}
+
+	holds, err := product.ListHolds(ctx, db, p.ID)
+	if err != nil {
+		t.Fatalf("listing holds: %s", err)
+	}
+	if len(holds) != 2 || holds[0].ID != alice.ID || holds[0].Status != product.HoldReady || holds[1].Status != product.HoldWaiting {
+		t.Fatalf("expected Alice's hold ready before Bob's, got %+v", holds)
+	}
+
+	if _, err := product.Checkout(ctx, db, p.ID, "bob", policy, now); err != product.ErrHoldsWaiting {
+		t.Fatalf("expected %v checking out ahead of the queue, got %v", product.ErrHoldsWaiting, err)
+	}
+	if _, err := product.Checkout(ctx, db, p.ID, "alice", policy, now); err != nil {
+		t.Fatalf("checking out a held copy: %s", err)
+	}
+	copies(0, 2, 0, 0)
+
+	got, err := product.RetrieveHold(ctx, db, alice.ID)
+	if err != nil {
+		t.Fatalf("getting hold: %s", err)
+	}
+	if got.Status != product.HoldFulfilled {
+		t.Fatalf("expected hold status %q, got %q", product.HoldFulfilled, got.Status)
+	}
+
+	if _, err := product.CancelHold(ctx, db, bob.ID, "alice", policy, now); err != product.ErrNotHolder {
+		t.Fatalf("expected %v cancelling another member's hold, got %v", product.ErrNotHolder, err)
+	}
+	if _, err := product.CancelHold(ctx, db, bob.ID, "bob", policy, now); err != nil {
+		t.Fatalf("cancelling hold: %s", err)
+	}
+	if _, err := product.CancelHold(ctx, db, bob.ID, "bob", policy, now); err != product.ErrHoldClosed {
+		t.Fatalf("expected %v cancelling twice, got %v", product.ErrHoldClosed, err)
+	}
+
+	renewed, err := product.Renew(ctx, db, p.ID, second, policy, now)
+	if err != nil {
+		t.Fatalf("renewing: %s", err)
+	}
+	if exp := now.Add(2 * policy.Period); renewed.Renewals != 1 || !renewed.DateDue.Equal(exp) {
+		t.Fatalf("expected one renewal due at %v, got %+v", exp, renewed)
+	}
+	if _, err := product.Renew(ctx, db, p.ID, second, policy, now); err != product.ErrRenewalLimit {
+		t.Fatalf("expected %v renewing again, got %v", product.ErrRenewalLimit, err)
+	}
+
+	// Only Alice's loan is overdue after an hour and a half.
+	sw, err := product.SweepLoans(ctx, db, policy, now.Add(90*time.Minute))
+	if err != nil {
+		t.Fatalf("sweeping loans: %s", err)
+	}
+	if exp := (product.LoanSweep{Overdue: 1}); sw != exp {
+		t.Fatalf("expected sweep %+v, got %+v", exp, sw)
+	}
+	copies(0, 2, 0, 1)
+	if _, err := product.Renew(ctx, db, p.ID, "alice", policy, now); err != product.ErrLoanOverdue {
+		t.Fatalf("expected %v renewing an overdue loan, got %v", product.ErrLoanOverdue, err)
+	}
+
+	loans, _, err := product.ListLoans(ctx, db, "alice", product.LoanQuery{})
+	if err != nil {
+		t.Fatalf("listing loans: %s", err)
+	}
+	if len(loans) != 1 || !loans[0].Overdue {
+		t.Fatalf("expected Alice's overdue loan, got %+v", loans)
+	}
+
+	if _, err := product.Return(ctx, db, p.ID, "alice", policy, now.Add(2*time.Hour)); err != nil {
+		t.Fatalf("returning: %s", err)
+	}
+	copies(1, 1, 0, 0)
+
+	// Carol's hold is ready right away, but she never picks the copy up.
+	carol, err := product.PlaceHold(ctx, db, p.ID, "carol", policy, now.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("placing hold: %s", err)
+	}
+	if carol.Status != product.HoldReady {
+		t.Fatalf("expected a ready hold, got %q", carol.Status)
+	}
+	copies(0, 1, 1, 0)
+
+	sw, err = product.SweepLoans(ctx, db, policy, now.Add(3*time.Hour))
+	if err != nil {
+		t.Fatalf("sweeping loans: %s", err)
+	}
+	if exp := (product.LoanSweep{Overdue: 1, Expired: 1}); sw != exp {
+		t.Fatalf("expected sweep %+v, got %+v", exp, sw)
+	}
+	copies(1, 1, 0, 1)
+
+	// Alice borrows the book again and pages through her loans.
+	if _, err := product.Checkout(ctx, db, p.ID, "alice", policy, now.Add(3*time.Hour)); err != nil {
+		t.Fatalf("checking out: %s", err)
+	}
+	loans, next, err := product.ListLoans(ctx, db, "alice", product.LoanQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("listing loans: %s", err)
+	}
+	if len(loans) != 1 || loans[0].Status != product.LoanActive || next == "" {
+		t.Fatalf("expected the active loan and a cursor, got %+v and %q", loans, next)
+	}
+	loans, next, err = product.ListLoans(ctx, db, "alice", product.LoanQuery{Limit: 1, Cursor: next})
+	if err != nil {
+		t.Fatalf("listing loans: %s", err)
+	}
+	if len(loans) != 1 || loans[0].Status != product.LoanReturned || next != "" {
+		t.Fatalf("expected the returned loan on the last page, got %+v and %q", loans, next)
+	}
+	loans, _, err = product.ListLoans(ctx, db, "alice", product.LoanQuery{Active: true})
+	if err != nil {
+		t.Fatalf("listing loans: %s", err)
+	}
+	if len(loans) != 1 || loans[0].Status != product.LoanActive {
+		t.Fatalf("expected only the active loan, got %+v", loans)
+	}
+}
+
+// TestOverdueEvent tests that the sweeper finding a loan overdue publishes an
+// event of its Product.
+func TestOverdueEvent(t *testing.T) {
+	b := product.NewBroadcaster(8, 8)
+	db := product.WithEvents(product.NewMemoryStore(), b)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	now := time.Now()
+
+	p, err := product.Create(ctx, db, product.NewProduct{Name: "Library Book", Stock: 1}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	if _, err := product.Checkout(ctx, db, p.ID, "alice", tests.LoanPolicy(), now); err != nil {
+		t.Fatalf("checking out: %s", err)
+	}
+
+	events, err := b.Subscribe(ctx, "")
+	if err != nil {
+		t.Fatalf("subscribing: %s", err)
+	}
+	if _, err := product.SweepLoans(ctx, db, tests.LoanPolicy(), now.Add(tests.LoanPolicy().Period)); err != nil {
+		t.Fatalf("sweeping loans: %s", err)
+	}
+
+	ev := <-events
+	if ev.Type != product.EventOverdue || ev.ProductID != p.ID || ev.Product == nil || ev.Product.Overdue != 1 {
+		t.Fatalf("expected an overdue event of %s, got %+v", p.ID, ev)
+	}
 }
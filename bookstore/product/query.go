@@ -0,0 +1,236 @@
+package product
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalidSort is used when a List is sorted by an unknown field.
+	ErrInvalidSort = errors.New("sort field is not supported")
+
+	// ErrInvalidCursor is used when a List cursor cannot be decoded or was
+	// issued for a different sort order.
+	ErrInvalidCursor = errors.New("cursor is not valid for this query")
+)
+
+// DefaultSort is the field List sorts by when none is given.
+const DefaultSort = "date_created"
+
+// sortFields maps the JSON names clients sort by to the stored field names.
+var sortFields = map[string]string{
+	"name":         "name",
+	"author":       "author",
+	"isbn":         "isbn",
+	"genre":        "genre",
+	"date_created": "datecreated",
+	"date_updated": "dateupdated",
+}
+
+// Query describes which Products List returns and in which order. Empty
+// filter fields match every Product.
+type Query struct {
+	Author   string
+	AuthorID string
+	Genre    string
+
+	// ISBN may be given as ISBN-10 or ISBN-13, it matches the stored ISBN-13.
+	ISBN string
+
+	// Deleted selects the Products in the trash instead of the live ones.
+	Deleted bool
+
+	// Sort is the JSON name of the field to order by and Desc reverses the
+	// order. Products with equal sort values are ordered by ID.
+	Sort string
+	Desc bool
+
+	// Limit caps the number of Products returned, zero means no limit.
+	Limit int
+
+	// Cursor is the opaque value returned by a previous List call. When set
+	// only Products after that position are returned.
+	Cursor string
+
+	// after is the decoded Cursor, populated by prepare.
+	after *cursor
+}
+
+// cursor is the position of the last Product of a page. It records the sort
+// order it was issued for so it cannot be replayed against another one.
+type cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// prepare validates the query, normalizes its ISBN filter and decodes its
+// cursor.
+func (q *Query) prepare() error {
+	if q.ISBN != "" {
+		isbn, err := NormalizeISBN(q.ISBN)
+		if err != nil {
+			return err
+		}
+		q.ISBN = isbn
+	}
+
+	if q.Sort == "" {
+		q.Sort = DefaultSort
+	}
+	if _, ok := sortFields[q.Sort]; !ok {
+		return ErrInvalidSort
+	}
+
+	q.after = nil
+	if q.Cursor == "" {
+		return nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return ErrInvalidCursor
+	}
+	if c.Sort != q.Sort || c.Desc != q.Desc || c.ID == "" {
+		return ErrInvalidCursor
+	}
+	if isTimeField(c.Sort) {
+		if _, err := time.Parse(time.RFC3339Nano, c.Value); err != nil {
+			return ErrInvalidCursor
+		}
+	}
+
+	q.after = &c
+	return nil
+}
+
+// cursorAfter returns the cursor pointing just past p.
+func (q *Query) cursorAfter(p Product) string {
+	c := cursor{
+		Sort:  q.Sort,
+		Desc:  q.Desc,
+		Value: fieldValue(p, q.Sort),
+		ID:    p.ID,
+	}
+
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// matches reports whether p passes the query filters.
+func (q *Query) matches(p Product) bool {
+	switch {
+	case q.Author != "" && p.Author != q.Author:
+		return false
+	case q.AuthorID != "" && p.AuthorID != q.AuthorID:
+		return false
+	case q.Genre != "" && p.Genre != q.Genre:
+		return false
+	case q.ISBN != "" && p.ISBN != q.ISBN:
+		return false
+	case q.Deleted != (p.DateDeleted != nil):
+		return false
+	}
+	return true
+}
+
+// afterValue returns the cursor value typed the way it is stored.
+func (c *cursor) afterValue() interface{} {
+	if isTimeField(c.Sort) {
+		t, _ := time.Parse(time.RFC3339Nano, c.Value)
+		return t
+	}
+	return c.Value
+}
+
+func isTimeField(field string) bool {
+	return field == "date_created" || field == "date_updated"
+}
+
+// fieldValue returns the value of the field of p with the given JSON name as a
+// string.
+func fieldValue(p Product, field string) string {
+	switch field {
+	case "name":
+		return p.Name
+	case "author":
+		return p.Author
+	case "isbn":
+		return p.ISBN
+	case "genre":
+		return p.Genre
+	case "date_created":
+		return p.DateCreated.UTC().Format(time.RFC3339Nano)
+	case "date_updated":
+		return p.DateUpdated.UTC().Format(time.RFC3339Nano)
+	}
+	return ""
+}
+
+// compareProducts orders a and b by the named sort field and then by ID. It
+// returns a negative number when a sorts first, zero when equal and a
+// positive number otherwise.
+func compareProducts(a, b Product, field string) int {
+	var c int
+	if isTimeField(field) {
+		c = compareTime(sortTime(a, field), sortTime(b, field))
+	} else {
+		c = compareString(fieldValue(a, field), fieldValue(b, field))
+	}
+	if c != 0 {
+		return c
+	}
+	return compareString(a.ID, b.ID)
+}
+
+// compareCursor orders p against the position recorded in c using the same
+// rules as compareProducts.
+func compareCursor(p Product, c *cursor) int {
+	var v int
+	if isTimeField(c.Sort) {
+		v = compareTime(sortTime(p, c.Sort), c.afterValue().(time.Time))
+	} else {
+		v = compareString(fieldValue(p, c.Sort), c.Value)
+	}
+	if v != 0 {
+		return v
+	}
+	return compareString(p.ID, c.ID)
+}
+
+// sortTime returns the value of the named time sort field of p.
+func sortTime(p Product, field string) time.Time {
+	if field == "date_updated" {
+		return p.DateUpdated
+	}
+	return p.DateCreated
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+func compareString(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
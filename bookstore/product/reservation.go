@@ -0,0 +1,194 @@
+package product
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Statuses of a Reservation. A reservation is pending until it is committed,
+// cancelled or expired, which are final.
+const (
+	ReservationPending   = "pending"
+	ReservationCommitted = "committed"
+	ReservationCancelled = "cancelled"
+	ReservationExpired   = "expired"
+)
+
+// Reservation lifetimes used when the client does not ask for one and the
+// longest a client may ask for.
+const (
+	DefaultReservationTTL = 15 * time.Minute
+	MaxReservationTTL     = 24 * time.Hour
+)
+
+// Predefined errors identify expected failure conditions of reservations.
+var (
+	// ErrReservationNotFound is used when a specific Reservation is
+	// requested but does not exist.
+	ErrReservationNotFound = errors.New("reservation not found")
+
+	// ErrInsufficientStock is used when a Product does not have enough
+	// copies in stock for a reservation.
+	ErrInsufficientStock = errors.New("not enough copies in stock")
+
+	// ErrReservationClosed is used when a Reservation that is no longer
+	// pending is committed or cancelled.
+	ErrReservationClosed = errors.New("reservation is no longer pending")
+
+	// ErrReservationExpired is used when a Reservation is committed after
+	// it expired.
+	ErrReservationExpired = errors.New("reservation has expired")
+
+	// ErrInvalidQuantity is used when a reservation asks for less than one
+	// copy.
+	ErrInvalidQuantity = errors.New("quantity must be at least 1")
+
+	// ErrInvalidTTL is used when a reservation asks to hold copies for a
+	// negative time or for longer than MaxReservationTTL.
+	ErrInvalidTTL = errors.Errorf("ttl must be at most %v", MaxReservationTTL)
+
+	// errReservationLive is used when a Reservation that has not expired
+	// yet is expired.
+	errReservationLive = errors.New("reservation has not expired")
+)
+
+// Reservation holds copies of a Product out of its stock until it is
+// committed, which sells them, or cancelled or expired, which puts them back.
+type Reservation struct {
+	ID          string     `db:"reservation_id" json:"id"`
+	ProductID   string     `db:"product_id" json:"product_id"`
+	Quantity    int        `db:"quantity" json:"quantity"`
+	Status      string     `db:"status" json:"status"`
+	DateCreated time.Time  `db:"datecreated" json:"date_created"`
+	DateExpires time.Time  `db:"dateexpires" json:"date_expires"`
+	DateClosed  *time.Time `db:"dateclosed" json:"date_closed,omitempty"`
+}
+
+// NewReservation is what a client provides to reserve copies of a Product.
+// TTLSeconds is how long the copies are held, DefaultReservationTTL when it
+// is zero.
+type NewReservation struct {
+	Quantity   int `json:"quantity" validate:"required,min=1"`
+	TTLSeconds int `json:"ttl_seconds" validate:"omitempty,min=1,max=86400"`
+}
+
+// Reserve takes copies of the Product with the given ID out of its stock and
+// returns the Reservation holding them. It fails with ErrInsufficientStock
+// when fewer copies are in stock, nothing is reserved then.
+func Reserve(ctx context.Context, db Store, productID string, nr NewReservation, now time.Time) (*Reservation, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	ttl := time.Duration(nr.TTLSeconds) * time.Second
+	switch {
+	case nr.Quantity < 1:
+		return nil, ErrInvalidQuantity
+	case ttl < 0 || ttl > MaxReservationTTL:
+		return nil, ErrInvalidTTL
+	case ttl == 0:
+		ttl = DefaultReservationTTL
+	}
+
+	r := Reservation{
+		ID:          uuid.New().String(),
+		ProductID:   productID,
+		Quantity:    nr.Quantity,
+		Status:      ReservationPending,
+		DateCreated: now.UTC(),
+		DateExpires: now.Add(ttl).UTC(),
+	}
+
+	if err := db.Reserve(ctx, r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// RetrieveReservation gets a single Reservation from the database.
+func RetrieveReservation(ctx context.Context, db Store, id string) (*Reservation, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	return db.RetrieveReservation(ctx, id)
+}
+
+// CommitReservation sells the copies held by a pending Reservation. It fails
+// with ErrReservationExpired once the reservation expired, even if the
+// sweeper did not reclaim it yet.
+func CommitReservation(ctx context.Context, db Store, id string, now time.Time) (*Reservation, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	return db.CloseReservation(ctx, id, ReservationCommitted, now.UTC())
+}
+
+// CancelReservation puts the copies held by a pending Reservation back in
+// stock.
+func CancelReservation(ctx context.Context, db Store, id string, now time.Time) (*Reservation, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	return db.CloseReservation(ctx, id, ReservationCancelled, now.UTC())
+}
+
+// SweepReservations expires the pending Reservations whose time ran out and
+// puts their copies back in stock. It returns how many were expired.
+// Reservations committed or cancelled while the sweep runs are skipped.
+func SweepReservations(ctx context.Context, db Store, now time.Time) (int, error) {
+	now = now.UTC()
+
+	ids, err := db.ExpiredReservations(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, id := range ids {
+		_, err := db.CloseReservation(ctx, id, ReservationExpired, now)
+		switch err {
+		case nil:
+			n++
+		case ErrReservationClosed, ErrReservationNotFound, errReservationLive:
+		default:
+			return n, errors.Wrapf(err, "expiring reservation %q", id)
+		}
+	}
+
+	return n, nil
+}
+
+// checkClose reports why r cannot move to status at now. Only pending
+// reservations can be closed, commits must come before the expiry and
+// expiring must come after.
+func checkClose(r Reservation, status string, now time.Time) error {
+	if r.Status != ReservationPending {
+		return ErrReservationClosed
+	}
+
+	expired := !now.Before(r.DateExpires)
+	switch {
+	case status == ReservationCommitted && expired:
+		return ErrReservationExpired
+	case status == ReservationExpired && !expired:
+		return errReservationLive
+	}
+
+	return nil
+}
+
+// releasedStock is how much a Product's stock grows when a Reservation of
+// quantity copies closes with status. Committed copies are sold.
+func releasedStock(status string, quantity int) int {
+	if status == ReservationCommitted {
+		return 0
+	}
+	return quantity
+}
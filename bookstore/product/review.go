@@ -0,0 +1,209 @@
+package product
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Ratings a Review may give.
+const (
+	MinRating = 1
+	MaxRating = 5
+)
+
+// Predefined errors identify expected failure conditions of reviews.
+var (
+	// ErrReviewNotFound is used when a specific Review is requested but
+	// does not exist.
+	ErrReviewNotFound = errors.New("review not found")
+
+	// ErrInvalidRating is used when a rating is not between MinRating and
+	// MaxRating.
+	ErrInvalidRating = errors.New("rating must be between 1 and 5")
+
+	// ErrDuplicateReview is used when a reviewer reviews the same Product
+	// twice.
+	ErrDuplicateReview = errors.New("product was already reviewed by this reviewer")
+
+	// ErrNotReviewer is used when a Review is deleted by someone other than
+	// its reviewer.
+	ErrNotReviewer = errors.New("review belongs to another reviewer")
+)
+
+// Review is the rating and opinion of a reviewer on a Product. A reviewer
+// reviews a Product at most once.
+type Review struct {
+	ID          string    `db:"review_id" json:"id"`
+	ProductID   string    `db:"product_id" json:"product_id"`
+	Reviewer    string    `db:"reviewer" json:"reviewer"`
+	Rating      int       `db:"rating" json:"rating"`
+	Text        string    `db:"text" json:"text"`
+	DateCreated time.Time `db:"datecreated" json:"date_created"`
+}
+
+// NewReview is what a reviewer provides to review a Product.
+type NewReview struct {
+	Rating int    `json:"rating" validate:"required,min=1,max=5"`
+	Text   string `json:"text" validate:"max=10000"`
+}
+
+// ReviewQuery describes which page of the Reviews of a Product ListReviews
+// returns. Reviews are ordered newest first.
+type ReviewQuery struct {
+
+	// Limit caps the number of Reviews returned, zero means no limit.
+	Limit int
+
+	// Cursor is the opaque value returned by a previous ListReviews call.
+	// When set only Reviews after that position are returned.
+	Cursor string
+
+	// after is the decoded Cursor, populated by prepare.
+	after *reviewCursor
+}
+
+// reviewCursor is the position of the last Review of a page.
+type reviewCursor struct {
+	Time time.Time `json:"t"`
+	ID   string    `json:"id"`
+}
+
+// prepare decodes the cursor of the query.
+func (q *ReviewQuery) prepare() error {
+	q.after = nil
+	if q.Cursor == "" {
+		return nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	var c reviewCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return ErrInvalidCursor
+	}
+
+	q.after = &c
+	return nil
+}
+
+// reviewBefore reports whether a sorts before b, newest first and then by
+// ID.
+func reviewBefore(a, b Review) bool {
+	if !a.DateCreated.Equal(b.DateCreated) {
+		return a.DateCreated.After(b.DateCreated)
+	}
+	return a.ID < b.ID
+}
+
+// AddReview records the Review of a reviewer on the live Product with the
+// given ID and updates the rating of the Product with it.
+func AddReview(ctx context.Context, db Store, productID, reviewer string, nr NewReview, now time.Time) (*Review, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	if nr.Rating < MinRating || nr.Rating > MaxRating {
+		return nil, ErrInvalidRating
+	}
+
+	r := Review{
+		ID:          uuid.New().String(),
+		ProductID:   productID,
+		Reviewer:    reviewer,
+		Rating:      nr.Rating,
+		Text:        nr.Text,
+		DateCreated: now.UTC(),
+	}
+
+	if err := db.AddReview(ctx, r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// ListReviews gets a page of the Reviews of the live Product with the given
+// ID, newest first. When more Reviews are available, the returned cursor can
+// be set on the next query to continue after the last returned Review. It is
+// empty on the last page.
+func ListReviews(ctx context.Context, db Store, productID string, q ReviewQuery) ([]Review, string, error) {
+	if _, err := Retrieve(ctx, db, productID); err != nil {
+		return nil, "", err
+	}
+
+	if err := q.prepare(); err != nil {
+		return nil, "", err
+	}
+
+	// Ask for one extra Review to learn whether there is a next page.
+	limit := q.Limit
+	if limit > 0 {
+		q.Limit = limit + 1
+	}
+
+	reviews, err := db.ListReviews(ctx, productID, q)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if limit > 0 && len(reviews) > limit {
+		reviews = reviews[:limit]
+
+		last := reviews[limit-1]
+		b, _ := json.Marshal(reviewCursor{Time: last.DateCreated, ID: last.ID})
+		next = base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	return reviews, next, nil
+}
+
+// RetrieveReview gets a single Review from the database.
+func RetrieveReview(ctx context.Context, db Store, id string) (*Review, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	return db.RetrieveReview(ctx, id)
+}
+
+// DeleteReview removes the Review with the given ID, which must be one of the
+// reviewer's, and takes it out of the rating of its Product.
+func DeleteReview(ctx context.Context, db Store, id, reviewer string) error {
+	r, err := RetrieveReview(ctx, db, id)
+	if err != nil {
+		return err
+	}
+	if r.Reviewer != reviewer {
+		return ErrNotReviewer
+	}
+
+	return db.DeleteReview(ctx, id, reviewer)
+}
+
+// rate adds delta reviews with the given rating to the rating of p. Ratings
+// is copied rather than changed in place, as copies of p share it.
+func (p *Product) rate(rating, delta int) {
+	ratings := make(map[string]int, len(p.Ratings)+1)
+	for k, n := range p.Ratings {
+		ratings[k] = n
+	}
+	ratings[strconv.Itoa(rating)] += delta
+
+	p.Ratings = ratings
+	p.RatingSum += rating * delta
+	p.ReviewCount += delta
+
+	p.Rating = 0
+	if p.ReviewCount > 0 {
+		p.Rating = float64(p.RatingSum) / float64(p.ReviewCount)
+	}
+}
@@ -0,0 +1,247 @@
+package product
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// ErrEmptySearch is used when a search is made without any text.
+var ErrEmptySearch = errors.New("search text must not be empty")
+
+// searchFieldNames lists the searched fields by JSON name.
+var searchFieldNames = []string{"name", "author", "genre"}
+
+// searchWeights is the relative importance of each searched field. The Mongo
+// text index is created with the same weights.
+var searchWeights = map[string]int{
+	"name":   10,
+	"author": 5,
+	"genre":  1,
+}
+
+// Match is a Product found by Search along with its relevance score. The
+// highlights hold the searched fields that matched, keyed by JSON name, as
+// HTML escaped text with matching words wrapped in <em></em>.
+type Match struct {
+	Product    `bson:",inline"`
+	Score      float64           `bson:"score" json:"score"`
+	Highlights map[string]string `bson:"-" json:"highlights,omitempty"`
+}
+
+// SearchQuery describes a full-text search over book names, authors and
+// genres. Results are ordered by descending score and then by ID.
+type SearchQuery struct {
+	Text string
+
+	// MinScore drops matches scoring below it.
+	MinScore float64
+
+	// Limit and Cursor page through the results the same way they do for
+	// Query.
+	Limit  int
+	Cursor string
+
+	// after is the decoded Cursor, populated by prepare.
+	after *searchCursor
+}
+
+// searchCursor is the position of the last Match of a page.
+type searchCursor struct {
+	Text  string  `json:"q"`
+	Score float64 `json:"s"`
+	ID    string  `json:"id"`
+}
+
+// prepare validates the search and decodes its cursor.
+func (q *SearchQuery) prepare() error {
+	q.Text = strings.TrimSpace(q.Text)
+	if q.Text == "" {
+		return ErrEmptySearch
+	}
+
+	q.after = nil
+	if q.Cursor == "" {
+		return nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	var c searchCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return ErrInvalidCursor
+	}
+	if c.Text != q.Text || c.ID == "" {
+		return ErrInvalidCursor
+	}
+
+	q.after = &c
+	return nil
+}
+
+// cursorAfter returns the cursor pointing just past m.
+func (q *SearchQuery) cursorAfter(m Match) string {
+	c := searchCursor{
+		Text:  q.Text,
+		Score: m.Score,
+		ID:    m.ID,
+	}
+
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Search finds the Products matching the search text, most relevant first.
+// Paging works like List: the returned cursor continues after the last Match
+// and is empty on the last page.
+func Search(ctx context.Context, db Store, q SearchQuery) ([]Match, string, error) {
+	if err := q.prepare(); err != nil {
+		return nil, "", err
+	}
+
+	// Ask for one extra Match to learn whether there is a next page.
+	limit := q.Limit
+	if limit > 0 {
+		q.Limit = limit + 1
+	}
+
+	matches, err := db.Search(ctx, q)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+		next = q.cursorAfter(matches[limit-1])
+	}
+
+	terms := searchTerms(q.Text)
+	for i := range matches {
+		matches[i].Highlights = highlight(matches[i].Product, terms)
+	}
+
+	return matches, next, nil
+}
+
+// searchTerms splits search text into lower case terms. Negated terms are
+// dropped as they never contribute to a match.
+func searchTerms(text string) []string {
+	var terms []string
+	for _, w := range strings.Fields(text) {
+		if strings.HasPrefix(w, "-") {
+			continue
+		}
+		for _, t := range words(w) {
+			terms = append(terms, stem(t))
+		}
+	}
+	return terms
+}
+
+// words splits s into lower case words of letters and digits.
+func words(s string) []string {
+	f := func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}
+	return strings.FieldsFunc(strings.ToLower(s), f)
+}
+
+// stem reduces a lower case word to a crude root so that simple plurals match
+// their singular form, close enough to what the Mongo text index does.
+func stem(w string) string {
+	switch {
+	case len(w) > 4 && strings.HasSuffix(w, "es"):
+		return strings.TrimSuffix(w, "es")
+	case len(w) > 3 && strings.HasSuffix(w, "s"):
+		return strings.TrimSuffix(w, "s")
+	}
+	return w
+}
+
+// matchesTerm reports whether the word w matches any of the terms.
+func matchesTerm(w string, terms []string) bool {
+	s := stem(strings.ToLower(w))
+	for _, t := range terms {
+		if s == t {
+			return true
+		}
+	}
+	return false
+}
+
+// score rates how well p matches the terms. Each field contributes its weight
+// times the share of its words that match. It returns zero when nothing
+// matches.
+func score(p Product, terms []string) float64 {
+	var total float64
+	for _, field := range searchFieldNames {
+		ws := words(fieldValue(p, field))
+		if len(ws) == 0 {
+			continue
+		}
+
+		var n int
+		for _, w := range ws {
+			if matchesTerm(w, terms) {
+				n++
+			}
+		}
+		total += float64(searchWeights[field]*n) / float64(len(ws))
+	}
+	return total
+}
+
+// highlight wraps the matching words of each searched field of p in
+// <em></em>. The text of the field is escaped, so the tags are the only
+// markup of the result. Fields without a match are left out.
+func highlight(p Product, terms []string) map[string]string {
+	hl := make(map[string]string)
+	for _, field := range searchFieldNames {
+		text := fieldValue(p, field)
+
+		var b strings.Builder
+		var word strings.Builder
+		var matched bool
+
+		flush := func() {
+			if word.Len() == 0 {
+				return
+			}
+			if matchesTerm(word.String(), terms) {
+				b.WriteString("<em>" + html.EscapeString(word.String()) + "</em>")
+				matched = true
+			} else {
+				b.WriteString(html.EscapeString(word.String()))
+			}
+			word.Reset()
+		}
+
+		for _, r := range text {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				word.WriteRune(r)
+				continue
+			}
+			flush()
+			b.WriteString(html.EscapeString(string(r)))
+		}
+		flush()
+
+		if matched {
+			hl[field] = b.String()
+		}
+	}
+
+	if len(hl) == 0 {
+		return nil
+	}
+	return hl
+}
@@ -0,0 +1,165 @@
+package product
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Stats summarizes the live Products of a Store. Products in the trash are
+// not counted, except for their copies on loan, which are still lent.
+type Stats struct {
+	Total    int
+	ByGenre  map[string]int
+	ByAuthor map[string]int
+
+	// Ratings counts the reviews of the Products giving each rating.
+	Ratings map[int]int
+
+	// CreatedSince counts the Products created at or after the time passed
+	// to Store.Stats.
+	CreatedSince int
+
+	// ActiveLoans counts the copies of the Products on loan, those in the
+	// trash included, and OverdueLoans those of them that are overdue.
+	ActiveLoans  int
+	OverdueLoans int
+}
+
+// count adds p to the summary.
+func (st *Stats) count(p Product, since time.Time) {
+	st.Total++
+	st.ByGenre[p.Genre]++
+	st.ByAuthor[p.Author]++
+	for k, n := range p.Ratings {
+		if rating, err := strconv.Atoi(k); err == nil {
+			st.Ratings[rating] += n
+		}
+	}
+	if !p.DateCreated.Before(since) {
+		st.CreatedSince++
+	}
+}
+
+// countLoans adds the copies of p on loan to the summary.
+func (st *Stats) countLoans(p Product) {
+	st.ActiveLoans += p.OnLoan
+	st.OverdueLoans += p.Overdue
+}
+
+// newStats returns an empty summary.
+func newStats() *Stats {
+	return &Stats{
+		ByGenre:  make(map[string]int),
+		ByAuthor: make(map[string]int),
+		Ratings:  make(map[int]int),
+	}
+}
+
+// Stats counts the Products in process memory.
+func (s *MemoryStore) Stats(ctx context.Context, since time.Time) (*Stats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st := newStats()
+	for _, p := range s.products {
+		if p.DateDeleted == nil {
+			st.count(p, since)
+		}
+		st.countLoans(p)
+	}
+
+	return st, nil
+}
+
+// Stats counts the Products with a single aggregation, only the counts leave
+// the server. The loan facets run over the trash too.
+func (s *MongoStore) Stats(ctx context.Context, since time.Time) (*Stats, error) {
+	live := bson.M{"$match": bson.M{"datedeleted": nil}}
+	group := func(field string) bson.A {
+		return bson.A{
+			live,
+			bson.M{"$group": bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}},
+		}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$facet", Value: bson.M{
+			"genres":  group("genre"),
+			"authors": group("author"),
+			"recent": bson.A{
+				live,
+				bson.M{"$match": bson.M{"datecreated": bson.M{"$gte": since}}},
+				bson.M{"$count": "count"},
+			},
+			"ratings": bson.A{
+				live,
+				bson.M{"$project": bson.M{"rating": bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$ratings", bson.M{}}}}}},
+				bson.M{"$unwind": "$rating"},
+				bson.M{"$group": bson.M{"_id": "$rating.k", "count": bson.M{"$sum": "$rating.v"}}},
+			},
+			"loans": bson.A{
+				bson.M{"$group": bson.M{"_id": "active", "count": bson.M{"$sum": "$onloan"}}},
+			},
+			"overdue": bson.A{
+				bson.M{"$group": bson.M{"_id": "overdue", "count": bson.M{"$sum": "$overdue"}}},
+			},
+		}}},
+	}
+
+	type bucket struct {
+		Key   string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	var facets []struct {
+		Genres  []bucket `bson:"genres"`
+		Authors []bucket `bson:"authors"`
+		Recent  []bucket `bson:"recent"`
+		Ratings []bucket `bson:"ratings"`
+		Loans   []bucket `bson:"loans"`
+		Overdue []bucket `bson:"overdue"`
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, errors.Wrap(err, "aggregating product stats")
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &facets); err != nil {
+		return nil, errors.Wrap(err, "decoding product stats")
+	}
+
+	st := newStats()
+	if len(facets) == 0 {
+		return st, nil
+	}
+
+	for _, b := range facets[0].Genres {
+		st.ByGenre[b.Key] += b.Count
+		st.Total += b.Count
+	}
+	for _, b := range facets[0].Authors {
+		st.ByAuthor[b.Key] += b.Count
+	}
+	for _, b := range facets[0].Recent {
+		st.CreatedSince += b.Count
+	}
+	for _, b := range facets[0].Ratings {
+		if rating, err := strconv.Atoi(b.Key); err == nil {
+			st.Ratings[rating] += b.Count
+		}
+	}
+	for _, b := range facets[0].Loans {
+		st.ActiveLoans += b.Count
+	}
+	for _, b := range facets[0].Overdue {
+		st.OverdueLoans += b.Count
+	}
+
+	return st, nil
+}
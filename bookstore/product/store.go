@@ -0,0 +1,203 @@
+package product
+
+import (
+	"context"
+	"time"
+)
+
+// Store is the persistence layer behind the product functions. The package
+// level functions such as Create and Update own the business rules (ID
+// generation, timestamps, validation of IDs) and use a Store only to read and
+// write documents.
+//
+// Deleted Products stay in the Store, in the trash, until they are purged.
+// Only List and Walk with Query.Deleted and Restore see them. Purging a
+// Product also removes its Reviews and Holds, but not its history or Loans.
+//
+// No two live Products have the same ISBN. Writes that would give a live
+// Product the ISBN of another return a *DuplicateISBNError naming it.
+type Store interface {
+
+	// Ping verifies the backing storage is reachable.
+	Ping(ctx context.Context) error
+
+	// List returns the Products matching q in the order it asks for. The
+	// query has already been validated and its cursor decoded.
+	List(ctx context.Context, q Query) ([]Product, error)
+
+	// Walk calls fn for each Product matching q in the order it asks for
+	// without holding the whole result in memory. It stops at the first
+	// error returned by fn.
+	Walk(ctx context.Context, q Query, fn func(Product) error) error
+
+	// Search returns the live Products matching the search text with their
+	// score, ordered by descending score and then by ID. The query has
+	// already been validated and its cursor decoded.
+	Search(ctx context.Context, q SearchQuery) ([]Match, error)
+
+	// Retrieve returns the live Product with the given ID or ErrNotFound.
+	Retrieve(ctx context.Context, id string) (*Product, error)
+
+	// Insert stores a new Product or returns a *DuplicateISBNError.
+	Insert(ctx context.Context, p Product) error
+
+	// InsertMany stores a batch of new Products. When only some of them
+	// could be stored it returns a *BatchError naming the failed ones.
+	InsertMany(ctx context.Context, ps []Product) error
+
+	// Update applies the fields set in update to the live Product with the
+	// given ID and increments its revision in a single atomic write. When rev is
+	// not AnyRevision the write is conditional on the stored revision being
+	// rev. It returns the updated Product, ErrNotFound,
+	// ErrRevisionMismatch or a *DuplicateISBNError.
+	Update(ctx context.Context, id string, rev int, update UpdateProduct, now time.Time) (*Product, error)
+
+	// Delete moves the live Product with the given ID to the trash by
+	// setting its DateDeleted to now and incrementing its revision. When rev
+	// is not AnyRevision the delete is conditional on the stored revision
+	// being rev. It returns ErrNotFound or ErrRevisionMismatch when nothing
+	// was deleted.
+	Delete(ctx context.Context, id string, rev int, now time.Time) error
+
+	// Restore clears the DateDeleted of the Product in the trash with the
+	// given ID and increments its revision. The revision check is the one
+	// of Delete. It returns the restored Product, ErrNotFound,
+	// ErrRevisionMismatch or a *DuplicateISBNError.
+	Restore(ctx context.Context, id string, rev int) (*Product, error)
+
+	// Purge permanently removes the Products moved to the trash before the
+	// given time, with their Reviews and Holds, and returns the IDs of those removed.
+	// Data kept outside the Store, such as covers, is removed by the caller.
+	Purge(ctx context.Context, before time.Time) ([]string, error)
+
+	// Stats summarizes the live Products, counting those created at or
+	// after since separately. Copies on loan are counted for every Product.
+	Stats(ctx context.Context, since time.Time) (*Stats, error)
+
+	// Reserve stores a new pending Reservation after moving its quantity
+	// from the Stock to the Reserved copies of its live Product. The stock
+	// check and the move are one atomic write so Stock never goes negative.
+	// It returns ErrNotFound or ErrInsufficientStock.
+	Reserve(ctx context.Context, r Reservation) error
+
+	// RetrieveReservation returns the Reservation with the given ID or
+	// ErrReservationNotFound.
+	RetrieveReservation(ctx context.Context, id string) (*Reservation, error)
+
+	// CloseReservation moves the pending Reservation with the given ID to
+	// status at now and releases its copies from the Reserved copies of the
+	// Product, back to Stock unless it is committed. Committing requires the
+	// reservation to be unexpired at now and expiring requires it to be
+	// expired. It returns the closed Reservation, ErrReservationNotFound,
+	// ErrReservationClosed or ErrReservationExpired.
+	CloseReservation(ctx context.Context, id string, status string, now time.Time) (*Reservation, error)
+
+	// ExpiredReservations returns the IDs of the pending Reservations that
+	// expired at or before now.
+	ExpiredReservations(ctx context.Context, now time.Time) ([]string, error)
+
+	// Checkout stores a new active Loan after taking a copy for it out of
+	// its live Product. A ready Hold of the member is fulfilled with the
+	// copy kept for it, otherwise the copy comes from Stock, which is only
+	// allowed while no Hold of the Product is waiting. The move of the copy
+	// to OnLoan is one atomic write. It returns ErrNotFound,
+	// ErrInsufficientStock, ErrHoldsWaiting or ErrAlreadyBorrowed when the
+	// member has the Product on loan.
+	Checkout(ctx context.Context, l Loan) error
+
+	// ActiveLoan returns the active Loan of member for the Product with the
+	// given ID or ErrLoanNotFound.
+	ActiveLoan(ctx context.Context, productID, member string) (*Loan, error)
+
+	// ReturnLoan marks the active Loan with the given ID returned at now and
+	// puts its copy back in the Stock of the Product, live or in the trash,
+	// taking it out of the Overdue copies when it was overdue. It returns the
+	// returned Loan, ErrLoanNotFound or ErrLoanClosed.
+	ReturnLoan(ctx context.Context, id string, now time.Time) (*Loan, error)
+
+	// RenewLoan moves the due date of the active Loan with the given ID to
+	// due and counts the renewal, provided it is not overdue at now and was
+	// renewed fewer than max times. It returns the renewed Loan,
+	// ErrLoanNotFound, ErrLoanClosed, ErrLoanOverdue or ErrRenewalLimit.
+	RenewLoan(ctx context.Context, id string, due time.Time, max int, now time.Time) (*Loan, error)
+
+	// ListLoans returns the Loans of the page q asks for of member, newest
+	// first. The query has already been validated and its cursor decoded.
+	ListLoans(ctx context.Context, member string, q LoanQuery) ([]Loan, error)
+
+	// OverdueLoans returns the IDs of the active Loans due at or before now
+	// that are not marked overdue yet.
+	OverdueLoans(ctx context.Context, now time.Time) ([]string, error)
+
+	// MarkOverdue marks the active Loan with the given ID overdue, provided
+	// it was due at or before now, and counts it in the Overdue copies of
+	// its Product. It returns the overdue Loan, ErrLoanNotFound or
+	// ErrLoanClosed.
+	MarkOverdue(ctx context.Context, id string, now time.Time) (*Loan, error)
+
+	// PlaceHold stores a new waiting Hold on its live Product. It returns
+	// ErrNotFound, ErrAlreadyBorrowed or ErrDuplicateHold when the member
+	// already has an open Hold on the Product.
+	PlaceHold(ctx context.Context, h Hold) error
+
+	// RetrieveHold returns the Hold with the given ID or ErrHoldNotFound.
+	RetrieveHold(ctx context.Context, id string) (*Hold, error)
+
+	// ListHolds returns the open Holds of the Product with the given ID,
+	// oldest first.
+	ListHolds(ctx context.Context, productID string) ([]Hold, error)
+
+	// CloseHold moves the open Hold with the given ID to status at now. The
+	// copy kept for a ready Hold goes back to the Stock of the Product.
+	// Expiring requires the hold to be ready and its pickup time to have
+	// run out at now. It returns the closed Hold, ErrHoldNotFound or
+	// ErrHoldClosed.
+	CloseHold(ctx context.Context, id string, status string, now time.Time) (*Hold, error)
+
+	// PromoteHold takes a copy out of the Stock of the live Product with the
+	// given ID for its oldest waiting Hold, which becomes ready at now until
+	// expires. It returns the ready Hold, ErrHoldNotFound when no Hold is
+	// waiting, ErrNotFound or ErrInsufficientStock.
+	PromoteHold(ctx context.Context, productID string, now, expires time.Time) (*Hold, error)
+
+	// ExpiredHolds returns the IDs of the ready Holds that expired at or
+	// before now.
+	ExpiredHolds(ctx context.Context, now time.Time) ([]string, error)
+
+	// WaitingHolds returns the IDs of the Products with waiting Holds.
+	WaitingHolds(ctx context.Context) ([]string, error)
+
+	// AddReview stores a new Review and adds its rating to the rating of
+	// its live Product. The rating, count and average of the Product are
+	// updated together in one atomic write so concurrent reviews are all
+	// counted. It returns ErrNotFound or ErrDuplicateReview when the
+	// reviewer already reviewed the Product.
+	AddReview(ctx context.Context, r Review) error
+
+	// ListReviews returns the Reviews of the page q asks for of the Product
+	// with the given ID, newest first. The query has already been validated
+	// and its cursor decoded.
+	ListReviews(ctx context.Context, productID string, q ReviewQuery) ([]Review, error)
+
+	// RetrieveReview returns the Review with the given ID or
+	// ErrReviewNotFound.
+	RetrieveReview(ctx context.Context, id string) (*Review, error)
+
+	// DeleteReview removes the Review with the given ID written by reviewer
+	// and takes its rating out of the rating of its Product, live or in the
+	// trash. It returns ErrReviewNotFound when there is no such Review.
+	DeleteReview(ctx context.Context, id, reviewer string) error
+
+	// AddHistory stores a new HistoryEntry. Entries are never changed or
+	// removed once stored.
+	AddHistory(ctx context.Context, e HistoryEntry) error
+
+	// ListHistory returns the entries of the page q asks for of the history
+	// of the Product with the given ID, newest first. The query has already
+	// been validated and its cursor decoded.
+	ListHistory(ctx context.Context, productID string, q HistoryQuery) ([]HistoryEntry, error)
+
+	// RetrieveHistory returns the entry recording the given revision of the
+	// Product with the given ID or ErrHistoryNotFound.
+	RetrieveHistory(ctx context.Context, productID string, rev int) (*HistoryEntry, error)
+}
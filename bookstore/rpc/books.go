@@ -0,0 +1,263 @@
+package rpc
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/author"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/handlers"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/pb"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// listPageSize is the number of books List reads from the store at a time.
+const listPageSize = 100
+
+// Books implements the Books gRPC service with the product functions the
+// REST handlers use.
+type Books struct {
+	pb.UnimplementedBooksServer
+
+	DB      product.Store
+	Authors author.Store
+	Feed    product.Feed
+	Log     *log.Logger
+}
+
+// Get gets a single book.
+func (b *Books) Get(ctx context.Context, req *pb.GetRequest) (*pb.Book, error) {
+	p, err := product.Retrieve(ctx, b.DB, req.GetId())
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting product %q", req.GetId())
+	}
+
+	return toBook(p), nil
+}
+
+// List streams the books matching the request, reading them from the store
+// a page at a time.
+func (b *Books) List(req *pb.ListRequest, stream pb.Books_ListServer) error {
+	q := product.Query{
+		Author:   req.GetAuthor(),
+		AuthorID: req.GetAuthorId(),
+		Genre:    req.GetGenre(),
+		ISBN:     req.GetIsbn(),
+		Sort:     req.GetSort(),
+	}
+	if strings.HasPrefix(q.Sort, "-") {
+		q.Sort = strings.TrimPrefix(q.Sort, "-")
+		q.Desc = true
+	}
+
+	if req.GetLimit() < 0 {
+		return status.Error(codes.InvalidArgument, "limit must not be negative")
+	}
+	left := int(req.GetLimit())
+
+	for {
+		q.Limit = listPageSize
+		if left > 0 && left < q.Limit {
+			q.Limit = left
+		}
+
+		list, next, err := product.List(stream.Context(), b.DB, q)
+		if err != nil {
+			return errors.Wrap(err, "getting product list")
+		}
+
+		for i := range list {
+			if err := stream.Send(toBook(&list[i])); err != nil {
+				return err
+			}
+		}
+
+		if left > 0 {
+			if left -= len(list); left == 0 {
+				return nil
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		q.Cursor = next
+	}
+}
+
+// Create creates a book. It is linked to the Author given by author_id, or
+// else to the Author its author name refers to, like on the REST API.
+func (b *Books) Create(ctx context.Context, req *pb.CreateRequest) (*pb.Book, error) {
+	nb := req.GetBook()
+	np := product.NewProduct{
+		Name:     nb.GetName(),
+		Author:   nb.GetAuthor(),
+		AuthorID: nb.GetAuthorId(),
+		ISBN:     nb.GetIsbn(),
+		Genre:    nb.GetGenre(),
+		Price:    nb.GetPrice(),
+		Currency: nb.GetCurrency(),
+		Stock:    int(nb.GetStock()),
+	}
+	if err := handlers.Validate(np); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	var err error
+	np.AuthorID, np.Author, err = author.NewLinker(b.Authors).Link(ctx, np.AuthorID, np.Author, now)
+	if err != nil {
+		return nil, linkError(err)
+	}
+
+	p, err := product.Create(ctx, b.DB, np, now)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating product")
+	}
+
+	return toBook(p), nil
+}
+
+// Update changes the fields of a book named by the update mask.
+func (b *Books) Update(ctx context.Context, req *pb.UpdateRequest) (*pb.Book, error) {
+	nb := req.GetBook()
+
+	var update product.UpdateProduct
+	for _, path := range req.GetUpdateMask().GetPaths() {
+		switch path {
+		case "name":
+			update.Name = stringPtr(nb.GetName())
+		case "author":
+			update.Author = stringPtr(nb.GetAuthor())
+		case "author_id":
+			update.AuthorID = stringPtr(nb.GetAuthorId())
+		case "isbn":
+			update.ISBN = stringPtr(nb.GetIsbn())
+		case "genre":
+			update.Genre = stringPtr(nb.GetGenre())
+		case "price":
+			price := nb.GetPrice()
+			update.Price = &price
+		case "currency":
+			update.Currency = stringPtr(nb.GetCurrency())
+		case "stock":
+			stock := int(nb.GetStock())
+			update.Stock = &stock
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "update_mask names unknown field %q", path)
+		}
+	}
+	if err := handlers.Validate(update); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := author.NewLinker(b.Authors).LinkUpdate(ctx, &update, now); err != nil {
+		return nil, linkError(err)
+	}
+
+	p, err := product.Update(ctx, b.DB, req.GetId(), revision(req.Revision), update, now)
+	if err != nil {
+		return nil, errors.Wrapf(err, "updating product %q", req.GetId())
+	}
+
+	return toBook(p), nil
+}
+
+// Delete moves a book to the trash.
+func (b *Books) Delete(ctx context.Context, req *pb.DeleteRequest) (*emptypb.Empty, error) {
+	if err := product.Delete(ctx, b.DB, req.GetId(), revision(req.Revision), time.Now()); err != nil {
+		return nil, errors.Wrapf(err, "deleting product %q", req.GetId())
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// Watch streams book changes after the event named in the request, or from
+// now on. A client that cannot keep up gets ABORTED and resumes from the last
+// event it received, like on the REST event stream.
+func (b *Books) Watch(req *pb.WatchRequest, stream pb.Books_WatchServer) error {
+	ctx := stream.Context()
+
+	events, err := b.Feed.Subscribe(ctx, req.GetAfterEventId())
+	if err != nil {
+		return errors.Wrap(err, "subscribing to product events")
+	}
+
+	// Send the headers right away so clients know they are subscribed.
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for ev := range events {
+		e := pb.Event{
+			Id:     ev.ID,
+			Type:   ev.Type,
+			BookId: ev.ProductID,
+			Time:   timestamppb.New(ev.Time),
+		}
+		if ev.Product != nil {
+			e.Book = toBook(ev.Product)
+		}
+
+		if err := stream.Send(&e); err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Aborted, "fell behind the event stream, resume from the last event received")
+}
+
+// linkError maps the errors of linking an author.
+func linkError(err error) error {
+	switch err {
+	case author.ErrNotFound, author.ErrInvalidID:
+		return status.Errorf(codes.InvalidArgument, "author_id: %v", err)
+	default:
+		return errors.Wrap(err, "linking author")
+	}
+}
+
+// revision returns the product revision of an optional request revision.
+func revision(rev *int64) int {
+	if rev == nil {
+		return product.AnyRevision
+	}
+	return int(*rev)
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+// toBook converts a Product to its message.
+func toBook(p *product.Product) *pb.Book {
+	return &pb.Book{
+		Id:          p.ID,
+		Name:        p.Name,
+		Author:      p.Author,
+		AuthorId:    p.AuthorID,
+		Isbn:        p.ISBN,
+		Genre:       p.Genre,
+		Price:       p.Price,
+		Currency:    p.Currency,
+		Stock:       int32(p.Stock),
+		Reserved:    int32(p.Reserved),
+		Rating:      p.Rating,
+		ReviewCount: int32(p.ReviewCount),
+		Revision:    int64(p.Revision),
+		DateCreated: timestamppb.New(p.DateCreated),
+		DateUpdated: timestamppb.New(p.DateUpdated),
+	}
+}
@@ -0,0 +1,218 @@
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/author"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/pb"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// newTestClient serves the gRPC server over in-memory stores and returns a
+// connection to it with a token generator for the given roles.
+func newTestClient(t *testing.T) (*grpc.ClientConn, func(roles ...string) context.Context) {
+	t.Helper()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := auth.Keys{"test": privateKey}
+	a, err := auth.New("RS256", keys.Lookup, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := product.NewBroadcaster(8, 8)
+	db := product.WithEvents(product.NewMemoryStore(), events)
+	logger := log.New(ioutil.Discard, "", 0)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := NewServer(db, author.NewMemoryStore(), events, a, nil, logger)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	dial := func(context.Context, string) (net.Conn, error) { return lis.Dial() }
+	conn, err := grpc.Dial("bufnet", grpc.WithContextDialer(dial), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	as := func(roles ...string) context.Context {
+		now := time.Now()
+		claims := auth.Claims{
+			StandardClaims: jwt.StandardClaims{
+				Subject:   "tester",
+				ExpiresAt: now.Add(time.Hour).Unix(),
+				IssuedAt:  now.Unix(),
+			},
+			Roles: roles,
+		}
+		tkn, err := a.GenerateToken("test", claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+tkn)
+	}
+
+	return conn, as
+}
+
+func TestBooks(t *testing.T) {
+	conn, as := newTestClient(t)
+	client := pb.NewBooksClient(conn)
+	ctx := context.Background()
+
+	// Writes need a token.
+	nb := pb.NewBook{Name: "The Go Programming Language", Author: "Alan Donovan", Price: 3000, Currency: "USD", Stock: 2}
+	if _, err := client.Create(ctx, &pb.CreateRequest{Book: &nb}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("anonymous create: expected Unauthenticated, got %v", err)
+	}
+
+	created, err := client.Create(as(auth.RoleUser), &pb.CreateRequest{Book: &nb})
+	if err != nil {
+		t.Fatalf("creating book: %v", err)
+	}
+	if created.GetId() == "" || created.GetAuthorId() == "" {
+		t.Errorf("expected the book and its author to get ids, got %v", created)
+	}
+
+	if _, err := client.Create(as(auth.RoleUser), &pb.CreateRequest{Book: &pb.NewBook{}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("create without name: expected InvalidArgument, got %v", err)
+	}
+
+	got, err := client.Get(ctx, &pb.GetRequest{Id: created.GetId()})
+	if err != nil {
+		t.Fatalf("getting book: %v", err)
+	}
+	if got.GetName() != nb.Name {
+		t.Errorf("expected name %q, got %q", nb.Name, got.GetName())
+	}
+
+	// The product errors map to their codes.
+	if _, err := client.Get(ctx, &pb.GetRequest{Id: "not-an-id"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("get invalid id: expected InvalidArgument, got %v", err)
+	}
+	if _, err := client.Get(ctx, &pb.GetRequest{Id: "0b0e4f5a-6b5e-4e57-9b5c-2c7b0ec1e0a1"}); status.Code(err) != codes.NotFound {
+		t.Errorf("get unknown id: expected NotFound, got %v", err)
+	}
+
+	stale := got.GetRevision() + 1
+	update := pb.UpdateRequest{
+		Id:         created.GetId(),
+		Book:       &pb.NewBook{Genre: "programming"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"genre"}},
+		Revision:   &stale,
+	}
+	if _, err := client.Update(as(auth.RoleUser), &update); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("update stale revision: expected FailedPrecondition, got %v", err)
+	}
+	update.Revision = nil
+	updated, err := client.Update(as(auth.RoleUser), &update)
+	if err != nil {
+		t.Fatalf("updating book: %v", err)
+	}
+	if updated.GetGenre() != "programming" || updated.GetName() != nb.Name {
+		t.Errorf("expected only the genre to change, got %v", updated)
+	}
+
+	// List streams every book.
+	if _, err := client.Create(as(auth.RoleUser), &pb.CreateRequest{Book: &pb.NewBook{Name: "Second"}}); err != nil {
+		t.Fatalf("creating book: %v", err)
+	}
+	stream, err := client.List(ctx, &pb.ListRequest{Sort: "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for {
+		b, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("listing books: %v", err)
+		}
+		names = append(names, b.GetName())
+	}
+	if len(names) != 2 || names[0] != "Second" {
+		t.Errorf("expected both books by name, got %v", names)
+	}
+
+	// Deletes need an admin.
+	if _, err := client.Delete(as(auth.RoleUser), &pb.DeleteRequest{Id: created.GetId()}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("user delete: expected PermissionDenied, got %v", err)
+	}
+	if _, err := client.Delete(as(auth.RoleAdmin), &pb.DeleteRequest{Id: created.GetId()}); err != nil {
+		t.Errorf("admin delete: %v", err)
+	}
+	if _, err := client.Get(ctx, &pb.GetRequest{Id: created.GetId()}); status.Code(err) != codes.NotFound {
+		t.Errorf("get deleted: expected NotFound, got %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	conn, as := newTestClient(t)
+	client := pb.NewBooksClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &pb.WatchRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The subscription is in place once the server has the stream, which the
+	// headers confirm.
+	if _, err := stream.Header(); err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := client.Create(as(auth.RoleUser), &pb.CreateRequest{Book: &pb.NewBook{Name: "Watched"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("receiving event: %v", err)
+	}
+	if ev.GetType() != product.EventCreated || ev.GetBookId() != created.GetId() || ev.GetBook().GetName() != "Watched" {
+		t.Errorf("expected the created event of %s, got %v", created.GetId(), ev)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	conn, _ := newTestClient(t)
+	client := healthpb.NewHealthClient(conn)
+
+	for _, service := range []string{"", serviceName} {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatalf("checking %q: %v", service, err)
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("%q: expected SERVING, got %v", service, resp.GetStatus())
+		}
+	}
+}
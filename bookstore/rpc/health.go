@@ -0,0 +1,40 @@
+package rpc
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// Health implements the gRPC health checking protocol for the server and the
+// Books service. Both are serving when the database is reachable, like on
+// the REST /health route.
+type Health struct {
+	healthpb.UnimplementedHealthServer
+
+	DB product.Store
+}
+
+// Check validates the service is healthy and ready to accept requests.
+func (h *Health) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	switch req.GetService() {
+	case "", serviceName:
+	default:
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", req.GetService())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	resp := healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}
+	if err := h.DB.Ping(ctx); err != nil {
+		resp.Status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,330 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/handlers"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/tenant"
+)
+
+// gRPC metrics mirror the http ones. They are labelled with the full method,
+// such as /bookstore.v1.Books/Get, and the status code name.
+var (
+	grpcRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bookstore_grpc_requests_total",
+			Help: "The number of grpc requests handled.",
+		},
+		[]string{"method", "code"},
+	)
+
+	grpcInFlight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bookstore_grpc_requests_in_flight",
+			Help: "The number of grpc requests being handled.",
+		},
+		[]string{"method"},
+	)
+
+	grpcDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "bookstore_grpc_request_duration_seconds",
+			Help:    "The grpc response latency, up to the end of the stream for streaming methods.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method", "code"},
+	)
+)
+
+// methodRoles lists the roles of which a token must carry one to call a
+// method, like on the matching REST routes. Other methods are anonymous.
+var methodRoles = map[string][]string{
+	"/" + serviceName + "/Create": {auth.RoleUser},
+	"/" + serviceName + "/Update": {auth.RoleUser},
+	"/" + serviceName + "/Delete": {auth.RoleAdmin},
+}
+
+// observe records a finished call in the metrics.
+func observe(method string, start time.Time, err error) {
+	code := status.Code(err).String()
+	grpcRequests.WithLabelValues(method, code).Inc()
+	grpcDuration.WithLabelValues(method, code).Observe(time.Since(start).Seconds())
+}
+
+// Metrics records the gRPC metrics of unary calls. It must run before Errors
+// so that the status codes it sends are recorded.
+func Metrics() grpc.UnaryServerInterceptor {
+	f := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		inFlight := grpcInFlight.WithLabelValues(info.FullMethod)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		observe(info.FullMethod, start, err)
+
+		return resp, err
+	}
+
+	return f
+}
+
+// StreamMetrics records the gRPC metrics of streaming calls.
+func StreamMetrics() grpc.StreamServerInterceptor {
+	f := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		inFlight := grpcInFlight.WithLabelValues(info.FullMethod)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		err := handler(srv, ss)
+		observe(info.FullMethod, start, err)
+
+		return err
+	}
+
+	return f
+}
+
+// Errors turns the errors coming out of unary calls into statuses the same
+// way the REST Errors middleware turns them into responses. Unexpected
+// errors are logged and sent as INTERNAL.
+func Errors(log *log.Logger) grpc.UnaryServerInterceptor {
+	f := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return nil, toStatus(log, info.FullMethod, err)
+		}
+		return resp, nil
+	}
+
+	return f
+}
+
+// StreamErrors is Errors for streaming calls.
+func StreamErrors(log *log.Logger) grpc.StreamServerInterceptor {
+	f := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := handler(srv, ss); err != nil {
+			return toStatus(log, info.FullMethod, err)
+		}
+		return nil
+	}
+
+	return f
+}
+
+// toStatus maps an error to a status error.
+func toStatus(log *log.Logger, method string, err error) error {
+	cause := errors.Cause(err)
+
+	if _, ok := cause.(interface{ GRPCStatus() *status.Status }); ok {
+		return cause
+	}
+
+	switch cause {
+	case product.ErrNotFound:
+		return status.Error(codes.NotFound, cause.Error())
+	case product.ErrInvalidID, product.ErrInvalidISBN, product.ErrInvalidCurrency, product.ErrNegativeAmount,
+		product.ErrInvalidSort, product.ErrInvalidCursor:
+		return status.Error(codes.InvalidArgument, cause.Error())
+	case product.ErrRevisionMismatch:
+		return status.Error(codes.FailedPrecondition, cause.Error())
+	case product.ErrEventsExpired:
+		return status.Error(codes.OutOfRange, cause.Error())
+	case context.Canceled, context.DeadlineExceeded:
+		return status.FromContextError(cause).Err()
+	}
+
+	if dup, ok := cause.(*product.DuplicateISBNError); ok {
+		return status.Error(codes.AlreadyExists, dup.Error())
+	}
+
+	if webErr, ok := cause.(*handlers.Error); ok {
+		msg := webErr.Err.Error()
+		for _, f := range webErr.Fields {
+			msg += fmt.Sprintf("; %s: %s", f.Field, f.Error)
+		}
+		return status.Error(httpCode(webErr.Status), msg)
+	}
+
+	log.Printf("ERROR: %s: %+v", method, err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+// httpCode returns the status code of an http status.
+func httpCode(s int) codes.Code {
+	switch s {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	default:
+		return codes.Unknown
+	}
+}
+
+// Authenticate validates the bearer token in the `authorization` metadata of
+// unary calls to the methods listed in methodRoles, and checks it carries
+// one of their roles.
+func Authenticate(a *auth.Auth) grpc.UnaryServerInterceptor {
+	f := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		roles, ok := methodRoles[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		claims, err := authenticate(ctx, a)
+		if err != nil {
+			return nil, err
+		}
+
+		if !claims.Authorized(roles...) {
+			return nil, status.Errorf(codes.PermissionDenied, "you are not authorized for that action: requires one of %v", roles)
+		}
+
+		// Add claims to the context so they can be retrieved later, and
+		// record the changes of the call as made by the subject.
+		ctx = context.WithValue(ctx, auth.Key, claims)
+		ctx = product.WithActor(ctx, claims.Subject)
+
+		return handler(ctx, req)
+	}
+
+	return f
+}
+
+// authenticate validates the bearer token of a call.
+func authenticate(ctx context.Context, a *auth.Auth) (auth.Claims, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+
+	// Expecting: bearer <token>
+	var parts []string
+	if len(values) == 1 {
+		parts = strings.Split(values[0], " ")
+	}
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return auth.Claims{}, status.Error(codes.Unauthenticated, "expected authorization metadata format: bearer <token>")
+	}
+
+	// Validate the token is signed by us.
+	claims, err := a.ValidateToken(parts[1])
+	if err != nil {
+		return auth.Claims{}, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return claims, nil
+}
+
+// Tenant names the tenant of calls to the Books service from the
+// `x-tenant-id` metadata or the tenant claim of the token, like the tenant
+// middleware of the REST API, and rejects calls naming none or an unknown
+// one. It must run after Authenticate.
+func Tenant(cats *tenant.Catalogs, a *auth.Auth) grpc.UnaryServerInterceptor {
+	f := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !strings.HasPrefix(info.FullMethod, "/"+serviceName+"/") {
+			return handler(ctx, req)
+		}
+
+		ctx, err := resolveTenant(ctx, cats, a)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+
+	return f
+}
+
+// StreamTenant is Tenant for streaming calls.
+func StreamTenant(cats *tenant.Catalogs, a *auth.Auth) grpc.StreamServerInterceptor {
+	f := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !strings.HasPrefix(info.FullMethod, "/"+serviceName+"/") {
+			return handler(srv, ss)
+		}
+
+		ctx, err := resolveTenant(ss.Context(), cats, a)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, tenantStream{ServerStream: ss, ctx: ctx})
+	}
+
+	return f
+}
+
+// tenantStream is a ServerStream whose context names a tenant.
+type tenantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context naming the tenant.
+func (s tenantStream) Context() context.Context {
+	return s.ctx
+}
+
+// resolveTenant returns ctx naming the tenant of a call.
+func resolveTenant(ctx context.Context, cats *tenant.Catalogs, a *auth.Auth) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var id string
+	if values := md.Get("x-tenant-id"); len(values) > 0 {
+		id = values[0]
+	}
+
+	// Anonymous calls are scoped by their token when they carry one.
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok && len(md.Get("authorization")) > 0 {
+		claims, _ = authenticate(ctx, a)
+	}
+
+	switch {
+	case id == "":
+		id = claims.Tenant
+	case claims.Tenant != "" && claims.Tenant != id:
+		return nil, status.Error(codes.PermissionDenied, "the token is scoped to another tenant")
+	}
+
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "the tenant must be named by the x-tenant-id metadata or the token")
+	}
+
+	if _, err := cats.Resolve(ctx, id); err != nil {
+		switch err {
+		case tenant.ErrNotFound:
+			return nil, status.Error(codes.NotFound, err.Error())
+		case tenant.ErrInvalidID:
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		default:
+			return nil, errors.Wrapf(err, "resolving tenant %q", id)
+		}
+	}
+
+	return tenant.WithID(ctx, id), nil
+}
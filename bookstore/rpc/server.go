@@ -0,0 +1,44 @@
+// Package rpc serves the Books gRPC service defined in pb/books.proto on top
+// of the product package, next to the REST API.
+package rpc
+
+import (
+	"log"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/author"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/auth"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/pb"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/tenant"
+)
+
+// serviceName is the full name of the Books service.
+const serviceName = "bookstore.v1.Books"
+
+// NewServer returns a gRPC server with the Books service, health checking and
+// reflection registered. Reads are anonymous, Create and Update require a
+// token with the USER role and Delete one with the ADMIN role. With cats set,
+// calls to the Books service name the tenant whose catalog they work on.
+func NewServer(db product.Store, authors author.Store, feed product.Feed, a *auth.Auth, cats *tenant.Catalogs, log *log.Logger) *grpc.Server {
+	unary := []grpc.UnaryServerInterceptor{Metrics(), Errors(log), Authenticate(a)}
+	stream := []grpc.StreamServerInterceptor{StreamMetrics(), StreamErrors(log)}
+	if cats != nil {
+		unary = append(unary, Tenant(cats, a))
+		stream = append(stream, StreamTenant(cats, a))
+	}
+
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	)
+
+	pb.RegisterBooksServer(srv, &Books{DB: db, Authors: authors, Feed: feed, Log: log})
+	healthpb.RegisterHealthServer(srv, &Health{DB: db})
+	reflection.Register(srv)
+
+	return srv
+}
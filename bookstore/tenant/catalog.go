@@ -0,0 +1,259 @@
+package tenant
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// Catalogs provisions tenants and hands out their catalogs. The catalogs of
+// the tenants in the Registry are opened on first use and kept open until
+// the tenant is torn down. Instances sharing a Registry pick up the tenants
+// provisioned elsewhere on first use, and see teardowns made elsewhere on
+// their next Refresh.
+type Catalogs struct {
+	registry Registry
+	backend  Backend
+	log      *log.Logger
+
+	// metrics registers a BookCollector labelled with the tenant for every
+	// open catalog when set.
+	metrics prometheus.Registerer
+	ttl     time.Duration
+	timeout time.Duration
+
+	mu   sync.Mutex
+	open map[string]*opened
+}
+
+// opened is an open catalog and its metrics.
+type opened struct {
+	catalog   *Catalog
+	collector *product.BookCollector
+}
+
+// NewCatalogs returns Catalogs for the tenants of the registry, stored in the
+// backend.
+func NewCatalogs(registry Registry, backend Backend, log *log.Logger) *Catalogs {
+	return &Catalogs{
+		registry: registry,
+		backend:  backend,
+		log:      log,
+		open:     make(map[string]*opened),
+	}
+}
+
+// CollectMetrics registers the book metrics of every open catalog, labelled
+// with its tenant, with r. Stats are cached for ttl and each query is given
+// timeout to complete.
+func (c *Catalogs) CollectMetrics(r prometheus.Registerer, ttl, timeout time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.metrics = r
+	c.ttl = ttl
+	c.timeout = timeout
+
+	for id, o := range c.open {
+		if err := c.register(id, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Ping verifies the storage of the registry is reachable.
+func (c *Catalogs) Ping(ctx context.Context) error {
+	return c.registry.Ping(ctx)
+}
+
+// List returns every provisioned Tenant ordered by ID.
+func (c *Catalogs) List(ctx context.Context) ([]Tenant, error) {
+	return c.registry.List(ctx)
+}
+
+// Retrieve returns the Tenant with the given ID.
+func (c *Catalogs) Retrieve(ctx context.Context, id string) (*Tenant, error) {
+	if !ValidID(id) {
+		return nil, ErrInvalidID
+	}
+
+	return c.registry.Retrieve(ctx, id)
+}
+
+// Provision adds a Tenant and prepares the storage of its catalog. The
+// Tenant is removed again when its storage cannot be prepared.
+func (c *Catalogs) Provision(ctx context.Context, nt NewTenant, now time.Time) (*Tenant, error) {
+	if !ValidID(nt.ID) {
+		return nil, ErrInvalidID
+	}
+
+	t := Tenant{
+		ID:          nt.ID,
+		Name:        nt.Name,
+		DateCreated: now.UTC(),
+	}
+
+	if err := c.registry.Insert(ctx, t); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.openLocked(ctx, t.ID); err != nil {
+		if err := c.registry.Delete(ctx, t.ID); err != nil {
+			c.log.Printf("tenant : Removing tenant %q after failed provisioning : %v", t.ID, err)
+		}
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// Teardown removes the Tenant with the given ID and all the data of its
+// catalog. Requests naming the Tenant are rejected from then on.
+func (c *Catalogs) Teardown(ctx context.Context, id string) error {
+	if !ValidID(id) {
+		return ErrInvalidID
+	}
+
+	if err := c.registry.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.closeLocked(id)
+	c.mu.Unlock()
+
+	return c.backend.Drop(ctx, id)
+}
+
+// Resolve returns the Catalog of the Tenant with the given ID, or
+// ErrNotFound when there is no such Tenant.
+func (c *Catalogs) Resolve(ctx context.Context, id string) (*Catalog, error) {
+	if !ValidID(id) {
+		return nil, ErrInvalidID
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if o, ok := c.open[id]; ok {
+		return o.catalog, nil
+	}
+
+	if _, err := c.registry.Retrieve(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return c.openLocked(ctx, id)
+}
+
+// FromContext returns the Catalog of the Tenant named by ctx.
+func (c *Catalogs) FromContext(ctx context.Context) (*Catalog, error) {
+	id, ok := IDFrom(ctx)
+	if !ok {
+		return nil, ErrMissing
+	}
+
+	return c.Resolve(ctx, id)
+}
+
+// Refresh opens the catalogs of every Tenant in the registry and closes the
+// catalogs of the Tenants torn down by other instances.
+func (c *Catalogs) Refresh(ctx context.Context) error {
+	tenants, err := c.registry.List(ctx)
+	if err != nil {
+		return errors.Wrap(err, "listing tenants")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	live := make(map[string]bool, len(tenants))
+	for _, t := range tenants {
+		live[t.ID] = true
+		if _, ok := c.open[t.ID]; ok {
+			continue
+		}
+		if _, err := c.openLocked(ctx, t.ID); err != nil {
+			return err
+		}
+	}
+
+	for id := range c.open {
+		if !live[id] {
+			c.closeLocked(id)
+		}
+	}
+
+	return nil
+}
+
+// Each calls fn with every open Catalog, in tenant ID order.
+func (c *Catalogs) Each(fn func(id string, catalog *Catalog)) {
+	c.mu.Lock()
+	ids := make([]string, 0, len(c.open))
+	catalogs := make(map[string]*Catalog, len(c.open))
+	for id, o := range c.open {
+		ids = append(ids, id)
+		catalogs[id] = o.catalog
+	}
+	c.mu.Unlock()
+
+	sort.Strings(ids)
+	for _, id := range ids {
+		fn(id, catalogs[id])
+	}
+}
+
+// openLocked opens the Catalog of a Tenant. c.mu must be held.
+func (c *Catalogs) openLocked(ctx context.Context, id string) (*Catalog, error) {
+	catalog, err := c.backend.Open(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	o := opened{catalog: catalog}
+	if c.metrics != nil {
+		if err := c.register(id, &o); err != nil {
+			return nil, err
+		}
+	}
+	c.open[id] = &o
+
+	return catalog, nil
+}
+
+// closeLocked forgets the Catalog of a Tenant. c.mu must be held.
+func (c *Catalogs) closeLocked(id string) {
+	o, ok := c.open[id]
+	if !ok {
+		return
+	}
+
+	if o.collector != nil {
+		c.metrics.Unregister(o.collector)
+	}
+	delete(c.open, id)
+}
+
+// register registers the metrics of an open Catalog.
+func (c *Catalogs) register(id string, o *opened) error {
+	bc := product.NewBookCollector(o.catalog.Products, c.ttl, c.timeout, c.log, prometheus.Labels{"tenant": id})
+	if err := c.metrics.Register(bc); err != nil {
+		return errors.Wrapf(err, "registering metrics of tenant %q", id)
+	}
+	o.collector = bc
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package tenant
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+)
+
+// TestRefresh closes the catalogs of tenants torn down elsewhere.
+func TestRefresh(t *testing.T) {
+	registry := NewMemoryRegistry()
+	backend := NewMemoryBackend(8, 8)
+	logger := log.New(ioutil.Discard, "", 0)
+	ctx := context.Background()
+
+	one := NewCatalogs(registry, backend, logger)
+	other := NewCatalogs(registry, backend, logger)
+
+	if _, err := one.Provision(ctx, NewTenant{ID: "north", Name: "Shop"}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Resolve(ctx, "north"); err != nil {
+		t.Fatalf("resolving a tenant provisioned elsewhere: %s", err)
+	}
+
+	if err := one.Teardown(ctx, "north"); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Resolve(ctx, "north"); err != ErrNotFound {
+		t.Errorf("after teardown elsewhere: expected ErrNotFound, got %v", err)
+	}
+}
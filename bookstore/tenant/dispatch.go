@@ -0,0 +1,445 @@
+package tenant
+
+import (
+	"context"
+	"time"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/author"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/cover"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// Products is a product.Store that passes every call to the catalog of the
+// tenant of its context. It lets the handlers and the product functions work
+// on the catalog of the tenant of a request unchanged.
+type Products struct {
+	Catalogs *Catalogs
+}
+
+// store returns the product store of the tenant of ctx.
+func (s Products) store(ctx context.Context) (product.Store, error) {
+	c, err := s.Catalogs.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.Products, nil
+}
+
+// Ping checks the store of the tenant of ctx, or the registry when ctx has
+// no tenant.
+func (s Products) Ping(ctx context.Context) error {
+	if _, ok := IDFrom(ctx); !ok {
+		return s.Catalogs.Ping(ctx)
+	}
+
+	db, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return db.Ping(ctx)
+}
+
+func (s Products) List(ctx context.Context, q product.Query) ([]product.Product, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.List(ctx, q)
+}
+
+func (s Products) Walk(ctx context.Context, q product.Query, fn func(product.Product) error) error {
+	db, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return db.Walk(ctx, q, fn)
+}
+
+func (s Products) Search(ctx context.Context, q product.SearchQuery) ([]product.Match, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.Search(ctx, q)
+}
+
+func (s Products) Retrieve(ctx context.Context, id string) (*product.Product, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.Retrieve(ctx, id)
+}
+
+func (s Products) Insert(ctx context.Context, p product.Product) error {
+	db, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return db.Insert(ctx, p)
+}
+
+func (s Products) InsertMany(ctx context.Context, ps []product.Product) error {
+	db, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return db.InsertMany(ctx, ps)
+}
+
+func (s Products) Update(ctx context.Context, id string, rev int, update product.UpdateProduct, now time.Time) (*product.Product, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.Update(ctx, id, rev, update, now)
+}
+
+func (s Products) Delete(ctx context.Context, id string, rev int, now time.Time) error {
+	db, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return db.Delete(ctx, id, rev, now)
+}
+
+func (s Products) Restore(ctx context.Context, id string, rev int) (*product.Product, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.Restore(ctx, id, rev)
+}
+
+func (s Products) Purge(ctx context.Context, before time.Time) ([]string, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.Purge(ctx, before)
+}
+
+func (s Products) Stats(ctx context.Context, since time.Time) (*product.Stats, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.Stats(ctx, since)
+}
+
+func (s Products) Reserve(ctx context.Context, r product.Reservation) error {
+	db, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return db.Reserve(ctx, r)
+}
+
+func (s Products) RetrieveReservation(ctx context.Context, id string) (*product.Reservation, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.RetrieveReservation(ctx, id)
+}
+
+func (s Products) CloseReservation(ctx context.Context, id string, status string, now time.Time) (*product.Reservation, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.CloseReservation(ctx, id, status, now)
+}
+
+func (s Products) ExpiredReservations(ctx context.Context, now time.Time) ([]string, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ExpiredReservations(ctx, now)
+}
+
+func (s Products) Checkout(ctx context.Context, l product.Loan) error {
+	db, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return db.Checkout(ctx, l)
+}
+
+func (s Products) ActiveLoan(ctx context.Context, productID, member string) (*product.Loan, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ActiveLoan(ctx, productID, member)
+}
+
+func (s Products) ReturnLoan(ctx context.Context, id string, now time.Time) (*product.Loan, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ReturnLoan(ctx, id, now)
+}
+
+func (s Products) RenewLoan(ctx context.Context, id string, due time.Time, max int, now time.Time) (*product.Loan, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.RenewLoan(ctx, id, due, max, now)
+}
+
+func (s Products) ListLoans(ctx context.Context, member string, q product.LoanQuery) ([]product.Loan, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListLoans(ctx, member, q)
+}
+
+func (s Products) OverdueLoans(ctx context.Context, now time.Time) ([]string, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.OverdueLoans(ctx, now)
+}
+
+func (s Products) MarkOverdue(ctx context.Context, id string, now time.Time) (*product.Loan, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.MarkOverdue(ctx, id, now)
+}
+
+func (s Products) PlaceHold(ctx context.Context, h product.Hold) error {
+	db, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return db.PlaceHold(ctx, h)
+}
+
+func (s Products) RetrieveHold(ctx context.Context, id string) (*product.Hold, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.RetrieveHold(ctx, id)
+}
+
+func (s Products) ListHolds(ctx context.Context, productID string) ([]product.Hold, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListHolds(ctx, productID)
+}
+
+func (s Products) CloseHold(ctx context.Context, id string, status string, now time.Time) (*product.Hold, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.CloseHold(ctx, id, status, now)
+}
+
+func (s Products) PromoteHold(ctx context.Context, productID string, now, expires time.Time) (*product.Hold, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.PromoteHold(ctx, productID, now, expires)
+}
+
+func (s Products) ExpiredHolds(ctx context.Context, now time.Time) ([]string, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ExpiredHolds(ctx, now)
+}
+
+func (s Products) WaitingHolds(ctx context.Context) ([]string, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.WaitingHolds(ctx)
+}
+
+func (s Products) AddReview(ctx context.Context, r product.Review) error {
+	db, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return db.AddReview(ctx, r)
+}
+
+func (s Products) ListReviews(ctx context.Context, productID string, q product.ReviewQuery) ([]product.Review, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListReviews(ctx, productID, q)
+}
+
+func (s Products) RetrieveReview(ctx context.Context, id string) (*product.Review, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.RetrieveReview(ctx, id)
+}
+
+func (s Products) DeleteReview(ctx context.Context, id, reviewer string) error {
+	db, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteReview(ctx, id, reviewer)
+}
+
+func (s Products) AddHistory(ctx context.Context, e product.HistoryEntry) error {
+	db, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return db.AddHistory(ctx, e)
+}
+
+func (s Products) ListHistory(ctx context.Context, productID string, q product.HistoryQuery) ([]product.HistoryEntry, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListHistory(ctx, productID, q)
+}
+
+func (s Products) RetrieveHistory(ctx context.Context, productID string, rev int) (*product.HistoryEntry, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.RetrieveHistory(ctx, productID, rev)
+}
+
+// Authors is an author.Store that passes every call to the catalog of the
+// tenant of its context.
+type Authors struct {
+	Catalogs *Catalogs
+}
+
+// store returns the author store of the tenant of ctx.
+func (s Authors) store(ctx context.Context) (author.Store, error) {
+	c, err := s.Catalogs.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.Authors, nil
+}
+
+func (s Authors) List(ctx context.Context, q author.Query) ([]author.Author, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.List(ctx, q)
+}
+
+func (s Authors) Retrieve(ctx context.Context, id string) (*author.Author, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.Retrieve(ctx, id)
+}
+
+func (s Authors) RetrieveByKey(ctx context.Context, key string) (*author.Author, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.RetrieveByKey(ctx, key)
+}
+
+func (s Authors) Insert(ctx context.Context, a author.Author) error {
+	db, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return db.Insert(ctx, a)
+}
+
+func (s Authors) Update(ctx context.Context, id string, name string, now time.Time) (*author.Author, error) {
+	db, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.Update(ctx, id, name, now)
+}
+
+func (s Authors) Delete(ctx context.Context, id string) error {
+	db, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return db.Delete(ctx, id)
+}
+
+// Feed is a product.Feed that subscribes to the events of the catalog of the
+// tenant of its context.
+type Feed struct {
+	Catalogs *Catalogs
+}
+
+// Subscribe delivers the events of the catalog of the tenant of ctx.
+func (f Feed) Subscribe(ctx context.Context, after string) (<-chan product.Event, error) {
+	c, err := f.Catalogs.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.Feed.Subscribe(ctx, after)
+}
+
+// Covers is a cover.Store that passes every call to the cover store of the
+// catalog of the tenant of its context.
+type Covers struct {
+	Catalogs *Catalogs
+}
+
+// store returns the cover store of the tenant of ctx.
+func (s Covers) store(ctx context.Context) (cover.Store, error) {
+	c, err := s.Catalogs.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.Covers, nil
+}
+
+func (s Covers) Put(ctx context.Context, b cover.Blob) error {
+	blobs, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return blobs.Put(ctx, b)
+}
+
+func (s Covers) Get(ctx context.Context, key string) (*cover.Blob, error) {
+	blobs, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return blobs.Get(ctx, key)
+}
+
+func (s Covers) Delete(ctx context.Context, key string) error {
+	blobs, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return blobs.Delete(ctx, key)
+}
@@ -0,0 +1,135 @@
+package tenant
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/author"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/cover"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// MemoryRegistry is a Registry that keeps tenants in process memory. It is
+// safe for concurrent use and is intended for tests and for running the
+// service without a database.
+type MemoryRegistry struct {
+	mu      sync.RWMutex
+	tenants map[string]Tenant
+}
+
+// NewMemoryRegistry returns an empty MemoryRegistry.
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		tenants: make(map[string]Tenant),
+	}
+}
+
+// Ping always succeeds, memory is always reachable.
+func (s *MemoryRegistry) Ping(ctx context.Context) error {
+	return nil
+}
+
+// List gets all Tenants.
+func (s *MemoryRegistry) List(ctx context.Context) ([]Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Tenant, 0, len(s.tenants))
+	for _, t := range s.tenants {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	return list, nil
+}
+
+// Retrieve gets a single Tenant.
+func (s *MemoryRegistry) Retrieve(ctx context.Context, id string) (*Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tenants[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &t, nil
+}
+
+// Insert adds a Tenant.
+func (s *MemoryRegistry) Insert(ctx context.Context, t Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenants[t.ID]; ok {
+		return ErrDuplicate
+	}
+	s.tenants[t.ID] = t
+
+	return nil
+}
+
+// Delete removes a Tenant.
+func (s *MemoryRegistry) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenants[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.tenants, id)
+
+	return nil
+}
+
+// MemoryBackend is a Backend that keeps a set of memory stores per tenant.
+type MemoryBackend struct {
+	history int
+	buffer  int
+
+	mu       sync.Mutex
+	catalogs map[string]*Catalog
+}
+
+// NewMemoryBackend returns a MemoryBackend whose catalogs publish their
+// events in process, keeping history past events for subscribers that fall
+// buffer events behind.
+func NewMemoryBackend(history, buffer int) *MemoryBackend {
+	return &MemoryBackend{
+		history:  history,
+		buffer:   buffer,
+		catalogs: make(map[string]*Catalog),
+	}
+}
+
+// Open returns the Catalog of a tenant, creating empty stores on first use.
+func (b *MemoryBackend) Open(ctx context.Context, id string) (*Catalog, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.catalogs[id]; ok {
+		return c, nil
+	}
+
+	events := product.NewBroadcaster(b.history, b.buffer)
+	c := &Catalog{
+		Products: product.WithEvents(product.NewMemoryStore(), events),
+		Authors:  author.NewMemoryStore(),
+		Feed:     events,
+		Covers:   cover.NewMemoryStore(),
+	}
+	b.catalogs[id] = c
+
+	return c, nil
+}
+
+// Drop forgets the stores of a tenant.
+func (b *MemoryBackend) Drop(ctx context.Context, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.catalogs, id)
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package tenant
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/author"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/cover"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/internal/platform/database"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// MongoRegistry is a Registry backed by a MongoDB collection.
+type MongoRegistry struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+}
+
+// document is how a Tenant is stored. The tenant ID doubles as the Mongo _id.
+type document struct {
+	MongoID string `bson:"_id"`
+	Tenant  `bson:",inline"`
+}
+
+// NewMongoRegistry returns a Registry that keeps tenants in the named
+// database and collection of the provided client.
+func NewMongoRegistry(client *mongo.Client, database, collection string) *MongoRegistry {
+	return &MongoRegistry{
+		client:     client,
+		collection: client.Database(database).Collection(collection),
+	}
+}
+
+// Ping checks the mongo server is reachable.
+func (s *MongoRegistry) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx, nil)
+}
+
+// List gets all Tenants from the collection.
+func (s *MongoRegistry) List(ctx context.Context) ([]Tenant, error) {
+	tenants := []Tenant{}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := s.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting tenants")
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &tenants); err != nil {
+		return nil, errors.Wrap(err, "decoding tenants")
+	}
+
+	return tenants, nil
+}
+
+// Retrieve gets a single Tenant from the collection.
+func (s *MongoRegistry) Retrieve(ctx context.Context, id string) (*Tenant, error) {
+	var t Tenant
+
+	if err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&t); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrapf(err, "get tenant %q", id)
+	}
+
+	return &t, nil
+}
+
+// Insert adds a Tenant to the collection.
+func (s *MongoRegistry) Insert(ctx context.Context, t Tenant) error {
+	if _, err := s.collection.InsertOne(ctx, document{t.ID, t}); err != nil {
+		if database.IsDuplicateKey(err) {
+			return ErrDuplicate
+		}
+		return errors.Wrap(err, "inserting tenant")
+	}
+
+	return nil
+}
+
+// Delete removes a Tenant from the collection.
+func (s *MongoRegistry) Delete(ctx context.Context, id string) error {
+	res, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return errors.Wrapf(err, "delete tenant %q", id)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// MongoBackend is a Backend that gives each tenant a database of its own,
+// named by the tenant ID after a prefix, with the collections of a single
+// catalog deployment.
+type MongoBackend struct {
+	client  *mongo.Client
+	prefix  string
+	books   string
+	authors string
+	covers  string
+	history int
+	buffer  int
+}
+
+// NewMongoBackend returns a MongoBackend keeping the books and authors of
+// each tenant in the named collections of its database, and their covers in
+// the named GridFS bucket. When the server has no change streams, events are
+// published in process, keeping history past events for subscribers that
+// fall buffer events behind.
+func NewMongoBackend(client *mongo.Client, prefix, books, authors, covers string, history, buffer int) *MongoBackend {
+	return &MongoBackend{
+		client:  client,
+		prefix:  prefix,
+		books:   books,
+		authors: authors,
+		covers:  covers,
+		history: history,
+		buffer:  buffer,
+	}
+}
+
+// Open returns the Catalog of a tenant and creates the indexes of its
+// collections. A catalog whose books share ISBNs is opened without the unique
+// ISBN index, its duplicates are reported like those of any catalog.
+func (b *MongoBackend) Open(ctx context.Context, id string) (*Catalog, error) {
+	database := b.prefix + id
+
+	ms := product.NewMongoStore(b.client, database, b.books)
+	if err := ms.EnsureIndexes(ctx); err != nil && err != product.ErrDuplicateISBNs {
+		return nil, errors.Wrapf(err, "creating indexes of tenant %q", id)
+	}
+
+	as := author.NewMongoStore(b.client, database, b.authors)
+	if err := as.EnsureIndexes(ctx); err != nil {
+		return nil, errors.Wrapf(err, "creating author indexes of tenant %q", id)
+	}
+
+	c := Catalog{
+		Products: ms,
+		Authors:  as,
+		Feed:     ms,
+		Covers:   cover.NewGridFSStore(b.client, database, b.covers),
+	}
+	if err := ms.CheckChangeStreams(ctx); err != nil {
+		events := product.NewBroadcaster(b.history, b.buffer)
+		c.Products = product.WithEvents(ms, events)
+		c.Feed = events
+	}
+
+	return &c, nil
+}
+
+// Drop drops the database of a tenant.
+func (b *MongoBackend) Drop(ctx context.Context, id string) error {
+	if err := b.client.Database(b.prefix + id).Drop(ctx); err != nil {
+		return errors.Wrapf(err, "dropping database of tenant %q", id)
+	}
+
+	return nil
+}
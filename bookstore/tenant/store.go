@@ -0,0 +1,49 @@
+package tenant
+
+import (
+	"context"
+
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/author"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/cover"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
+)
+
+// Registry is the persistence layer of the provisioned tenants.
+type Registry interface {
+
+	// Ping verifies the backing storage is reachable.
+	Ping(ctx context.Context) error
+
+	// List returns every Tenant ordered by ID.
+	List(ctx context.Context) ([]Tenant, error)
+
+	// Retrieve returns the Tenant with the given ID or ErrNotFound.
+	Retrieve(ctx context.Context, id string) (*Tenant, error)
+
+	// Insert stores a new Tenant. It returns ErrDuplicate when its ID is
+	// taken.
+	Insert(ctx context.Context, t Tenant) error
+
+	// Delete removes the Tenant with the given ID or returns ErrNotFound.
+	Delete(ctx context.Context, id string) error
+}
+
+// Catalog is the storage of the catalog of one tenant.
+type Catalog struct {
+	Products product.Store
+	Authors  author.Store
+	Feed     product.Feed
+	Covers   cover.Store
+}
+
+// Backend keeps the catalogs of the tenants apart in one kind of storage.
+type Backend interface {
+
+	// Open returns the Catalog of the tenant with the given ID, preparing
+	// its storage on first use. Opening a Catalog again returns the same
+	// data.
+	Open(ctx context.Context, id string) (*Catalog, error)
+
+	// Drop removes all the data of the tenant with the given ID.
+	Drop(ctx context.Context, id string) error
+}
@@ -0,0 +1,66 @@
+// Package tenant isolates the catalogs of the storefronts served by one
+// bookstore. Each tenant has its own books, authors and events, kept apart in
+// the storage, and requests name the tenant whose catalog they work on.
+package tenant
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Predefined errors identify expected failure conditions.
+var (
+	// ErrNotFound is used when a tenant is named but was not provisioned.
+	ErrNotFound = errors.New("tenant not found")
+
+	// ErrInvalidID is used when a tenant ID is not in its proper form.
+	ErrInvalidID = errors.New("tenant ID must be 1 to 32 lowercase letters, digits or dashes, starting with a letter or digit")
+
+	// ErrDuplicate is used when a tenant is provisioned with the ID of an
+	// existing one.
+	ErrDuplicate = errors.New("tenant already exists")
+
+	// ErrMissing is used when a catalog is used without a tenant in the
+	// context.
+	ErrMissing = errors.New("no tenant in context")
+)
+
+// validID matches tenant IDs. They end up in database names, so only a few
+// characters are allowed.
+var validID = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// Tenant is a storefront with its own catalog.
+type Tenant struct {
+	ID          string    `db:"tenant_id" json:"id"`
+	Name        string    `db:"name" json:"name"`
+	DateCreated time.Time `db:"datecreated" json:"date_created"`
+}
+
+// NewTenant is what is needed to provision a Tenant.
+type NewTenant struct {
+	ID   string `json:"id" validate:"required"`
+	Name string `json:"name" validate:"required"`
+}
+
+// ValidID reports whether id is in the proper form of a tenant ID.
+func ValidID(id string) bool {
+	return validID.MatchString(id)
+}
+
+// ctxKey is the context key of the tenant of a request.
+type ctxKey struct{}
+
+// WithID returns a context whose catalog calls go to the tenant with the
+// given ID.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// IDFrom returns the tenant ID set on ctx by WithID.
+func IDFrom(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(ctxKey{}).(string)
+	return id, ok
+}
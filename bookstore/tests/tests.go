@@ -12,6 +12,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"www-github.cisco.com/bota/maglev-bootcamp/track-controlplane/week-1/bookstore/product"
 )
 
 // Container tracks information about a docker container started for tests.
@@ -20,10 +21,15 @@ type Container struct {
 	Host string // IP:Port
 }
 
-// StartContainer runs a postgres container to execute commands.
+// StartContainer runs a mongo container to execute commands. The test is
+// skipped when docker is not available so the rest of the suite can run.
 func StartContainer(t *testing.T) *Container {
 	t.Helper()
 
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker is not available, skipping mongo tests")
+	}
+
 	cmd := exec.Command("docker", "run", "-P", "-d", "mongo")
 	var out bytes.Buffer
 	cmd.Stdout = &out
@@ -122,7 +128,7 @@ func NewUnit(t *testing.T) (*mongo.Client, func()) {
 	err = mclient.Connect(ctx)
 
 	if err != nil {
-		log.Fatal("error: failed to connect to mongodb docker image %v", err)
+		log.Fatalf("error: failed to connect to mongodb docker image %v", err)
 	}
 	/*
 		defer func() {
@@ -173,3 +179,13 @@ func NewUnit(t *testing.T) (*mongo.Client, func()) {
 
 	return mclient, teardown
 }
+
+// LoanPolicy returns the policy tests lend books under: two weeks, renewed at
+// most twice, with three days to pick up a held copy.
+func LoanPolicy() product.LoanPolicy {
+	return product.LoanPolicy{
+		Period:      14 * 24 * time.Hour,
+		MaxRenewals: 2,
+		Pickup:      3 * 24 * time.Hour,
+	}
+}